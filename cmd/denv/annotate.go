@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// keyAnnotation is the metadata annotate records for a key: who owns it,
+// what it is for and whether it is sensitive.
+type keyAnnotation struct {
+	Description string `json:"description,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	// Secret is nil unless set, so the usual secret detection applies.
+	Secret *bool `json:"secret,omitempty"`
+}
+
+// annotationsPath is the sidecar holding the annotations of the keys of an
+// env file, e.g. .env.meta.json for .env.
+func annotationsPath(envPath string) string {
+	return envPath + ".meta.json"
+}
+
+// readAnnotations reads a sidecar with read; a missing one has no
+// annotations.
+func readAnnotations(path string, read func(string) ([]byte, error)) (map[string]keyAnnotation, error) {
+	annotations := make(map[string]keyAnnotation)
+	data, err := read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return annotations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &annotations); err != nil {
+		return nil, fmt.Errorf("invalid annotations in %s: %w", path, err)
+	}
+	return annotations, nil
+}
+
+// keyAnnotations merges the sidecars of the file sources, as of --at when
+// set. Later files override the fields they set; unreadable sidecars are
+// skipped like unparsable files in fileEntries.
+func keyAnnotations(c *cli.Context) map[string]keyAnnotation {
+	merged := make(map[string]keyAnnotation)
+	reader := &sourceReader{c: c}
+	for _, file := range envFiles(c) {
+		if file.Kind != sourceFile {
+			continue
+		}
+		annotations, err := readAnnotations(annotationsPath(file.Path), reader.readFile)
+		if err != nil {
+			continue
+		}
+		for k, a := range annotations {
+			m := merged[k]
+			if a.Description != "" {
+				m.Description = a.Description
+			}
+			if a.Owner != "" {
+				m.Owner = a.Owner
+			}
+			if a.Secret != nil {
+				m.Secret = a.Secret
+			}
+			merged[k] = m
+		}
+	}
+	return merged
+}
+
+// runAnnotate records the description, owner and sensitivity of a key in
+// the sidecar of the file set would edit, or prints them without flags.
+func runAnnotate(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("expected exactly one key, got %d arguments", c.NArg())
+	}
+	key := c.Args().First()
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	envPath, err := targetFile(c)
+	if err != nil {
+		return err
+	}
+	path := annotationsPath(envPath)
+	annotations, err := readAnnotations(path, os.ReadFile)
+	if err != nil {
+		return err
+	}
+
+	a := annotations[key]
+	switch {
+	case c.Bool("clear"):
+		delete(annotations, key)
+	case c.IsSet("description") || c.IsSet("owner") || c.IsSet("secret"):
+		if c.IsSet("description") {
+			a.Description = c.String("description")
+		}
+		if c.IsSet("owner") {
+			a.Owner = c.String("owner")
+		}
+		if c.IsSet("secret") {
+			secret := c.Bool("secret")
+			a.Secret = &secret
+		}
+		annotations[key] = a
+	default:
+		return writeJSON(c, c.App.Writer, a, true)
+	}
+
+	if len(annotations) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(annotations, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func runAnnotateOutput(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "annotate",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "description"},
+				&cli.StringFlag{Name: "owner"},
+				&cli.BoolFlag{Name: "secret"},
+				&cli.BoolFlag{Name: "clear"},
+			},
+			Action: runAnnotate,
+		},
+	}
+
+	var buf bytes.Buffer
+	app.Writer = &buf
+	err := app.Run(append([]string{"denv"}, args...))
+	return buf.String(), err
+}
+
+func TestAnnotate(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("# Listen port\nPORT=8080\nSIGNING_SALT=abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := envFile + ".meta.json"
+
+	if _, err := runAnnotateOutput(t, "-f", envFile, "annotate", "--description", "Salt for session cookies", "--owner", "platform-team", "--secret", "SIGNING_SALT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runAnnotateOutput(t, "-f", envFile, "annotate", "--owner", "web", "PORT"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(sidecar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "PORT": {
+    "owner": "web"
+  },
+  "SIGNING_SALT": {
+    "description": "Salt for session cookies",
+    "owner": "platform-team",
+    "secret": true
+  }
+}
+`
+	if string(data) != want {
+		t.Errorf("expected sidecar %s, got %s", want, data)
+	}
+
+	out, err := runAnnotateOutput(t, "-f", envFile, "annotate", "SIGNING_SALT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a keyAnnotation
+	if err := json.Unmarshal([]byte(out), &a); err != nil || a.Owner != "platform-team" || a.Secret == nil || !*a.Secret {
+		t.Errorf("expected the annotations to be printed, got %q (%v)", out, err)
+	}
+
+	// Annotations show up in list and the schema.
+	if out := runListOutput(t, "-f", envFile, "--isolate", "list"); out != "PORT=8080\nSIGNING_SALT=***\n" {
+		t.Errorf("expected the annotated secret to be masked, got %q", out)
+	}
+	var meta map[string]keyMetadata
+	if err := json.Unmarshal([]byte(runListOutput(t, "-f", envFile, "--isolate", "list", "-o", "json", "--with-meta")), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if m := meta["PORT"]; m.Owner != "web" || m.Description != "Listen port" || m.Secret {
+		t.Errorf("unexpected metadata of PORT: %+v", m)
+	}
+	if m := meta["SIGNING_SALT"]; m.Owner != "platform-team" || m.Description != "Salt for session cookies" || !m.Secret {
+		t.Errorf("unexpected metadata of SIGNING_SALT: %+v", m)
+	}
+
+	var buf bytes.Buffer
+	app := createSchemaApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "-f", envFile, "--isolate", "schema", "export"}); err != nil {
+		t.Fatal(err)
+	}
+	var schema jsonSchema
+	if err := json.Unmarshal(buf.Bytes(), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if p := schema.Properties["SIGNING_SALT"]; p.DenvOwner != "platform-team" || !p.DenvSecret || p.Description != "Salt for session cookies" {
+		t.Errorf("unexpected schema of SIGNING_SALT: %+v", p)
+	}
+
+	if _, err := runAnnotateOutput(t, "-f", envFile, "annotate", "--clear", "SIGNING_SALT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runAnnotateOutput(t, "-f", envFile, "annotate", "--clear", "PORT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sidecar); !os.IsNotExist(err) {
+		t.Errorf("expected the empty sidecar to be removed, got %v", err)
+	}
+}
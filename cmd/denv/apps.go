@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// decodeConfigApps decodes the apps section: app names mapped to configs
+// with the same keys as the top level, except apps and check-permissions.
+func decodeConfigApps(value any, dir string) (map[string]*config, error) {
+	m, ok := value.(map[string]any)
+	if !ok && value != nil {
+		return nil, fmt.Errorf("expected a mapping of app names to configs")
+	}
+	apps := make(map[string]*config, len(m))
+	for name, body := range m {
+		if name == "" || strings.ContainsAny(name, " \t/") {
+			return nil, fmt.Errorf("invalid app name %q", name)
+		}
+		if body != nil {
+			if _, ok := body.(map[string]any); !ok {
+				return nil, fmt.Errorf("%s: expected a mapping", name)
+			}
+			for _, key := range []string{"apps", "check-permissions"} {
+				if _, ok := body.(map[string]any)[key]; ok {
+					return nil, fmt.Errorf("%s: %s is only allowed at the top level", name, key)
+				}
+			}
+		}
+		app, err := decodeConfig(body, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		apps[name] = app
+	}
+	return apps, nil
+}
+
+// forApp returns the config of the named app: the shared files, variables,
+// run targets and hooks, followed by those of the app. Variables of the app
+// override the shared ones, including those set by shared conditions.
+func (cfg *config) forApp(name string) (*config, error) {
+	app, ok := cfg.Apps[name]
+	if !ok {
+		if len(cfg.Apps) == 0 {
+			return nil, fmt.Errorf("unknown app %q: %s defines no apps", name, cfg.Path)
+		}
+		return nil, fmt.Errorf("unknown app %q (expected one of %s)", name, strings.Join(slices.Sorted(maps.Keys(cfg.Apps)), ", "))
+	}
+
+	merged := &config{
+		Path:             cfg.Path,
+		App:              name,
+		Files:            slices.Concat(cfg.Files, app.Files),
+		Env:              maps.Clone(cfg.Env),
+		Conditions:       slices.Clone(cfg.Conditions),
+		Run:              maps.Clone(cfg.Run),
+		BeforeExec:       slices.Concat(cfg.BeforeExec, app.BeforeExec),
+		AfterExec:        slices.Concat(cfg.AfterExec, app.AfterExec),
+		CheckPermissions: cfg.CheckPermissions,
+		Isolate:          cfg.Isolate,
+		Merge:            maps.Clone(cfg.Merge),
+		Apps:             cfg.Apps,
+	}
+	if len(app.Env) > 0 {
+		// A condition without comparisons always matches, which applies
+		// the app variables after the shared conditions.
+		merged.Conditions = append(merged.Conditions, configCondition{When: condition{nil}, Env: app.Env})
+	}
+	merged.Conditions = append(merged.Conditions, app.Conditions...)
+	maps.Copy(merged.Run, app.Run)
+	if app.Isolate != nil {
+		merged.Isolate = app.Isolate
+	}
+	if len(app.Merge) > 0 {
+		if merged.Merge == nil {
+			merged.Merge = make(map[string]string)
+		}
+		maps.Copy(merged.Merge, app.Merge)
+	}
+	return merged, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfigApps(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	orig := conditionFacts
+	conditionFacts = func() map[string]string { return map[string]string{"os": "linux"} }
+	t.Cleanup(func() { conditionFacts = orig })
+
+	cfg := `files:
+  - .env
+env:
+  LOG_LEVEL: info
+conditions:
+  - when: os == "linux"
+    env:
+      LOG_LEVEL: warn
+run:
+  test: echo shared
+apps:
+  api:
+    files:
+      - api.env
+    env:
+      LOG_LEVEL: debug
+      PORT: "8080"
+    run:
+      serve: echo api
+  worker:
+    env:
+      QUEUE: jobs
+`
+	files := map[string]string{
+		defaultConfigFile: cfg,
+		".env":            "REGION=eu\nPORT=1\n",
+		"api.env":         "DB_URL=postgres://api\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		app := createRunApp()
+		app.Writer = &buf
+		err := app.Run(append(append([]string{"denv", "--isolate"}, args...), "list"))
+		return buf.String(), err
+	}
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "LOG_LEVEL=warn\nPORT=1\nREGION=eu\n"},
+		{[]string{"--app", "api"}, "DB_URL=postgres://api\nLOG_LEVEL=debug\nPORT=8080\nREGION=eu\n"},
+		{[]string{"--app", "worker"}, "LOG_LEVEL=warn\nPORT=1\nQUEUE=jobs\nREGION=eu\n"},
+	} {
+		out, err := list(tt.args...)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if out != tt.want {
+			t.Errorf("%v: expected:\n%s\ngot:\n%s", tt.args, tt.want, out)
+		}
+	}
+
+	if _, err := list("--app", "web"); err == nil || !strings.Contains(err.Error(), `unknown app "web" (expected one of api, worker)`) {
+		t.Errorf("expected an unknown app error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	app := createRunApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "--app", "api", "run"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "serve\techo api\ntest\techo shared\n"; buf.String() != want {
+		t.Errorf("expected run targets:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func TestConfigAppsInvalid(t *testing.T) {
+	for _, tt := range []struct{ config, want string }{
+		{"apps:\n  api:\n    apps:\n      web:\n", "apps: api: apps is only allowed at the top level"},
+		{"apps:\n  api:\n    port: 1\n", `apps: api: unknown key "port"`},
+		{"apps:\n  - api\n", "apps: expected a mapping of app names to configs"},
+	} {
+		doc, err := parseYAML([]byte(tt.config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decodeConfig(doc, "."); err == nil || err.Error() != tt.want {
+			t.Errorf("%q: expected %q, got %v", tt.config, tt.want, err)
+		}
+	}
+
+	t.Chdir(t.TempDir())
+	if err := createRunApp().Run([]string{"denv", "--app", "api", "list"}); err == nil || !strings.Contains(err.Error(), "needs a project config") {
+		t.Errorf("expected a missing config error, got %v", err)
+	}
+}
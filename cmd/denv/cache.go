@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// sourceCache stores values fetched from remote sources on disk, encrypted
+// with AES-GCM under a random key kept next to the entries (readable by the
+// owner only), so secrets never land on disk in plain text.
+type sourceCache struct {
+	dir     string
+	ttl     time.Duration
+	refresh bool
+	aead    cipher.AEAD
+}
+
+type cacheEntry struct {
+	Stored time.Time         `json:"stored"`
+	Env    map[string]string `json:"env"`
+	// TTL overrides the cache-wide TTL for this entry.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// ETag is the version of a cached object source, see readObject.
+	ETag string `json:"etag,omitempty"`
+}
+
+// cacheDir returns --cache-dir or the per-user cache directory.
+func cacheDir(c *cli.Context) (string, error) {
+	if dir := c.String("cache-dir"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "denv"), nil
+}
+
+// openSourceCache opens the cache of remote values. Entries expire after
+// --cache-ttl unless they were stored with their own TTL.
+func openSourceCache(c *cli.Context) (*sourceCache, error) {
+	dir, err := cacheDir(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	aead, err := cacheCipher(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceCache{dir: dir, ttl: c.Duration("cache-ttl"), refresh: c.Bool("refresh"), aead: aead}, nil
+}
+
+// cacheCipher returns the AEAD used for all entries below dir.
+func cacheCipher(dir string) (cipher.AEAD, error) {
+	key, err := cacheKey(filepath.Join(dir, "key"))
+	if err != nil {
+		return nil, fmt.Errorf("cache key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cacheKey reads the cache encryption key, creating it on first use.
+func cacheKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("%s: invalid key length %d", path, len(key))
+		}
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		// Another process created it first.
+		return cacheKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return key, f.Close()
+}
+
+// entryPath maps a source and the scope it was fetched in (server address,
+// cluster context, ...) to a cache file.
+func (sc *sourceCache) entryPath(file EnvFile, scope string) string {
+	sum := sha256.Sum256([]byte(file.Kind + "\x00" + scope + "\x00" + file.Path))
+	return filepath.Join(sc.dir, hex.EncodeToString(sum[:])+".bin")
+}
+
+// get returns the cached values of a source if present and not expired.
+// Unreadable or corrupt entries are treated as missing.
+func (sc *sourceCache) get(path string) (map[string]string, bool) {
+	if sc.refresh {
+		return nil, false
+	}
+	var entry cacheEntry
+	if !readSealed(sc.aead, path, &entry) {
+		return nil, false
+	}
+	ttl := sc.ttl
+	if entry.TTL > 0 {
+		ttl = entry.TTL
+	}
+	if time.Since(entry.Stored) > ttl {
+		return nil, false
+	}
+	return entry.Env, true
+}
+
+// stored returns the entry at path regardless of its age and --refresh.
+func (sc *sourceCache) stored(path string) (cacheEntry, bool) {
+	var entry cacheEntry
+	ok := readSealed(sc.aead, path, &entry)
+	return entry, ok
+}
+
+// put stores env at path; a zero ttl uses the cache-wide TTL.
+func (sc *sourceCache) put(path string, env map[string]string, ttl time.Duration) error {
+	return writeSealed(sc.aead, path, cacheEntry{Stored: time.Now(), Env: env, TTL: ttl})
+}
+
+// readSealed decrypts the JSON value stored at path into v. It reports
+// false for missing, corrupt or foreign entries.
+func readSealed(aead cipher.AEAD, path string, v any) bool {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) < aead.NonceSize() {
+		return false
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, []byte(filepath.Base(path)))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(plain, v) == nil
+}
+
+// writeSealed atomically stores v at path as encrypted JSON. The file name
+// is bound to the ciphertext so entries cannot be swapped.
+func writeSealed(aead cipher.AEAD, path string, v any) error {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data := aead.Seal(nonce, nonce, plain, []byte(filepath.Base(path)))
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// parseCacheMinSize is the file size from which parsed env files are cached.
+var parseCacheMinSize int64 = 64 << 10
+
+// parseCache stores parsed env files keyed by path, modification time and
+// size so large files are not re-parsed on every invocation. Entries are
+// encrypted like remote source entries.
+type parseCache struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+type parseEntry struct {
+	ModTime time.Time         `json:"mtime"`
+	Size    int64             `json:"size"`
+	Env     map[string]string `json:"env"`
+	Modes   map[string]string `json:"modes,omitempty"`
+}
+
+// openParseCache returns the parse cache, or nil when --no-parse-cache is
+// set.
+func openParseCache(c *cli.Context) (*parseCache, error) {
+	if c.Bool("no-parse-cache") {
+		return nil, nil
+	}
+	dir, err := cacheDir(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "parsed"), 0700); err != nil {
+		return nil, err
+	}
+	aead, err := cacheCipher(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &parseCache{dir: filepath.Join(dir, "parsed"), aead: aead}, nil
+}
+
+// read parses the env file at path, using the cached result when the file
+// is unchanged since it was cached.
+func (pc *parseCache) read(path string, info fs.FileInfo, opts parseOptions) (env, modes map[string]string, err error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256([]byte(abs + "?format=" + opts.Format))
+	entryPath := filepath.Join(pc.dir, hex.EncodeToString(sum[:])+".bin")
+
+	var entry parseEntry
+	if readSealed(pc.aead, entryPath, &entry) && entry.ModTime.Equal(info.ModTime()) && entry.Size == info.Size() {
+		return entry.Env, entry.Modes, nil
+	}
+
+	env, modes, err = readEnvFile(path, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeSealed(pc.aead, entryPath, parseEntry{ModTime: info.ModTime(), Size: info.Size(), Env: env, Modes: modes}); err != nil && opts.Warn != nil {
+		opts.Warn(fmt.Sprintf("failed to cache parsed file: %v", err))
+	}
+	return env, modes, nil
+}
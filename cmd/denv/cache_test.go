@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestSourceCache(t *testing.T) {
+	calls := filepath.Join(t.TempDir(), "calls")
+	kubectl := writeFakeCommand(t, "kubectl", `echo call >> "`+calls+`"
+echo '{"data":{"DB_PASSWORD":"czNjcjN0"}}'
+`)
+	defer func(orig string) { kubectlCommand = orig }(kubectlCommand)
+	kubectlCommand = kubectl
+
+	cache := t.TempDir()
+	load := func(extra ...string) {
+		t.Helper()
+		app, _ := newApp()
+		app.Action = func(c *cli.Context) error {
+			envMap, err := loadEnv(c)
+			if err != nil {
+				return err
+			}
+			if envMap["DB_PASSWORD"] != "s3cr3t" {
+				return fmt.Errorf("expected DB_PASSWORD=s3cr3t, got %s", envMap["DB_PASSWORD"])
+			}
+			return nil
+		}
+		args := append([]string{"denv", "--isolate", "--cache-dir", cache, "--cache-ttl", "1h", "--k8s-secret", "default/app"}, extra...)
+		if err := app.Run(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	callCount := func() int {
+		data, _ := os.ReadFile(calls)
+		return strings.Count(string(data), "call")
+	}
+
+	load()
+	load()
+	if n := callCount(); n != 1 {
+		t.Errorf("expected 1 kubectl call with a warm cache, got %d", n)
+	}
+
+	load("--refresh")
+	if n := callCount(); n != 2 {
+		t.Errorf("expected --refresh to bypass the cache, got %d calls", n)
+	}
+
+	entries, err := filepath.Glob(filepath.Join(cache, "*.bin"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one cache entry, got %v (%v)", entries, err)
+	}
+	data, err := os.ReadFile(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("s3cr3t")) {
+		t.Error("cache entry contains the plain text secret")
+	}
+	if info, err := os.Stat(filepath.Join(cache, "key")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected a 0600 key file, got %v (%v)", info, err)
+	}
+}
+
+func TestSourceCacheExpired(t *testing.T) {
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		sc, err := openSourceCache(c)
+		if err != nil {
+			return err
+		}
+		path := sc.entryPath(EnvFile{Path: "default/app", Kind: sourceK8sSecret}, "")
+		if err := sc.put(path, map[string]string{"A": "1"}, 0); err != nil {
+			return err
+		}
+		if _, ok := sc.get(path); ok {
+			return fmt.Errorf("expected entry to be expired")
+		}
+		return nil
+	}
+
+	if err := app.Run([]string{"denv", "--cache-dir", t.TempDir(), "--cache-ttl", "1ns"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseCache(t *testing.T) {
+	defer func(orig int64) { parseCacheMinSize = orig }(parseCacheMinSize)
+	parseCacheMinSize = 0
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := t.TempDir()
+
+	load := func(extra ...string) string {
+		t.Helper()
+		var port string
+		app, _ := newApp()
+		app.Action = func(c *cli.Context) error {
+			envMap, err := loadEnv(c)
+			port = envMap["PORT"]
+			return err
+		}
+		args := append([]string{"denv", "--isolate", "--cache-dir", cache, "--file", envFile}, extra...)
+		if err := app.Run(args); err != nil {
+			t.Fatal(err)
+		}
+		return port
+	}
+
+	if port := load(); port != "8080" {
+		t.Fatalf("expected PORT=8080, got %s", port)
+	}
+
+	// Same size and mtime: the cached result is used.
+	info, err := os.Stat(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(envFile, []byte("PORT=9090\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(envFile, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if port := load(); port != "8080" {
+		t.Errorf("expected cached PORT=8080, got %s", port)
+	}
+	if port := load("--no-parse-cache"); port != "9090" {
+		t.Errorf("expected --no-parse-cache to re-parse, got %s", port)
+	}
+
+	// A new mtime invalidates the entry.
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(envFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if port := load(); port != "9090" {
+		t.Errorf("expected PORT=9090 after modification, got %s", port)
+	}
+}
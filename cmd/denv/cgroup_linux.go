@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cpuPeriod is the cgroup v2 cpu.max period in microseconds.
+const cpuPeriod = 100_000
+
+// Where the cgroup and mounts of denv are listed; variables for tests.
+var (
+	procCgroup    = "/proc/self/cgroup"
+	procMountinfo = "/proc/self/mountinfo"
+)
+
+// ownCgroup returns the cgroup v2 directory denv runs in.
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile(procCgroup)
+	if err != nil {
+		return "", err
+	}
+	var rel string
+	found := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			rel, found = path, true
+			break
+		}
+	}
+	if !found {
+		return "", errors.New("no cgroup v2 hierarchy")
+	}
+
+	f, err := os.Open(procMountinfo)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The fields after " - " start with the filesystem type; the mount
+		// point is the fifth field before it.
+		before, after, ok := strings.Cut(scanner.Text(), " - ")
+		if !ok || !strings.HasPrefix(after, "cgroup2 ") {
+			continue
+		}
+		if fields := strings.Fields(before); len(fields) >= 5 {
+			return filepath.Join(fields[4], rel), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("cgroup v2 is not mounted")
+}
+
+// cpuMax formats a quota in CPUs as the cgroup v2 cpu.max value.
+func cpuMax(cpus float64) string {
+	return fmt.Sprintf("%d %d", max(int64(cpus*cpuPeriod), 1000), cpuPeriod)
+}
+
+// prepareCgroup creates a cgroup below denv's own enforcing --cpu-limit
+// and --memory-limit, and records it in l for the command to join. Without
+// a writable cgroup v2 hierarchy --memory-limit falls back to an rlimit,
+// while --cpu-limit, having no rlimit equivalent, fails.
+func prepareCgroup(l *resourceLimits) (cleanup func(), err error) {
+	cleanup = func() {}
+	if l.CPUQuota == 0 && l.MemoryBytes == 0 {
+		return cleanup, nil
+	}
+	dir, err := createCgroup(*l)
+	if err != nil {
+		if l.CPUQuota != 0 {
+			return cleanup, fmt.Errorf("--cpu-limit needs a writable cgroup v2 hierarchy: %v", err)
+		}
+		return cleanup, nil
+	}
+	l.Cgroup = dir
+	// Removal fails while processes the command left behind are alive,
+	// which keeps them limited.
+	return func() { os.Remove(dir) }, nil
+}
+
+func createCgroup(l resourceLimits) (string, error) {
+	parent, err := ownCgroup()
+	if err != nil {
+		return "", err
+	}
+	var settings [][2]string
+	if l.CPUQuota != 0 {
+		settings = append(settings, [2]string{"cpu", cpuMax(l.CPUQuota)})
+	}
+	if l.MemoryBytes != 0 {
+		settings = append(settings, [2]string{"memory", strconv.FormatUint(l.MemoryBytes, 10)})
+	}
+	var controllers []string
+	for _, s := range settings {
+		controllers = append(controllers, s[0])
+	}
+	if err := enableControllers(parent, controllers); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(parent, "denv-"+strconv.Itoa(os.Getpid()))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", err
+	}
+	for _, s := range settings {
+		if err := os.WriteFile(filepath.Join(dir, s[0]+".max"), []byte(s[1]), 0); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// selfCgroup is the leaf below its own cgroup that denv moves into to
+// enable controllers there. Every run shares it, so at most one empty leaf
+// is left behind.
+const selfCgroup = "denv-self"
+
+// enableControllers makes controllers available to the children of dir,
+// denv's own cgroup. cgroup v2 only allows that for a cgroup without
+// processes of its own, so denv first moves into selfCgroup below it; once
+// the controllers are enabled it cannot move back. Other processes in dir,
+// such as the shell of a login scope, make it fail unless the controllers
+// were delegated already.
+func enableControllers(dir string, controllers []string) error {
+	control := filepath.Join(dir, "cgroup.subtree_control")
+	enabled, err := os.ReadFile(control)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, name := range controllers {
+		if !slices.Contains(strings.Fields(string(enabled)), name) {
+			missing = append(missing, "+"+name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	enable := []byte(strings.Join(missing, " "))
+	err = os.WriteFile(control, enable, 0)
+	if !errors.Is(err, syscall.EBUSY) {
+		return err
+	}
+
+	leaf := filepath.Join(dir, selfCgroup)
+	if err := os.Mkdir(leaf, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if err := joinCgroup(leaf); err != nil {
+		os.Remove(leaf)
+		return err
+	}
+	if err := os.WriteFile(control, enable, 0); err != nil {
+		// Nothing was enabled, so denv can move back.
+		joinCgroup(dir)
+		os.Remove(leaf)
+		if errors.Is(err, syscall.EBUSY) {
+			return fmt.Errorf("other processes share cgroup %s; run denv in a delegated cgroup, e.g. with systemd-run --user --scope -p Delegate=yes", dir)
+		}
+		return err
+	}
+	return nil
+}
+
+// joinCgroup moves the calling process into dir.
+func joinCgroup(dir string) error {
+	return os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte("0"), 0)
+}
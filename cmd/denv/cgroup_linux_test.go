@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOwnCgroup(t *testing.T) {
+	dir := t.TempDir()
+	procCgroup, procMountinfo = filepath.Join(dir, "cgroup"), filepath.Join(dir, "mountinfo")
+	t.Cleanup(func() { procCgroup, procMountinfo = "/proc/self/cgroup", "/proc/self/mountinfo" })
+
+	cgroup := "4:memory:/legacy\n0::/user.slice/app.scope\n"
+	mountinfo := "30 25 0:26 / /sys/fs/cgroup/memory rw,relatime - cgroup cgroup rw,memory\n" +
+		"31 25 0:27 / /sys/fs/cgroup/unified rw,relatime shared:9 - cgroup2 cgroup2 rw\n"
+	os.WriteFile(procCgroup, []byte(cgroup), 0644)
+	os.WriteFile(procMountinfo, []byte(mountinfo), 0644)
+
+	got, err := ownCgroup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "/sys/fs/cgroup/unified/user.slice/app.scope" {
+		t.Errorf("unexpected cgroup %q", got)
+	}
+
+	os.WriteFile(procCgroup, []byte("4:memory:/legacy\n"), 0644)
+	if _, err := ownCgroup(); err == nil {
+		t.Error("expected an error without a cgroup v2 hierarchy")
+	}
+}
+
+func TestCPUMax(t *testing.T) {
+	cases := map[float64]string{
+		0.5:    "50000 100000",
+		2:      "200000 100000",
+		0.0001: "1000 100000",
+	}
+	for cpus, expected := range cases {
+		if got := cpuMax(cpus); got != expected {
+			t.Errorf("cpuMax(%v) = %q, expected %q", cpus, got, expected)
+		}
+	}
+}
+
+func TestEnableControllers(t *testing.T) {
+	dir := t.TempDir()
+	control := filepath.Join(dir, "cgroup.subtree_control")
+	os.WriteFile(control, []byte("cpu io\n"), 0644)
+
+	// Delegated controllers are used as they are.
+	if err := enableControllers(dir, []string{"cpu"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(control); string(data) != "cpu io\n" {
+		t.Errorf("expected no write for enabled controllers, got %q", data)
+	}
+
+	if err := enableControllers(dir, []string{"cpu", "memory"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(control); string(data) != "+memory" {
+		t.Errorf("expected only the missing controller to be enabled, got %q", data)
+	}
+}
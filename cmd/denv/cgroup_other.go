@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// prepareCgroup rejects --cpu-limit, which needs cgroups; --memory-limit is
+// an rlimit here.
+func prepareCgroup(l *resourceLimits) (func(), error) {
+	if l.CPUQuota != 0 {
+		return func() {}, errors.New("--cpu-limit is only supported on Linux")
+	}
+	return func() {}, nil
+}
+
+func joinCgroup(dir string) error {
+	return errors.New("cgroups are only supported on Linux")
+}
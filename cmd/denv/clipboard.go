@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// clipboardCommands are the tools tried in order to write stdin to the
+// system clipboard. It is a variable so tests can replace it.
+var clipboardCommands = defaultClipboardCommands()
+
+func defaultClipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		// clip.exe mangles UTF-8, so PowerShell is preferred.
+		return [][]string{
+			{"powershell", "-NoProfile", "-Command", "$input | Out-String | Set-Clipboard"},
+			{"clip"},
+		}
+	default:
+		return [][]string{
+			{"wl-copy"},
+			{"xclip", "-selection", "clipboard"},
+			{"xsel", "--clipboard", "--input"},
+		}
+	}
+}
+
+// copyToClipboard places data on the system clipboard with the first
+// available tool from clipboardCommands.
+func copyToClipboard(c *cli.Context, data []byte) error {
+	var tried []string
+	for _, argv := range clipboardCommands {
+		path, err := exec.LookPath(argv[0])
+		if err != nil {
+			tried = append(tried, argv[0])
+			continue
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(path, argv[1:]...)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && stderr.Len() > 0 {
+				err = errors.New(strings.TrimSpace(stderr.String()))
+			}
+			return fmt.Errorf("failed to copy to the clipboard with %s: %w", argv[0], err)
+		}
+		fmt.Fprintln(humanWriter(c), "Copied to the clipboard")
+		return nil
+	}
+	return fmt.Errorf("no clipboard tool found (tried %s)", strings.Join(tried, ", "))
+}
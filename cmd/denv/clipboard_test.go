@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestListCopy(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=8080\nGREETING=\"it's 100%\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(dir, "clipboard")
+	tool := writeFakeCommand(t, "copy", "cat > "+copied+"\n")
+	defer func(commands [][]string) { clipboardCommands = commands }(clipboardCommands)
+
+	run := func(args ...string) (string, error) {
+		app, _ := newApp()
+		app.Commands = []*cli.Command{
+			{
+				Name: "list",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: "text"},
+					&cli.StringFlag{Name: "group-by"},
+					&cli.BoolFlag{Name: "copy"},
+				},
+				Action: runList,
+			},
+		}
+		var stdout bytes.Buffer
+		app.Writer = &stdout
+		err := app.Run(append([]string{"denv", "-f", envFile, "--isolate", "list"}, args...))
+		return stdout.String(), err
+	}
+
+	clipboardCommands = [][]string{{"denv-missing-clipboard-tool"}, {tool}}
+	for output, want := range map[string]string{
+		"ps1": "${env:GREETING} = 'it''s 100%'\n${env:PORT} = '8080'\n",
+		"cmd": "set \"GREETING=it's 100%%\"\r\nset \"PORT=8080\"\r\n",
+	} {
+		out, err := run("-o", output, "--copy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "Copied to the clipboard\n" {
+			t.Errorf("expected only a confirmation on stdout, got %q", out)
+		}
+		data, err := os.ReadFile(copied)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("-o %s: expected %q on the clipboard, got %q", output, want, data)
+		}
+	}
+
+	clipboardCommands = [][]string{{"denv-missing-clipboard-tool"}}
+	if _, err := run("--copy"); err == nil || !strings.Contains(err.Error(), "no clipboard tool found") {
+		t.Errorf("expected an error without a clipboard tool, got %v", err)
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/urfave/cli/v2"
+)
+
+// codegenHeader marks generated files so tools and reviewers skip them.
+const codegenHeader = "Code generated by denv codegen. DO NOT EDIT."
+
+// codegenLangs are the languages supported by denv codegen.
+var codegenLangs = []string{"go", "typescript", "python"}
+
+// goInitialisms are name parts written in upper case in Go identifiers.
+var goInitialisms = []string{"API", "AWS", "CPU", "DB", "DNS", "HTTP", "HTTPS", "ID", "IP", "JSON", "SQL", "SSH", "TLS", "TTL", "UI", "URI", "URL", "UUID"}
+
+// pythonKeywords cannot be used as field names.
+var pythonKeywords = []string{
+	"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else", "except",
+	"finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "nonlocal", "not", "or", "pass",
+	"raise", "return", "try", "while", "with", "yield",
+}
+
+// codegenField is a key with the identifier it gets in generated code.
+type codegenField struct {
+	Key  string
+	Name string
+	Spec *keySpec
+}
+
+// codegenFields orders the specs by key and names them with name, adding a
+// numeric suffix when two keys map to the same identifier.
+func codegenFields(specs map[string]*keySpec, name func(string) string) []codegenField {
+	fields := make([]codegenField, 0, len(specs))
+	seen := make(map[string]bool, len(specs))
+	for _, k := range slices.Sorted(maps.Keys(specs)) {
+		base := name(k)
+		n := base
+		for i := 2; seen[n]; i++ {
+			n = base + strconv.Itoa(i)
+		}
+		seen[n] = true
+		fields = append(fields, codegenField{Key: k, Name: n, Spec: specs[k]})
+	}
+	return fields
+}
+
+// keyWords splits a key such as API_BASE_URL into its lower-cased words.
+func keyWords(key string) []string {
+	words := strings.FieldsFunc(key, func(r rune) bool { return r == '_' || r == '.' })
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return words
+}
+
+func goFieldName(key string) string {
+	var b strings.Builder
+	for _, w := range keyWords(key) {
+		if up := strings.ToUpper(w); slices.Contains(goInitialisms, up) {
+			b.WriteString(up)
+		} else {
+			b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	name := b.String()
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		name = "Var" + name
+	}
+	return name
+}
+
+func tsFieldName(key string) string {
+	words := keyWords(key)
+	var b strings.Builder
+	for i, w := range words {
+		if i > 0 {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		b.WriteString(w)
+	}
+	name := b.String()
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		name = "var" + name
+	}
+	return name
+}
+
+func pythonFieldName(key string) string {
+	name := strings.Join(keyWords(key), "_")
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		name = "var_" + name
+	}
+	if slices.Contains(pythonKeywords, name) {
+		name += "_"
+	}
+	return name
+}
+
+// jsonString quotes s as a JSON string, which is also a valid TypeScript
+// and Python string literal.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// genGo generates a Go package with a Config struct and a Load function.
+func genGo(fields []codegenField, pkg string) ([]byte, error) {
+	imports := []string{"errors"}
+	for _, f := range fields {
+		imports = append(imports, "os")
+		switch f.Spec.Type {
+		case "integer", "number", "boolean":
+			imports = append(imports, "fmt", "strconv")
+		case "url":
+			imports = append(imports, "fmt", "net/url")
+		case "duration":
+			imports = append(imports, "fmt", "time")
+		}
+		if f.Spec.Enum != nil {
+			imports = append(imports, "fmt", "slices")
+		}
+		if f.Spec.Pattern != "" {
+			imports = append(imports, "fmt", "regexp")
+		}
+	}
+	slices.Sort(imports)
+	imports = slices.Compact(imports)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s\n\npackage %s\n\nimport (\n", codegenHeader, pkg)
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "\t%q\n", imp)
+	}
+	b.WriteString(")\n\n// Config holds the environment variables of the application.\ntype Config struct {\n")
+	for _, f := range fields {
+		if f.Spec.Description != "" {
+			for _, line := range strings.Split(f.Spec.Description, "\n") {
+				fmt.Fprintf(&b, "\t// %s\n", line)
+			}
+		}
+		typ := map[string]string{"integer": "int64", "number": "float64", "boolean": "bool", "url": "*url.URL", "duration": "time.Duration"}[f.Spec.Type]
+		if typ == "" {
+			typ = "string"
+		}
+		fmt.Fprintf(&b, "\t%s %s // %s\n", f.Name, typ, f.Key)
+	}
+	b.WriteString("}\n\n// Load reads the configuration from the environment and reports all\n// invalid or missing variables at once.\nfunc Load() (*Config, error) {\n\tvar cfg Config\n\tvar errs []error\n")
+	for _, f := range fields {
+		key := strconv.Quote(f.Key)
+		fmt.Fprintf(&b, "\tif v := os.Getenv(%s); v != \"\" {\n", key)
+		if f.Spec.Enum != nil {
+			quoted := make([]string, len(f.Spec.Enum))
+			for i, e := range f.Spec.Enum {
+				quoted[i] = strconv.Quote(e)
+			}
+			fmt.Fprintf(&b, "\t\tif !slices.Contains([]string{%s}, v) {\n\t\t\terrs = append(errs, fmt.Errorf(%s, v))\n\t\t}\n",
+				strings.Join(quoted, ", "), strconv.Quote(f.Key+": expected one of "+strings.ReplaceAll(strings.Join(f.Spec.Enum, ", "), "%", "%%")+", got %q"))
+		}
+		if f.Spec.Pattern != "" {
+			fmt.Fprintf(&b, "\t\tif !regexp.MustCompile(%s).MatchString(v) {\n\t\t\terrs = append(errs, fmt.Errorf(%s, v))\n\t\t}\n",
+				goRegexpLiteral(f.Spec.Pattern), strconv.Quote(f.Key+": %q does not match pattern "+strings.ReplaceAll(f.Spec.Pattern, "%", "%%")))
+		}
+		parse := map[string]string{
+			"integer":  "strconv.ParseInt(v, 10, 64)",
+			"number":   "strconv.ParseFloat(v, 64)",
+			"boolean":  "strconv.ParseBool(v)",
+			"url":      "url.Parse(v)",
+			"duration": "time.ParseDuration(v)",
+		}[f.Spec.Type]
+		expected := strconv.Quote(f.Key + ": expected " + f.Spec.Type + ", got %q")
+		switch {
+		case parse == "":
+			fmt.Fprintf(&b, "\t\tcfg.%s = v\n", f.Name)
+		case f.Spec.Type == "url":
+			fmt.Fprintf(&b, "\t\tif u, err := %s; err != nil || u.Scheme == \"\" || u.Host == \"\" {\n\t\t\terrs = append(errs, fmt.Errorf(%s, v))\n\t\t} else {\n\t\t\tcfg.%s = u\n\t\t}\n",
+				parse, expected, f.Name)
+		default:
+			fmt.Fprintf(&b, "\t\tif x, err := %s; err != nil {\n\t\t\terrs = append(errs, fmt.Errorf(%s, v))\n\t\t} else {\n\t\t\tcfg.%s = x\n\t\t}\n",
+				parse, expected, f.Name)
+		}
+		if f.Spec.Required {
+			fmt.Fprintf(&b, "\t} else {\n\t\terrs = append(errs, errors.New(%s))\n", strconv.Quote(f.Key+": is required but empty"))
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("\tif err := errors.Join(errs...); err != nil {\n\t\treturn nil, err\n\t}\n\treturn &cfg, nil\n}\n")
+	return format.Source(b.Bytes())
+}
+
+// goRegexpLiteral writes a pattern as a raw string when possible so it
+// reads as written in the annotation.
+func goRegexpLiteral(pattern string) string {
+	if strconv.CanBackquote(pattern) {
+		return "`" + pattern + "`"
+	}
+	return strconv.Quote(pattern)
+}
+
+// Go durations for the generated TypeScript and Python parsers: the whole
+// value with its sign and number-unit parts, and a single part.
+const (
+	goDurationPattern   = `^([-+]?)(0|(?:(?:[0-9]+(?:\.[0-9]*)?|\.[0-9]+)(?:ns|us|µs|ms|s|m|h))+)$`
+	durationPartPattern = `([0-9.]+)(ns|us|µs|ms|s|m|h)`
+)
+
+func hasDurations(fields []codegenField) bool {
+	return slices.ContainsFunc(fields, func(f codegenField) bool { return f.Spec.Type == "duration" })
+}
+
+// codegenDoc documents a field with its description and key, and for
+// durations the unit they are converted to.
+func codegenDoc(f codegenField, durationUnit string) string {
+	ref := f.Key
+	if f.Spec.Type == "duration" {
+		ref += ", in " + durationUnit
+	}
+	if f.Spec.Description == "" {
+		return ref
+	}
+	return strings.ReplaceAll(f.Spec.Description, "\n", " ") + " (" + ref + ")"
+}
+
+// genTypeScript generates a module with a Config interface and a
+// loadConfig function.
+func genTypeScript(fields []codegenField) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s\n\n/** Environment variables of the application. */\nexport interface Config {\n", codegenHeader)
+	for _, f := range fields {
+		doc := codegenDoc(f, "milliseconds")
+		typ := map[string]string{"integer": "number", "number": "number", "boolean": "boolean", "url": "URL", "duration": "number"}[f.Spec.Type]
+		if typ == "" {
+			typ = "string"
+		}
+		optional := "?"
+		if f.Spec.Required {
+			optional = ""
+		}
+		fmt.Fprintf(&b, "  /** %s */\n  %s%s: %s;\n", strings.ReplaceAll(doc, "*/", "*\\/"), f.Name, optional, typ)
+	}
+	b.WriteString("}\n\n" +
+		"const booleans = new Map<string, boolean>([\n" +
+		"  [\"1\", true], [\"t\", true], [\"T\", true], [\"true\", true], [\"TRUE\", true], [\"True\", true],\n" +
+		"  [\"0\", false], [\"f\", false], [\"F\", false], [\"false\", false], [\"FALSE\", false], [\"False\", false],\n" +
+		"]);\n\n")
+	if hasDurations(fields) {
+		b.WriteString("const durationUnits: Record<string, number> = { ns: 1e-6, us: 1e-3, \"µs\": 1e-3, ms: 1, s: 1000, m: 60000, h: 3600000 };\n\n" +
+			"/** Parses a Go duration such as 1h30m into milliseconds. */\n" +
+			"function parseDuration(v: string): number | undefined {\n" +
+			"  const m = new RegExp(" + jsonString(goDurationPattern) + ").exec(v);\n" +
+			"  if (!m) {\n    return undefined;\n  }\n" +
+			"  let ms = 0;\n" +
+			"  for (const [, n, unit] of m[2].matchAll(new RegExp(" + jsonString(durationPartPattern) + ", \"g\"))) {\n" +
+			"    ms += Number(n) * durationUnits[unit];\n  }\n" +
+			"  return m[1] === \"-\" ? -ms : ms;\n}\n\n")
+	}
+	b.WriteString("/** Reads the configuration from env and reports all invalid or missing variables at once. */\n" +
+		"export function loadConfig(env: Record<string, string | undefined> = process.env): Config {\n" +
+		"  const errors: string[] = [];\n" +
+		"  const config: Record<string, unknown> = {};\n")
+	for _, f := range fields {
+		key := jsonString(f.Key)
+		fmt.Fprintf(&b, "  {\n    const v = env[%s] ?? \"\";\n    if (v !== \"\") {\n", key)
+		if f.Spec.Enum != nil {
+			enum, _ := json.Marshal(f.Spec.Enum)
+			fmt.Fprintf(&b, "      if (!%s.includes(v)) {\n        errors.push(%s + JSON.stringify(v));\n      }\n",
+				enum, jsonString(f.Key+": expected one of "+strings.Join(f.Spec.Enum, ", ")+", got "))
+		}
+		if f.Spec.Pattern != "" {
+			fmt.Fprintf(&b, "      if (!new RegExp(%s).test(v)) {\n        errors.push(%s + JSON.stringify(v) + %s);\n      }\n",
+				jsonString(f.Spec.Pattern), jsonString(f.Key+": "), jsonString(" does not match pattern "+f.Spec.Pattern))
+		}
+		field := "config[" + jsonString(f.Name) + "]"
+		expected := "errors.push(" + jsonString(f.Key+": expected "+f.Spec.Type+", got ") + " + JSON.stringify(v));"
+		switch f.Spec.Type {
+		case "integer":
+			fmt.Fprintf(&b, "      if (/^[+-]?[0-9]+$/.test(v)) {\n        %s = Number(v);\n      } else {\n        %s\n      }\n", field, expected)
+		case "number":
+			fmt.Fprintf(&b, "      if (v.trim() !== \"\" && !Number.isNaN(Number(v))) {\n        %s = Number(v);\n      } else {\n        %s\n      }\n", field, expected)
+		case "boolean":
+			fmt.Fprintf(&b, "      if (booleans.has(v)) {\n        %s = booleans.get(v);\n      } else {\n        %s\n      }\n", field, expected)
+		case "url":
+			fmt.Fprintf(&b, "      try {\n        %s = new URL(v);\n      } catch {\n        %s\n      }\n", field, expected)
+		case "duration":
+			fmt.Fprintf(&b, "      const ms = parseDuration(v);\n      if (ms !== undefined) {\n        %s = ms;\n      } else {\n        %s\n      }\n", field, expected)
+		default:
+			fmt.Fprintf(&b, "      %s = v;\n", field)
+		}
+		if f.Spec.Required {
+			fmt.Fprintf(&b, "    } else {\n      errors.push(%s);\n", jsonString(f.Key+": is required but empty"))
+		}
+		b.WriteString("    }\n  }\n")
+	}
+	b.WriteString("  if (errors.length > 0) {\n    throw new Error(errors.join(\"\\n\"));\n  }\n  return config as unknown as Config;\n}\n")
+	return b.Bytes()
+}
+
+// genPython generates a module with a Config dataclass and a load function.
+func genPython(fields []codegenField) []byte {
+	// Fields without defaults must come first in a dataclass.
+	ordered := slices.Clone(fields)
+	slices.SortStableFunc(ordered, func(a, b codegenField) int {
+		switch {
+		case a.Spec.Required == b.Spec.Required:
+			return 0
+		case a.Spec.Required:
+			return -1
+		}
+		return 1
+	})
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\nfrom __future__ import annotations\n\nimport os\nimport re\n"+
+		"from dataclasses import dataclass\nfrom typing import Mapping, Optional\nfrom urllib.parse import urlsplit\n\n"+
+		"_TRUE = (\"1\", \"t\", \"T\", \"true\", \"TRUE\", \"True\")\n"+
+		"_FALSE = (\"0\", \"f\", \"F\", \"false\", \"FALSE\", \"False\")\n\n\n", codegenHeader)
+	if hasDurations(fields) {
+		fmt.Fprintf(&b, "_DURATION = re.compile(r\"%s\")\n_DURATION_PART = re.compile(r\"%s\")\n"+
+			"_DURATION_UNITS = {\"ns\": 1e-9, \"us\": 1e-6, \"µs\": 1e-6, \"ms\": 1e-3, \"s\": 1.0, \"m\": 60.0, \"h\": 3600.0}\n\n\n"+
+			"def _parse_duration(v: str) -> Optional[float]:\n"+
+			"    \"\"\"Parses a Go duration such as 1h30m into seconds.\"\"\"\n"+
+			"    m = _DURATION.fullmatch(v)\n    if not m:\n        return None\n"+
+			"    seconds = sum(float(n) * _DURATION_UNITS[u] for n, u in _DURATION_PART.findall(m.group(2)))\n"+
+			"    return -seconds if m.group(1) == \"-\" else seconds\n\n\n", goDurationPattern, durationPartPattern)
+	}
+	b.WriteString("@dataclass(frozen=True)\nclass Config:\n    \"\"\"Environment variables of the application.\"\"\"\n\n")
+	if len(ordered) == 0 {
+		b.WriteString("    pass\n")
+	}
+	for _, f := range ordered {
+		typ := map[string]string{"integer": "int", "number": "float", "boolean": "bool", "duration": "float"}[f.Spec.Type]
+		if typ == "" {
+			typ = "str"
+		}
+		if f.Spec.Required {
+			fmt.Fprintf(&b, "    %s: %s\n", f.Name, typ)
+		} else {
+			fmt.Fprintf(&b, "    %s: Optional[%s] = None\n", f.Name, typ)
+		}
+		fmt.Fprintf(&b, "    %s\n", jsonString(codegenDoc(f, "seconds")))
+	}
+	b.WriteString("\n\ndef load(env: Mapping[str, str] = os.environ) -> Config:\n" +
+		"    \"\"\"Reads the configuration from env and reports all invalid or missing variables at once.\"\"\"\n" +
+		"    errors = []\n    values = {}\n")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "    v = env.get(%s, \"\")\n    if v != \"\":\n", jsonString(f.Key))
+		if f.Spec.Enum != nil {
+			enum, _ := json.Marshal(f.Spec.Enum)
+			fmt.Fprintf(&b, "        if v not in %s:\n            errors.append(%s %% (v,))\n",
+				enum, jsonString(f.Key+": expected one of "+strings.ReplaceAll(strings.Join(f.Spec.Enum, ", "), "%", "%%")+", got %r"))
+		}
+		if f.Spec.Pattern != "" {
+			fmt.Fprintf(&b, "        if not re.search(%s, v):\n            errors.append(%s %% (v,))\n",
+				jsonString(f.Spec.Pattern), jsonString(f.Key+": %r does not match pattern "+strings.ReplaceAll(f.Spec.Pattern, "%", "%%")))
+		}
+		field := "values[" + jsonString(f.Name) + "]"
+		expected := "errors.append(" + jsonString(f.Key+": expected "+f.Spec.Type+", got %r") + " % (v,))"
+		switch f.Spec.Type {
+		case "integer":
+			fmt.Fprintf(&b, "        if re.fullmatch(r\"[+-]?[0-9]+\", v):\n            %s = int(v)\n        else:\n            %s\n", field, expected)
+		case "number":
+			fmt.Fprintf(&b, "        try:\n            %s = float(v)\n        except ValueError:\n            %s\n", field, expected)
+		case "boolean":
+			fmt.Fprintf(&b, "        if v in _TRUE or v in _FALSE:\n            %s = v in _TRUE\n        else:\n            %s\n", field, expected)
+		case "duration":
+			fmt.Fprintf(&b, "        seconds = _parse_duration(v)\n        if seconds is not None:\n            %s = seconds\n        else:\n            %s\n", field, expected)
+		case "url":
+			fmt.Fprintf(&b, "        parts = urlsplit(v)\n        if parts.scheme and parts.netloc:\n            %s = v\n        else:\n            %s\n", field, expected)
+		default:
+			fmt.Fprintf(&b, "        %s = v\n", field)
+		}
+		if f.Spec.Required {
+			fmt.Fprintf(&b, "    else:\n        errors.append(%s)\n", jsonString(f.Key+": is required but empty"))
+		}
+	}
+	b.WriteString("    if errors:\n        raise ValueError(\"\\n\".join(errors))\n    return Config(**values)\n")
+	return b.Bytes()
+}
+
+func runCodegen(c *cli.Context) error {
+	lang := c.String("lang")
+	if !slices.Contains(codegenLangs, lang) {
+		return fmt.Errorf("unsupported --lang %q (expected %s)", lang, strings.Join(codegenLangs, ", "))
+	}
+	pkg := c.String("package")
+	if !isIdentifier(pkg) {
+		return fmt.Errorf("invalid --package %q", pkg)
+	}
+	specs, err := keySpecs(c)
+	if err != nil {
+		return err
+	}
+
+	var code []byte
+	switch lang {
+	case "go":
+		if code, err = genGo(codegenFields(specs, goFieldName), pkg); err != nil {
+			return fmt.Errorf("failed to generate Go code: %w", err)
+		}
+	case "typescript":
+		code = genTypeScript(codegenFields(specs, tsFieldName))
+	case "python":
+		code = genPython(codegenFields(specs, pythonFieldName))
+	}
+
+	output := c.String("output")
+	if output == "" || output == "-" {
+		_, err := c.App.Writer.Write(code)
+		return err
+	}
+	return os.WriteFile(output, code, 0644)
+}
+
+// isIdentifier reports whether s is a valid Go identifier.
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
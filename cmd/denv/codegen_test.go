@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestFieldNames(t *testing.T) {
+	for key, want := range map[string][3]string{
+		"API_BASE_URL": {"APIBaseURL", "apiBaseUrl", "api_base_url"},
+		"port":         {"Port", "port", "port"},
+		"app.name":     {"AppName", "appName", "app_name"},
+		"_1_TOKEN":     {"Var1Token", "var1Token", "var_1_token"},
+		"CLASS":        {"Class", "class", "class_"},
+	} {
+		got := [3]string{goFieldName(key), tsFieldName(key), pythonFieldName(key)}
+		if got != want {
+			t.Errorf("field names of %s: expected %v, got %v", key, want, got)
+		}
+	}
+}
+
+func TestCodegenFieldsUnique(t *testing.T) {
+	specs := map[string]*keySpec{"A_B": {}, "A__B": {}, "a.b": {}}
+	var names []string
+	for _, f := range codegenFields(specs, goFieldName) {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "AB,AB2,AB3" {
+		t.Errorf("unexpected names %v", names)
+	}
+}
+
+func runCodegenApp(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	envFile := filepath.Join(t.TempDir(), ".env.example")
+	content := `# Port the HTTP server listens on.
+# denv:required
+PORT=8080
+# denv:enum=debug|info|warn
+LOG_LEVEL=info
+# denv:pattern=^[a-z]+$
+NAME=api
+API_URL=https://api.example.com
+DEBUG=false
+# denv:type=duration
+TIMEOUT=30s
+`
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app, _ := newApp()
+	app.Writer = &buf
+	app.Commands = []*cli.Command{
+		{
+			Name: "codegen",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "lang", Value: "go"},
+				&cli.StringFlag{Name: "package", Value: "config"},
+				&cli.StringFlag{Name: "output", Aliases: []string{"o"}},
+			},
+			Action: runCodegen,
+		},
+	}
+	err := app.Run(append([]string{"denv", "-f", envFile, "codegen"}, args...))
+	return buf.String(), err
+}
+
+func TestCodegenGo(t *testing.T) {
+	out, err := runCodegenApp(t, "--package", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "config.go", out, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, out)
+	}
+	if file.Name.Name != "settings" {
+		t.Errorf("expected package settings, got %s", file.Name.Name)
+	}
+	for _, want := range []string{
+		"// " + codegenHeader,
+		"\t// Port the HTTP server listens on.\n\tPort    int64         // PORT\n",
+		"APIURL   *url.URL // API_URL",
+		"Debug    bool     // DEBUG",
+		"Timeout time.Duration // TIMEOUT",
+		"time.ParseDuration(v)",
+		`errors.New("PORT: is required but empty")`,
+		`slices.Contains([]string{"debug", "info", "warn"}, v)`,
+		"regexp.MustCompile(`^[a-z]+$`)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCodegenTypeScriptAndPython(t *testing.T) {
+	out, err := runCodegenApp(t, "--lang", "typescript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"  /** Port the HTTP server listens on. (PORT) */\n  port: number;\n",
+		"  apiUrl?: URL;\n",
+		"  /** TIMEOUT, in milliseconds */\n  timeout?: number;\n",
+		"const ms = parseDuration(v);",
+		`errors.push("PORT: is required but empty");`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected TypeScript output to contain %q:\n%s", want, out)
+		}
+	}
+
+	out, err = runCodegenApp(t, "--lang", "python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Required fields come first since they have no default.
+	if !strings.Contains(out, "    port: int\n    \"Port the HTTP server listens on. (PORT)\"\n    api_url: Optional[str] = None\n") {
+		t.Errorf("unexpected Python fields:\n%s", out)
+	}
+	if !strings.Contains(out, `re.search("^[a-z]+$", v)`) {
+		t.Errorf("expected pattern check in Python output:\n%s", out)
+	}
+	if !strings.Contains(out, "    timeout: Optional[float] = None\n    \"TIMEOUT, in seconds\"\n") || !strings.Contains(out, "seconds = _parse_duration(v)") {
+		t.Errorf("expected TIMEOUT as seconds in Python output:\n%s", out)
+	}
+}
+
+func TestCodegenInvalidFlags(t *testing.T) {
+	if _, err := runCodegenApp(t, "--lang", "rust"); err == nil || !strings.Contains(err.Error(), `unsupported --lang "rust"`) {
+		t.Errorf("expected unsupported language error, got %v", err)
+	}
+	if _, err := runCodegenApp(t, "--package", "my-config"); err == nil || !strings.Contains(err.Error(), `invalid --package`) {
+		t.Errorf("expected invalid package error, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// conditionFacts returns the values conditions can test. It is a variable
+// so tests can pretend to run on another machine.
+var conditionFacts = func() map[string]string {
+	facts := map[string]string{"os": runtime.GOOS, "arch": runtime.GOARCH}
+	facts["hostname"], _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		facts["user"] = u.Username
+	}
+	return facts
+}
+
+// comparison is a single test such as os == "darwin".
+type comparison struct {
+	fact  string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (cmp comparison) eval(facts map[string]string) bool {
+	v := facts[cmp.fact]
+	switch cmp.op {
+	case "==":
+		return v == cmp.value
+	case "!=":
+		return v != cmp.value
+	case "=~":
+		return cmp.re.MatchString(v)
+	default: // "!~"
+		return !cmp.re.MatchString(v)
+	}
+}
+
+// condition is a parsed when: expression: comparisons joined by && and ||,
+// with && binding tighter. It is stored as a disjunction of conjunctions.
+type condition [][]comparison
+
+func (cond condition) eval(facts map[string]string) bool {
+	for _, all := range cond {
+		ok := true
+		for _, cmp := range all {
+			ok = ok && cmp.eval(facts)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCondition parses expressions like
+//
+//	os == "darwin" && arch == "arm64" || hostname =~ "^ci-"
+//
+// Facts are os, arch, hostname and user; operators are ==, != and the
+// regular expression matches =~ and !~.
+func parseCondition(expr string) (condition, error) {
+	var cond condition
+	for _, alternative := range strings.Split(expr, "||") {
+		var all []comparison
+		for _, term := range strings.Split(alternative, "&&") {
+			cmp, err := parseComparison(strings.TrimSpace(term))
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, cmp)
+		}
+		cond = append(cond, all)
+	}
+	return cond, nil
+}
+
+func parseComparison(term string) (comparison, error) {
+	// The first operator wins so patterns may contain operators.
+	var cmp comparison
+	at := len(term)
+	for _, op := range []string{"==", "!=", "=~", "!~"} {
+		if i := strings.Index(term, op); i >= 0 && i < at {
+			at = i
+			cmp = comparison{fact: strings.TrimSpace(term[:i]), op: op, value: strings.TrimSpace(term[i+len(op):])}
+		}
+	}
+	if cmp.op == "" {
+		return cmp, fmt.Errorf("invalid condition %q: expected FACT OP \"VALUE\"", term)
+	}
+	switch cmp.fact {
+	case "os", "arch", "hostname", "user":
+	default:
+		return cmp, fmt.Errorf("unknown fact %q (expected os, arch, hostname or user)", cmp.fact)
+	}
+
+	value, err := strconv.Unquote(cmp.value)
+	if err != nil {
+		return cmp, fmt.Errorf("invalid condition %q: the value must be a double-quoted string", term)
+	}
+	cmp.value = value
+	if cmp.op == "=~" || cmp.op == "!~" {
+		if cmp.re, err = regexp.Compile(value); err != nil {
+			return cmp, fmt.Errorf("invalid pattern in %q: %w", term, err)
+		}
+	}
+	return cmp, nil
+}
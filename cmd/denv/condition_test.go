@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCondition(t *testing.T) {
+	facts := map[string]string{"os": "darwin", "arch": "arm64", "hostname": "ci-runner-7", "user": "build"}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`os == "darwin"`, true},
+		{`os != "darwin"`, false},
+		{`hostname =~ "^ci-"`, true},
+		{`hostname !~ "^ci-"`, false},
+		{`hostname =~ "^ci-[a-z]+-[0-9](==)?$"`, true},
+		{`os == "linux" && arch == "arm64"`, false},
+		{`os == "linux" || arch == "arm64"`, true},
+		{`os == "linux" && arch == "amd64" || user == "build"`, true},
+	}
+	for _, tt := range tests {
+		cond, err := parseCondition(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := cond.eval(facts); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	cases := map[string]string{
+		`os = "darwin"`:      "expected FACT OP",
+		`kernel == "linux"`:  `unknown fact "kernel"`,
+		`os == darwin`:       "double-quoted",
+		`hostname =~ "ci-("`: "invalid pattern",
+		`os == "linux" && `:  "expected FACT OP",
+	}
+	for expr, want := range cases {
+		if _, err := parseCondition(expr); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", expr, want, err)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// defaultConfigFile is the project config read from the working directory
+// when --config is not given.
+const defaultConfigFile = "denv.yaml"
+
+// config is the project configuration:
+//
+//	files:
+//	  - .env
+//	  - path: .env.local
+//	    optional: true
+//	  - path: legacy/app.properties
+//	    format: properties
+//	env:
+//	  LOG_LEVEL: info
+//	conditions:
+//	  - when: os == "darwin"
+//	    env:
+//	      DOCKER_HOST: unix:///var/run/docker.sock
+//	run:
+//	  server: go run ./cmd/api
+//	before_exec:
+//	  - command: aws sso login
+//	    on-failure: warn
+//	after_exec:
+//	  - ./scripts/stop-tunnel.sh
+//	check-permissions: true
+//	isolate: minimal
+//	apps:
+//	  api:
+//	    files:
+//	      - services/api/.env
+//	    env:
+//	      PORT: "8080"
+type config struct {
+	Path string
+	// App is the name of the app selected with --app, if any.
+	App string
+	// Files are sources loaded before the ones given on the command line.
+	Files []EnvFile
+	// Env holds variables set by the config itself. They are loaded after
+	// Files, with matching Conditions adding to or overriding them.
+	Env        map[string]string
+	Conditions []configCondition
+	// Run maps target names to shell commands for denv run.
+	Run map[string]string
+	// BeforeExec and AfterExec run around commands started by exec and
+	// run.
+	BeforeExec []configHook
+	AfterExec  []configHook
+	// CheckPermissions enables --check-permissions for the project.
+	CheckPermissions bool
+	// Isolate is the isolation used without --isolate, if set.
+	Isolate *isolation
+	// Merge maps key glob patterns to the merge mode applied to every
+	// assignment of matching keys, see joinPathList.
+	Merge map[string]string
+	// Apps are the per-app configs of a monorepo, see forApp.
+	Apps map[string]*config
+}
+
+// configCondition sets variables only when its expression matches.
+type configCondition struct {
+	When condition
+	Env  map[string]string
+}
+
+// env returns the variables of the config on this machine.
+func (cfg *config) env() map[string]string {
+	env := maps.Clone(cfg.Env)
+	if env == nil {
+		env = make(map[string]string)
+	}
+	if len(cfg.Conditions) == 0 {
+		return env
+	}
+	facts := conditionFacts()
+	for _, cond := range cfg.Conditions {
+		if cond.When.eval(facts) {
+			maps.Copy(env, cond.Env)
+		}
+	}
+	return env
+}
+
+// readConfig parses the content of the config file at path. Relative
+// paths in it are resolved against the directory of the file.
+func readConfig(path string, data []byte) (*config, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, &fs.PathError{Op: "invalid config", Path: path, Err: err}
+	}
+	cfg, err := decodeConfig(doc, filepath.Dir(path))
+	if err != nil {
+		return nil, &fs.PathError{Op: "invalid config", Path: path, Err: err}
+	}
+	cfg.Path = path
+	return cfg, nil
+}
+
+func decodeConfig(doc any, dir string) (*config, error) {
+	cfg := &config{Run: map[string]string{}}
+	if doc == nil {
+		return cfg, nil
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping at the top level")
+	}
+
+	for key, value := range root {
+		switch key {
+		case "files":
+			items, ok := value.([]any)
+			if !ok && value != nil {
+				return nil, fmt.Errorf("files: expected a list")
+			}
+			for i, item := range items {
+				file, err := decodeConfigFile(item, dir)
+				if err != nil {
+					return nil, fmt.Errorf("files[%d]: %w", i, err)
+				}
+				cfg.Files = append(cfg.Files, file)
+			}
+		case "env":
+			env, err := decodeConfigEnv(value)
+			if err != nil {
+				return nil, fmt.Errorf("env: %w", err)
+			}
+			cfg.Env = env
+		case "conditions":
+			items, ok := value.([]any)
+			if !ok && value != nil {
+				return nil, fmt.Errorf("conditions: expected a list")
+			}
+			for i, item := range items {
+				cond, err := decodeConfigCondition(item)
+				if err != nil {
+					return nil, fmt.Errorf("conditions[%d]: %w", i, err)
+				}
+				cfg.Conditions = append(cfg.Conditions, cond)
+			}
+		case "before_exec", "after_exec":
+			items, ok := value.([]any)
+			if !ok && value != nil {
+				return nil, fmt.Errorf("%s: expected a list", key)
+			}
+			var hooks []configHook
+			for i, item := range items {
+				hook, err := decodeConfigHook(item)
+				if err != nil {
+					return nil, fmt.Errorf("%s[%d]: %w", key, i, err)
+				}
+				hooks = append(hooks, hook)
+			}
+			if key == "before_exec" {
+				cfg.BeforeExec = hooks
+			} else {
+				cfg.AfterExec = hooks
+			}
+		case "merge":
+			rules, err := decodeConfigMerge(value)
+			if err != nil {
+				return nil, fmt.Errorf("merge: %w", err)
+			}
+			cfg.Merge = rules
+		case "apps":
+			apps, err := decodeConfigApps(value, dir)
+			if err != nil {
+				return nil, fmt.Errorf("apps: %w", err)
+			}
+			cfg.Apps = apps
+		case "isolate":
+			iso, err := decodeConfigIsolation(value)
+			if err != nil {
+				return nil, fmt.Errorf("isolate: %w", err)
+			}
+			cfg.Isolate = iso
+		case "check-permissions":
+			if value != "true" && value != "false" {
+				return nil, fmt.Errorf("check-permissions: expected true or false")
+			}
+			cfg.CheckPermissions = value == "true"
+		case "run":
+			targets, ok := value.(map[string]any)
+			if !ok && value != nil {
+				return nil, fmt.Errorf("run: expected a mapping of names to commands")
+			}
+			for name, command := range targets {
+				s, ok := command.(string)
+				if !ok || s == "" {
+					return nil, fmt.Errorf("run.%s: expected a command", name)
+				}
+				cfg.Run[name] = s
+			}
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return cfg, nil
+}
+
+// decodeConfigEnv decodes a mapping of variable names to values.
+func decodeConfigEnv(value any) (map[string]string, error) {
+	m, ok := value.(map[string]any)
+	if !ok && value != nil {
+		return nil, fmt.Errorf("expected a mapping of names to values")
+	}
+	env := make(map[string]string, len(m))
+	for k, v := range m {
+		if err := validateKey(k); err != nil {
+			return nil, err
+		}
+		s, ok := v.(string)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("%s: expected a single value", k)
+		}
+		env[k] = s
+	}
+	return env, nil
+}
+
+func decodeConfigCondition(item any) (configCondition, error) {
+	var cond configCondition
+	m, ok := item.(map[string]any)
+	if !ok {
+		return cond, fmt.Errorf("expected a mapping with when and env")
+	}
+	for key, value := range m {
+		switch key {
+		case "when":
+			expr, _ := value.(string)
+			if expr == "" {
+				return cond, fmt.Errorf("when: expected an expression")
+			}
+			when, err := parseCondition(expr)
+			if err != nil {
+				return cond, fmt.Errorf("when: %w", err)
+			}
+			cond.When = when
+		case "env":
+			env, err := decodeConfigEnv(value)
+			if err != nil {
+				return cond, fmt.Errorf("env: %w", err)
+			}
+			cond.Env = env
+		default:
+			return cond, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if cond.When == nil {
+		return cond, fmt.Errorf("missing when")
+	}
+	return cond, nil
+}
+
+// decodeConfigFile decodes a files entry: a path, or a mapping with path,
+// optional and format.
+func decodeConfigFile(item any, dir string) (EnvFile, error) {
+	file := EnvFile{FromConfig: true}
+	format := ""
+	switch v := item.(type) {
+	case string:
+		file.Path = v
+	case map[string]any:
+		for key, value := range v {
+			s, _ := value.(string)
+			switch key {
+			case "path":
+				file.Path = s
+			case "optional":
+				if s != "true" && s != "false" {
+					return file, fmt.Errorf("optional: expected true or false")
+				}
+				file.Optional = s == "true"
+			case "format":
+				format = s
+			case "verify":
+				if _, _, err := parseVerify(s); err != nil {
+					return file, err
+				}
+				file.Verify = s
+			case "timeout", "retries", "on-error":
+				if err := file.Policy.set(key, s); err != nil {
+					return file, fmt.Errorf("%s: %w", key, err)
+				}
+			default:
+				return file, fmt.Errorf("unknown key %q", key)
+			}
+		}
+	}
+	if src, ok, err := gitFileSource(file.Path); err != nil {
+		return file, err
+	} else if ok {
+		src.Optional, src.FromConfig, src.Verify, src.Policy = file.Optional, true, file.Verify, file.Policy
+		if format != "" {
+			if _, src.Format, err = splitFormat("?format=" + format); err != nil {
+				return file, err
+			}
+		}
+		return src, nil
+	}
+	if format != "" {
+		file.Path += "?format=" + format
+	}
+	var err error
+	if file.Path, file.Format, err = splitFormat(file.Path); err != nil {
+		return file, err
+	}
+	if file.Path == "" {
+		return file, fmt.Errorf("expected a path")
+	}
+	if kind, path, ok, err := objectSource(file.Path); err != nil {
+		return file, err
+	} else if ok {
+		file.Kind, file.Path = kind, path
+		return file, nil
+	}
+	if file.Verify != "" {
+		return file, fmt.Errorf("verify: only s3://, gs:// and git:: sources can be verified")
+	}
+	if file.Policy != (sourcePolicy{}) {
+		return file, fmt.Errorf("timeout, retries and on-error only apply to remote sources")
+	}
+	if !filepath.IsAbs(file.Path) {
+		file.Path = filepath.Join(dir, file.Path)
+	}
+	return file, nil
+}
+
+// applyConfig reads --config, or denv.yaml when present, and puts its
+// files and variables before the sources given on the command line. The
+// config is kept in the app metadata for commands that need it. With
+// --app, the config of that app is used; with --at, the config as
+// committed then.
+func applyConfig(c *cli.Context, files *[]EnvFile) error {
+	path := c.String("config")
+	if path == "" {
+		path = defaultConfigFile
+	}
+	// With --at, a default config in a repository without that revision
+	// counts as missing; the env files report a bad revision themselves.
+	data, err := (&sourceReader{c: c}).readFile(path)
+	if c.String("config") == "" && (errors.Is(err, fs.ErrNotExist) || err != nil && c.String("at") != "") {
+		if app := c.String("app"); app != "" {
+			return fmt.Errorf("--app %s needs a project config, but %s does not exist", app, path)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cfg, err := readConfig(path, data)
+	if err != nil {
+		return err
+	}
+	if app := c.String("app"); app != "" {
+		if cfg, err = cfg.forApp(app); err != nil {
+			return err
+		}
+	}
+	sources := slices.Clone(cfg.Files)
+	if len(cfg.Env) > 0 || len(cfg.Conditions) > 0 {
+		sources = append(sources, EnvFile{Path: path, Kind: sourceConfig, FromConfig: true})
+	}
+	*files = append(sources, *files...)
+	c.App.Metadata["config"] = cfg
+	return nil
+}
+
+// loadedConfig returns the config read by applyConfig, or an empty one.
+func loadedConfig(c *cli.Context) *config {
+	if cfg, ok := c.App.Metadata["config"].(*config); ok {
+		return cfg
+	}
+	return &config{Run: map[string]string{}}
+}
+
+func runRun(c *cli.Context) error {
+	cfg := loadedConfig(c)
+	if c.NArg() == 0 {
+		names := make([]string, 0, len(cfg.Run))
+		for name := range cfg.Run {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(c.App.Writer, "%s\t%s\n", name, cfg.Run[name])
+		}
+		return nil
+	}
+
+	name := c.Args().First()
+	command, ok := cfg.Run[name]
+	if !ok {
+		return fmt.Errorf("unknown run target %q", name)
+	}
+	for _, arg := range c.Args().Tail() {
+		if runtime.GOOS == "windows" {
+			command += ` "` + strings.ReplaceAll(arg, `"`, `""`) + `"`
+		} else {
+			command += " " + shellQuote(arg)
+		}
+	}
+
+	envMap, err := loadEnv(c)
+	if err != nil {
+		return err
+	}
+	return execWithEnv(c, shellArgs(command), envMap, nil, nil)
+}
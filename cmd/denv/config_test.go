@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func createRunApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{Name: "run", Action: runRun},
+		{
+			Name:   "list",
+			Flags:  []cli.Flag{&cli.StringFlag{Name: "output", Value: "text"}, &cli.StringFlag{Name: "group-by"}},
+			Action: runList,
+		},
+	}
+	return app
+}
+
+func TestConfigConditions(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	orig := conditionFacts
+	conditionFacts = func() map[string]string {
+		return map[string]string{"os": "darwin", "arch": "arm64", "hostname": "ci-runner-1"}
+	}
+	t.Cleanup(func() { conditionFacts = orig })
+
+	cfg := `files:
+  - .env
+env:
+  LOG_LEVEL: info
+  DOCKER_HOST: unix:///var/run/docker.sock
+conditions:
+  - when: os == "darwin"
+    env:
+      DOCKER_HOST: unix:///Users/me/.colima/docker.sock
+  - when: hostname =~ "^ci-" && os == "linux"
+    env:
+      LOG_LEVEL: debug
+  - when: hostname =~ "^ci-"
+    env:
+      CI: "true"
+`
+	if err := os.WriteFile(defaultConfigFile, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".env", []byte("LOG_LEVEL=warn\nPORT=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app := createRunApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "--isolate", "list"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "CI=true\nDOCKER_HOST=unix:///Users/me/.colima/docker.sock\nLOG_LEVEL=info\nPORT=1\n"
+	if buf.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	if err := os.WriteFile(defaultConfigFile, []byte("conditions:\n  - when: os = \"mac\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := createRunApp().Run([]string{"denv", "list"})
+	if err == nil || !strings.Contains(err.Error(), "conditions[0]: when: invalid condition") {
+		t.Errorf("expected an invalid condition error, got %v", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	cfg := `files:
+  - .env
+  - path: .env.local
+    optional: true
+  - path: legacy.ini
+    format: ini
+run:
+  greet: echo "$GREETING" > out.txt; printf '%s\n' >> out.txt
+  fail: exit 3
+`
+	if err := os.WriteFile(defaultConfigFile, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".env", []byte("GREETING=hello\nPORT=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("legacy.ini", []byte("[app]\nmode = legacy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	override := filepath.Join(dir, "override.env")
+	if err := os.WriteFile(override, []byte("PORT=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app := createRunApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "--isolate", "-f", override, "list"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "APP_MODE=legacy\nGREETING=hello\nPORT=2\n" {
+		t.Errorf("expected config files before -f files, got %q", buf.String())
+	}
+
+	buf.Reset()
+	app = createRunApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "run"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "fail\texit 3\ngreet\t") {
+		t.Errorf("expected sorted targets, got %q", buf.String())
+	}
+
+	code := captureExit(t)
+	if err := createRunApp().Run([]string{"denv", "run", "greet", "it's", "b c"}); err != nil || *code > 0 {
+		t.Fatalf("run failed: %v (exit %d)", err, *code)
+	}
+	out, _ := os.ReadFile("out.txt")
+	if string(out) != "hello\nit's\nb c\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	createRunApp().Run([]string{"denv", "run", "fail"})
+	if *code != 3 {
+		t.Errorf("expected exit code 3, got %d", *code)
+	}
+
+	err := createRunApp().Run([]string{"denv", "run", "missing"})
+	if err == nil || !strings.Contains(err.Error(), `unknown run target "missing"`) {
+		t.Errorf("expected unknown target error, got %v", err)
+	}
+
+	if err := os.WriteFile(defaultConfigFile, []byte("fils:\n  - .env\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = createRunApp().Run([]string{"denv", "run"})
+	if err == nil || !strings.Contains(err.Error(), `denv.yaml: unknown key "fils"`) {
+		t.Errorf("expected unknown key error, got %v", err)
+	}
+}
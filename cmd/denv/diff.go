@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// herokuCommand and flyctlCommand are the platform CLIs used by diff. They
+// are variables so tests can substitute fakes.
+var (
+	herokuCommand = "heroku"
+	flyctlCommand = "flyctl"
+)
+
+// Statuses of a key in denv diff.
+const (
+	driftLocalOnly  = "local-only"
+	driftRemoteOnly = "remote-only"
+	driftChanged    = "changed"
+	// driftUnknown marks keys set remotely whose value cannot be read back,
+	// such as Fly secrets or Kubernetes downward API fields.
+	driftUnknown = "unknown"
+)
+
+type drift struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Local  string `json:"local,omitempty"`
+	Remote string `json:"remote,omitempty"`
+}
+
+// format renders d as a diff line against target.
+func (d drift) format(target string) string {
+	switch d.Status {
+	case driftLocalOnly:
+		return fmt.Sprintf("+ %s=%s", d.Key, d.Local)
+	case driftRemoteOnly:
+		return fmt.Sprintf("- %s=%s", d.Key, d.Remote)
+	case driftChanged:
+		return fmt.Sprintf("~ %s: %s -> %s", d.Key, d.Remote, d.Local)
+	}
+	return fmt.Sprintf("? %s (value on %s cannot be read)", d.Key, target)
+}
+
+// maskDrifts replaces the values of secret keys, and of values that look
+// like secrets, with maskedValue.
+func maskDrifts(drifts []drift, secret map[string]bool) {
+	for i, d := range drifts {
+		if !secret[d.Key] && !looksSecret(d.Key, d.Local, defaultSecretKeys) && !looksSecret(d.Key, d.Remote, defaultSecretKeys) {
+			continue
+		}
+		if d.Local != "" {
+			drifts[i].Local = maskedValue
+		}
+		if d.Remote != "" {
+			drifts[i].Remote = maskedValue
+		}
+	}
+}
+
+// runCLI runs a platform CLI with stdin as its input and returns its
+// output, reporting its stderr on failure. The CLI is killed once ctx is
+// done.
+func runCLI(ctx context.Context, name, stdin string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	data, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%s: %s", name, strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// runCLIJSON runs a platform CLI and decodes its JSON output into out.
+func runCLIJSON(ctx context.Context, name string, out any, args ...string) error {
+	data, err := runCLI(ctx, name, "", args...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid %s output: %w", name, err)
+	}
+	return nil
+}
+
+// readHerokuEnv returns the config vars of a Heroku app.
+func readHerokuEnv(app string) (map[string]string, error) {
+	env := make(map[string]string)
+	if err := runCLIJSON(context.Background(), herokuCommand, &env, "config", "--app", app, "--json"); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// readFlyEnv returns the env section of a Fly app's deployed config. Fly
+// only reports digests of secrets, so their names are returned as unknown.
+func readFlyEnv(app string) (map[string]string, []string, error) {
+	var cfg struct {
+		Env map[string]string `json:"env"`
+	}
+	if err := runCLIJSON(context.Background(), flyctlCommand, &cfg, "config", "show", "--app", app); err != nil {
+		return nil, nil, err
+	}
+	var secrets []struct {
+		Name string `json:"name"`
+	}
+	if err := runCLIJSON(context.Background(), flyctlCommand, &secrets, "secrets", "list", "--app", app, "--json"); err != nil {
+		return nil, nil, err
+	}
+	env := cfg.Env
+	if env == nil {
+		env = make(map[string]string)
+	}
+	var unknown []string
+	for _, s := range secrets {
+		unknown = append(unknown, s.Name)
+	}
+	return env, unknown, nil
+}
+
+// remoteEnv reads the environment of the deployment selected by the diff
+// flags, with the keys whose values cannot be read.
+func remoteEnv(c *cli.Context) (string, map[string]string, []string, error) {
+	var targets []string
+	for _, flag := range []string{"k8s", "heroku", "flyctl"} {
+		if c.String(flag) != "" {
+			targets = append(targets, flag)
+		}
+	}
+	if len(targets) != 1 {
+		return "", nil, nil, fmt.Errorf("expected exactly one of --k8s, --heroku or --flyctl")
+	}
+	ref := c.String(targets[0])
+	switch targets[0] {
+	case "k8s":
+		env, unknown, err := readWorkloadEnv(ref, c.String("container"), c.String("k8s-context"))
+		return "k8s:" + ref, env, unknown, err
+	case "heroku":
+		env, err := readHerokuEnv(ref)
+		return "heroku:" + ref, env, nil, err
+	default:
+		env, unknown, err := readFlyEnv(ref)
+		return "fly:" + ref, env, unknown, err
+	}
+}
+
+// diffDeployment compares local and remote values key by key, in key order.
+// Unknown remote keys only differ when they are not defined locally.
+func diffDeployment(local, remote map[string]string, unknown []string) []drift {
+	keys := sortedKeys(local)
+	for k := range remote {
+		if _, ok := local[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range unknown {
+		if _, ok := local[k]; !ok {
+			if _, ok := remote[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	var drifts []drift
+	for _, k := range keys {
+		l, inLocal := local[k]
+		r, inRemote := remote[k]
+		isUnknown := slices.Contains(unknown, k)
+		switch {
+		case isUnknown && inLocal:
+			drifts = append(drifts, drift{Key: k, Status: driftUnknown, Local: l})
+		case isUnknown:
+			drifts = append(drifts, drift{Key: k, Status: driftRemoteOnly})
+		case !inRemote:
+			drifts = append(drifts, drift{Key: k, Status: driftLocalOnly, Local: l})
+		case !inLocal:
+			drifts = append(drifts, drift{Key: k, Status: driftRemoteOnly, Remote: r})
+		case l != r:
+			drifts = append(drifts, drift{Key: k, Status: driftChanged, Local: l, Remote: r})
+		}
+	}
+	return drifts
+}
+
+// runDiff compares the variables of the local sources with what a platform
+// reports for a running app. It exits with status 1 when they differ, like
+// diff(1).
+func runDiff(c *cli.Context) error {
+	output := c.String("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unsupported output format: %s", output)
+	}
+	envMap, origins, err := mergeSources(c, nil)
+	if err != nil {
+		return err
+	}
+	target, remote, unknown, err := remoteEnv(c)
+	if err != nil {
+		return err
+	}
+
+	ignore := c.StringSlice("ignore")
+	for _, m := range []map[string]string{envMap, remote} {
+		for k := range m {
+			if matchesAny(k, ignore) {
+				delete(m, k)
+			}
+		}
+	}
+	unknown = slices.DeleteFunc(unknown, func(k string) bool { return matchesAny(k, ignore) })
+
+	drifts := diffDeployment(envMap, remote, unknown)
+	if !c.Bool("show-secrets") {
+		maskDrifts(drifts, secretKeys(c, envMap, origins, defaultSecretKeys))
+	}
+
+	if output == "json" {
+		if drifts == nil {
+			drifts = []drift{}
+		}
+		if err := writeJSON(c, c.App.Writer, drifts, true); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range drifts {
+			fmt.Fprintln(c.App.Writer, d.format(target))
+		}
+		if len(drifts) == 0 {
+			fmt.Fprintf(humanWriter(c), "No differences from %s\n", target)
+		}
+	}
+	for _, d := range drifts {
+		if d.Status != driftUnknown {
+			return cli.Exit("", 1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func createDiffApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "diff",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "k8s"},
+				&cli.StringFlag{Name: "container"},
+				&cli.StringFlag{Name: "heroku"},
+				&cli.StringFlag{Name: "flyctl"},
+				&cli.StringSliceFlag{Name: "ignore"},
+				&cli.StringFlag{Name: "output", Value: "text"},
+			},
+			Action: runDiff,
+		},
+	}
+	return app
+}
+
+func TestDiffDeployment(t *testing.T) {
+	local := map[string]string{"A": "1", "B": "2", "C": "3", "S": "x"}
+	remote := map[string]string{"A": "1", "B": "20", "D": "4"}
+	got := diffDeployment(local, remote, []string{"S", "T"})
+	want := []drift{
+		{Key: "B", Status: driftChanged, Local: "2", Remote: "20"},
+		{Key: "C", Status: driftLocalOnly, Local: "3"},
+		{Key: "D", Status: driftRemoteOnly, Remote: "4"},
+		{Key: "S", Status: driftUnknown, Local: "x"},
+		{Key: "T", Status: driftRemoteOnly},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDiffPlatforms(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=8080\nLOG_LEVEL=debug\nAPI_TOKEN=local-token\nNEW_FLAG=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	kubectl := writeFakeCommand(t, "kubectl", `
+case "$2" in
+deployment/api) [ "$5 $6" = "--namespace prod" ] || { echo "unexpected $*" >&2; exit 1; }
+  echo '{"metadata":{"namespace":"prod"},"spec":{"template":{"spec":{"containers":[
+    {"name":"sidecar","env":[{"name":"PORT","value":"1"}]},
+    {"name":"api","envFrom":[{"configMapRef":{"name":"api"}}],"env":[
+      {"name":"PORT","value":"80"},
+      {"name":"API_TOKEN","valueFrom":{"secretKeyRef":{"name":"api","key":"token"}}},
+      {"name":"POD_IP","valueFrom":{"fieldRef":{"fieldPath":"status.podIP"}}}]}]}}}}' ;;
+configmap) echo '{"data":{"LOG_LEVEL":"info","OLD":"x"}}' ;;
+secret) echo '{"data":{"token":"cmVtb3RlLXRva2Vu"}}' ;;
+*) echo "unexpected $*" >&2; exit 1 ;;
+esac
+`)
+	heroku := writeFakeCommand(t, "heroku", `echo '{"PORT":"8080","LOG_LEVEL":"debug","API_TOKEN":"local-token","NEW_FLAG":"1","DATABASE_URL":"postgres://x"}'`)
+	flyctl := writeFakeCommand(t, "flyctl", `
+case "$1" in
+config) echo '{"app":"api","env":{"PORT":"8080","LOG_LEVEL":"debug","NEW_FLAG":"1"}}' ;;
+secrets) echo '[{"Name":"API_TOKEN","Digest":"abc"}]' ;;
+esac
+`)
+	defer func(k, h, f string) { kubectlCommand, herokuCommand, flyctlCommand = k, h, f }(kubectlCommand, herokuCommand, flyctlCommand)
+	kubectlCommand, herokuCommand, flyctlCommand = kubectl, heroku, flyctl
+
+	run := func(args ...string) (string, int) {
+		t.Helper()
+		code := captureExit(t)
+		*code = 0
+		var buf bytes.Buffer
+		app := createDiffApp()
+		app.Writer = &buf
+		if err := app.Run(append([]string{"denv", "-f", envFile, "diff"}, args...)); err != nil && *code == 0 {
+			t.Fatal(err)
+		}
+		return buf.String(), *code
+	}
+
+	out, code := run("--k8s", "prod/deployment/api", "--container", "api", "--ignore", "POD_*")
+	want := "~ API_TOKEN: *** -> ***\n" +
+		"~ LOG_LEVEL: info -> debug\n" +
+		"+ NEW_FLAG=1\n" +
+		"- OLD=x\n" +
+		"~ PORT: 80 -> 8080\n"
+	if out != want || code != 1 {
+		t.Errorf("expected exit code 1 and\n%s\ngot %d and\n%s", want, code, out)
+	}
+
+	out, code = run("--heroku", "api", "--ignore", "DATABASE_URL")
+	if out != "No differences from heroku:api\n" || code != 0 {
+		t.Errorf("expected no differences, got %d and %q", code, out)
+	}
+
+	out, code = run("--flyctl", "api", "--output", "json")
+	var drifts []drift
+	if err := json.Unmarshal([]byte(out), &drifts); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if want := []drift{{Key: "API_TOKEN", Status: driftUnknown, Local: maskedValue}}; !reflect.DeepEqual(drifts, want) || code != 0 {
+		t.Errorf("expected %+v with exit code 0, got %+v and %d", want, drifts, code)
+	}
+
+	app := createDiffApp()
+	if err := app.Run([]string{"denv", "-f", envFile, "diff", "--heroku", "a", "--flyctl", "b"}); err == nil {
+		t.Error("expected an error for several targets")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// criticalKeys are system variables that env files rarely mean to replace.
+var criticalKeys = []string{
+	"PATH", "HOME", "USER", "SHELL", "PWD", "TMPDIR",
+	"LD_PRELOAD", "LD_LIBRARY_PATH", "DYLD_INSERT_LIBRARIES", "DYLD_LIBRARY_PATH",
+}
+
+// envLimits returns the per-variable and total environment size limits of
+// the current OS in bytes; 0 means no specific limit.
+func envLimits() (perVar, total int) {
+	switch runtime.GOOS {
+	case "linux":
+		return 128 << 10, 2 << 20
+	case "windows":
+		return 32767, 32767
+	case "darwin":
+		return 0, 1 << 20
+	default:
+		return 0, 256 << 10
+	}
+}
+
+// checkEnvSize validates env against the OS limits and describes each
+// violation, naming the oversized keys. argBytes is the size of the command
+// line, which shares the total limit with the environment on Unix.
+func checkEnvSize(env map[string]string, argBytes int) []string {
+	perVar, total := envLimits()
+
+	// Sorting is only needed to report problems, which are rare; exec runs
+	// this check on every invocation.
+	var oversized []string
+	size := argBytes
+	for k, v := range env {
+		n := len(k) + len(v) + 2
+		size += n
+		if perVar > 0 && n > perVar {
+			oversized = append(oversized, k)
+		}
+	}
+	sort.Strings(oversized)
+	var problems []string
+	for _, k := range oversized {
+		problems = append(problems, fmt.Sprintf("%s is %d bytes, exceeding the %d byte per-variable limit", k, len(k)+len(env[k])+2, perVar))
+	}
+
+	if total > 0 && size > total {
+		type sized struct {
+			key  string
+			size int
+		}
+		vars := make([]sized, 0, len(env))
+		for _, k := range sortedKeys(env) {
+			vars = append(vars, sized{k, len(k) + len(env[k]) + 2})
+		}
+		sort.SliceStable(vars, func(i, j int) bool { return vars[i].size > vars[j].size })
+		var largest []string
+		for _, v := range vars[:min(5, len(vars))] {
+			largest = append(largest, fmt.Sprintf("%s (%d bytes)", v.key, v.size))
+		}
+		problems = append(problems, fmt.Sprintf("environment is %d bytes in %d variables, exceeding the %d byte limit; largest: %s",
+			size, len(env), total, strings.Join(largest, ", ")))
+	}
+	return problems
+}
+
+type finding struct {
+	Level   string
+	Source  string
+	Message string
+}
+
+type doctor struct {
+	findings []finding
+	// opts are the parse options used to check files.
+	opts parseOptions
+}
+
+func (d *doctor) report(level, source, format string, args ...any) {
+	d.findings = append(d.findings, finding{Level: level, Source: source, Message: fmt.Sprintf(format, args...)})
+}
+
+// checkFile inspects the raw content of an env file for problems that the
+// parser would silently tolerate or turn into confusing errors. It returns
+// false if it reported an error, which loading the file will run into again.
+func (d *doctor) checkFile(file EnvFile) bool {
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		if skipMissing(file, err) {
+			return true
+		}
+		d.report("error", file.Path, "cannot read file: %v", err)
+		return false
+	}
+
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		d.report("warning", file.Path, "file starts with a UTF-8 byte order mark")
+	case bytes.HasPrefix(data, bomUTF16LE), bytes.HasPrefix(data, bomUTF16BE):
+		d.report("warning", file.Path, "file is UTF-16 encoded")
+	}
+
+	data, err = decodeEnv(data, d.opts.Encoding)
+	if err != nil {
+		d.report("error", file.Path, "cannot decode file: %v", err)
+		return false
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		d.report("warning", file.Path, "file uses CRLF line endings")
+	}
+
+	opts := d.opts
+	opts.Format = file.Format
+	entries, err := parseEnvFormat(data, opts)
+	if err != nil {
+		d.report("error", file.Path, "parse error: %v", err)
+		return false
+	}
+
+	seen := make(map[string]int)
+	for _, e := range entries {
+		if line, ok := seen[e.Key]; ok {
+			d.report("warning", file.Path, "%s is defined twice (lines %d and %d)", e.Key, line, e.Line)
+		}
+		seen[e.Key] = e.Line
+		for _, name := range e.Unresolved {
+			d.report("warning", file.Path, "line %d: %s references undefined variable %s", e.Line, e.Key, name)
+		}
+	}
+	return true
+}
+
+func runDoctor(c *cli.Context) error {
+	d := &doctor{opts: parseOptions{ShellCompat: c.Bool("shell-compat"), Encoding: c.String("encoding")}}
+
+	type definition struct {
+		source string
+		value  string
+	}
+	defined := make(map[string][]definition)
+	merged := make(map[string]string)
+
+	for _, e := range inheritedEnv(c) {
+		if k, v, ok := strings.Cut(e, "="); ok {
+			merged[k] = v
+		}
+	}
+
+	files := envFiles(c)
+	reader := &sourceReader{c: c}
+	results, errs := reader.readAll(files)
+	for i, file := range files {
+		checked := true
+		if file.Kind == sourceFile {
+			checked = d.checkFile(file)
+		}
+
+		loaded, err := results[i], errs[i]
+		if err != nil {
+			switch {
+			case skipMissing(file, err):
+			case !checked:
+				// checkFile already reported why the file cannot be read.
+			case file.Kind == sourceFile:
+				d.report("error", file.Path, "cannot load file: %v", err)
+			default:
+				d.report("error", file.Path, "cannot load %s source: %v", file.Kind, err)
+			}
+			continue
+		}
+
+		for k, v := range loaded {
+			defined[k] = append(defined[k], definition{source: file.Path, value: v})
+			merged[k] = v
+		}
+	}
+
+	keys := make([]string, 0, len(defined))
+	for k := range defined {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		defs := defined[k]
+		for _, def := range defs[1:] {
+			if def.value != defs[0].value {
+				sources := make([]string, len(defs))
+				for i, def := range defs {
+					sources[i] = def.source
+				}
+				d.report("warning", defs[len(defs)-1].source, "%s has conflicting values across %s", k, strings.Join(sources, ", "))
+				break
+			}
+		}
+		for _, critical := range criticalKeys {
+			if k == critical {
+				d.report("warning", defs[len(defs)-1].source, "%s overrides the system variable %s", k, critical)
+			}
+		}
+	}
+
+	for _, problem := range checkEnvSize(merged, 0) {
+		d.report("error", "environment", "%s", problem)
+	}
+
+	errorsFound := 0
+	for _, f := range d.findings {
+		if f.Level == "error" {
+			errorsFound++
+		}
+		fmt.Fprintf(c.App.Writer, "%s: %s: %s\n", f.Level, f.Source, f.Message)
+	}
+
+	if len(d.findings) == 0 {
+		fmt.Fprintln(humanWriter(c), "No problems found")
+	}
+	if errorsFound > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("doctor found %d error(s)", errorsFound))
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestDoctor(t *testing.T) {
+	tmpDir := t.TempDir()
+	base := filepath.Join(tmpDir, "base.env")
+	local := filepath.Join(tmpDir, "local.env")
+	bom := filepath.Join(tmpDir, "bom.env")
+	broken := filepath.Join(tmpDir, "broken.env")
+
+	if err := os.WriteFile(base, []byte("PORT=8080\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bom, []byte("\xEF\xBB\xBFKEY=value\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, []byte("PORT=9090\nPATH=/tmp\nPATH=/opt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(broken, []byte("no separator\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app, _ := newApp()
+	app.Writer = &buf
+	app.Commands = []*cli.Command{{Name: "doctor", Action: runDoctor}}
+
+	err := app.Run([]string{"denv", "--isolate", "--file", base, "--file", local, "--file", bom, "--file", broken, "--file-optional", filepath.Join(tmpDir, "missing.env"), "doctor"})
+	if err == nil {
+		t.Fatal("expected doctor to fail on the parse error")
+	}
+
+	out := buf.String()
+	for _, expected := range []string{
+		"byte order mark",
+		"broken.env: parse error: line 1",
+		"CRLF line endings",
+		"PORT has conflicting values",
+		"PATH overrides the system variable",
+		"PATH is defined twice (lines 2 and 3)",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to mention %q, got:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "missing.env") {
+		t.Errorf("expected missing optional file to be ignored, got:\n%s", out)
+	}
+}
+
+func TestDoctorUnresolvedAndClean(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("URL=http://${HOST}/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app, _ := newApp()
+	app.Writer = &buf
+	app.Commands = []*cli.Command{{Name: "doctor", Action: runDoctor}}
+	if err := app.Run([]string{"denv", "--isolate", "--file", envFile, "doctor"}); err != nil {
+		t.Fatalf("warnings must not fail doctor: %v", err)
+	}
+	if !strings.Contains(buf.String(), "line 1: URL references undefined variable HOST") {
+		t.Errorf("expected unresolved reference warning, got:\n%s", buf.String())
+	}
+
+	if err := os.WriteFile(envFile, []byte("URL=http://localhost/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	app2, _ := newApp()
+	app2.Writer = &buf
+	app2.Commands = []*cli.Command{{Name: "doctor", Action: runDoctor}}
+	if err := app2.Run([]string{"denv", "--isolate", "--file", envFile, "doctor"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "No problems found") {
+		t.Errorf("expected clean report, got:\n%s", buf.String())
+	}
+}
+
+func TestDoctorLoadErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, tc := range []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"invalid base64", "TOKEN=base64:!!\n", "cannot load file: key TOKEN"},
+		{"missing file reference", "CERT=file:missing.pem\n", "cannot load file: key CERT"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			envFile := filepath.Join(tmpDir, strings.ReplaceAll(tc.name, " ", "-")+".env")
+			if err := os.WriteFile(envFile, []byte(tc.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			app, _ := newApp()
+			app.Writer = &buf
+			app.Commands = []*cli.Command{{Name: "doctor", Action: runDoctor}}
+			if err := app.Run([]string{"denv", "--isolate", "--file", envFile, "doctor"}); err == nil {
+				t.Fatal("expected doctor to fail on the load error")
+			}
+			if out := buf.String(); !strings.Contains(out, tc.expected) || strings.Contains(out, "No problems found") {
+				t.Errorf("expected output to mention %q, got:\n%s", tc.expected, out)
+			}
+		})
+	}
+}
+
+func TestDoctorMissingFileReportedOnce(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.env")
+
+	var buf bytes.Buffer
+	app, _ := newApp()
+	app.Writer = &buf
+	app.Commands = []*cli.Command{{Name: "doctor", Action: runDoctor}}
+	if err := app.Run([]string{"denv", "--isolate", "--file", missing, "doctor"}); err == nil {
+		t.Fatal("expected doctor to fail on the missing file")
+	}
+	if n := strings.Count(buf.String(), "error:"); n != 1 {
+		t.Errorf("expected the missing file to be reported once, got %d times:\n%s", n, buf.String())
+	}
+}
+
+func TestDoctorAgreesWithList(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.env")
+	bad := filepath.Join(dir, "bad.env")
+	if err := os.WriteFile(good, []byte("PORT=80\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bad, []byte("TOKEN=base64:!!\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	aws := writeFakeCommand(t, "aws", `echo "access denied" >&2; exit 1`)
+	defer func(a string) { awsCommand = a }(awsCommand)
+	awsCommand = aws
+
+	run := func(command string, sources ...string) (string, error) {
+		var buf bytes.Buffer
+		app := createRunApp()
+		app.Commands = append(app.Commands, &cli.Command{Name: "doctor", Action: runDoctor})
+		app.Writer, app.ErrWriter = &buf, &buf
+		err := app.Run(append(append([]string{"denv", "--isolate", "--cache-dir", filepath.Join(dir, "cache")}, sources...), command))
+		return buf.String(), err
+	}
+
+	for _, sources := range [][]string{
+		{"-f", good, "--file-optional", filepath.Join(dir, "missing.env")},
+		{"-f", good, "-f", bad},
+		{"-f", good, "-f", "s3://bucket/app.env"},
+	} {
+		_, listErr := run("list", sources...)
+		out, doctorErr := run("doctor", sources...)
+		if (listErr == nil) != (doctorErr == nil) {
+			t.Errorf("%v: list returned %v but doctor %v:\n%s", sources, listErr, doctorErr, out)
+		}
+	}
+}
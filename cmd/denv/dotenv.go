@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// envEntry is a single assignment parsed from a .env file.
+type envEntry struct {
+	Key     string
+	Value   string
+	Line    int // first line of the assignment (1-based)
+	EndLine int // last line, differs from Line for multiline quoted values
+	Quote   byte
+	Export  bool
+	// Raw is the value exactly as written after the separator, including
+	// quotes, inline comments and embedded newlines.
+	Raw string
+	// Unresolved lists $VAR references that were not defined earlier in
+	// the file and therefore expanded to "".
+	Unresolved []string
+	// Comments holds the comment lines directly above the assignment,
+	// without the leading "#".
+	Comments []string
+	// Append is set for assignments written as KEY+=VALUE.
+	Append bool
+	// Merge is mergeAppend or mergePrepend when the value still extends
+	// the one from earlier sources, see joinPathList.
+	Merge string
+}
+
+// annotation returns the value of a "denv:name=value" annotation in the
+// comments above the entry; bare "denv:name" annotations have value "".
+func (e envEntry) annotation(name string) (string, bool) {
+	for _, comment := range e.Comments {
+		for _, field := range strings.Fields(comment) {
+			key, value, _ := strings.Cut(strings.TrimPrefix(field, "denv:"), "=")
+			if strings.HasPrefix(field, "denv:") && key == name {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// description returns the comments above the entry that are not denv:
+// annotations, one line each.
+func (e envEntry) description() string {
+	var lines []string
+	for _, comment := range e.Comments {
+		comment = strings.TrimSpace(comment)
+		if comment != "" && !strings.HasPrefix(comment, "denv:") {
+			lines = append(lines, comment)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseError reports a problem at a specific line of an env file.
+type parseError struct {
+	Line int
+	Key  string
+	Err  error
+}
+
+func (e *parseError) Error() string {
+	if e.Key != "" {
+		return fmt.Sprintf("line %d: %s: %v", e.Line, e.Key, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *parseError) Unwrap() error {
+	return e.Err
+}
+
+type parseOptions struct {
+	// ExecValues enables $(command) substitution in unquoted and
+	// double-quoted values. Commands run with Dir as working directory and
+	// are killed after ExecTimeout.
+	ExecValues  bool
+	ExecTimeout time.Duration
+	Dir         string
+	// Warn receives security warnings, e.g. for every executed command.
+	Warn func(string)
+	// ShellCompat accepts files written for "source": set -a/+a lines and
+	// bare "export KEY" lines are skipped, $VAR falls back to the process
+	// environment and ${VAR:-default} is supported.
+	ShellCompat bool
+	// Encoding of the file, see decodeEnv.
+	Encoding string
+	// Format of the file, see parseEnvFormat.
+	Format string
+}
+
+// readEnvFile reads and parses an env file into a map, see parseEnvData.
+func readEnvFile(path string, opts parseOptions) (env, modes map[string]string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseEnvData(data, opts)
+}
+
+// parseEnvData decodes and parses the content of an env file into a map.
+// modes holds the keys whose final value extends the one from earlier
+// sources, with their merge mode, and is nil when there are none.
+func parseEnvData(data []byte, opts parseOptions) (env, modes map[string]string, err error) {
+	data, err = decodeEnv(data, opts.Encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := parseEnvFormat(data, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env = make(map[string]string, len(entries))
+	for _, e := range entries {
+		env[e.Key] = e.Value
+		modes = recordMergeMode(modes, e)
+	}
+	return env, modes, nil
+}
+
+// recordMergeMode updates the merge modes of a file with its next
+// assignment: a plain assignment replaces whatever the key extended.
+func recordMergeMode(modes map[string]string, e envEntry) map[string]string {
+	switch {
+	case e.Merge != "":
+		if modes == nil {
+			modes = make(map[string]string)
+		}
+		modes[e.Key] = e.Merge
+	case modes != nil:
+		delete(modes, e.Key)
+	}
+	return modes
+}
+
+// parseDotenv parses .env content. It follows godotenv's dialect: optional
+// "export" prefix, "=" or ":" separators, single quotes are literal, double
+// quotes support \n and \r escapes and may span lines, and $VAR / ${VAR}
+// references expand to variables defined earlier in the same file.
+func parseDotenv(src []byte, opts parseOptions) ([]envEntry, error) {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	n := 0
+	next := func() (string, bool) {
+		if n == len(lines) {
+			return "", false
+		}
+		n++
+		return lines[n-1], true
+	}
+
+	entries := make([]envEntry, 0, len(lines))
+	vars := make(map[string]string, len(lines))
+	err := scanDotenv(next, opts, vars, nil, func(e envEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// scanDotenv parses the lines returned by next (without line terminators)
+// and calls emit for each assignment, so callers can process files without
+// holding them in memory. Values of keys accepted by keep, or of all keys
+// when keep is nil, are stored in vars for $VAR references in later lines;
+// references to other keys expand as if they were undefined.
+func scanDotenv(next func() (string, bool), opts parseOptions, vars map[string]string, keep func(string) bool, emit func(envEntry) error) error {
+	var comments []string
+	// extending maps keys whose value extends the one from earlier sources
+	// to their merge mode.
+	extending := make(map[string]string)
+	lineNo := 0
+	for {
+		line, ok := next()
+		if !ok {
+			return nil
+		}
+		lineNo++
+		start := lineNo
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			comments = nil
+			continue
+		}
+		if line[0] == '#' {
+			comments = append(comments, strings.TrimSpace(line[1:]))
+			continue
+		}
+
+		if opts.ShellCompat && isAllexportLine(line) {
+			continue
+		}
+
+		export := false
+		if rest, ok := strings.CutPrefix(line, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimLeft(rest, " \t")
+			export = true
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 && export && opts.ShellCompat && validateKey(stripInlineComment(line)) == nil {
+			// "export KEY" only marks an already defined variable.
+			continue
+		}
+		if sep < 0 {
+			return &parseError{Line: start, Err: fmt.Errorf("expected KEY=VALUE, got %q", line)}
+		}
+		key := strings.TrimRight(line[:sep], " \t")
+		appendOp := false
+		if line[sep] == '=' && strings.HasSuffix(key, "+") {
+			key = strings.TrimRight(strings.TrimSuffix(key, "+"), " \t")
+			appendOp = true
+		}
+		if err := validateKey(key); err != nil {
+			return &parseError{Line: start, Err: err}
+		}
+
+		entry := envEntry{Key: key, Line: start, EndLine: start, Export: export, Comments: comments, Append: appendOp}
+		comments = nil
+		mode := ""
+		if appendOp {
+			mode = mergeAppend
+		}
+		if m, ok := entry.annotation("merge"); ok {
+			if m != mergeAppend && m != mergePrepend {
+				return &parseError{Line: start, Key: key, Err: fmt.Errorf("invalid denv:merge=%s (expected append or prepend)", m)}
+			}
+			mode = m
+		}
+		rest := strings.TrimLeft(line[sep+1:], " \t")
+		raw := rest
+
+		var value string
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			quote := rest[0]
+			body := rest[1:]
+			var sb strings.Builder
+			for {
+				if end := closingQuote(body, quote); end >= 0 {
+					sb.WriteString(body[:end])
+					// Only a comment may follow the closing quote.
+					if trailing := strings.TrimLeft(body[end+1:], " \t"); trailing != "" && trailing[0] != '#' {
+						return &parseError{Line: lineNo, Key: key, Err: fmt.Errorf("unexpected %q after closing quote", trailing)}
+					}
+					break
+				}
+				sb.WriteString(body)
+				sb.WriteByte('\n')
+				if body, ok = next(); !ok {
+					return &parseError{Line: start, Key: key, Err: errors.New("unterminated quoted value")}
+				}
+				lineNo++
+				raw += "\n" + body
+			}
+			entry.EndLine = lineNo
+			entry.Quote = quote
+
+			value = sb.String()
+			if quote == '"' {
+				expanded, unresolved, err := expandValue(unescapeDoubleQuoted(value), vars, opts)
+				if err != nil {
+					return &parseError{Line: start, Key: key, Err: err}
+				}
+				value = expanded
+				entry.Unresolved = unresolved
+			}
+		} else {
+			expanded, unresolved, err := expandValue(stripInlineComment(rest), vars, opts)
+			if err != nil {
+				return &parseError{Line: start, Key: key, Err: err}
+			}
+			value = expanded
+			entry.Unresolved = unresolved
+		}
+
+		switch prev, defined := vars[key]; {
+		case mode == "":
+			delete(extending, key)
+		case defined:
+			value = joinPathList(prev, value, mode)
+		default:
+			extending[key] = mode
+		}
+		entry.Merge = extending[key]
+		entry.Value = value
+		entry.Raw = strings.TrimRight(raw, " \t")
+		if keep == nil || keep(key) {
+			vars[key] = value
+		}
+		if err := emit(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// isAllexportLine reports whether line toggles the shell's allexport option,
+// as in "set -a" ... "set +a" blocks around assignments.
+func isAllexportLine(line string) bool {
+	switch strings.Join(strings.Fields(stripInlineComment(line)), " ") {
+	case "set -a", "set +a", "set -o allexport", "set +o allexport":
+		return true
+	}
+	return false
+}
+
+// validateKey accepts the variable names godotenv does: letters and
+// numbers of any script, underscores and dots.
+func validateKey(key string) error {
+	if key == "" {
+		return errors.New("empty variable name")
+	}
+	for _, r := range key {
+		if !(r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsNumber(r)) {
+			return fmt.Errorf("unexpected character %q in variable name %q", r, key)
+		}
+	}
+	return nil
+}
+
+// closingQuote returns the index of the first unescaped quote in s, or -1.
+// Inside double quotes a backslash can itself be escaped, so only an odd
+// run of backslashes escapes the quote.
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		backslashes := 0
+		for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+			backslashes++
+		}
+		if backslashes == 0 || quote == '"' && backslashes%2 == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// stripInlineComment removes a trailing " # comment" from an unquoted value.
+func stripInlineComment(s string) string {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '#' && (s[i-1] == ' ' || s[i-1] == '\t') {
+			s = s[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// unescapeDoubleQuoted resolves \n and \r and drops the backslash from any
+// other escaped character, except \$ which is left for expandValue.
+func unescapeDoubleQuoted(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case '$':
+			sb.WriteString(`\$`)
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+func isVarNameChar(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isVarName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isVarNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// expandValue expands $VAR and ${VAR} from vars, keeps \$ as a literal
+// dollar and, when enabled, replaces $(command) with the command's output.
+// Unknown names expand to "" and are returned as unresolved.
+func expandValue(s string, vars map[string]string, opts parseOptions) (string, []string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil, nil
+	}
+
+	var unresolved []string
+	lookup := func(name string) string {
+		v, ok := vars[name]
+		if !ok && opts.ShellCompat {
+			v, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			unresolved = append(unresolved, name)
+		}
+		return v
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			sb.WriteByte('$')
+			i++
+			continue
+		}
+		if c != '$' || i+1 == len(s) {
+			sb.WriteByte(c)
+			continue
+		}
+
+		switch next := s[i+1]; {
+		case next == '(':
+			end := matchingParen(s, i+1)
+			if end < 0 {
+				sb.WriteByte(c)
+				continue
+			}
+			if !opts.ExecValues {
+				sb.WriteString(s[i : end+1])
+				i = end
+				continue
+			}
+			out, err := runValueCommand(s[i+2:end], vars, opts)
+			if err != nil {
+				return "", nil, err
+			}
+			sb.WriteString(out)
+			i = end
+		case next == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			name := ""
+			if end >= 0 {
+				name = s[i+2 : i+2+end]
+			}
+			if ref, def, ok := strings.Cut(name, ":-"); ok && opts.ShellCompat && isVarName(ref) {
+				v, found := vars[ref]
+				if !found {
+					v = os.Getenv(ref)
+				}
+				if v == "" {
+					v = def
+				}
+				sb.WriteString(v)
+				i += 2 + end
+				continue
+			}
+			if !isVarName(name) {
+				sb.WriteByte(c)
+				continue
+			}
+			sb.WriteString(lookup(name))
+			i += 2 + end
+		case isVarNameChar(next):
+			j := i + 1
+			for j < len(s) && isVarNameChar(s[j]) {
+				j++
+			}
+			sb.WriteString(lookup(s[i+1 : j]))
+			i = j - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), unresolved, nil
+}
+
+// matchingParen returns the index of the parenthesis closing the one at
+// open, or -1.
+func matchingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// runValueCommand executes a $(command) substitution through the system
+// shell with the variables parsed so far added to the environment. Trailing
+// newlines are trimmed as a POSIX shell would.
+func runValueCommand(command string, vars map[string]string, opts parseOptions) (string, error) {
+	if opts.Warn != nil {
+		opts.Warn(fmt.Sprintf("executing command substitution $(%s)", command))
+	}
+
+	timeout := opts.ExecTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = opts.Dir
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = time.Second
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command $(%s) timed out after %s", command, timeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("command $(%s) failed: %w", command, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// shellCommand runs command through the system shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	args := shellArgs(command)
+	return exec.CommandContext(ctx, args[0], args[1:]...)
+}
+
+// shellArgs returns the argv running command through the system shell.
+func shellArgs(command string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", command}
+	}
+	return []string{"sh", "-c", command}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestParseDotenv(t *testing.T) {
+	src := `# comment
+export EXPORTED=yes
+PLAIN = value # trailing comment
+YAML: style
+SINGLE='no $PLAIN expansion'
+DOUBLE="line1\nline2 ${PLAIN} $PLAIN \$PLAIN"
+MULTI="first
+second"
+HASH=a#b
+EMPTY=
+ÜBER_Ñ2=unicode
+`
+	entries, err := parseDotenv([]byte(src), parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := make(map[string]string)
+	for _, e := range entries {
+		env[e.Key] = e.Value
+	}
+
+	expected := map[string]string{
+		"EXPORTED": "yes",
+		"PLAIN":    "value",
+		"YAML":     "style",
+		"SINGLE":   "no $PLAIN expansion",
+		"DOUBLE":   "line1\nline2 value value $PLAIN",
+		"MULTI":    "first\nsecond",
+		"HASH":     "a#b",
+		"EMPTY":    "",
+		"ÜBER_Ñ2":  "unicode",
+	}
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, env[k])
+		}
+	}
+
+	last := entries[len(entries)-4]
+	if last.Key != "MULTI" || last.Line != 7 || last.EndLine != 8 {
+		t.Errorf("expected MULTI on lines 7-8, got %s on %d-%d", last.Key, last.Line, last.EndLine)
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	cases := []string{
+		"BAD KEY=value",
+		"UNTERMINATED=\"value",
+		"TRAILING=\"a\"b",
+		"TRAILING='a' b",
+		"TRAILING=\"a\nb\"c",
+		"no separator",
+	}
+	for _, src := range cases {
+		if _, err := parseDotenv([]byte(src), parseOptions{}); err == nil {
+			t.Errorf("expected error for %q", src)
+		}
+	}
+}
+
+func TestParseDotenvShellCompat(t *testing.T) {
+	t.Setenv("DENV_TEST_HOST", "example.com")
+
+	src := `set -a
+export PORT=8080
+URL="http://$DENV_TEST_HOST:$PORT"
+LEVEL=${DENV_TEST_UNSET:-info}
+NAME=${PORT:-none}
+export URL
+set +a
+`
+	if _, err := parseDotenv([]byte(src), parseOptions{}); err == nil {
+		t.Error("expected set -a to be rejected without shell-compat")
+	}
+
+	entries, err := parseDotenv([]byte(src), parseOptions{ShellCompat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := make(map[string]string)
+	for _, e := range entries {
+		env[e.Key] = e.Value
+	}
+
+	expected := map[string]string{
+		"PORT":  "8080",
+		"URL":   "http://example.com:8080",
+		"LEVEL": "info",
+		"NAME":  "8080",
+	}
+	if len(env) != len(expected) {
+		t.Errorf("expected %d entries, got %v", len(expected), env)
+	}
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, env[k])
+		}
+	}
+}
+
+func TestExecValues(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	if err := os.WriteFile(envFile, []byte("NAME=world\nGREETING=$(echo hello $NAME)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, allow := range []bool{false, true} {
+		var stderr bytes.Buffer
+		app, _ := newApp()
+		app.ErrWriter = &stderr
+		app.Action = func(c *cli.Context) error {
+			envMap, err := loadEnv(c)
+			if err != nil {
+				return err
+			}
+			expected := "$(echo hello $NAME)"
+			if allow {
+				expected = "hello world"
+			}
+			if envMap["GREETING"] != expected {
+				return fmt.Errorf("allow=%v: expected GREETING=%q, got %q", allow, expected, envMap["GREETING"])
+			}
+			return nil
+		}
+
+		args := []string{"denv", "--isolate", "--file", envFile}
+		if allow {
+			args = append(args, "--allow-exec-values")
+		}
+		if err := app.Run(args); err != nil {
+			t.Fatal(err)
+		}
+		if allow && !strings.Contains(stderr.String(), "Warning") {
+			t.Errorf("expected a security warning on stderr, got %q", stderr.String())
+		}
+	}
+}
+
+func TestExecValuesTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	opts := parseOptions{ExecValues: true, ExecTimeout: 50 * time.Millisecond}
+	if _, err := parseDotenv([]byte("SLOW=$(sleep 1)"), opts); err == nil {
+		t.Fatal("expected timeout error")
+	}
+}
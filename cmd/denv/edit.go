@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// formatValue quotes a value so that parseDotenv reads it back unchanged.
+// Simple values stay bare, values without quotes or backslashes are single
+// quoted, and everything else (including multiline values) is double quoted
+// with real newlines kept so PEM keys and JSON blobs stay readable.
+func formatValue(v string) string {
+	if v == "" {
+		return ""
+	}
+	if !strings.ContainsAny(v, " \t\r\n\"'\\$#`") {
+		return v
+	}
+	if !strings.ContainsAny(v, "'\\\r\n") {
+		return "'" + v + "'"
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range v {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '"':
+			sb.WriteString(`\"`)
+		case '$':
+			sb.WriteString(`\$`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func formatEntry(e envEntry, raw string) string {
+	prefix := ""
+	if e.Export {
+		prefix = "export "
+	}
+	op := "="
+	if e.Append {
+		op = "+="
+	}
+	return prefix + e.Key + op + raw
+}
+
+// setEnvValue replaces the assignment of key in src (all of its lines for
+// multiline values) or appends a new one, leaving the rest untouched.
+func setEnvValue(src []byte, key, value string) ([]byte, error) {
+	entries, err := parseDotenv(src, parseOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Key != key {
+			continue
+		}
+		replaced := append([]string{}, lines[:e.Line-1]...)
+		replaced = append(replaced, formatEntry(e, formatValue(value)))
+		replaced = append(replaced, lines[e.EndLine:]...)
+		return []byte(strings.Join(replaced, "\n") + "\n"), nil
+	}
+
+	lines = append(lines, key+"="+formatValue(value))
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// formatEnvFile normalizes a .env file: assignments become KEY=VALUE with
+// the value text kept verbatim (multiline values included), trailing
+// whitespace is removed and runs of blank lines are collapsed.
+func formatEnvFile(src []byte) ([]byte, error) {
+	entries, err := parseDotenv(src, parseOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+
+	var out []string
+	blank := true
+	next := 0
+	for i := 0; i < len(lines); i++ {
+		if next < len(entries) && entries[next].Line == i+1 {
+			e := entries[next]
+			raw := e.Raw
+			// Typed values written without expansions or inline comments
+			// are quoted and normalized for their type, e.g. JSON gets
+			// quoted and booleans become true or false.
+			if typ, ok := e.annotation("type"); ok && (raw == e.Value || e.Quote == '\'' && raw == "'"+e.Value+"'") {
+				if encoded, err := encodeValue(e.Value, typ, "dotenv"); err == nil {
+					raw = encoded
+				}
+			}
+			out = append(out, formatEntry(e, raw))
+			i = e.EndLine - 1
+			next++
+			blank = false
+			continue
+		}
+
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			if !blank {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		out = append(out, line)
+		blank = false
+	}
+
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
+
+// targetFile returns the file edited by set: the last -f file, since its
+// values take precedence, or .env when none was given. Only dotenv files
+// can be edited.
+func targetFile(c *cli.Context) (string, error) {
+	files := envFiles(c)
+	for i := len(files) - 1; i >= 0; i-- {
+		if files[i].Kind != sourceFile {
+			continue
+		}
+		if format := files[i].Format; format != "" && format != formatExports {
+			return "", fmt.Errorf("%s: cannot edit %s files", files[i].Path, format)
+		}
+		return files[i].Path, nil
+	}
+	return ".env", nil
+}
+
+func runSet(c *cli.Context) error {
+	key := c.Args().Get(0)
+	if key == "" {
+		return fmt.Errorf("key argument is required")
+	}
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	var value string
+	switch c.NArg() {
+	case 1:
+		data, err := io.ReadAll(c.App.Reader)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimSuffix(string(data), "\n")
+	case 2:
+		value = c.Args().Get(1)
+	default:
+		return fmt.Errorf("expected KEY [VALUE], got %d arguments", c.NArg())
+	}
+
+	path, err := targetFile(c)
+	if err != nil {
+		return err
+	}
+	src, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if src, err = decodeEnv(src, c.String("encoding")); err != nil {
+		return &fs.PathError{Op: "failed to decode", Path: path, Err: err}
+	}
+
+	// The value must match the key's denv:type annotation, or --type for
+	// a key that is not annotated; new keys get the annotation.
+	entries, err := parseDotenv(src, parseOptions{})
+	if err != nil {
+		return &fs.PathError{Op: "failed to parse", Path: path, Err: err}
+	}
+	typ, annotated, defined := c.String("type"), "", false
+	for _, e := range entries {
+		if e.Key == key {
+			defined = true
+			if t, ok := e.annotation("type"); ok {
+				annotated = t
+			}
+		}
+	}
+	switch {
+	case typ != "" && !slices.Contains(keyTypes, typ):
+		return fmt.Errorf("unknown type %q (expected %s)", typ, strings.Join(keyTypes, ", "))
+	case typ != "" && annotated != "" && typ != annotated:
+		return withExitCode(exitValidation, fmt.Errorf("%s is annotated as %s, not %s", key, annotated, typ))
+	case typ == "":
+		typ = annotated
+	}
+	if value, err = normalizeValue(value, typ); err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("%s: %w", key, err))
+	}
+	if !defined && c.String("type") != "" {
+		if len(src) > 0 && !bytes.HasSuffix(src, []byte("\n")) {
+			src = append(src, '\n')
+		}
+		src = append(src, "# denv:type="+typ+"\n"...)
+	}
+
+	updated, err := setEnvValue(src, key, value)
+	if err != nil {
+		return &fs.PathError{Op: "failed to parse", Path: path, Err: err}
+	}
+	return writeFileKeepMode(path, updated)
+}
+
+func runFmt(c *cli.Context) error {
+	paths := c.Args().Slice()
+	if len(paths) == 0 {
+		path, err := targetFile(c)
+		if err != nil {
+			return err
+		}
+		paths = []string{path}
+	}
+
+	var unformatted []string
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		decoded, err := decodeEnv(src, c.String("encoding"))
+		if err != nil {
+			return &fs.PathError{Op: "failed to decode", Path: path, Err: err}
+		}
+		formatted, err := formatEnvFile(decoded)
+		if err != nil {
+			return &fs.PathError{Op: "failed to parse", Path: path, Err: err}
+		}
+		if bytes.Equal(src, formatted) {
+			continue
+		}
+		if c.Bool("check") {
+			unformatted = append(unformatted, path)
+			continue
+		}
+		if err := writeFileKeepMode(path, formatted); err != nil {
+			return err
+		}
+	}
+
+	if len(unformatted) > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("not formatted: %s", strings.Join(unformatted, ", ")))
+	}
+	return nil
+}
+
+// writeFileKeepMode writes data to path, keeping the permissions of an
+// existing file and creating new files readable by the owner only.
+func writeFileKeepMode(path string, data []byte) error {
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return os.WriteFile(path, data, mode)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// decodeEnv converts env file content to UTF-8 without a byte order mark.
+// With "auto" (or "") the encoding is detected from the BOM, or for content
+// without one from its NUL bytes (see guessUTF16); anything else is used
+// as is.
+func decodeEnv(data []byte, encoding string) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "", "auto":
+		switch {
+		case bytes.HasPrefix(data, bomUTF16LE):
+			return decodeUTF16(data[2:], binary.LittleEndian)
+		case bytes.HasPrefix(data, bomUTF16BE):
+			return decodeUTF16(data[2:], binary.BigEndian)
+		}
+		if order, ok := guessUTF16(data); ok {
+			return decodeUTF16(data, order)
+		}
+		return bytes.TrimPrefix(data, bomUTF8), nil
+	case "utf-8", "utf8":
+		return bytes.TrimPrefix(data, bomUTF8), nil
+	case "utf-16le":
+		return decodeUTF16(bytes.TrimPrefix(data, bomUTF16LE), binary.LittleEndian)
+	case "utf-16be":
+		return decodeUTF16(bytes.TrimPrefix(data, bomUTF16BE), binary.BigEndian)
+	case "latin1", "iso-8859-1":
+		var buf bytes.Buffer
+		for _, b := range data {
+			buf.WriteRune(rune(b))
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %q (expected auto, utf-8, utf-16le, utf-16be or latin1)", encoding)
+}
+
+// guessUTF16 detects UTF-16 without a byte order mark. Text files never
+// contain NUL bytes, while the ASCII keys and punctuation of an env file
+// in UTF-16 put one in every other byte: the high byte, second in little
+// endian and first in big endian.
+func guessUTF16(data []byte) (binary.ByteOrder, bool) {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return nil, false
+	}
+	sample := data[:min(len(data), 1024)]
+	var evenNUL, oddNUL int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenNUL++
+		} else {
+			oddNUL++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case evenNUL == 0 && oddNUL*2 >= pairs:
+		return binary.LittleEndian, true
+	case oddNUL == 0 && evenNUL*2 >= pairs:
+		return binary.BigEndian, true
+	}
+	return nil, false
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, errors.New("invalid UTF-16 content: odd number of bytes")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+
+	var buf bytes.Buffer
+	for _, r := range utf16.Decode(units) {
+		buf.WriteRune(r)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestDecodeEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		encoding string
+		want     string
+	}{
+		{"utf-8 bom", []byte("\xEF\xBB\xBFKEY=v"), "auto", "KEY=v"},
+		{"utf-16le bom", []byte("\xFF\xFEK\x00=\x00\xE9\x00"), "auto", "K=é"},
+		{"utf-16be bom", []byte("\xFE\xFF\x00K\x00=\x00v"), "auto", "K=v"},
+		{"utf-16le explicit", []byte("K\x00=\x00v\x00"), "utf-16le", "K=v"},
+		{"latin1", []byte("K=\xE9"), "latin1", "K=é"},
+		{"utf-16le without bom", []byte("K\x00=\x00\xE9\x00"), "auto", "K=é"},
+		{"utf-16be without bom", []byte("\x00K\x00=\x00v"), "auto", "K=v"},
+		{"plain", []byte("K=v\r\n"), "auto", "K=v\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeEnv(tt.data, tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := decodeEnv([]byte("\xFF\xFEK"), "auto"); err == nil {
+		t.Error("expected error for truncated UTF-16")
+	}
+	if _, err := decodeEnv(nil, "ebcdic"); err == nil {
+		t.Error("expected error for unsupported encoding")
+	}
+}
+
+func TestLoadWindowsFile(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	// UTF-16LE with BOM and CRLF line endings, as saved by Notepad.
+	content := []byte{0xFF, 0xFE}
+	for _, r := range "PORT=8080\r\nHOST=localhost\r\n" {
+		content = append(content, byte(r), 0)
+	}
+	if err := os.WriteFile(envFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if envMap["PORT"] != "8080" || envMap["HOST"] != "localhost" {
+			return fmt.Errorf("expected clean keys and values, got %q", envMap)
+		}
+		return nil
+	}
+	if err := app.Run([]string{"denv", "--isolate", "--file", envFile}); err != nil {
+		t.Fatal(err)
+	}
+}
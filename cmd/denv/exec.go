@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+)
+
+func runExec(c *cli.Context) error {
+	args := c.Args().Slice()
+	if len(args) == 0 {
+		return fmt.Errorf("no command specified")
+	}
+
+	envMap, origins, err := loadEnvOrigins(c)
+	if err != nil {
+		return err
+	}
+	var masked []string
+	if c.Bool("mask-output") {
+		masked = maskedSecrets(c, envMap, origins)
+	}
+	// --trace-usage reports on the variables of the sources, not the
+	// inherited ones.
+	var traced []string
+	for k, origin := range origins {
+		if origin != sourceEnvironment {
+			traced = append(traced, k)
+		}
+	}
+	return execWithEnv(c, args, envMap, masked, traced)
+}
+
+// execWithEnv runs args with exactly the variables in envMap, applying the
+// exec flags defined on the current command, and exits with its status.
+// Occurrences of the masked values in the command's output are replaced
+// with ***. The command starts once the --wait-for dependencies are
+// reachable. The before_exec and after_exec hooks of the project config run
+// around the command. With --trace-usage, the lookups of the traced keys
+// are reported once the command exits.
+func execWithEnv(c *cli.Context, args []string, envMap map[string]string, masked, traced []string) error {
+	argBytes := 0
+	for _, arg := range args {
+		argBytes += len(arg) + 1
+	}
+	if problems := checkEnvSize(envMap, argBytes); len(problems) > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("environment exceeds OS limits:\n  %s", strings.Join(problems, "\n  ")))
+	}
+
+	var envFileTmp string
+	if c.Bool("env-file-tmp") {
+		var err error
+		envFileTmp, err = writeEnvFileTmp(envMap, c.String("env-file-format"))
+		if err != nil {
+			return err
+		}
+		defer os.Remove(envFileTmp)
+		envMap["DENV_ENV_FILE"] = envFileTmp
+	}
+
+	limits, err := parseResourceLimits(c)
+	if err != nil {
+		return err
+	}
+
+	// Dependencies must be up before the hooks, which may run migrations.
+	if err := waitForDependencies(c, envMap); err != nil {
+		return err
+	}
+
+	cfg := loadedConfig(c)
+	if err := runHooks(c, "before_exec", cfg.BeforeExec, envMap); err != nil {
+		return err
+	}
+
+	childEnv := envMap
+	if c.Bool("trace-usage") {
+		childEnv = maps.Clone(envMap)
+	}
+	tracer, err := startTrace(c, args[0], childEnv, traced)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = envSlice(childEnv)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	closeRedirects, err := applyRedirects(c, cmd, envMap)
+	if err != nil {
+		return err
+	}
+	defer closeRedirects()
+	flushMasked := maskOutput(cmd, masked)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sigChan)
+
+	go func() {
+		for sig := range sigChan {
+			if cmd.Process != nil {
+				cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	cleanupLimits, err := limitCommand(cmd, limits)
+	if err != nil {
+		return err
+	}
+	defer cleanupLimits()
+
+	if err := cmd.Start(); err != nil {
+		switch {
+		case errors.Is(err, exec.ErrNotFound), errors.Is(err, os.ErrNotExist):
+			return withExitCode(exitNotFound, fmt.Errorf("failed to start command: %w", err))
+		case errors.Is(err, os.ErrPermission):
+			return withExitCode(exitNotExecutable, fmt.Errorf("failed to start command: %w", err))
+		}
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	err = cmd.Wait()
+	if flushErr := flushMasked(); err == nil && flushErr != nil {
+		return flushErr
+	}
+	if tracer != nil {
+		if traceErr := tracer.finish(c); traceErr != nil {
+			fmt.Fprintf(c.App.ErrWriter, "denv: failed to read the usage trace: %v\n", traceErr)
+		}
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+	// A failing after_exec hook only changes the outcome when the command
+	// succeeded.
+	if hookErr := runHooks(c, "after_exec", cfg.AfterExec, afterExecEnv(envMap, exitErr)); hookErr != nil {
+		if exitErr == nil {
+			return hookErr
+		}
+		fmt.Fprintf(c.App.ErrWriter, "denv: %v\n", hookErr)
+	}
+	if exitErr == nil {
+		return nil
+	}
+
+	// A child killed by a signal has no exit status; follow the shell
+	// convention of 128+signal so the cause is not lost.
+	if sig, ok := terminationSignal(exitErr); ok {
+		fmt.Fprintf(c.App.ErrWriter, "denv: command terminated by signal %d (%v)\n", int(sig), sig)
+		if c.Bool("propagate-signal") {
+			signal.Stop(sigChan)
+			if envFileTmp != "" {
+				os.Remove(envFileTmp)
+			}
+			raiseSignal(sig)
+		}
+		return cli.Exit("", 128+int(sig))
+	}
+
+	return cli.Exit("", exitErr.ExitCode())
+}
+
+// envSlice converts envMap to the KEY=VALUE form expected by exec.Cmd. The
+// entries are slices of a single string to avoid an allocation per variable.
+func envSlice(envMap map[string]string) []string {
+	size := 0
+	for k, v := range envMap {
+		size += len(k) + len(v) + 1
+	}
+	var sb strings.Builder
+	sb.Grow(size)
+	ends := make([]int, 0, len(envMap))
+	for k, v := range envMap {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(v)
+		ends = append(ends, sb.Len())
+	}
+
+	all := sb.String()
+	env := make([]string, len(ends))
+	start := 0
+	for i, end := range ends {
+		env[i] = all[start:end]
+		start = end
+	}
+	return env
+}
+
+// maskOutput routes the command's stdout and stderr through writers that
+// mask the given values. The returned function writes output still held
+// back; it must be called after the command has exited.
+func maskOutput(cmd *exec.Cmd, masked []string) func() error {
+	if len(masked) == 0 {
+		return func() error { return nil }
+	}
+	stdout := newMaskWriter(cmd.Stdout, masked)
+	stderr := stdout
+	if cmd.Stderr != cmd.Stdout {
+		stderr = newMaskWriter(cmd.Stderr, masked)
+	}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return func() error {
+		return errors.Join(stdout.Flush(), stderr.Flush())
+	}
+}
+
+// writeEnvFileTmp writes env to a new temporary file readable by the owner
+// only and returns its path. The "docker" format writes raw KEY=VALUE lines
+// as docker --env-file expects, so it cannot represent multiline values.
+func writeEnvFileTmp(env map[string]string, format string) (string, error) {
+	var sb strings.Builder
+	for _, k := range sortedKeys(env) {
+		switch format {
+		case "dotenv":
+			sb.WriteString(k + "=" + formatValue(env[k]) + "\n")
+		case "docker":
+			if strings.ContainsAny(env[k], "\r\n") {
+				return "", fmt.Errorf("%s: multiline values are not supported by the docker env file format", k)
+			}
+			sb.WriteString(k + "=" + env[k] + "\n")
+		default:
+			return "", fmt.Errorf("unsupported --env-file-format %q (expected dotenv or docker)", format)
+		}
+	}
+
+	f, err := os.CreateTemp("", "denv-*.env")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(sb.String()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// applyRedirects points the command's standard streams at the files given
+// by --stdin, --stdout and --stderr. Paths may reference loaded variables
+// ($LOG_DIR/app.log). The returned function closes the opened files.
+func applyRedirects(c *cli.Context, cmd *exec.Cmd, envMap map[string]string) (func(), error) {
+	var opened []*os.File
+	closeAll := func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}
+	expand := func(path string) string {
+		return os.Expand(path, func(name string) string { return envMap[name] })
+	}
+
+	if path := c.String("stdin"); path != "" {
+		f, err := os.Open(expand(path))
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, f)
+		cmd.Stdin = f
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if c.Bool("append") {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	stdout := expand(c.String("stdout"))
+	if stdout != "" {
+		f, err := os.OpenFile(stdout, flags, 0644)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		opened = append(opened, f)
+		cmd.Stdout = f
+	}
+
+	if stderr := expand(c.String("stderr")); stderr != "" {
+		if stderr == stdout {
+			cmd.Stderr = cmd.Stdout
+			return closeAll, nil
+		}
+		f, err := os.OpenFile(stderr, flags, 0644)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		opened = append(opened, f)
+		cmd.Stderr = f
+	}
+
+	return closeAll, nil
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// terminationSignal always reports false: processes on this platform do not
+// terminate with a signal status.
+func terminationSignal(exitErr *exec.ExitError) (syscall.Signal, bool) {
+	return 0, false
+}
+
+func raiseSignal(sig syscall.Signal) {}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// captureExit replaces cli.OsExiter for the duration of a test and returns
+// a pointer to the last exit code passed to it.
+func captureExit(t *testing.T) *int {
+	t.Helper()
+	code := -1
+	orig := cli.OsExiter
+	cli.OsExiter = func(c int) { code = c }
+	t.Cleanup(func() { cli.OsExiter = orig })
+	return &code
+}
+
+func createExecApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "exec",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "propagate-signal"},
+				&cli.StringFlag{Name: "stdin"},
+				&cli.StringFlag{Name: "stdout"},
+				&cli.StringFlag{Name: "stderr"},
+				&cli.BoolFlag{Name: "append"},
+				&cli.IntFlag{Name: "nice"},
+				&cli.StringFlag{Name: "ionice"},
+				&cli.StringFlag{Name: "memory-limit"},
+				&cli.Float64Flag{Name: "cpu-limit"},
+				&cli.DurationFlag{Name: "cpu-time"},
+				&cli.Uint64Flag{Name: "max-open-files"},
+				&cli.BoolFlag{Name: "env-file-tmp"},
+				&cli.StringFlag{Name: "env-file-format", Value: "dotenv"},
+				&cli.BoolFlag{Name: "mask-output"},
+				&cli.BoolFlag{Name: "trace-usage"},
+				&cli.StringFlag{Name: "trace-report"},
+			},
+			Action: runExec,
+		},
+	}
+	return app
+}
+
+func TestExecExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	code := captureExit(t)
+	app := createExecApp()
+	app.Run([]string{"denv", "exec", "--", "sh", "-c", "exit 7"})
+	if *code != 7 {
+		t.Errorf("expected exit code 7, got %d", *code)
+	}
+}
+
+func TestExecSignalExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not supported on Windows")
+	}
+
+	code := captureExit(t)
+	var stderr bytes.Buffer
+	app := createExecApp()
+	app.ErrWriter = &stderr
+	app.Run([]string{"denv", "exec", "sh", "-c", "kill -TERM $$"})
+
+	if *code != 128+15 {
+		t.Errorf("expected exit code 143, got %d", *code)
+	}
+	if !strings.Contains(stderr.String(), "terminated by signal 15") {
+		t.Errorf("expected signal report on stderr, got %q", stderr.String())
+	}
+}
+
+func TestExecRedirects(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	if err := os.WriteFile(envFile, []byte("LOG_DIR="+tmpDir+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(input, []byte("from-stdin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	captureExit(t)
+	for i := 0; i < 2; i++ {
+		args := []string{"denv", "--file", envFile, "exec", "--stdin", input, "--stdout", "$LOG_DIR/out.log", "--stderr", "${LOG_DIR}/err.log"}
+		if i > 0 {
+			args = append(args, "--append")
+		}
+		args = append(args, "sh", "-c", "cat; echo oops >&2")
+		if err := createExecApp().Run(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, _ := os.ReadFile(filepath.Join(tmpDir, "out.log"))
+	if string(out) != "from-stdin\nfrom-stdin\n" {
+		t.Errorf("expected stdout to be written and appended, got %q", out)
+	}
+	errOut, _ := os.ReadFile(filepath.Join(tmpDir, "err.log"))
+	if string(errOut) != "oops\noops\n" {
+		t.Errorf("expected stderr to be written and appended, got %q", errOut)
+	}
+}
+
+func TestExecEnvTooLarge(t *testing.T) {
+	perVar, _ := envLimits()
+	if perVar == 0 {
+		t.Skip("no per-variable limit on this OS")
+	}
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := "SMALL=1\nHUGE=" + strings.Repeat("x", perVar) + "\n"
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := createExecApp()
+	err := app.Run([]string{"denv", "--isolate", "--no-parse-cache", "--file", envFile, "exec", "true"})
+	if exitCode(err) != exitValidation {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "HUGE is") || strings.Contains(err.Error(), "SMALL") {
+		t.Errorf("expected error naming HUGE only, got %v", err)
+	}
+}
+
+func TestExecEnvFileTmp(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	out := filepath.Join(tmpDir, "out")
+	if err := os.WriteFile(envFile, []byte("GREETING='hello world'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ format, want string }{
+		{"dotenv", "GREETING='hello world'\n"},
+		{"docker", "GREETING=hello world\n"},
+	} {
+		code := captureExit(t)
+		app := createExecApp()
+		script := `cat "$DENV_ENV_FILE" > ` + out + `; ls -l "$DENV_ENV_FILE" >> ` + out + `; echo "$DENV_ENV_FILE" >> ` + out
+		err := app.Run([]string{"denv", "--isolate", "-f", envFile, "exec", "--env-file-tmp", "--env-file-format", tt.format, "sh", "-c", script})
+		if err != nil || *code > 0 {
+			t.Fatalf("%s: exec failed: %v (exit %d)", tt.format, err, *code)
+		}
+
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if !strings.HasPrefix(string(data), tt.want) {
+			t.Errorf("%s: expected file to start with %q, got %q", tt.format, tt.want, data)
+		}
+		if !strings.HasPrefix(lines[len(lines)-2], "-rw-------") {
+			t.Errorf("%s: expected a 0600 file, got %q", tt.format, lines[len(lines)-2])
+		}
+		if _, err := os.Stat(lines[len(lines)-1]); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the temporary file to be removed", tt.format)
+		}
+	}
+}
+
+func BenchmarkEnvSlice(b *testing.B) {
+	envMap := make(map[string]string, 10000)
+	for i := 0; i < 10000; i++ {
+		envMap[fmt.Sprintf("GENERATED_KEY_%05d", i)] = fmt.Sprintf("value-%d-abcdefghijklmnopqrstuvwxyz", i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		envSlice(envMap)
+		checkEnvSize(envMap, 0)
+	}
+}
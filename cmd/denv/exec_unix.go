@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// terminationSignal reports the signal that killed the command, if any.
+func terminationSignal(exitErr *exec.ExitError) (syscall.Signal, bool) {
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return 0, false
+	}
+	return status.Signal(), true
+}
+
+// raiseSignal terminates denv with sig using the default disposition, so a
+// parent shell sees the same signal the command died from. It returns only
+// if the signal did not terminate the process.
+func raiseSignal(sig syscall.Signal) {
+	signal.Reset(sig)
+	if err := syscall.Kill(os.Getpid(), sig); err != nil {
+		return
+	}
+	// Give the kernel a moment to deliver the signal.
+	time.Sleep(100 * time.Millisecond)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes are part of denv's interface: scripts may branch on them, so
+// existing values must never change meaning.
+const (
+	exitFailure       = 1   // any other error
+	exitFileMissing   = 2   // a required env file does not exist
+	exitParseError    = 3   // an env file could not be parsed
+	exitValidation    = 4   // a check (doctor, fmt --check) failed
+	exitNotExecutable = 126 // exec: command found but not executable
+	exitNotFound      = 127 // exec: command not found
+)
+
+// exitCodeError attaches an explicit exit code to an error.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+func withExitCode(code int, err error) error {
+	return &exitCodeError{code: code, err: err}
+}
+
+// exitCode maps an error returned by a command to the process exit code.
+func exitCode(err error) int {
+	var coded *exitCodeError
+	var parseErr *parseError
+	switch {
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.As(err, &parseErr):
+		return exitParseError
+	case errors.Is(err, os.ErrNotExist):
+		return exitFileMissing
+	}
+	return exitFailure
+}
+
+// errorReport is the structured form of an error printed with
+// --error-format json. File, Line and Key are set when the error can be
+// attributed to them.
+type errorReport struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Key     string `json:"key,omitempty"`
+}
+
+func newErrorReport(err error) errorReport {
+	report := errorReport{Code: exitCode(err), Message: err.Error()}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		report.File = pathErr.Path
+	}
+	var parseErr *parseError
+	if errors.As(err, &parseErr) {
+		report.Line = parseErr.Line
+		report.Key = parseErr.Key
+	}
+	return report
+}
+
+// applyErrorFlags records --error-format for writeError and discards
+// error output and warnings with --quiet.
+func applyErrorFlags(c *cli.Context) error {
+	switch format := c.String("error-format"); format {
+	case "text", "json":
+		c.App.Metadata["error-format"] = format
+	default:
+		return fmt.Errorf("unsupported --error-format %q (expected text or json)", format)
+	}
+	if c.Bool("quiet") {
+		c.App.ErrWriter = io.Discard
+	}
+	return nil
+}
+
+// writeError prints err to w in the given format ("text" or "json").
+func writeError(w io.Writer, err error, format string) {
+	if format == "json" {
+		data, _ := json.Marshal(newErrorReport(err))
+		fmt.Fprintln(w, string(data))
+		return
+	}
+	fmt.Fprintf(w, "Error: %v\n", err)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestExitCodes(t *testing.T) {
+	tmpDir := t.TempDir()
+	bad := filepath.Join(tmpDir, "bad.env")
+	if err := os.WriteFile(bad, []byte("NOT VALID\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notExecutable := filepath.Join(tmpDir, "script.sh")
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"missing file", []string{"denv", "--file", filepath.Join(tmpDir, "missing.env"), "list"}, exitFileMissing},
+		{"parse error", []string{"denv", "--file", bad, "list"}, exitParseError},
+		{"fmt check", []string{"denv", "fmt", "--check", bad}, exitParseError},
+		{"command not found", []string{"denv", "exec", "denv-no-such-command"}, exitNotFound},
+		{"not executable", []string{"denv", "exec", notExecutable}, exitNotExecutable},
+	}
+
+	for _, tc := range cases {
+		app, _ := newApp()
+		app.Commands = []*cli.Command{
+			{Name: "list", Flags: []cli.Flag{&cli.StringFlag{Name: "output", Value: "text"}}, Action: runList},
+			{Name: "fmt", Flags: []cli.Flag{&cli.BoolFlag{Name: "check"}}, Action: runFmt},
+			{Name: "exec", Action: runExec},
+		}
+		app.Writer = io.Discard
+
+		err := app.Run(tc.args)
+		if err == nil {
+			t.Errorf("%s: expected error", tc.name)
+			continue
+		}
+		if got := exitCode(err); got != tc.code {
+			t.Errorf("%s: expected exit code %d, got %d (%v)", tc.name, tc.code, got, err)
+		}
+	}
+}
+
+func TestErrorReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	bad := filepath.Join(tmpDir, "bad.env")
+	if err := os.WriteFile(bad, []byte("A=1\nB=\"unterminated\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(tmpDir, "missing.env")
+
+	cases := []struct {
+		file string
+		want errorReport
+	}{
+		{bad, errorReport{Code: exitParseError, File: bad, Line: 2, Key: "B"}},
+		{missing, errorReport{Code: exitFileMissing, File: missing}},
+	}
+	for _, tc := range cases {
+		app, _ := newApp()
+		app.Commands = []*cli.Command{
+			{Name: "list", Flags: []cli.Flag{&cli.StringFlag{Name: "output", Value: "text"}}, Action: runList},
+		}
+		err := app.Run([]string{"denv", "--file", tc.file, "list"})
+		if err == nil {
+			t.Fatalf("%s: expected error", tc.file)
+		}
+
+		var buf bytes.Buffer
+		writeError(&buf, err, "json")
+		var got errorReport
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+		}
+		if got.Message != err.Error() {
+			t.Errorf("expected message %q, got %q", err.Error(), got.Message)
+		}
+		got.Message = ""
+		if got != tc.want {
+			t.Errorf("expected %+v, got %+v", tc.want, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	writeError(&buf, errors.New("boom"), "text")
+	if buf.String() != "Error: boom\n" {
+		t.Errorf("unexpected text error %q", buf.String())
+	}
+}
+
+// runReportingErrors runs app like main, returning what it wrote to stderr.
+func runReportingErrors(t *testing.T, app *cli.App, args ...string) string {
+	t.Helper()
+	var stderr bytes.Buffer
+	app.ErrWriter = &stderr
+	defer func(w io.Writer) { cli.ErrWriter = w }(cli.ErrWriter)
+	cli.ErrWriter = &stderr
+	exited := captureExit(t)
+	if err := app.Run(args); err != nil {
+		format, _ := app.Metadata["error-format"].(string)
+		writeError(app.ErrWriter, err, format)
+	}
+	if *exited != -1 {
+		t.Errorf("expected errors to be returned, but the app exited with %d", *exited)
+	}
+	return stderr.String()
+}
+
+func TestGetMissingKeyErrorFormat(t *testing.T) {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{{Name: "get", Action: runGet}}
+	out := runReportingErrors(t, app, "denv", "--isolate", "--error-format", "json", "get", "NOPE")
+	var report errorReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("expected a JSON error report, got %q", out)
+	}
+	if report != (errorReport{Code: exitFailure, Message: "key 'NOPE' not found"}) {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestGetMissingKeyQuiet(t *testing.T) {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{{Name: "get", Action: runGet}}
+	if out := runReportingErrors(t, app, "denv", "--isolate", "--quiet", "get", "NOPE"); out != "" {
+		t.Errorf("expected no error output with --quiet, got %q", out)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// File formats selected with a ?format= suffix on a file source. The
+// default is dotenv; exports is dotenv with --shell-compat, for files
+// written to be sourced by a shell.
+const (
+	formatDotenv     = "dotenv"
+	formatProperties = "properties"
+	formatINI        = "ini"
+	formatExports    = "exports"
+)
+
+var envFormats = []string{formatDotenv, formatProperties, formatINI, formatExports}
+
+// splitFormat separates a trailing ?format=NAME from a file path.
+func splitFormat(value string) (path, format string, err error) {
+	i := strings.LastIndex(value, "?format=")
+	if i < 0 {
+		return value, "", nil
+	}
+	path, format = value[:i], value[i+len("?format="):]
+	if !slices.Contains(envFormats, format) {
+		return "", "", fmt.Errorf("unsupported format %q (expected %s)", format, strings.Join(envFormats, ", "))
+	}
+	if format == formatDotenv {
+		format = ""
+	}
+	return path, format, nil
+}
+
+// formatSuffix returns the ?format= suffix selecting the parser of file, or
+// "" for dotenv.
+func formatSuffix(file EnvFile) string {
+	if file.Format == "" {
+		return ""
+	}
+	return "?format=" + file.Format
+}
+
+// parseEnvFormat parses file content in the format selected by opts.
+func parseEnvFormat(src []byte, opts parseOptions) ([]envEntry, error) {
+	switch opts.Format {
+	case formatProperties:
+		return parseProperties(src)
+	case formatINI:
+		return parseINI(src)
+	case formatExports:
+		opts.ShellCompat = true
+	}
+	return parseDotenv(src, opts)
+}
+
+// envKey joins name parts into an environment variable name: upper case,
+// with every character that is not a letter, digit or underscore replaced
+// by an underscore, so db.host and [db] host both become DB_HOST.
+func envKey(parts ...string) string {
+	key := strings.ToUpper(strings.Join(parts, "_"))
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// parseProperties parses a Java .properties file: "key=value", "key:
+// value" or "key value" pairs, # and ! comments, backslash line
+// continuations and escapes including \uXXXX. Keys are converted with
+// envKey.
+func parseProperties(src []byte) ([]envEntry, error) {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	var entries []envEntry
+	var comments []string
+	for i := 0; i < len(lines); i++ {
+		start := i + 1
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" {
+			comments = nil
+			continue
+		}
+		if line[0] == '#' || line[0] == '!' {
+			comments = append(comments, strings.TrimSpace(line[1:]))
+			continue
+		}
+		for continued(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+
+		// The key ends at the first unescaped separator or whitespace.
+		end := 0
+		for end < len(line) && !strings.ContainsRune("=: \t\f", rune(line[end])) {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		end = min(end, len(line))
+		rest := strings.TrimLeft(line[end:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+
+		name, err := unescapeProperty(line[:end])
+		if err == nil && name == "" {
+			err = errors.New("empty key")
+		}
+		if err != nil {
+			return nil, &parseError{Line: start, Err: err}
+		}
+		key := envKey(name)
+		value, err := unescapeProperty(rest)
+		if err != nil {
+			return nil, &parseError{Line: start, Key: key, Err: err}
+		}
+		entries = append(entries, envEntry{Key: key, Value: value, Line: start, EndLine: i + 1, Raw: rest, Comments: comments})
+		comments = nil
+	}
+	return entries, nil
+}
+
+// continued reports whether a properties line ends with an odd number of
+// backslashes, which joins it with the next line.
+func continued(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("invalid \\u escape %q", s[i-1:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid \\u escape %q", s[i-1:i+5])
+			}
+			sb.WriteRune(rune(r))
+			i += 4
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// parseINI parses an INI file. Keys are prefixed with their section, so
+// "host" in [db] becomes DB_HOST; keys before the first section have no
+// prefix. Comments start with ; or #, also after a value when preceded by
+// whitespace, and values may be quoted.
+func parseINI(src []byte) ([]envEntry, error) {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	var entries []envEntry
+	var comments []string
+	section := ""
+	for i, line := range lines {
+		lineNo := i + 1
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			comments = nil
+			continue
+		case line[0] == ';' || line[0] == '#':
+			comments = append(comments, strings.TrimSpace(line[1:]))
+			continue
+		case line[0] == '[':
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				return nil, &parseError{Line: lineNo, Err: fmt.Errorf("unterminated section header %q", line)}
+			}
+			section = strings.TrimSpace(line[1:end])
+			comments = nil
+			continue
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep <= 0 {
+			return nil, &parseError{Line: lineNo, Err: fmt.Errorf("expected key = value, got %q", line)}
+		}
+		name := strings.TrimSpace(line[:sep])
+		key := envKey(name)
+		if section != "" {
+			key = envKey(section, name)
+		}
+		raw := strings.TrimSpace(line[sep+1:])
+		value := raw
+		var quote byte
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			quote = value[0]
+			end := strings.IndexByte(value[1:], quote)
+			if end < 0 {
+				return nil, &parseError{Line: lineNo, Key: key, Err: errors.New("unterminated quoted value")}
+			}
+			value = value[1 : end+1]
+		} else {
+			for _, marker := range []string{" ;", "\t;", " #", "\t#"} {
+				if j := strings.Index(value, marker); j >= 0 {
+					value = strings.TrimSpace(value[:j])
+				}
+			}
+		}
+		entries = append(entries, envEntry{Key: key, Value: value, Line: lineNo, EndLine: lineNo, Quote: quote, Raw: raw, Comments: comments})
+		comments = nil
+	}
+	return entries, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func entryValues(entries []envEntry) map[string]string {
+	env := make(map[string]string)
+	for _, e := range entries {
+		env[e.Key] = e.Value
+	}
+	return env
+}
+
+func TestParseProperties(t *testing.T) {
+	src := "# Database\n" +
+		"db.url = jdbc:postgresql://localhost/app\n" +
+		"! legacy comment\n" +
+		"db.user:admin\n" +
+		"app-name   Demo App\n" +
+		"greeting=Hello \\\n" +
+		"    World\n" +
+		"path=C:\\\\data\\tlogs\n" +
+		"unicode=caf\\u00e9\n" +
+		"empty=\n"
+	entries, err := parseProperties([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"DB_URL":   "jdbc:postgresql://localhost/app",
+		"DB_USER":  "admin",
+		"APP_NAME": "Demo App",
+		"GREETING": "Hello World",
+		"PATH":     "C:\\data\tlogs",
+		"UNICODE":  "café",
+		"EMPTY":    "",
+	}
+	if got := entryValues(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if e := entries[3]; e.Line != 6 || e.EndLine != 7 {
+		t.Errorf("expected GREETING on lines 6-7, got %d-%d", e.Line, e.EndLine)
+	}
+	if !reflect.DeepEqual(entries[0].Comments, []string{"Database"}) {
+		t.Errorf("unexpected comments %q", entries[0].Comments)
+	}
+
+	if _, err := parseProperties([]byte("a=1\nbad=\\u12\n")); err == nil || err.Error() != `line 2: BAD: invalid \u escape "\\u12"` {
+		t.Errorf("expected an escape error, got %v", err)
+	}
+}
+
+func TestParseINI(t *testing.T) {
+	src := "; global settings\n" +
+		"debug = true\n" +
+		"\n" +
+		"[db]\n" +
+		"host = localhost ; primary\n" +
+		"password = \"p;ss # word\"\n" +
+		"\n" +
+		"[cache.redis]\n" +
+		"# comment\n" +
+		"url: redis://localhost:6379\n"
+	entries, err := parseINI([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"DEBUG":           "true",
+		"DB_HOST":         "localhost",
+		"DB_PASSWORD":     "p;ss # word",
+		"CACHE_REDIS_URL": "redis://localhost:6379",
+	}
+	if got := entryValues(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	for _, tt := range []struct{ src, err string }{
+		{"[db\nhost=x\n", `line 1: unterminated section header "[db"`},
+		{"[db]\nhost\n", `line 2: expected key = value, got "host"`},
+		{"[db]\nhost='x\n", "line 2: DB_HOST: unterminated quoted value"},
+	} {
+		if _, err := parseINI([]byte(tt.src)); err == nil || err.Error() != tt.err {
+			t.Errorf("expected %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestFileFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"app.env":        "DB_HOST=from-env\nNAME=app\n",
+		"app.properties": "db.host=from-properties\ndb.port=5432\n",
+		"app.ini":        "[db]\nhost = from-ini\nuser = admin\n",
+		"app.sh":         "set -a\nexport HOME_DIR=${HOME_DIR:-/srv}\nset +a\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmpDir)
+
+	app, sources := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		want := map[string]string{
+			"DB_HOST":  "from-ini",
+			"DB_PORT":  "5432",
+			"DB_USER":  "admin",
+			"NAME":     "app",
+			"HOME_DIR": "/srv",
+		}
+		if !reflect.DeepEqual(envMap, want) {
+			t.Errorf("expected %q, got %q", want, envMap)
+		}
+		return nil
+	}
+	args := []string{"denv", "--isolate",
+		"-f", "app.env?format=dotenv",
+		"-f", "app.properties?format=properties",
+		"-f", "app.ini?format=ini",
+		"-f", "app.sh?format=exports",
+	}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*sources)[2].String(); got != "app.ini?format=ini" {
+		t.Errorf("unexpected source %q", got)
+	}
+
+	app, _ = newApp()
+	err := app.Run([]string{"denv", "-f", "app.yaml?format=yaml"})
+	if err == nil || err.Error() != `invalid value "app.yaml?format=yaml" for flag -f: unsupported format "yaml" (expected dotenv, properties, ini, exports)` {
+		t.Errorf("expected an unsupported format error, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+// sourceGit is an env file read from a git repository at a pinned ref,
+// given as -f git::<repo>//<path>?ref=<ref>.
+const sourceGit = "git"
+
+// gitMu serializes fetches, since sources from the same repository share
+// its cache.
+var gitMu sync.Mutex
+
+// gitSource is a parsed git:: source.
+type gitSource struct {
+	Repo string
+	File string
+	// Ref is a branch, tag or commit; "" is the default branch.
+	Ref string
+}
+
+// parseGitSource parses the part of a git:: source after the prefix, as
+// in git@github.com:org/config.git//apps/api/.env?ref=v1.2.0. The query
+// may also set the file format.
+func parseGitSource(value string) (src gitSource, format string, err error) {
+	rest, query, _ := strings.Cut(value, "?")
+	// The file path follows the first // after the scheme of the repo URL.
+	start := 0
+	if i := strings.Index(rest, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(rest[start:], "//")
+	if i < 0 {
+		return src, "", fmt.Errorf("invalid git source %q (expected git::<repo>//<path>[?ref=<ref>])", value)
+	}
+	src.Repo, src.File = rest[:start+i], strings.Trim(rest[start+i+2:], "/")
+	if src.Repo == "" || src.File == "" {
+		return src, "", fmt.Errorf("invalid git source %q (expected git::<repo>//<path>[?ref=<ref>])", value)
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return src, "", fmt.Errorf("invalid git source %q: %w", value, err)
+	}
+	for key := range params {
+		switch key {
+		case "ref":
+			src.Ref = params.Get(key)
+		case "format":
+			format = params.Get(key)
+		default:
+			return src, "", fmt.Errorf("invalid git source %q: unknown parameter %q", value, key)
+		}
+	}
+	return src, format, nil
+}
+
+// String returns the source without the git:: prefix.
+func (s gitSource) String() string {
+	if s.Ref == "" {
+		return s.Repo + "//" + s.File
+	}
+	return s.Repo + "//" + s.File + "?ref=" + s.Ref
+}
+
+// gitFileSource turns a --file value starting with git:: into a source.
+func gitFileSource(value string) (EnvFile, bool, error) {
+	spec, ok := strings.CutPrefix(value, "git::")
+	if !ok {
+		return EnvFile{}, false, nil
+	}
+	src, format, err := parseGitSource(spec)
+	if err != nil {
+		return EnvFile{}, false, err
+	}
+	if format != "" {
+		if _, format, err = splitFormat("?format=" + format); err != nil {
+			return EnvFile{}, false, err
+		}
+	}
+	return EnvFile{Path: src.String(), Kind: sourceGit, Format: format}, true, nil
+}
+
+// gitRepoDir returns the bare repository caching fetches of repo.
+func gitRepoDir(dir, repo string) string {
+	sum := sha256.Sum256([]byte(repo))
+	return filepath.Join(dir, "git", hex.EncodeToString(sum[:8])+".git")
+}
+
+// localRef returns the local ref a source's ref is fetched into.
+func (s gitSource) localRef() string {
+	sum := sha256.Sum256([]byte(s.Ref))
+	return "refs/denv/" + hex.EncodeToString(sum[:8])
+}
+
+// fetchGitRev fetches the pinned ref of src and returns the bare
+// repository in the cache dir and the revision to read files from. The ref
+// is shallowly fetched; if that fails, the last fetched commit is used with
+// a warning, so pinned sources keep working offline.
+func (r *sourceReader) fetchGitRev(ctx context.Context, src gitSource) (repoDir, rev string, err error) {
+	dir, err := cacheDir(r.c)
+	if err != nil {
+		return "", "", err
+	}
+	repoDir = gitRepoDir(dir, src.Repo)
+
+	gitMu.Lock()
+	defer gitMu.Unlock()
+	if _, err := os.Stat(repoDir); err != nil {
+		if err := os.MkdirAll(filepath.Dir(repoDir), 0700); err != nil {
+			return "", "", err
+		}
+		if _, err := git("init", "--quiet", "--bare", repoDir); err != nil {
+			return "", "", err
+		}
+	}
+
+	// A full commit id cannot move, so a fetched one is never fetched again.
+	if isCommitID(src.Ref) && !r.c.Bool("refresh") {
+		if _, err := gitInContext(ctx, repoDir, "cat-file", "-e", src.Ref+"^{commit}"); err == nil {
+			return repoDir, src.Ref, nil
+		}
+	}
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	local := src.localRef()
+	if _, err := gitInContext(ctx, repoDir, "fetch", "--quiet", "--depth", "1", "--no-tags", src.Repo, "+"+ref+":"+local); err != nil {
+		if _, cached := gitIn(repoDir, "rev-parse", "--verify", "--quiet", local); cached != nil {
+			return "", "", err
+		}
+		r.warnf("%s: %v; using the last fetched commit", src, err)
+	}
+	return repoDir, local, nil
+}
+
+// gitShow returns the content of path at rev.
+func gitShow(ctx context.Context, repoDir, rev, path string) ([]byte, error) {
+	data, err := gitInContext(ctx, repoDir, "show", rev+":"+path)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s not found at the fetched ref: %w", path, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+// isCommitID reports whether ref is a full SHA-1 or SHA-256 commit id.
+func isCommitID(ref string) bool {
+	if len(ref) != 40 && len(ref) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(ref)
+	return err == nil
+}
+
+// readGit reads an env file from a git source. Like object sources, it
+// never runs command substitution.
+func (r *sourceReader) readGit(ctx context.Context, file EnvFile) (map[string]string, error) {
+	src, _, err := parseGitSource(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	repoDir, rev, err := r.fetchGitRev(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	data, err := gitShow(ctx, repoDir, rev, src.File)
+	if err != nil {
+		return nil, err
+	}
+	if file.Verify != "" {
+		signature := func(suffix string) ([]byte, error) {
+			return gitShow(ctx, repoDir, rev, src.File+suffix)
+		}
+		if err := verifySource(r.c, file, data, signature); err != nil {
+			return nil, err
+		}
+	}
+	opts := r.parseOptions(file.String())
+	opts.ExecValues = false
+	opts.Format = file.Format
+	if data, err = decodeEnv(data, opts.Encoding); err != nil {
+		return nil, err
+	}
+	entries, err := parseEnvFormat(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string, len(entries))
+	for _, e := range entries {
+		env[e.Key] = e.Value
+	}
+	return env, nil
+}
+
+// gitFormatParam returns the query parameter selecting the format of a git
+// source, to append to its String.
+func gitFormatParam(file EnvFile) string {
+	if file.Format == "" {
+		return ""
+	}
+	if strings.Contains(file.Path, "?") {
+		return "&format=" + file.Format
+	}
+	return "?format=" + file.Format
+}
+
+// gitCacheStatus describes the last fetched commit of a git source.
+func gitCacheStatus(c *cli.Context, file EnvFile) string {
+	src, _, err := parseGitSource(file.Path)
+	if err != nil {
+		return ""
+	}
+	dir, err := cacheDir(c)
+	if err != nil {
+		return ""
+	}
+	rev := src.localRef()
+	if isCommitID(src.Ref) {
+		rev = src.Ref
+	}
+	commit, err := gitIn(gitRepoDir(dir, src.Repo), "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return ", not fetched"
+	}
+	return ", fetched commit " + strings.TrimSpace(string(commit))[:12]
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGitSource(t *testing.T) {
+	for _, tt := range []struct {
+		value, repo, file, ref, format string
+	}{
+		{"git@github.com:org/config.git//apps/api/.env?ref=v1.2.0", "git@github.com:org/config.git", "apps/api/.env", "v1.2.0", ""},
+		{"https://github.com/org/config.git//api.ini?ref=main&format=ini", "https://github.com/org/config.git", "api.ini", "main", "ini"},
+		{"file:///srv/config//.env", "file:///srv/config", ".env", "", ""},
+	} {
+		src, format, err := parseGitSource(tt.value)
+		if err != nil || src.Repo != tt.repo || src.File != tt.file || src.Ref != tt.ref || format != tt.format {
+			t.Errorf("%s: got %+v %q %v", tt.value, src, format, err)
+		}
+	}
+	for _, value := range []string{"git@github.com:org/config.git", "https://github.com/org/config.git//", "repo//.env?branch=main"} {
+		if _, _, err := parseGitSource(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestReadGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	gitRun := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(content, tag string) string {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(repo, "apps"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repo, "apps", "api.env"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitRun("add", ".")
+		gitRun("commit", "-q", "-m", tag)
+		gitRun("tag", tag)
+		return gitRun("rev-parse", "HEAD")
+	}
+	gitRun("init", "-q")
+	first := commit("PORT=80\n", "v1")
+	commit("PORT=8080\n", "v2")
+
+	cache := filepath.Join(t.TempDir(), "cache")
+	list := func(source string) (string, error) {
+		var buf bytes.Buffer
+		app := createRunApp()
+		app.Writer = &buf
+		err := app.Run([]string{"denv", "--isolate", "--cache-dir", cache, "-f", source, "list"})
+		return buf.String(), err
+	}
+	url := "git::file://" + repo + "//apps/api.env"
+	for _, tt := range []struct{ ref, want string }{
+		{"?ref=v1", "PORT=80\n"},
+		{"?ref=v2", "PORT=8080\n"},
+		{"", "PORT=8080\n"},
+		{"?ref=" + first, "PORT=80\n"},
+	} {
+		out, err := list(url + tt.ref)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.ref, err)
+		}
+		if out != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.ref, tt.want, out)
+		}
+	}
+
+	// Fetched refs keep working when the repository is unreachable.
+	if err := os.RemoveAll(repo); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := list(url + "?ref=v1"); err != nil || out != "PORT=80\n" {
+		t.Errorf("expected the cached commit, got %q (%v)", out, err)
+	}
+	if _, err := list(url + "?ref=v3"); err == nil {
+		t.Error("expected an error for a ref that was never fetched")
+	}
+}
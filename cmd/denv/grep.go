@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/urfave/cli/v2"
+)
+
+// grepMatch is a key found by grep and where it is defined.
+type grepMatch struct {
+	Location string
+	Key      string
+	Value    string
+	Secret   bool
+}
+
+// grepSources searches keys and values of all sources. Files are searched
+// as written, so references such as vault: values can be found too; other
+// sources are searched by their loaded values.
+func grepSources(c *cli.Context, re *regexp.Regexp, masks []string) ([]grepMatch, error) {
+	files := envFiles(c)
+	var remote []EnvFile
+	for _, file := range files {
+		if file.Kind != sourceFile {
+			remote = append(remote, file)
+		}
+	}
+	reader := &sourceReader{c: c}
+	results, errs := reader.readAll(remote)
+	loaded := make(map[EnvFile]map[string]string, len(remote))
+	for i, file := range remote {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", file, errs[i])
+		}
+		loaded[file] = results[i]
+	}
+
+	var matches []grepMatch
+	add := func(location, key, value string, secret bool) {
+		if re.MatchString(key) || re.MatchString(value) {
+			matches = append(matches, grepMatch{Location: location, Key: key, Value: value, Secret: secret})
+		}
+	}
+	for _, file := range files {
+		if file.Kind != sourceFile {
+			env := loaded[file]
+			for _, k := range sortedKeys(env) {
+				add(file.String(), k, env[k], file.Kind == sourceVault || file.Kind == sourceK8sSecret || file.Kind == sourceOnePassword || looksSecret(k, env[k], masks))
+			}
+			continue
+		}
+		for _, e := range fileEntries(c, file) {
+			secret, ok := secretAnnotation(e)
+			if !ok {
+				secret = looksSecret(e.Key, e.Value, masks)
+			}
+			add(fmt.Sprintf("%s:%d", file.Path, e.Line), e.Key, e.Value, secret)
+		}
+	}
+	return matches, nil
+}
+
+func runGrep(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("expected exactly one pattern, got %d arguments", c.NArg())
+	}
+	expr := c.Args().First()
+	if c.Bool("ignore-case") {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	var masks []string
+	if !c.Bool("no-mask") {
+		masks = c.StringSlice("mask")
+	}
+	matches, err := grepSources(c, re, masks)
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		value := m.Value
+		if m.Secret && masks != nil {
+			value = maskedValue
+		}
+		fmt.Fprintf(c.App.Writer, "%s:%s=%s\n", m.Location, m.Key, value)
+	}
+	if len(matches) == 0 {
+		return withExitCode(exitFailure, fmt.Errorf("no matches for %s", c.Args().First()))
+	}
+	return nil
+}
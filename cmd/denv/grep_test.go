@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func runGrepOutput(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "grep",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "ignore-case", Aliases: []string{"i"}},
+				&cli.StringSliceFlag{Name: "mask", Value: cli.NewStringSlice(defaultSecretKeys...)},
+				&cli.BoolFlag{Name: "no-mask"},
+			},
+			Action: runGrep,
+		},
+	}
+
+	var buf bytes.Buffer
+	app.Writer = &buf
+	err := app.Run(append([]string{"denv"}, args...))
+	return buf.String(), err
+}
+
+func TestGrep(t *testing.T) {
+	tmpDir := t.TempDir()
+	base := filepath.Join(tmpDir, "base.env")
+	local := filepath.Join(tmpDir, "local.env")
+	content := `API_URL=https://api.example.com
+API_TOKEN=https://api.example.com/s3cr3t
+# denv:secret
+WEBHOOK=https://hooks.example.com/abc
+PORT=8080
+`
+	if err := os.WriteFile(base, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, []byte("\nAPI_URL=http://localhost:8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runGrepOutput(t, "-f", base, "-f", local, "grep", "EXAMPLE.COM")
+	if exitCode(err) != exitFailure {
+		t.Errorf("expected exit code 1 without matches, got %v", err)
+	}
+
+	out, err := runGrepOutput(t, "-f", base, "-f", local, "grep", "-i", "EXAMPLE.COM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := base + ":1:API_URL=https://api.example.com\n" +
+		base + ":2:API_TOKEN=***\n" +
+		base + ":4:WEBHOOK=***\n"
+	if out != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+
+	out, err = runGrepOutput(t, "-f", base, "-f", local, "grep", "--no-mask", "^API_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = base + ":1:API_URL=https://api.example.com\n" +
+		base + ":2:API_TOKEN=https://api.example.com/s3cr3t\n" +
+		local + ":2:API_URL=http://localhost:8080\n"
+	if out != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// grpcWatchPath is the route of the Watch method of the denv.v1.Env gRPC
+// service described by proto/denv/v1/env.proto.
+const grpcWatchPath = "/denv.v1.Env/Watch"
+
+// gRPC status codes sent in the Grpc-Status trailer.
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcInternal        = 13
+	grpcUnauthenticated = 16
+)
+
+// grpcError fails a call with a trailers-only response: gRPC clients expect
+// HTTP 200 with the status in Grpc-Status, not an HTTP error code.
+func grpcError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", grpcMessage(msg))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcMessage percent-encodes msg for the Grpc-Message header.
+func grpcMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// appendProtoBytes appends a length-delimited protobuf field.
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// marshalWatchEvent encodes a denv.v1.WatchEvent: changed keys (field 1, a
+// map<string, string>), removed keys (field 2) and an error (field 3).
+func marshalWatchEvent(change envChange, err error) []byte {
+	var b []byte
+	for _, k := range sortedKeys(change.Changed) {
+		var entry []byte
+		entry = appendProtoBytes(entry, 1, []byte(k))
+		entry = appendProtoBytes(entry, 2, []byte(change.Changed[k]))
+		b = appendProtoBytes(b, 1, entry)
+	}
+	for _, k := range change.Removed {
+		b = appendProtoBytes(b, 2, []byte(k))
+	}
+	if err != nil {
+		b = appendProtoBytes(b, 3, []byte(err.Error()))
+	}
+	return b
+}
+
+// grpcFrame prefixes an uncompressed message with its length, as gRPC
+// frames messages on the HTTP/2 stream.
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// serveGRPCWatch implements the server stream of Env.Watch over HTTP/2:
+// the same events as /watch, one WatchEvent message each. The request
+// message is empty and ignored.
+func serveGRPCWatch(w http.ResponseWriter, r *http.Request, load func() (map[string]string, error), interval time.Duration) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		grpcError(w, grpcInvalidArgument, "gRPC requires HTTP/2 and application/grpc")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		grpcError(w, grpcInternal, "streaming not supported")
+		return
+	}
+	io.Copy(io.Discard, r.Body)
+
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Trailer", "Grpc-Status")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	pollChanges(r.Context(), load, interval, func(change envChange, err error) {
+		w.Write(grpcFrame(marshalWatchEvent(change, err)))
+		flusher.Flush()
+	})
+	// The stream only ends when the client cancels it.
+	w.Header().Set("Grpc-Status", strconv.Itoa(grpcOK))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// readProtoFields splits a protobuf message of length-delimited fields.
+func readProtoFields(t *testing.T, msg []byte) (fields []int, values [][]byte) {
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		size, m := binary.Uvarint(msg[n:])
+		if n <= 0 || m <= 0 || tag&7 != 2 || uint64(len(msg)-n-m) < size {
+			t.Fatalf("malformed message %x", msg)
+		}
+		fields = append(fields, int(tag>>3))
+		values = append(values, msg[n+m:n+m+int(size)])
+		msg = msg[n+m+int(size):]
+	}
+	return fields, values
+}
+
+func TestMarshalWatchEvent(t *testing.T) {
+	msg := marshalWatchEvent(envChange{Changed: map[string]string{"PORT": "9090"}, Removed: []string{"DEBUG"}}, nil)
+	fields, values := readProtoFields(t, msg)
+	if len(fields) != 2 || fields[0] != 1 || fields[1] != 2 || string(values[1]) != "DEBUG" {
+		t.Fatalf("unexpected fields %v %q", fields, values)
+	}
+	entryFields, entry := readProtoFields(t, values[0])
+	if len(entryFields) != 2 || string(entry[0]) != "PORT" || string(entry[1]) != "9090" {
+		t.Errorf("unexpected map entry %q", entry)
+	}
+
+	fields, values = readProtoFields(t, marshalWatchEvent(envChange{}, io.ErrUnexpectedEOF))
+	if len(fields) != 1 || fields[0] != 3 || string(values[0]) != io.ErrUnexpectedEOF.Error() {
+		t.Errorf("expected an error field, got %v %q", fields, values)
+	}
+}
+
+func TestServeGRPCWatch(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		srv := httptest.NewUnstartedServer(newServeHandler(c, serveOptions{Token: "s3cret", WatchInterval: 20 * time.Millisecond}))
+		srv.Config.Protocols = new(http.Protocols)
+		srv.Config.Protocols.SetUnencryptedHTTP2(true)
+		srv.Start()
+		defer srv.Close()
+
+		transport := &http.Transport{Protocols: new(http.Protocols)}
+		transport.Protocols.SetUnencryptedHTTP2(true)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		call := func(token, contentType string) (*http.Response, error) {
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+grpcWatchPath, bytes.NewReader(grpcFrame(nil)))
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("Authorization", "Bearer "+token)
+			return (&http.Client{Transport: transport}).Do(req)
+		}
+
+		// Failed calls are trailers-only responses with a gRPC status.
+		for _, tc := range []struct {
+			token, contentType string
+			status             string
+		}{
+			{"wrong", "application/grpc", "16"},
+			{"s3cret", "application/json", "3"},
+		} {
+			resp, err := call(tc.token, tc.contentType)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != tc.status {
+				t.Errorf("%s with %s: expected grpc-status %s, got %d %q", tc.token, tc.contentType, tc.status, resp.StatusCode, resp.Header.Get("Grpc-Status"))
+			}
+		}
+
+		resp, err := call("s3cret", "application/grpc")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/grpc+proto" {
+			t.Fatalf("unexpected response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+
+		nextEvent := func() []byte {
+			header := make([]byte, 5)
+			if _, err := io.ReadFull(resp.Body, header); err != nil {
+				t.Fatal(err)
+			}
+			msg := make([]byte, binary.BigEndian.Uint32(header[1:]))
+			if _, err := io.ReadFull(resp.Body, msg); err != nil {
+				t.Fatal(err)
+			}
+			return msg
+		}
+
+		if got, expected := nextEvent(), marshalWatchEvent(envChange{Changed: map[string]string{"PORT": "8080"}}, nil); !bytes.Equal(got, expected) {
+			t.Errorf("expected the initial environment, got %x", got)
+		}
+		if err := os.WriteFile(envFile, []byte("PORT=9090\n"), 0644); err != nil {
+			return err
+		}
+		if got, expected := nextEvent(), marshalWatchEvent(envChange{Changed: map[string]string{"PORT": "9090"}}, nil); !bytes.Equal(got, expected) {
+			t.Errorf("expected the PORT change, got %x", got)
+		}
+		return nil
+	}
+
+	if err := app.Run([]string{"denv", "--isolate", "--file", envFile}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// gitCommand is the git binary used by guard. It is a variable so tests can
+// substitute a fake.
+var gitCommand = "git"
+
+// guardMinLength is the shortest secret value guard looks for; shorter
+// values such as "true" or port numbers would match almost any change.
+const guardMinLength = 6
+
+// guardHookMarker identifies pre-commit hooks written by guard --install.
+const guardHookMarker = "# Installed by denv guard --install"
+
+func git(args ...string) ([]byte, error) {
+	return gitIn("", args...)
+}
+
+// gitIn runs git in dir, or the working directory if dir is empty.
+func gitIn(dir string, args ...string) ([]byte, error) {
+	return gitInContext(context.Background(), dir, args...)
+}
+
+// gitInContext is gitIn killing git once ctx is done.
+func gitInContext(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gitCommand, args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// guardLeak is a staged line containing a secret value.
+type guardLeak struct {
+	Path string
+	Line int
+	Key  string
+}
+
+// scanDiff finds added lines of a unified diff (as printed by git diff -U0)
+// that contain any of the needles, which map a value to its key.
+func scanDiff(diff []byte, needles map[string]string) []guardLeak {
+	var leaks []guardLeak
+	var path string
+	line := 0
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			path = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+		case strings.HasPrefix(text, "@@ "):
+			// @@ -a,b +c,d @@
+			fields := strings.Fields(text)
+			if len(fields) > 2 {
+				start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+				line, _ = strconv.Atoi(start)
+			}
+		case strings.HasPrefix(text, "+"):
+			for value, key := range needles {
+				if strings.Contains(text[1:], value) {
+					leaks = append(leaks, guardLeak{Path: path, Line: line, Key: key})
+				}
+			}
+			line++
+		}
+	}
+	return leaks
+}
+
+func runGuard(c *cli.Context) error {
+	if c.Bool("install") {
+		return installGuardHook(c)
+	}
+
+	envMap, origins, err := mergeSources(c, nil)
+	if err != nil {
+		return err
+	}
+
+	// Multiline values such as PEM keys are matched line by line, since
+	// the diff is.
+	needles := make(map[string]string)
+	for k := range secretKeys(c, envMap, origins, c.StringSlice("secret-key")) {
+		for _, part := range strings.Split(envMap[k], "\n") {
+			if part = strings.TrimSpace(part); len(part) >= guardMinLength {
+				needles[part] = k
+			}
+		}
+	}
+	if len(needles) == 0 {
+		return nil
+	}
+
+	diff, err := git("diff", "--cached", "-U0", "--no-color", "--no-ext-diff", "--text")
+	if err != nil {
+		return err
+	}
+	leaks := scanDiff(diff, needles)
+	if len(leaks) == 0 {
+		return nil
+	}
+	for _, leak := range leaks {
+		fmt.Fprintf(c.App.ErrWriter, "%s:%d: staged change contains the value of %s\n", leak.Path, leak.Line, leak.Key)
+	}
+	return withExitCode(exitValidation, fmt.Errorf("%d staged line(s) contain secret values", len(leaks)))
+}
+
+// installGuardHook writes a pre-commit hook running guard with the sources
+// and global flags of the current invocation. File paths are stored
+// relative to the repository root, where git runs hooks.
+func installGuardHook(c *cli.Context) error {
+	out, err := git("rev-parse", "--show-toplevel", "--git-path", "hooks/pre-commit")
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		return fmt.Errorf("unexpected git rev-parse output %q", out)
+	}
+	root, hook := lines[0], lines[1]
+
+	existing, err := os.ReadFile(hook)
+	if err == nil && !bytes.Contains(existing, []byte(guardHookMarker)) && !c.Bool("force") {
+		return fmt.Errorf("%s already exists; use --force to replace it", hook)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	words := []string{"exec", "denv"}
+	for _, arg := range wrapArgs(c) {
+		value := arg.value
+		if arg.path {
+			abs, err := filepath.Abs(value)
+			if err != nil {
+				return err
+			}
+			// git reports the root with symlinks resolved.
+			if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+				abs = resolved
+			}
+			if value, err = filepath.Rel(root, abs); err != nil {
+				return err
+			}
+			value = filepath.ToSlash(value)
+		}
+		words = append(words, shellQuote(value))
+	}
+	words = append(words, "guard")
+	if c.IsSet("secret-key") {
+		for _, pattern := range c.StringSlice("secret-key") {
+			words = append(words, shellQuote("--secret-key="+pattern))
+		}
+	}
+
+	script := "#!/bin/sh\n" + guardHookMarker + "; re-run it to update.\n" + strings.Join(words, " ") + "\n"
+	if err := os.MkdirAll(filepath.Dir(hook), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(hook, []byte(script), 0755); err != nil {
+		return err
+	}
+	fmt.Fprintf(humanWriter(c), "Installed pre-commit hook %s\n", hook)
+	return nil
+}
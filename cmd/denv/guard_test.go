@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestScanDiff(t *testing.T) {
+	diff := `diff --git a/config.yaml b/config.yaml
+--- a/config.yaml
++++ b/config.yaml
+@@ -3,0 +4,2 @@ server:
++  port: 8080
++  token: s3cr3t-value
+@@ -10 +12 @@
+-old
++password: hunter22
+`
+	leaks := scanDiff([]byte(diff), map[string]string{"s3cr3t-value": "API_TOKEN", "hunter22": "DB_PASSWORD"})
+	want := []guardLeak{
+		{Path: "config.yaml", Line: 5, Key: "API_TOKEN"},
+		{Path: "config.yaml", Line: 12, Key: "DB_PASSWORD"},
+	}
+	if !reflect.DeepEqual(leaks, want) {
+		t.Errorf("expected %+v, got %+v", want, leaks)
+	}
+}
+
+func createGuardApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "guard",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{Name: "secret-key", Value: cli.NewStringSlice(defaultSecretKeys...)},
+				&cli.BoolFlag{Name: "install"},
+				&cli.BoolFlag{Name: "force"},
+			},
+			Action: runGuard,
+		},
+	}
+	return app
+}
+
+func TestGuard(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	t.Chdir(repo)
+	if out, err := exec.Command("git", "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	content := "API_TOKEN=s3cr3t-value\n# denv:secret\nWEBHOOK=https://hooks.example.com/x1\nPORT=8080\n"
+	if err := os.WriteFile(".env", []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("config.yaml", []byte("port: 8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "add", "config.yaml").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v: %s", err, out)
+	}
+	if err := createGuardApp().Run([]string{"denv", "-f", ".env", "guard"}); err != nil {
+		t.Fatalf("expected clean staged changes to pass, got %v", err)
+	}
+
+	leaked := "port: 8080\ntoken: s3cr3t-value\nhook: https://hooks.example.com/x1\n"
+	if err := os.WriteFile("config.yaml", []byte(leaked), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "add", "config.yaml").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v: %s", err, out)
+	}
+	var stderr bytes.Buffer
+	app := createGuardApp()
+	app.ErrWriter = &stderr
+	err := app.Run([]string{"denv", "-f", ".env", "guard"})
+	if exitCode(err) != exitValidation {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	want := "config.yaml:2: staged change contains the value of API_TOKEN\nconfig.yaml:3: staged change contains the value of WEBHOOK\n"
+	if stderr.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, stderr.String())
+	}
+	if strings.Contains(stderr.String(), "s3cr3t") {
+		t.Error("guard printed a secret value")
+	}
+
+	app = createGuardApp()
+	app.Writer = &bytes.Buffer{}
+	if err := app.Run([]string{"denv", "-f", filepath.Join(repo, ".env"), "--isolate", "guard", "--install"}); err != nil {
+		t.Fatal(err)
+	}
+	hook, err := os.ReadFile(filepath.Join(".git", "hooks", "pre-commit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(hook), "\nexec denv '--file' '.env' '--isolate' guard\n") {
+		t.Errorf("unexpected hook:\n%s", hook)
+	}
+
+	if err := os.WriteFile(filepath.Join(".git", "hooks", "pre-commit"), []byte("#!/bin/sh\nmake lint\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	app = createGuardApp()
+	err = app.Run([]string{"denv", "guard", "--install"})
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("expected existing hook to be kept, got %v", err)
+	}
+}
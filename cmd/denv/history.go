@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// historyDateLayouts are the date forms --at accepts besides revisions.
+var historyDateLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04", time.RFC3339}
+
+// atRevision resolves --at in the repository containing dir to a commit:
+// a revision git understands, or else a date, selecting the last commit on
+// HEAD before it.
+func (r *sourceReader) atRevision(dir string) (string, error) {
+	at := r.c.String("at")
+	r.mu.Lock()
+	rev, ok := r.revisions[dir]
+	r.mu.Unlock()
+	if ok {
+		return rev, nil
+	}
+
+	out, err := gitIn(dir, "rev-parse", "--verify", "--quiet", at+"^{commit}")
+	if err != nil {
+		isDate := false
+		for _, layout := range historyDateLayouts {
+			if _, perr := time.Parse(layout, at); perr == nil {
+				isDate = true
+				break
+			}
+		}
+		if !isDate {
+			return "", fmt.Errorf("--at %s: unknown revision in %s", at, dir)
+		}
+		if out, err = gitIn(dir, "rev-list", "-1", "--before="+at, "HEAD"); err != nil {
+			return "", fmt.Errorf("--at %s: %w", at, err)
+		}
+		if len(out) == 0 {
+			return "", fmt.Errorf("--at %s: no commit before that date in %s", at, dir)
+		}
+	}
+	rev = strings.TrimSpace(string(out))
+
+	r.mu.Lock()
+	if r.revisions == nil {
+		r.revisions = make(map[string]string)
+	}
+	r.revisions[dir] = rev
+	r.mu.Unlock()
+	return rev, nil
+}
+
+// readFile reads a local file as committed at --at, or from the working
+// tree without it. Files missing at that revision are reported as not
+// existing, so optional ones are skipped.
+func (r *sourceReader) readFile(path string) ([]byte, error) {
+	if r.c.String("at") == "" {
+		return os.ReadFile(path)
+	}
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	rev, err := r.atRevision(dir)
+	if err != nil {
+		return nil, err
+	}
+	object := rev + ":./" + name
+	if _, err := gitIn(dir, "cat-file", "-e", object); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: path + "@" + r.c.String("at"), Err: fs.ErrNotExist}
+	}
+	return gitIn(dir, "show", object)
+}
+
+// readEnvFileAt parses an env file as committed at --at instead of the
+// working tree.
+func (r *sourceReader) readEnvFileAt(file EnvFile, opts parseOptions) (env, modes map[string]string, err error) {
+	data, err := r.readFile(file.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseEnvData(data, opts)
+}
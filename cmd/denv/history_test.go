@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestLoadAtRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	gitRun := func(env []string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), env...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+	envFile := filepath.Join(repo, ".env")
+	commit := func(content, date string) {
+		t.Helper()
+		if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitRun(nil, "add", ".")
+		gitRun([]string{"GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date}, "commit", "-q", "-m", date)
+	}
+	gitRun(nil, "init", "-q")
+	commit("PORT=80\n", "2024-01-01T12:00:00Z")
+	commit("PORT=8080\n", "2024-03-01T12:00:00Z")
+	gitRun(nil, "tag", "v2")
+	if err := os.WriteFile(envFile, []byte("PORT=9090\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(args ...string) (map[string]string, error) {
+		app, _ := newApp()
+		var env map[string]string
+		app.Action = func(c *cli.Context) error {
+			var err error
+			env, err = loadSources(c)
+			return err
+		}
+		err := app.Run(append([]string{"denv", "-f", envFile}, args...))
+		return env, err
+	}
+
+	for at, want := range map[string]string{
+		"":           "9090",
+		"HEAD":       "8080",
+		"HEAD~1":     "80",
+		"v2":         "8080",
+		"2024-02-01": "80",
+		"2024-06-01": "8080",
+	} {
+		env, err := load("--at", at)
+		if err != nil {
+			t.Errorf("--at %q: %v", at, err)
+		} else if env["PORT"] != want {
+			t.Errorf("--at %q: expected PORT=%s, got %q", at, want, env["PORT"])
+		}
+	}
+
+	if _, err := load("--at", "2023-01-01"); err == nil || !strings.Contains(err.Error(), "no commit before") {
+		t.Errorf("expected an error for a date before the first commit, got %v", err)
+	}
+	if _, err := load("--at", "nope"); err == nil || !strings.Contains(err.Error(), "unknown revision") {
+		t.Errorf("expected an error for an unknown revision, got %v", err)
+	}
+
+	// Files that did not exist yet are missing, so optional ones are skipped.
+	local := filepath.Join(repo, ".env.local")
+	if err := os.WriteFile(local, []byte("DEBUG=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if env, err := load("-fo", local, "--at", "HEAD"); err != nil || env["DEBUG"] != "" || env["PORT"] != "8080" {
+		t.Errorf("expected the optional file to be skipped, got %v (%v)", env, err)
+	}
+	if _, err := load("-f", local, "--at", "HEAD"); exitCode(err) != exitFileMissing {
+		t.Errorf("expected exit code %d for a missing file, got %v", exitFileMissing, err)
+	}
+}
+
+func TestLoadAtRevisionMetadata(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	t.Chdir(repo)
+	gitRun := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+	write := func(files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	gitRun("init", "-q")
+	write(map[string]string{
+		".env":            "# Port of the server\nPORT=80\nCERT=file:cert.pem\nPATH+=/opt/old\n",
+		".env.meta.json":  `{"PORT":{"owner":"ops"}}`,
+		"cert.pem":        "old",
+		defaultConfigFile: "env:\n  REGION: eu\n",
+	})
+	gitRun("add", ".")
+	gitRun("commit", "-q", "-m", "initial")
+	write(map[string]string{
+		".env":            "# Listening port\nPORT=8080\nCERT=file:cert.pem\nPATH=/opt/new\n",
+		".env.meta.json":  `{"PORT":{"owner":"dev"}}`,
+		"cert.pem":        "new",
+		defaultConfigFile: "env:\n  REGION: us\n",
+	})
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		env, err := loadSources(c)
+		if err != nil {
+			return err
+		}
+		if env["CERT"] != "old" || env["REGION"] != "eu" || env["PATH"] != "/opt/old" {
+			t.Errorf("expected values as of HEAD, got %v", env)
+		}
+		if d := keyDescriptions(c)["PORT"]; d != "Port of the server" {
+			t.Errorf("expected the committed description, got %q", d)
+		}
+		if a := keyAnnotations(c)["PORT"]; a.Owner != "ops" {
+			t.Errorf("expected the committed annotations, got %+v", a)
+		}
+		return nil
+	}
+	if err := app.Run([]string{"denv", "--isolate", "-f", ".env", "--at", "HEAD"}); err != nil {
+		t.Fatal(err)
+	}
+}
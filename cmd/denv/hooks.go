@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Policies for a failing hook: fail stops denv (before_exec hooks then skip
+// the command), warn reports the failure and continues, ignore continues
+// silently.
+const (
+	hookFail   = "fail"
+	hookWarn   = "warn"
+	hookIgnore = "ignore"
+)
+
+// configHook is a shell command run around exec, as listed under
+// before_exec or after_exec in the project config.
+type configHook struct {
+	Command   string
+	OnFailure string
+}
+
+// decodeConfigHook decodes a hook list item: a command, or a mapping with
+// command and on-failure.
+func decodeConfigHook(item any) (configHook, error) {
+	hook := configHook{OnFailure: hookFail}
+	switch v := item.(type) {
+	case string:
+		hook.Command = v
+	case map[string]any:
+		for key, value := range v {
+			s, _ := value.(string)
+			switch key {
+			case "command":
+				hook.Command = s
+			case "on-failure":
+				if s != hookFail && s != hookWarn && s != hookIgnore {
+					return hook, fmt.Errorf("on-failure: expected fail, warn or ignore")
+				}
+				hook.OnFailure = s
+			default:
+				return hook, fmt.Errorf("unknown key %q", key)
+			}
+		}
+	}
+	if hook.Command == "" {
+		return hook, fmt.Errorf("expected a command")
+	}
+	return hook, nil
+}
+
+// runHooks runs the hooks of a stage in order through the system shell
+// with envMap as environment. Their output goes to stderr so it does not
+// mix with the command's stdout. A failing hook with the fail policy stops
+// the remaining ones and is returned.
+func runHooks(c *cli.Context, stage string, hooks []configHook, envMap map[string]string) error {
+	if c.Bool("no-hooks") {
+		return nil
+	}
+	for _, hook := range hooks {
+		args := shellArgs(hook.Command)
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Env = envSlice(envMap)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = c.App.ErrWriter
+		cmd.Stderr = c.App.ErrWriter
+		err := cmd.Run()
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s hook %q failed: %w", stage, hook.Command, err)
+		switch hook.OnFailure {
+		case hookFail:
+			return withExitCode(exitFailure, err)
+		case hookWarn:
+			fmt.Fprintf(c.App.ErrWriter, "Warning: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// afterExecEnv returns envMap with DENV_EXIT_CODE set to the exit status
+// of the command, or 128+N when it was killed by signal N.
+func afterExecEnv(envMap map[string]string, exitErr *exec.ExitError) map[string]string {
+	code := 0
+	if exitErr != nil {
+		code = exitErr.ExitCode()
+		if sig, ok := terminationSignal(exitErr); ok {
+			code = 128 + int(sig)
+		}
+	}
+	env := maps.Clone(envMap)
+	env["DENV_EXIT_CODE"] = strconv.Itoa(code)
+	return env
+}
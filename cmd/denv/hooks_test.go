@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExecHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile(".env", []byte("NAME=api\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig := func(cfg string) {
+		t.Helper()
+		if err := os.WriteFile(defaultConfigFile, []byte("files:\n  - .env\n"+cfg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(args ...string) (int, string, error) {
+		t.Helper()
+		os.Remove("log")
+		code := captureExit(t)
+		var stderr bytes.Buffer
+		app := createExecApp()
+		app.ErrWriter = &stderr
+		err := app.Run(append([]string{"denv", "--isolate"}, args...))
+		log, _ := os.ReadFile("log")
+		return *code, string(log) + stderr.String(), err
+	}
+
+	writeConfig(`before_exec:
+  - echo "start $NAME" >> log
+  - command: exit 3
+    on-failure: warn
+after_exec:
+  - echo "stop $DENV_EXIT_CODE" >> log
+`)
+	code, out, err := run("exec", "sh", "-c", `echo "run $NAME" >> log; exit 5`)
+	if code != 5 {
+		t.Fatalf("expected exit code 5, got %d (%v)", code, err)
+	}
+	if !strings.HasPrefix(out, "start api\nrun api\nstop 5\nWarning: before_exec hook \"exit 3\" failed: exit status 3\n") {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	_, out, _ = run("--no-hooks", "exec", "sh", "-c", "echo run >> log")
+	if out != "run\n" {
+		t.Errorf("expected hooks to be skipped, got %q", out)
+	}
+
+	writeConfig(`before_exec:
+  - exit 4
+  - echo unreachable >> log
+`)
+	_, out, err = run("exec", "sh", "-c", "echo run >> log")
+	if err == nil || err.Error() != `before_exec hook "exit 4" failed: exit status 4` || out != "" {
+		t.Errorf("expected the failing hook to stop exec, got %v (output %q)", err, out)
+	}
+
+	writeConfig(`after_exec:
+  - exit 1
+`)
+	if _, _, err := run("exec", "true"); err == nil || !strings.Contains(err.Error(), `after_exec hook "exit 1" failed`) {
+		t.Errorf("expected a failing after_exec hook to fail a successful command, got %v", err)
+	}
+	code, out, _ = run("exec", "sh", "-c", "exit 2")
+	if code != 2 || !strings.Contains(out, `denv: after_exec hook "exit 1" failed`) {
+		t.Errorf("expected the command's exit code with a reported hook failure, got %d, %q", code, out)
+	}
+
+	writeConfig(`after_exec:
+  - command: true
+    on-failure: sometimes
+`)
+	if _, _, err := run("exec", "true"); err == nil || !strings.Contains(err.Error(), "after_exec[0]: on-failure: expected fail, warn or ignore") {
+		t.Errorf("expected an invalid policy error, got %v", err)
+	}
+	writeConfig("before_exec: true\n")
+	if _, _, err := run("exec", "true"); err == nil || !strings.Contains(err.Error(), "before_exec: expected a list") {
+		t.Errorf("expected a list error, got %v", err)
+	}
+
+	// Hooks of an app run after the shared ones, and only with --app.
+	writeConfig(`before_exec:
+  - echo shared >> log
+apps:
+  api:
+    before_exec:
+      - echo "api $NAME" >> log
+`)
+	if _, out, err := run("--app", "api", "exec", "true"); err != nil || out != "shared\napi api\n" {
+		t.Errorf("expected shared and app hooks, got %q (%v)", out, err)
+	}
+	if _, out, err := run("exec", "true"); err != nil || out != "shared\n" {
+		t.Errorf("expected only shared hooks without --app, got %q (%v)", out, err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// dockerCommand is the docker binary used to inspect containers. It is a
+// variable so tests can substitute a fake.
+var dockerCommand = "docker"
+
+func runImport(c *cli.Context) error {
+	pid := c.Int("pid")
+	container := c.String("container")
+
+	var entries []string
+	var err error
+	switch {
+	case pid != 0 && container != "":
+		return fmt.Errorf("--pid and --container are mutually exclusive")
+	case pid != 0:
+		entries, err = readProcessEnv(pid)
+	case container != "":
+		entries, err = readContainerEnv(container)
+	default:
+		return fmt.Errorf("either --pid or --container is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	envMap := make(map[string]string, len(entries))
+	for _, e := range entries {
+		k, v, ok := strings.Cut(e, "=")
+		if !ok || k == "" {
+			continue
+		}
+		// Processes may carry names no env file can hold, such as exported
+		// shell functions.
+		if err := validateKey(k); err != nil {
+			fmt.Fprintf(c.App.ErrWriter, "Warning: skipping %v\n", err)
+			continue
+		}
+		envMap[k] = v
+	}
+
+	var sb strings.Builder
+	for _, k := range sortedKeys(envMap) {
+		fmt.Fprintf(&sb, "%s=%s\n", k, formatValue(envMap[k]))
+	}
+
+	output := c.String("output")
+	if output == "" || output == "-" {
+		fmt.Fprint(c.App.Writer, sb.String())
+		return nil
+	}
+	return os.WriteFile(output, []byte(sb.String()), 0600)
+}
+
+// readProcessEnv reads the initial environment of a process from
+// /proc/<pid>/environ (Linux only).
+func readProcessEnv(pid int) ([]string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment of process %d: %w", pid, err)
+	}
+	return strings.Split(strings.TrimRight(string(data), "\x00"), "\x00"), nil
+}
+
+// readContainerEnv returns the configured environment of a container using
+// docker inspect.
+func readContainerEnv(id string) ([]string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(dockerCommand, "inspect", "--format", "{{json .Config.Env}}", id)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("docker inspect: %s", strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+
+	var env []string
+	if err := json.Unmarshal(out, &env); err != nil {
+		return nil, fmt.Errorf("invalid docker inspect output: %w", err)
+	}
+	return env, nil
+}
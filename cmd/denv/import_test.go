@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func createImportApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "import",
+			Flags: []cli.Flag{
+				&cli.IntFlag{Name: "pid"},
+				&cli.StringFlag{Name: "container"},
+				&cli.StringFlag{Name: "output", Aliases: []string{"o"}},
+			},
+			Action: runImport,
+		},
+	}
+	return app
+}
+
+func TestImportPid(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc is only available on Linux")
+	}
+
+	os.Setenv("DENV_IMPORT_TEST", "from-proc")
+	defer os.Unsetenv("DENV_IMPORT_TEST")
+
+	// /proc/<pid>/environ holds the initial environment, so inspect a child
+	// started after the variable was set.
+	cmd := exec.Command("sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Skip("sleep not available")
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	out := filepath.Join(t.TempDir(), "captured.env")
+	app := createImportApp()
+	args := []string{"denv", "import", "--pid", strconv.Itoa(cmd.Process.Pid), "-o", out}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+
+	env, _, err := readEnvFile(out, parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["DENV_IMPORT_TEST"] != "from-proc" {
+		t.Errorf("expected DENV_IMPORT_TEST=from-proc, got %q", env["DENV_IMPORT_TEST"])
+	}
+}
+
+func TestImportContainer(t *testing.T) {
+	docker := writeFakeCommand(t, "docker", `echo '["PATH=/usr/bin","GREETING=hello world","PRICE=$5 \\\\o/ \\"quoted\\"","BASH_FUNC_f%%=() {}"]'`)
+	defer func(orig string) { dockerCommand = orig }(dockerCommand)
+	dockerCommand = docker
+
+	var buf strings.Builder
+	app := createImportApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "import", "--container", "web"}); err != nil {
+		t.Fatal(err)
+	}
+
+	env, _, err := parseEnvData([]byte(buf.String()), parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"PATH": "/usr/bin", "GREETING": "hello world", "PRICE": `$5 \o/ "quoted"`}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("expected %q, got %q", want, env)
+	}
+}
+
+func TestImportRequiresSource(t *testing.T) {
+	app := createImportApp()
+	if err := app.Run([]string{"denv", "import"}); err == nil {
+		t.Fatal("expected error without --pid or --container")
+	}
+}
@@ -0,0 +1,7 @@
+package main
+
+import "errors"
+
+func setIOPriority(pid, class, level int) error {
+	return errors.New("I/O priorities are only supported on Linux")
+}
@@ -0,0 +1,13 @@
+package main
+
+import "syscall"
+
+const ioprioWhoProcess = 1
+
+func setIOPriority(pid, class, level int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(class<<13|level))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
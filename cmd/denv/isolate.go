@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// windowsBaseline are variables Windows programs fail without; they are
+// kept by every preset and simply absent elsewhere.
+var windowsBaseline = []string{"SYSTEMROOT", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE"}
+
+// isolatePresets are the glob patterns of system variables kept by
+// --isolate=PRESET.
+var isolatePresets = map[string][]string{
+	"minimal": slices.Concat([]string{"PATH", "HOME", "TMPDIR", "LANG", "TERM"}, windowsBaseline),
+	"posix": slices.Concat([]string{"PATH", "HOME", "TMPDIR", "LANG", "LC_*", "TERM", "TZ", "USER", "LOGNAME", "SHELL", "PWD"},
+		windowsBaseline),
+	"ci": slices.Concat([]string{"PATH", "HOME", "TMPDIR", "LANG", "TERM",
+		"CI", "CI_*", "GITHUB_*", "RUNNER_*", "GITLAB_*", "BUILDKITE*", "CIRCLE*", "JENKINS_*", "BUILD_ID", "BUILD_NUMBER", "TF_BUILD"},
+		windowsBaseline),
+}
+
+// isolation selects the system variables the sources are merged over: all
+// of them, none (--isolate) or a baseline (--isolate=PRESET).
+type isolation struct {
+	On bool
+	// Keep lists glob patterns of variables inherited despite isolation.
+	Keep []string
+	// Setting is how the isolation was given: true, false, a preset name
+	// or the patterns of the project config joined with commas.
+	Setting string
+}
+
+// parseIsolation parses true, false or a preset name.
+func parseIsolation(value string) (isolation, error) {
+	if keep, ok := isolatePresets[value]; ok {
+		return isolation{On: true, Keep: keep, Setting: value}, nil
+	}
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return isolation{}, fmt.Errorf("unknown isolate preset %q (expected true, false, %s)", value, strings.Join(slices.Sorted(maps.Keys(isolatePresets)), ", "))
+	}
+	return isolation{On: on, Setting: strconv.FormatBool(on)}, nil
+}
+
+// decodeConfigIsolation decodes the isolate key of the project config: true,
+// false, a preset, or a list of variable patterns and presets to keep.
+func decodeConfigIsolation(value any) (*isolation, error) {
+	switch v := value.(type) {
+	case string:
+		iso, err := parseIsolation(v)
+		if err != nil {
+			return nil, err
+		}
+		return &iso, nil
+	case []any:
+		iso := &isolation{On: true}
+		var names []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("expected variable patterns or presets")
+			}
+			if keep, ok := isolatePresets[s]; ok {
+				iso.Keep = append(iso.Keep, keep...)
+			} else {
+				iso.Keep = append(iso.Keep, s)
+			}
+			names = append(names, s)
+		}
+		iso.Setting = strings.Join(names, ",")
+		return iso, nil
+	}
+	return nil, fmt.Errorf("expected true, false, a preset or a list of variables")
+}
+
+// isolateFlag is --isolate. It is a boolean flag, so -i and --isolate need
+// no value, that also accepts --isolate=PRESET. Its String is the boolean
+// so c.Bool("isolate") keeps working.
+type isolateFlag struct {
+	isolation
+}
+
+func (f *isolateFlag) IsBoolFlag() bool { return true }
+
+func (f *isolateFlag) Set(value string) error {
+	// cli copies the value between -i and --isolate through String, which
+	// must not reset a preset.
+	if value == "true" && f.On {
+		return nil
+	}
+	iso, err := parseIsolation(value)
+	if err != nil {
+		return err
+	}
+	f.isolation = iso
+	return nil
+}
+
+func (f *isolateFlag) String() string {
+	if f == nil {
+		return "false"
+	}
+	return strconv.FormatBool(f.On)
+}
+
+// currentIsolation returns --isolate if given, or else the isolation of the
+// project config.
+func currentIsolation(c *cli.Context) isolation {
+	if c.IsSet("isolate") {
+		if f, ok := c.Generic("isolate").(*isolateFlag); ok {
+			return f.isolation
+		}
+		return isolation{On: c.Bool("isolate")}
+	}
+	if iso := loadedConfig(c).Isolate; iso != nil {
+		return *iso
+	}
+	return isolation{}
+}
+
+// inheritedEnv returns the system variables the sources are merged over,
+// as KEY=VALUE pairs: all of them, unless isolated.
+func inheritedEnv(c *cli.Context) []string {
+	iso := currentIsolation(c)
+	if !iso.On {
+		return os.Environ()
+	}
+	var env []string
+	for _, e := range os.Environ() {
+		k, _, _ := strings.Cut(e, "=")
+		// Windows variable names are case-insensitive, e.g. Path.
+		if runtime.GOOS == "windows" {
+			k = strings.ToUpper(k)
+		}
+		if matchesAny(k, iso.Keep) {
+			env = append(env, e)
+		}
+	}
+	return env
+}
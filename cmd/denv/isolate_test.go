@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIsolatePresets(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".env", []byte("PORT=8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// t.Setenv restores every variable once the test is done.
+	for _, e := range os.Environ() {
+		k, v, _ := strings.Cut(e, "=")
+		t.Setenv(k, v)
+		os.Unsetenv(k)
+	}
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("HOME", "/home/dev")
+	t.Setenv("LC_ALL", "C")
+	t.Setenv("GITHUB_SHA", "abc")
+	t.Setenv("AWS_PROFILE", "prod")
+	t.Setenv("STRAY", "1")
+
+	keys := func(args ...string) string {
+		t.Helper()
+		var names []string
+		for _, line := range strings.Split(strings.TrimSpace(runListOutput(t, append(args, "list")...)), "\n") {
+			k, _, _ := strings.Cut(line, "=")
+			names = append(names, k)
+		}
+		return strings.Join(names, " ")
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "AWS_PROFILE GITHUB_SHA HOME LC_ALL PATH PORT STRAY"},
+		{[]string{"--isolate"}, "PORT"},
+		{[]string{"-i"}, "PORT"},
+		{[]string{"--isolate=minimal"}, "HOME PATH PORT"},
+		{[]string{"--isolate=posix"}, "HOME LC_ALL PATH PORT"},
+		{[]string{"--isolate=ci"}, "GITHUB_SHA HOME PATH PORT"},
+	} {
+		if got := keys(append([]string{"-f", ".env"}, tt.args...)...); got != tt.want {
+			t.Errorf("%v: expected %s, got %s", tt.args, tt.want, got)
+		}
+	}
+
+	app, _ := newApp()
+	app.Writer, app.ErrWriter = io.Discard, io.Discard
+	if err := app.Run([]string{"denv", "--isolate=sandbox"}); err == nil || !strings.Contains(err.Error(), `unknown isolate preset "sandbox"`) {
+		t.Errorf("expected an error for an unknown preset, got %v", err)
+	}
+
+	// The config sets a baseline for the project and per app; the flag wins.
+	config := `files:
+  - .env
+isolate:
+  - minimal
+  - AWS_*
+apps:
+  ci:
+    isolate: ci
+  local:
+    isolate: false
+`
+	if err := os.WriteFile(defaultConfigFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "AWS_PROFILE HOME PATH PORT"},
+		{[]string{"--app", "ci"}, "GITHUB_SHA HOME PATH PORT"},
+		{[]string{"--app", "local"}, "AWS_PROFILE GITHUB_SHA HOME LC_ALL PATH PORT STRAY"},
+		{[]string{"--isolate"}, "PORT"},
+		{[]string{"--isolate=false"}, "AWS_PROFILE GITHUB_SHA HOME LC_ALL PATH PORT STRAY"},
+	} {
+		if got := keys(tt.args...); got != tt.want {
+			t.Errorf("config, %v: expected %s, got %s", tt.args, tt.want, got)
+		}
+	}
+}
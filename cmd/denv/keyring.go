@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// keyringService is the service name denv's entries are stored under in
+// the OS keychain; the variable name is the account.
+const keyringService = "denv"
+
+var errKeyringNotFound = errors.New("not found in the keyring")
+
+func runSecretSet(c *cli.Context) error {
+	key := c.Args().Get(0)
+	if key == "" {
+		return fmt.Errorf("key argument is required")
+	}
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	var value string
+	switch c.NArg() {
+	case 1:
+		data, err := io.ReadAll(c.App.Reader)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimSuffix(string(data), "\n")
+	case 2:
+		value = c.Args().Get(1)
+	default:
+		return fmt.Errorf("expected KEY [VALUE], got %d arguments", c.NArg())
+	}
+	if value == "" {
+		return fmt.Errorf("refusing to store an empty value for %s", key)
+	}
+	return keyringSet(key, value)
+}
+
+func runSecretGet(c *cli.Context) error {
+	key := c.Args().First()
+	if key == "" {
+		return fmt.Errorf("key argument is required")
+	}
+	value, err := keyringGet(key)
+	if errors.Is(err, errKeyringNotFound) {
+		return withExitCode(exitFailure, fmt.Errorf("key '%s' not found in the keyring", key))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, value)
+	return nil
+}
+
+func runSecretDelete(c *cli.Context) error {
+	key := c.Args().First()
+	if key == "" {
+		return fmt.Errorf("key argument is required")
+	}
+	err := keyringDelete(key)
+	if errors.Is(err, errKeyringNotFound) {
+		return withExitCode(exitFailure, fmt.Errorf("key '%s' not found in the keyring", key))
+	}
+	return err
+}
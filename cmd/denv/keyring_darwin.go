@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// securityCommand is the macOS Keychain CLI. It is a variable so tests can
+// substitute a fake.
+var securityCommand = "security"
+
+// securityItemNotFound is the exit status of security when no keychain
+// item matches.
+const securityItemNotFound = 44
+
+func keyringSet(key, value string) error {
+	// Commands read by "security -i" keep the value off the command line;
+	// -X passes it hex-encoded so it needs no quoting.
+	cmd := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n",
+		shellQuote(keyringService), shellQuote(key), hex.EncodeToString([]byte(value)))
+	_, err := runSecurity(cmd, "-i")
+	return err
+}
+
+func keyringGet(key string) (string, error) {
+	out, err := runSecurity("", "find-generic-password", "-s", keyringService, "-a", key, "-w")
+	return strings.TrimSuffix(out, "\n"), err
+}
+
+func keyringDelete(key string) error {
+	_, err := runSecurity("", "delete-generic-password", "-s", keyringService, "-a", key)
+	return err
+}
+
+func runSecurity(stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(securityCommand, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", err
+		}
+		if exitErr.ExitCode() == securityItemNotFound {
+			return "", errKeyringNotFound
+		}
+		return "", fmt.Errorf("security: %s", strings.TrimSpace(stderr.String()))
+	}
+	// In interactive mode failed commands are only reported on stderr.
+	if msg := strings.TrimSpace(stderr.String()); msg != "" && args[0] == "-i" {
+		return "", fmt.Errorf("security: %s", msg)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,19 @@
+//go:build !unix && !windows
+
+package main
+
+import "errors"
+
+var errKeyringUnsupported = errors.New("keyring is not supported on this platform")
+
+func keyringSet(key, value string) error {
+	return errKeyringUnsupported
+}
+
+func keyringGet(key string) (string, error) {
+	return "", errKeyringUnsupported
+}
+
+func keyringDelete(key string) error {
+	return errKeyringUnsupported
+}
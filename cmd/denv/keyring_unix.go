@@ -0,0 +1,55 @@
+//go:build unix && !darwin
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secretToolCommand is the libsecret CLI used to reach the Secret Service
+// (GNOME Keyring, KWallet). It is a variable so tests can substitute a fake.
+var secretToolCommand = "secret-tool"
+
+func keyringSet(key, value string) error {
+	// secret-tool reads the secret from stdin, keeping it off the command
+	// line.
+	_, err := runSecretTool(value, "store", "--label", keyringService+" "+key, "service", keyringService, "account", key)
+	return err
+}
+
+func keyringGet(key string) (string, error) {
+	return runSecretTool("", "lookup", "service", keyringService, "account", key)
+}
+
+func keyringDelete(key string) error {
+	if _, err := keyringGet(key); err != nil {
+		return err
+	}
+	_, err := runSecretTool("", "clear", "service", keyringService, "account", key)
+	return err
+}
+
+// runSecretTool runs secret-tool with stdin as input. lookup exits with
+// status 1 and no message when there is no matching item.
+func runSecretTool(stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(secretToolCommand, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", fmt.Errorf("keyring: %w (is libsecret's secret-tool installed?)", err)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("secret-tool: %s", msg)
+		}
+		return "", errKeyringNotFound
+	}
+	return stdout.String(), nil
+}
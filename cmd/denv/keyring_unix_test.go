@@ -0,0 +1,93 @@
+//go:build unix && !darwin
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// fakeSecretTool stores secrets as files in a temporary directory.
+func fakeSecretTool(t *testing.T) {
+	t.Helper()
+	store := t.TempDir()
+	tool := writeFakeCommand(t, "secret-tool", `
+store=`+store+`
+case "$1" in
+store) cat > "$store/$7" ;;
+lookup) [ -f "$store/$5" ] || exit 1; cat "$store/$5" ;;
+clear) rm -f "$store/$5" ;;
+*) echo "unexpected $*" >&2; exit 2 ;;
+esac
+`)
+	orig := secretToolCommand
+	t.Cleanup(func() { secretToolCommand = orig })
+	secretToolCommand = tool
+}
+
+func createSecretApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{Name: "get", Action: runGet},
+		{Name: "secret", Subcommands: []*cli.Command{
+			{Name: "set", Action: runSecretSet},
+			{Name: "get", Action: runSecretGet},
+			{Name: "delete", Action: runSecretDelete},
+		}},
+	}
+	return app
+}
+
+func TestSecretKeyring(t *testing.T) {
+	fakeSecretTool(t)
+
+	app := createSecretApp()
+	app.Reader = strings.NewReader("ghp_personal\n")
+	if err := app.Run([]string{"denv", "secret", "set", "GITHUB_TOKEN"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app = createSecretApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "secret", "get", "GITHUB_TOKEN"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "ghp_personal\n" {
+		t.Errorf("unexpected secret get output %q", buf.String())
+	}
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("TOKEN=keyring://GITHUB_TOKEN\nMISSING=keyring://NOPE\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	app = createSecretApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "--isolate", "-f", envFile, "get", "TOKEN"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "ghp_personal\n" {
+		t.Errorf("expected the keyring value, got %q", buf.String())
+	}
+
+	err := createSecretApp().Run([]string{"denv", "--isolate", "-f", envFile, "get", "MISSING"})
+	if err == nil || !strings.Contains(err.Error(), "key MISSING: keyring NOPE: not found in the keyring") {
+		t.Errorf("expected a keyring error, got %v", err)
+	}
+
+	if err := createSecretApp().Run([]string{"denv", "secret", "delete", "GITHUB_TOKEN"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyringGet("GITHUB_TOKEN"); err != errKeyringNotFound {
+		t.Errorf("expected the secret to be deleted, got %v", err)
+	}
+	if err := keyringDelete("GITHUB_TOKEN"); err != errKeyringNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
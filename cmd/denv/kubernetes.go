@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// kubectlCommand is the kubectl binary used to read cluster objects. It is a
+// variable so tests can substitute a fake.
+var kubectlCommand = "kubectl"
+
+type k8sObject struct {
+	Data       map[string]string `json:"data"`
+	BinaryData map[string]string `json:"binaryData"`
+}
+
+// readKubernetes reads a Secret or ConfigMap given as "namespace/name" (or
+// just "name" for the context's default namespace) using kubectl and the
+// current kubeconfig context.
+func readKubernetes(ctx context.Context, kind, ref, kubeContext string) (map[string]string, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		namespace, name = "", ref
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid %s reference %q (expected namespace/name)", kind, ref)
+	}
+
+	args := []string{"get", kind, name, "-o", "json"}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+
+	var obj k8sObject
+	if err := runKubectl(ctx, &obj, args...); err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string, len(obj.Data)+len(obj.BinaryData))
+	for k, v := range obj.Data {
+		if kind == "secret" {
+			decoded, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return nil, fmt.Errorf("secret key %s: %w", k, err)
+			}
+			v = string(decoded)
+		}
+		env[k] = v
+	}
+	for k, v := range obj.BinaryData {
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("configmap key %s: %w", k, err)
+		}
+		env[k] = string(decoded)
+	}
+	return env, nil
+}
+
+// runKubectl runs kubectl and decodes its JSON output into out. kubectl is
+// killed once ctx is done.
+func runKubectl(ctx context.Context, out any, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, kubectlCommand, args...)
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	data, err := cmd.Output()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("kubectl: %s", strings.TrimSpace(stderr.String()))
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid kubectl output: %w", err)
+	}
+	return nil
+}
+
+type k8sWorkload struct {
+	Metadata struct {
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Template struct {
+			Spec struct {
+				Containers []k8sContainer `json:"containers"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+type k8sContainer struct {
+	Name    string `json:"name"`
+	EnvFrom []struct {
+		Prefix       string                 `json:"prefix"`
+		ConfigMapRef *struct{ Name string } `json:"configMapRef"`
+		SecretRef    *struct{ Name string } `json:"secretRef"`
+	} `json:"envFrom"`
+	Env []struct {
+		Name      string `json:"name"`
+		Value     string `json:"value"`
+		ValueFrom *struct {
+			ConfigMapKeyRef *k8sKeyRef `json:"configMapKeyRef"`
+			SecretKeyRef    *k8sKeyRef `json:"secretKeyRef"`
+		} `json:"valueFrom"`
+	} `json:"env"`
+}
+
+type k8sKeyRef struct {
+	Name     string `json:"name"`
+	Key      string `json:"key"`
+	Optional bool   `json:"optional"`
+}
+
+// readWorkloadEnv returns the environment of a container of a workload
+// given as "[namespace/]kind/name", e.g. deployment/api: envFrom objects
+// first, then env entries, with ConfigMap and Secret references resolved.
+// Variables from the downward API have no fixed value and are returned in
+// unknown instead. The first container is used unless one is named.
+func readWorkloadEnv(ref, container, kubeContext string) (env map[string]string, unknown []string, err error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) == 2 {
+		parts = append([]string{""}, parts...)
+	}
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return nil, nil, fmt.Errorf("invalid workload reference %q (expected [namespace/]kind/name)", ref)
+	}
+	args := []string{"get", parts[1] + "/" + parts[2], "-o", "json"}
+	if parts[0] != "" {
+		args = append(args, "--namespace", parts[0])
+	}
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+	var workload k8sWorkload
+	if err := runKubectl(context.Background(), &workload, args...); err != nil {
+		return nil, nil, err
+	}
+
+	var c *k8sContainer
+	for i, candidate := range workload.Spec.Template.Spec.Containers {
+		if container == "" && i == 0 || candidate.Name == container {
+			c = &workload.Spec.Template.Spec.Containers[i]
+			break
+		}
+	}
+	if c == nil {
+		if container == "" {
+			return nil, nil, fmt.Errorf("%s has no containers", ref)
+		}
+		return nil, nil, fmt.Errorf("%s has no container %q", ref, container)
+	}
+
+	// Referenced objects are read once each.
+	objects := make(map[string]map[string]string)
+	object := func(kind, name string) (map[string]string, error) {
+		id := kind + "/" + name
+		if data, ok := objects[id]; ok {
+			return data, nil
+		}
+		data, err := readKubernetes(context.Background(), kind, workload.Metadata.Namespace+"/"+name, kubeContext)
+		if err != nil {
+			return nil, err
+		}
+		objects[id] = data
+		return data, nil
+	}
+
+	env = make(map[string]string)
+	for _, from := range c.EnvFrom {
+		kind, name := sourceK8sConfigMap, ""
+		switch {
+		case from.ConfigMapRef != nil:
+			name = from.ConfigMapRef.Name
+		case from.SecretRef != nil:
+			kind, name = sourceK8sSecret, from.SecretRef.Name
+		default:
+			continue
+		}
+		data, err := object(kind, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range data {
+			env[from.Prefix+k] = v
+		}
+	}
+	for _, e := range c.Env {
+		if e.ValueFrom == nil {
+			env[e.Name] = e.Value
+			continue
+		}
+		kind, keyRef := sourceK8sConfigMap, e.ValueFrom.ConfigMapKeyRef
+		if e.ValueFrom.SecretKeyRef != nil {
+			kind, keyRef = sourceK8sSecret, e.ValueFrom.SecretKeyRef
+		}
+		if keyRef == nil {
+			unknown = append(unknown, e.Name)
+			continue
+		}
+		data, err := object(kind, keyRef.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, ok := data[keyRef.Key]
+		if !ok && !keyRef.Optional {
+			return nil, nil, fmt.Errorf("%s %s has no key %s referenced by %s", kind, keyRef.Name, keyRef.Key, e.Name)
+		}
+		if ok {
+			env[e.Name] = v
+		}
+	}
+	return env, unknown, nil
+}
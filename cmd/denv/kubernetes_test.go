@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestKubernetesSources(t *testing.T) {
+	kubectl := writeFakeCommand(t, "kubectl", `
+case "$2" in
+secret) echo '{"data":{"DB_PASSWORD":"czNjcjN0"}}' ;;
+configmap) echo '{"data":{"LOG_LEVEL":"debug","DB_PASSWORD":"plain"},"binaryData":{"BLOB":"YmluYXJ5"}}' ;;
+*) echo "unexpected $*" >&2; exit 1 ;;
+esac
+`)
+	defer func(orig string) { kubectlCommand = orig }(kubectlCommand)
+	kubectlCommand = kubectl
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if envMap["DB_PASSWORD"] != "s3cr3t" {
+			return fmt.Errorf("expected decoded DB_PASSWORD=s3cr3t from the later secret, got %s", envMap["DB_PASSWORD"])
+		}
+		if envMap["LOG_LEVEL"] != "debug" {
+			return fmt.Errorf("expected LOG_LEVEL=debug, got %s", envMap["LOG_LEVEL"])
+		}
+		if envMap["BLOB"] != "binary" {
+			return fmt.Errorf("expected BLOB=binary, got %s", envMap["BLOB"])
+		}
+		return nil
+	}
+
+	args := []string{"denv", "--isolate", "--k8s-configmap", "default/app", "--k8s-secret", "default/app"}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKubernetesError(t *testing.T) {
+	kubectl := writeFakeCommand(t, "kubectl", `echo 'Error from server (NotFound): secrets "app" not found' >&2; exit 1`)
+	defer func(orig string) { kubectlCommand = orig }(kubectlCommand)
+	kubectlCommand = kubectl
+
+	if _, err := readKubernetes(context.Background(), sourceK8sSecret, "default/app", ""); err == nil {
+		t.Fatal("expected error when kubectl fails")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// sourceSystem is the pseudo source standing for the system environment
+// where the system layer of --layer puts it.
+const sourceSystem = "system"
+
+// Layers of --layer, each selecting a group of sources.
+const (
+	layerSystem    = "system"
+	layerConfig    = "config"
+	layerFile      = "file"
+	layerSecrets   = "secrets"
+	layerOverrides = "overrides"
+)
+
+var layerNames = []string{layerSystem, layerConfig, layerFile, layerSecrets, layerOverrides}
+
+// remoteKinds are the backends a secrets:KIND layer can select.
+var remoteKinds = []string{sourceVault, sourceK8sSecret, sourceK8sConfigMap, sourceOnePassword, sourceS3, sourceGCS, sourceGit}
+
+// layer is one --layer: a group of sources, optionally narrowed by an
+// argument such as the path of file:.env.
+type layer struct {
+	Name string
+	Arg  string
+}
+
+func (l layer) String() string {
+	if l.Arg == "" {
+		return l.Name
+	}
+	return l.Name + ":" + l.Arg
+}
+
+func parseLayer(value string) (layer, error) {
+	name, arg, _ := strings.Cut(value, ":")
+	l := layer{Name: name, Arg: arg}
+	switch {
+	case !slices.Contains(layerNames, name):
+		return l, fmt.Errorf("unknown --layer %q (expected %s)", value, strings.Join(layerNames, ", "))
+	case arg != "" && name != layerFile && name != layerSecrets:
+		return l, fmt.Errorf("--layer %s takes no argument", name)
+	case name == layerSecrets && arg != "" && !slices.Contains(remoteKinds, arg):
+		return l, fmt.Errorf("unknown --layer %q (expected secrets:KIND with KIND one of %s)", value, strings.Join(remoteKinds, ", "))
+	}
+	return l, nil
+}
+
+// matches reports whether the layer selects file.
+func (l layer) matches(file EnvFile) bool {
+	switch l.Name {
+	case layerSystem:
+		return file.Kind == sourceSystem
+	case layerConfig:
+		return file.Kind == sourceConfig
+	case layerFile:
+		if file.Kind != sourceFile {
+			return false
+		}
+		if l.Arg == "" {
+			return true
+		}
+		ok, _ := filepath.Match(filepath.Clean(l.Arg), filepath.Clean(file.Path))
+		return ok
+	case layerSecrets:
+		return isRemoteSource(file) && (l.Arg == "" || file.Kind == l.Arg)
+	case layerOverrides:
+		return file.Kind == sourceTemporary
+	}
+	return false
+}
+
+// layeredSources returns the sources in the order of --layer, lowest
+// precedence first, or envFiles without it. A source belongs to the first
+// layer naming it with an argument, else to the first layer of its kind,
+// and keeps its relative order within the layer; sources no layer selects
+// are not loaded. With system, the system environment is a source where
+// the system layer is, so callers must not add it again.
+func layeredSources(c *cli.Context, system bool) ([]EnvFile, error) {
+	files := envFiles(c)
+	values := c.StringSlice("layer")
+	if len(values) == 0 {
+		return files, nil
+	}
+
+	var layers []layer
+	for _, value := range values {
+		l, err := parseLayer(value)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(layers, l) {
+			return nil, fmt.Errorf("--layer %s is given twice", l)
+		}
+		layers = append(layers, l)
+	}
+
+	candidates := files
+	if system {
+		candidates = append([]EnvFile{{Kind: sourceSystem}}, files...)
+	}
+	assigned := make([][]EnvFile, len(layers))
+	for _, file := range candidates {
+		i := slices.IndexFunc(layers, func(l layer) bool { return l.Arg != "" && l.matches(file) })
+		if i < 0 {
+			i = slices.IndexFunc(layers, func(l layer) bool { return l.Arg == "" && l.matches(file) })
+		}
+		if i >= 0 {
+			assigned[i] = append(assigned[i], file)
+		}
+	}
+
+	var ordered []EnvFile
+	for i, l := range layers {
+		// A misspelled path or backend would silently load nothing.
+		if l.Arg != "" && len(assigned[i]) == 0 {
+			return nil, fmt.Errorf("--layer %s matches no source", l)
+		}
+		ordered = append(ordered, assigned[i]...)
+	}
+	return ordered, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLayers(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for name, content := range map[string]string{
+		".env":       "PORT=2\nNAME=base\n",
+		".env.local": "PORT=3\nDEBUG=1\n",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PORT", "1")
+
+	list := func(args ...string) map[string]string {
+		t.Helper()
+		var env map[string]string
+		out := runListOutput(t, append(append([]string{"-f", ".env", "-f", ".env.local", "--on-conflict", "last-wins"}, args...), "list", "-o", "json")...)
+		if err := json.Unmarshal([]byte(out), &env); err != nil {
+			t.Fatal(err)
+		}
+		return env
+	}
+
+	if env := list(); env["PORT"] != "3" {
+		t.Errorf("expected the files to override the system, got PORT=%s", env["PORT"])
+	}
+	if env := list("--layer", "file", "--layer", "system"); env["PORT"] != "1" || env["NAME"] != "base" || env["PATH"] == "" {
+		t.Errorf("expected the system to override the files, got %v", env)
+	}
+	// A layer naming a file takes it out of the generic file layer.
+	if env := list("--layer", "system", "--layer", "file:.env.local", "--layer", "file"); env["PORT"] != "2" || env["DEBUG"] != "1" {
+		t.Errorf("expected .env to override .env.local, got %v", env)
+	}
+	// Sources without a layer are not loaded.
+	if env := list("--layer", "file:.env"); len(env) != 2 || env["PORT"] != "2" {
+		t.Errorf("expected only .env, got %v", env)
+	}
+	// Protected keys may come from the system layer in any position.
+	t.Setenv("PATH", "/usr/bin")
+	if env := list("--layer", "file", "--layer", "system"); env["PATH"] != "/usr/bin" {
+		t.Errorf("expected PATH from the system, got %q", env["PATH"])
+	}
+
+	for args, want := range map[string]string{
+		"--layer=files":                            `unknown --layer "files"`,
+		"--layer=system:x":                         "--layer system takes no argument",
+		"--layer=secrets:aws":                      `unknown --layer "secrets:aws"`,
+		"--layer=file:.env.prod":                   "--layer file:.env.prod matches no source",
+		"--layer=file --layer=system --layer=file": "--layer file is given twice",
+	} {
+		app := createRunApp()
+		app.Writer, app.ErrWriter = io.Discard, io.Discard
+		err := app.Run(append(append([]string{"denv", "-f", ".env"}, strings.Fields(args)...), "list"))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", args, want, err)
+		}
+	}
+}
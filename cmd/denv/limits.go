@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// limitedExecArg is the first argument with which denv re-executes itself
+// to apply the resource limits to its own process and then exec the
+// command, so the limits never bind denv itself and are in place before
+// the command runs.
+const limitedExecArg = "__denv-limited-exec"
+
+// resourceLimits are the exec resource controls. Zero values mean "not set".
+// They are passed to the re-executed denv as JSON.
+type resourceLimits struct {
+	Nice         int     `json:"nice,omitempty"`
+	NiceSet      bool    `json:"nice_set,omitempty"`
+	IOClass      int     `json:"io_class,omitempty"`
+	IOLevel      int     `json:"io_level,omitempty"`
+	MemoryBytes  uint64  `json:"memory_bytes,omitempty"`
+	CPUSeconds   uint64  `json:"cpu_seconds,omitempty"`
+	CPUQuota     float64 `json:"cpu_quota,omitempty"`
+	MaxOpenFiles uint64  `json:"max_open_files,omitempty"`
+	// Cgroup is the cgroup v2 directory the command joins, which enforces
+	// CPUQuota and MemoryBytes; without one MemoryBytes is an rlimit.
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+func (l resourceLimits) isSet() bool {
+	return l.NiceSet || l.IOClass != 0 || l.MemoryBytes != 0 || l.CPUSeconds != 0 || l.CPUQuota != 0 || l.MaxOpenFiles != 0
+}
+
+func parseResourceLimits(c *cli.Context) (resourceLimits, error) {
+	var l resourceLimits
+
+	if c.IsSet("nice") {
+		l.Nice = c.Int("nice")
+		l.NiceSet = true
+		if l.Nice < -20 || l.Nice > 19 {
+			return l, fmt.Errorf("--nice must be between -20 and 19")
+		}
+	}
+
+	if v := c.String("ionice"); v != "" {
+		class, level, err := parseIONice(v)
+		if err != nil {
+			return l, err
+		}
+		l.IOClass, l.IOLevel = class, level
+	}
+
+	if v := c.String("memory-limit"); v != "" {
+		n, err := parseSize(v)
+		if err != nil {
+			return l, fmt.Errorf("invalid --memory-limit: %w", err)
+		}
+		l.MemoryBytes = n
+	}
+
+	if c.IsSet("cpu-limit") {
+		l.CPUQuota = c.Float64("cpu-limit")
+		if l.CPUQuota <= 0 || math.IsInf(l.CPUQuota, 0) || math.IsNaN(l.CPUQuota) {
+			return l, fmt.Errorf("--cpu-limit must be a positive number of CPUs")
+		}
+	}
+
+	if d := c.Duration("cpu-time"); d > 0 {
+		l.CPUSeconds = uint64((d + 999_999_999) / 1_000_000_000)
+	}
+
+	if n := c.Uint64("max-open-files"); n > 0 {
+		l.MaxOpenFiles = n
+	}
+
+	return l, nil
+}
+
+// parseIONice parses "idle", "best-effort[:0-7]" or "realtime[:0-7]" into
+// a Linux I/O scheduling class and level.
+func parseIONice(v string) (class, level int, err error) {
+	name, lvl, hasLevel := strings.Cut(v, ":")
+	switch name {
+	case "realtime", "rt":
+		class = 1
+	case "best-effort", "be":
+		class = 2
+	case "idle":
+		class = 3
+	default:
+		return 0, 0, fmt.Errorf("invalid --ionice class %q (expected idle, best-effort or realtime)", name)
+	}
+
+	level = 4
+	if hasLevel {
+		level, err = strconv.Atoi(lvl)
+		if err != nil || level < 0 || level > 7 {
+			return 0, 0, fmt.Errorf("invalid --ionice level %q (expected 0-7)", lvl)
+		}
+	}
+	return class, level, nil
+}
+
+// parseSize parses a byte size such as 512M, 2G or 1048576.
+func parseSize(v string) (uint64, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := uint64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	hi, size := bits.Mul64(n, multiplier)
+	if hi != 0 {
+		return 0, fmt.Errorf("size %q is too large", v)
+	}
+	return size, nil
+}
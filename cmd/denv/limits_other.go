@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func limitCommand(cmd *exec.Cmd, l resourceLimits) (func(), error) {
+	if l.isSet() {
+		return func() {}, errors.New("resource limits are not supported on this platform")
+	}
+	return func() {}, nil
+}
+
+func runLimitedExec(args []string) {
+	os.Exit(exitFailure)
+}
@@ -0,0 +1,115 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// limitCommand rewrites cmd to start through a re-executed denv that
+// applies l to its own process before it execs the command, so the
+// command never runs unconstrained and denv keeps its own limits. The
+// returned cleanup removes the cgroup once the command has exited.
+func limitCommand(cmd *exec.Cmd, l resourceLimits) (cleanup func(), err error) {
+	cleanup = func() {}
+	// A command that was not found fails in Start as usual.
+	if !l.isSet() || cmd.Err != nil {
+		return cleanup, nil
+	}
+	self, err := selfExecutable()
+	if err != nil {
+		return cleanup, fmt.Errorf("failed to apply resource limits: %w", err)
+	}
+	if cleanup, err = prepareCgroup(&l); err != nil {
+		return func() {}, err
+	}
+	spec, err := json.Marshal(l)
+	if err != nil {
+		cleanup()
+		return func() {}, err
+	}
+	cmd.Args = append([]string{self, limitedExecArg, string(spec), cmd.Path}, cmd.Args...)
+	cmd.Path = self
+	return cleanup, nil
+}
+
+// runLimitedExec is the re-executed denv: args are the limits, the path
+// of the command and its argv. It never returns.
+func runLimitedExec(args []string) {
+	// Niceness and I/O priority are per-thread on Linux; the thread that
+	// sets them must be the one that execs.
+	runtime.LockOSThread()
+
+	var l resourceLimits
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "denv: invalid limited exec")
+		os.Exit(exitFailure)
+	}
+	if err := json.Unmarshal([]byte(args[0]), &l); err != nil {
+		fmt.Fprintf(os.Stderr, "denv: invalid limited exec: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	if err := l.applyToSelf(); err != nil {
+		fmt.Fprintf(os.Stderr, "denv: %v\n", err)
+		os.Exit(exitFailure)
+	}
+
+	err := syscall.Exec(args[1], args[2:], os.Environ())
+	fmt.Fprintf(os.Stderr, "denv: failed to start command: %v\n", err)
+	if errors.Is(err, os.ErrPermission) {
+		os.Exit(exitNotExecutable)
+	}
+	os.Exit(exitNotFound)
+}
+
+// applyToSelf applies the limits to the calling thread and process; they
+// carry over into the command it then execs.
+func (l resourceLimits) applyToSelf() error {
+	if l.Cgroup != "" {
+		if err := joinCgroup(l.Cgroup); err != nil {
+			return fmt.Errorf("failed to join cgroup %s: %w", l.Cgroup, err)
+		}
+	}
+	if l.NiceSet {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, l.Nice); err != nil {
+			return fmt.Errorf("failed to apply --nice: %w", err)
+		}
+	}
+	if l.IOClass != 0 {
+		if err := setIOPriority(0, l.IOClass, l.IOLevel); err != nil {
+			return fmt.Errorf("failed to apply --ionice: %w", err)
+		}
+	}
+
+	// The cgroup limits actual memory use; without one, the address space
+	// is the closest rlimit.
+	memory := l.MemoryBytes
+	if l.Cgroup != "" {
+		memory = 0
+	}
+	limits := []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"--memory-limit", syscall.RLIMIT_AS, memory},
+		{"--cpu-time", syscall.RLIMIT_CPU, l.CPUSeconds},
+		{"--max-open-files", syscall.RLIMIT_NOFILE, l.MaxOpenFiles},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		rlim := syscall.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := syscall.Setrlimit(limit.resource, &rlim); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", limit.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]uint64{
+		"1024": 1024,
+		"512M": 512 << 20,
+		"2G":   2 << 30,
+		"1GiB": 1 << 30,
+		"64kb": 64 << 10,
+	}
+	for in, expected := range cases {
+		got, err := parseSize(in)
+		if err != nil || got != expected {
+			t.Errorf("parseSize(%q) = %d, %v; expected %d", in, got, err, expected)
+		}
+	}
+	if _, err := parseSize("lots"); err == nil {
+		t.Error("expected error for invalid size")
+	}
+	if _, err := parseSize("20000000T"); err == nil {
+		t.Error("expected error for a size overflowing 64 bits")
+	}
+}
+
+func TestParseIONice(t *testing.T) {
+	if class, level, err := parseIONice("best-effort:7"); err != nil || class != 2 || level != 7 {
+		t.Errorf("unexpected result %d %d %v", class, level, err)
+	}
+	if class, _, err := parseIONice("idle"); err != nil || class != 3 {
+		t.Errorf("unexpected result %d %v", class, err)
+	}
+	if _, _, err := parseIONice("fast"); err == nil {
+		t.Error("expected error for unknown class")
+	}
+}
+
+func TestExecNice(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads niceness from /proc")
+	}
+
+	out := filepath.Join(t.TempDir(), "stat")
+	captureExit(t)
+	// The priority is set before the command starts, so its very first
+	// sample of its niceness (field 19 of /proc/self/stat) sees it.
+	args := []string{"denv", "exec", "--nice", "5", "--stdout", out, "cut", "-d", " ", "-f19", "/proc/self/stat"}
+	if err := createExecApp().Run(args); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(out)
+	if strings.TrimSpace(string(data)) != "5" {
+		t.Errorf("expected niceness 5, got %q", data)
+	}
+}
+
+func TestExecMaxOpenFiles(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("rlimits are not supported")
+	}
+
+	var before syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &before); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "ulimit")
+	captureExit(t)
+	args := []string{"denv", "exec", "--max-open-files", "64", "--stdout", out, "sh", "-c", "ulimit -n"}
+	if err := createExecApp().Run(args); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(out)
+	if strings.TrimSpace(string(data)) != "64" {
+		t.Errorf("expected the command to be limited to 64 files, got %q", data)
+	}
+	// The limit binds only the command, never denv itself.
+	var after syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &after); err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("expected denv's own limit to stay %+v, got %+v", before, after)
+	}
+}
+
+func TestExecCPULimitInvalid(t *testing.T) {
+	captureExit(t)
+	err := createExecApp().Run([]string{"denv", "exec", "--cpu-limit", "0", "true"})
+	if err == nil || !strings.Contains(err.Error(), "--cpu-limit") {
+		t.Errorf("expected an invalid --cpu-limit error, got %v", err)
+	}
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/urfave/cli/v2"
+)
+
+// lspMessage is a JSON-RPC 2.0 request, response or notification of the
+// language server protocol.
+type lspMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *lspError       `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes.
+const (
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+)
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+// Severities of diagnostics.
+const (
+	lspSeverityError   = 1
+	lspSeverityWarning = 2
+)
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspPositionParams struct {
+	TextDocument lspTextDocument `json:"textDocument"`
+	Position     lspPosition     `json:"position"`
+}
+
+// lspServer serves the open env files of an editor. Hover and definition
+// use the sources denv was started with, e.g. denv -f .env -f .env.local lsp.
+type lspServer struct {
+	c        *cli.Context
+	out      io.Writer
+	docs     map[string]string
+	shutdown bool
+}
+
+// readLSPMessage reads a message framed by a Content-Length header.
+func readLSPMessage(r *bufio.Reader) (*lspMessage, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	var msg lspMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return &msg, nil
+}
+
+func (s *lspServer) send(msg lspMessage) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *lspServer) notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.send(lspMessage{Method: method, Params: data})
+}
+
+// runLSP serves the language server protocol on stdin and stdout until the
+// editor sends exit.
+func runLSP(c *cli.Context) error {
+	s := &lspServer{c: c, out: c.App.Writer, docs: make(map[string]string)}
+	r := bufio.NewReader(c.App.Reader)
+	for {
+		msg, err := readLSPMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return withExitCode(exitFailure, errors.New("exit before shutdown"))
+			}
+			return nil
+		}
+		result, rpcErr := s.handle(msg)
+		if msg.ID == nil {
+			continue
+		}
+		reply := lspMessage{ID: msg.ID, Result: result, Error: rpcErr}
+		if rpcErr == nil && result == nil {
+			reply.Result = json.RawMessage("null")
+		}
+		if err := s.send(reply); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches a request or notification and returns the result of a
+// request.
+func (s *lspServer) handle(msg *lspMessage) (any, *lspError) {
+	var params struct {
+		lspPositionParams
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+	}
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+	}
+	uri := params.TextDocument.URI
+
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				// Full document sync.
+				"textDocumentSync":   1,
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "denv"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		s.docs[uri] = params.TextDocument.Text
+		s.publish(uri)
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			s.docs[uri] = params.ContentChanges[n-1].Text
+		}
+		s.publish(uri)
+	case "textDocument/didSave":
+		s.publish(uri)
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": []lspDiagnostic{}})
+	case "textDocument/hover":
+		return s.hover(uri, params.Position), nil
+	case "textDocument/definition":
+		return s.definition(uri, params.Position), nil
+	default:
+		if msg.ID != nil {
+			return nil, &lspError{Code: lspMethodNotFound, Message: "method not found: " + msg.Method}
+		}
+	}
+	return nil, nil
+}
+
+// uriPath returns the file path of a file: URI.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathURI returns the file: URI of a path.
+func pathURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// docSource returns the loaded source an open document is, or a dotenv
+// file source for documents that are not loaded.
+func (s *lspServer) docSource(uri string) EnvFile {
+	path := uriPath(uri)
+	for _, file := range envFiles(s.c) {
+		if file.Kind == sourceFile && sameFile(file.Path, path) {
+			return file
+		}
+	}
+	return EnvFile{Path: path}
+}
+
+func sameFile(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
+
+// docEntries parses an open document in the format of its source.
+func (s *lspServer) docEntries(uri string) ([]envEntry, error) {
+	file := s.docSource(uri)
+	return parseEnvFormat([]byte(s.docs[uri]), parseOptions{Format: file.Format})
+}
+
+// lineRange spans line n (1-based) of text.
+func lineRange(text string, n int) lspRange {
+	lines := strings.Split(text, "\n")
+	width := 0
+	if n >= 1 && n <= len(lines) {
+		width = len(utf16.Encode([]rune(strings.TrimSuffix(lines[n-1], "\r"))))
+	}
+	return lspRange{Start: lspPosition{Line: n - 1}, End: lspPosition{Line: n - 1, Character: width}}
+}
+
+// diagnostics checks an open document like denv validate: parse errors,
+// invalid annotations, values violating them, required keys with
+// placeholder values, references defined nowhere and duplicate keys.
+func (s *lspServer) diagnostics(uri string) []lspDiagnostic {
+	text := s.docs[uri]
+	diags := []lspDiagnostic{}
+	add := func(line, severity int, format string, args ...any) {
+		diags = append(diags, lspDiagnostic{Range: lineRange(text, line), Severity: severity, Source: "denv", Message: fmt.Sprintf(format, args...)})
+	}
+
+	entries, err := s.docEntries(uri)
+	if err != nil {
+		var parseErr *parseError
+		line := 1
+		if errors.As(err, &parseErr) {
+			line = parseErr.Line
+		}
+		add(line, lspSeverityError, "%v", err)
+		return diags
+	}
+
+	// References may be defined by any loaded source.
+	loaded, _, _ := loadEnvOrigins(s.c)
+	defined := make(map[string]int)
+	for _, e := range entries {
+		if line, ok := defined[e.Key]; ok {
+			add(e.Line, lspSeverityWarning, "%s is already set on line %d", e.Key, line)
+		}
+		defined[e.Key] = e.Line
+
+		spec := &keySpec{}
+		if err := spec.apply(e); err != nil {
+			var parseErr *parseError
+			if errors.As(err, &parseErr) {
+				err = parseErr.Err
+			}
+			add(e.Line, lspSeverityError, "%s: %v", e.Key, err)
+			continue
+		}
+		if err := spec.validate(e.Value); err != nil {
+			add(e.Line, lspSeverityError, "%s: %v", e.Key, err)
+		} else if spec.Required && obviouslyEmpty(e.Value) {
+			add(e.Line, lspSeverityError, "%s is required but has the placeholder value %q", e.Key, e.Value)
+		}
+		for _, name := range e.Unresolved {
+			if _, ok := loaded[name]; !ok {
+				add(e.Line, lspSeverityWarning, "%s references %s, which is not defined anywhere", e.Key, name)
+			}
+		}
+	}
+	return diags
+}
+
+func (s *lspServer) publish(uri string) {
+	s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": s.diagnostics(uri)})
+}
+
+// keyAt returns the variable at pos in an open document: a $NAME or
+// ${NAME} reference under the cursor, or else the key assigned on that
+// line.
+func (s *lspServer) keyAt(uri string, pos lspPosition) string {
+	lines := strings.Split(s.docs[uri], "\n")
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return ""
+	}
+	line := lines[pos.Line]
+	col := utf16Offset(line, pos.Character)
+	for i := 0; i < len(line); i++ {
+		if line[i] != '$' {
+			continue
+		}
+		start := i + 1
+		if start < len(line) && line[start] == '{' {
+			start++
+		}
+		end := start
+		for end < len(line) && isVarNameChar(line[end]) {
+			end++
+		}
+		if end > start && col >= i && col <= end {
+			return line[start:end]
+		}
+	}
+
+	entries, err := s.docEntries(uri)
+	if err != nil {
+		return ""
+	}
+	// Comments above an assignment, such as its annotations, belong to it.
+	for _, e := range entries {
+		if pos.Line+1 >= e.Line-len(e.Comments) && pos.Line+1 <= max(e.Line, e.EndLine) {
+			return e.Key
+		}
+	}
+	return ""
+}
+
+// utf16Offset converts an LSP character offset on line to a byte offset.
+func utf16Offset(line string, character int) int {
+	units := 0
+	for i, r := range line {
+		if units >= character {
+			return i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(line)
+}
+
+// hover describes the variable under the cursor: its resolved value,
+// masked for likely secrets unless --show-secrets is set, the source it
+// comes from and its description.
+func (s *lspServer) hover(uri string, pos lspPosition) any {
+	key := s.keyAt(uri, pos)
+	if key == "" {
+		return nil
+	}
+	var b strings.Builder
+	envMap, origins, err := loadEnvOrigins(s.c)
+	if err != nil {
+		fmt.Fprintf(&b, "`%s`\n\nfailed to load the sources: %v", key, err)
+	} else if v, ok := envMap[key]; ok {
+		if !s.c.Bool("show-secrets") && secretKeys(s.c, envMap, origins, defaultSecretKeys)[key] {
+			v = maskedValue
+		}
+		fmt.Fprintf(&b, "`%s=%s`\n\nfrom %s", key, v, origins[key])
+	} else {
+		fmt.Fprintf(&b, "`%s` is not set by the loaded sources", key)
+	}
+
+	if entries, err := s.docEntries(uri); err == nil {
+		for _, e := range entries {
+			if e.Key != key {
+				continue
+			}
+			if _, ok := envMap[key]; !ok && err == nil {
+				fmt.Fprintf(&b, "; this file sets it to `%s`", e.Value)
+			}
+			if d := e.description(); d != "" {
+				b.WriteString("\n\n" + d)
+			}
+			break
+		}
+	}
+	return map[string]any{"contents": map[string]string{"kind": "markdown", "value": b.String()}}
+}
+
+// definition returns every assignment of the variable under the cursor in
+// the loaded file sources and the open document, in load order.
+func (s *lspServer) definition(uri string, pos lspPosition) []lspLocation {
+	key := s.keyAt(uri, pos)
+	locations := []lspLocation{}
+	if key == "" {
+		return locations
+	}
+	seen := false
+	for _, file := range envFiles(s.c) {
+		if file.Kind != sourceFile {
+			continue
+		}
+		fileURI := pathURI(file.Path)
+		text, open := s.docs[fileURI]
+		var entries []envEntry
+		if open {
+			entries, _ = s.docEntries(fileURI)
+			seen = seen || fileURI == uri
+		} else {
+			entries = fileEntries(s.c, file)
+		}
+		for _, e := range entries {
+			if e.Key == key {
+				if !open {
+					text = ""
+				}
+				locations = append(locations, lspLocation{URI: fileURI, Range: lineRange(text, e.Line)})
+			}
+		}
+	}
+	if !seen {
+		entries, _ := s.docEntries(uri)
+		for _, e := range entries {
+			if e.Key == key {
+				locations = append(locations, lspLocation{URI: uri, Range: lineRange(s.docs[uri], e.Line)})
+			}
+		}
+	}
+	return locations
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestLSP(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	if err := os.WriteFile(base, []byte("PORT=80\nAPI_TOKEN=s3cr3t-value\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The open document differs from the file on disk.
+	if err := os.WriteFile(local, []byte(""), 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc := "# Port of the API server\n" +
+		"# denv:type=integer\n" +
+		"PORT=80x\n" +
+		"URL=http://localhost:$PORT/$MISSING\n" +
+		"URL=again\n"
+	uri := pathURI(local)
+
+	var in bytes.Buffer
+	id := 0
+	send := func(method string, params any) {
+		id++
+		p, _ := json.Marshal(params)
+		msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":%s}`, id, method, p)
+		if strings.HasPrefix(method, "textDocument/did") || method == "exit" {
+			msg = fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"params":%s}`, method, p)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	position := func(line, character int) map[string]any {
+		return map[string]any{"textDocument": map[string]string{"uri": uri}, "position": map[string]int{"line": line, "character": character}}
+	}
+	send("initialize", map[string]any{})
+	send("textDocument/didOpen", map[string]any{"textDocument": map[string]string{"uri": uri, "text": doc}})
+	send("textDocument/hover", position(3, 23))
+	send("textDocument/definition", position(3, 23))
+	send("textDocument/hover", position(1, 0))
+	send("unknown/method", map[string]any{})
+	send("shutdown", nil)
+	send("exit", nil)
+
+	var out bytes.Buffer
+	app, _ := newApp()
+	app.Reader = &in
+	app.Writer = &out
+	app.Commands = []*cli.Command{{Name: "lsp", Action: runLSP}}
+	if err := app.Run([]string{"denv", "--isolate", "-f", base, "-f", local, "lsp"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var msgs []map[string]any
+	r := bufio.NewReader(&out)
+	for {
+		msg, err := readLSPMessage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(msg)
+		var m map[string]any
+		json.Unmarshal(data, &m)
+		msgs = append(msgs, m)
+	}
+	if len(msgs) != 7 {
+		t.Fatalf("expected 7 messages, got %d: %v", len(msgs), msgs)
+	}
+	dump := func(v any) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	if got := dump(msgs[0]["result"]); !strings.Contains(got, `"hoverProvider":true`) {
+		t.Errorf("unexpected initialize result %s", got)
+	}
+	diags := dump(msgs[1]["params"])
+	for _, want := range []string{
+		`"message":"PORT: expected integer, got \"80x\"","range":{"end":{"character":8,"line":2},"start":{"character":0,"line":2}},"severity":1`,
+		`URL references MISSING, which is not defined anywhere`,
+		`URL is already set on line 4`,
+	} {
+		if !strings.Contains(diags, want) {
+			t.Errorf("expected diagnostic %s in %s", want, diags)
+		}
+	}
+	if strings.Contains(diags, "references PORT") {
+		t.Errorf("unexpected diagnostic for a defined reference in %s", diags)
+	}
+	if got := dump(msgs[2]["result"]); !strings.Contains(got, "`PORT=80`\\n\\nfrom "+base) || !strings.Contains(got, "Port of the API server") {
+		t.Errorf("unexpected hover %s", got)
+	}
+	// Messages were decoded into maps, which marshal with sorted keys.
+	var locations any
+	json.Unmarshal([]byte(dump([]lspLocation{
+		{URI: pathURI(base), Range: lspRange{Start: lspPosition{Line: 0}, End: lspPosition{Line: 0}}},
+		{URI: uri, Range: lspRange{Start: lspPosition{Line: 2}, End: lspPosition{Line: 2, Character: 8}}},
+	})), &locations)
+	want := dump(locations)
+	if got := dump(msgs[3]["result"]); got != want {
+		t.Errorf("expected definitions %s, got %s", want, got)
+	}
+	if got := dump(msgs[4]["result"]); !strings.Contains(got, "`PORT=80`") {
+		t.Errorf("unexpected hover on an annotation %s", got)
+	}
+	if msgs[5]["error"] == nil {
+		t.Errorf("expected an error for an unknown method, got %v", msgs[5])
+	}
+	if msgs[6]["result"] != nil || msgs[6]["id"] == nil {
+		t.Errorf("unexpected shutdown response %v", msgs[6])
+	}
+}
+
+func TestLSPMasksSecrets(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("API_TOKEN=s3cr3t-value\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app, _ := newApp()
+	app.Commands = []*cli.Command{{Name: "lsp", Action: func(c *cli.Context) error {
+		s := &lspServer{c: c, docs: map[string]string{"file:///x.env": "API_TOKEN=x\n"}}
+		got, _ := json.Marshal(s.hover("file:///x.env", lspPosition{Line: 0, Character: 2}))
+		if !strings.Contains(string(got), "`API_TOKEN=***`") {
+			t.Errorf("expected a masked value, got %s", got)
+		}
+		return nil
+	}}}
+	if err := app.Run([]string{"denv", "--isolate", "-f", envFile, "lsp"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,29 +1,93 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"maps"
 	"os"
-	"os/exec"
-	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
-	"syscall"
+	"sync"
+	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/urfave/cli/v2"
 )
 
+const (
+	sourceFile  = ""
+	sourceVault = "vault"
+
+	sourceK8sSecret    = "secret"
+	sourceK8sConfigMap = "configmap"
+
+	sourceOnePassword = "op"
+
+	// sourceConfig is the env section of the project config.
+	sourceConfig = "config"
+)
+
 type EnvFile struct {
 	Path     string
 	Optional bool
+	Kind     string
+	// Format selects the parser of a file source, "" for dotenv.
+	Format string
+	// FromConfig marks sources listed in the project config.
+	FromConfig bool
+	// Verify is the --verify check of a remote file source, see parseVerify.
+	Verify string
+	// Policy sets the timeout, retries and failure handling of a remote
+	// source.
+	Policy sourcePolicy
 }
 
+// String returns the path of a file source, or kind:path for other sources.
+func (f EnvFile) String() string {
+	if f.Kind == sourceFile {
+		return f.Path + formatSuffix(f)
+	}
+	if f.Kind == sourceSystem {
+		return sourceEnvironment
+	}
+	if isObjectSource(f) {
+		return f.Kind + "://" + f.Path
+	}
+	if f.Kind == sourceGit {
+		return "git::" + f.Path
+	}
+	return f.Kind + ":" + f.Path
+}
+
+// Policies for a key defined with different values by several sources.
+const (
+	conflictError     = "error"
+	conflictWarn      = "warn"
+	conflictFirstWins = "first-wins"
+	conflictLastWins  = "last-wins"
+)
+
+var conflictPolicies = []string{conflictError, conflictWarn, conflictFirstWins, conflictLastWins}
+
+// defaultProtectedKeys are keys that sources may not set without
+// --allow-protected, since they let an env file hijack the launched process.
+var defaultProtectedKeys = []string{"PATH", "HOME", "LD_PRELOAD", "LD_LIBRARY_PATH", "DYLD_*"}
+
+// sourceEnvironment is the origin reported for inherited system variables.
+const sourceEnvironment = "environment"
+
 type envFileFlag struct {
 	files    *[]EnvFile
 	optional bool
+	kind     string
 }
 
 func (f *envFileFlag) String() string {
@@ -34,168 +98,1549 @@ func (f *envFileFlag) Set(value string) error {
 	if value == "" {
 		return nil
 	}
-	*f.files = append(*f.files, EnvFile{Path: value, Optional: f.optional})
+	file := EnvFile{Path: value, Optional: f.optional, Kind: f.kind}
+	if f.kind == sourceFile {
+		if src, ok, err := gitFileSource(value); err != nil {
+			return err
+		} else if ok {
+			src.Optional = f.optional
+			*f.files = append(*f.files, src)
+			return nil
+		}
+		var err error
+		if file.Path, file.Format, err = splitFormat(value); err != nil {
+			return err
+		}
+		if kind, path, ok, err := objectSource(file.Path); err != nil {
+			return err
+		} else if ok {
+			file.Kind, file.Path = kind, path
+		}
+	}
+	*f.files = append(*f.files, file)
 	return nil
 }
 
 func main() {
-	var files []EnvFile
+	if len(os.Args) > 1 && os.Args[1] == limitedExecArg {
+		runLimitedExec(os.Args[2:])
+	}
 
-	app := &cli.App{
-		Name:  "denv",
-		Usage: "A simple CLI utility to manage environment variables from .env files",
-		Flags: []cli.Flag{
-			&cli.GenericFlag{
-				Name:    "file",
-				Aliases: []string{"f"},
-				Usage:   "path to .env file",
-				Value:   &envFileFlag{files: &files, optional: false},
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name:      "exec",
+			Usage:     "Execute a command with the loaded environment variables",
+			ArgsUsage: "[--] <COMMAND> [ARGS...]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "propagate-signal",
+					Usage: "when the command is killed by a signal, terminate denv with the same signal",
+				},
+				&cli.StringFlag{
+					Name:  "stdin",
+					Usage: "read the command's stdin from `FILE` ($VARS are expanded)",
+				},
+				&cli.StringFlag{
+					Name:  "stdout",
+					Usage: "write the command's stdout to `FILE` ($VARS are expanded)",
+				},
+				&cli.StringFlag{
+					Name:  "stderr",
+					Usage: "write the command's stderr to `FILE` ($VARS are expanded)",
+				},
+				&cli.BoolFlag{
+					Name:  "append",
+					Usage: "append to --stdout/--stderr files instead of truncating them",
+				},
+				&cli.IntFlag{
+					Name:  "nice",
+					Usage: "run the command with niceness `N` (-20..19)",
+				},
+				&cli.StringFlag{
+					Name:  "ionice",
+					Usage: "I/O scheduling `CLASS[:LEVEL]`: idle, best-effort or realtime (Linux)",
+				},
+				&cli.StringFlag{
+					Name:  "memory-limit",
+					Usage: "limit the command's memory, e.g. 512M or 2G (a cgroup v2 limit where available, else its address space)",
+				},
+				&cli.Float64Flag{
+					Name:  "cpu-limit",
+					Usage: "limit the command to `CPUS` CPUs, e.g. 0.5 (cgroup v2, Linux)",
+				},
+				&cli.DurationFlag{
+					Name:  "cpu-time",
+					Usage: "limit the command's total CPU time, e.g. 30s or 5m",
+				},
+				&cli.Uint64Flag{
+					Name:  "max-open-files",
+					Usage: "limit the number of open file descriptors",
+				},
+				&cli.BoolFlag{
+					Name:  "env-file-tmp",
+					Usage: "write the environment to a private temporary file, pass its path as $DENV_ENV_FILE and remove it on exit",
+				},
+				&cli.StringFlag{
+					Name:  "env-file-format",
+					Usage: "format of the --env-file-tmp file (dotenv, docker)",
+					Value: "dotenv",
+				},
+				&cli.BoolFlag{
+					Name:  "mask-output",
+					Usage: "replace values of likely secrets in the command's stdout and stderr with ***",
+				},
+				&cli.BoolFlag{
+					Name:  "trace-usage",
+					Usage: "report which variables from the sources the command looked up (Linux, dynamically linked programs; needs a C compiler)",
+				},
+				&cli.StringFlag{
+					Name:  "trace-report",
+					Usage: "write the --trace-usage report as JSON to `FILE` instead of stderr",
+				},
+				&cli.StringSliceFlag{
+					Name:  "wait-for",
+					Usage: "wait until `TARGET` is reachable before starting the command: tcp://HOST:PORT or an http(s):// URL answering 2xx/3xx, $VARS expanded from the environment (repeatable)",
+				},
+				&cli.DurationFlag{
+					Name:  "wait-timeout",
+					Usage: "give up waiting for --wait-for after `DURATION` (0 waits indefinitely)",
+					Value: 30 * time.Second,
+				},
 			},
-			&cli.GenericFlag{
-				Name:    "file-optional",
-				Aliases: []string{"fo"},
-				Usage:   "path to .env file (optional, ignore if missing)",
-				Value:   &envFileFlag{files: &files, optional: true},
+			Action: runExec,
+		},
+		{
+			Name:      "run",
+			Usage:     "Run a command defined under run: in denv.yaml; lists the targets without a name",
+			ArgsUsage: "[NAME] [ARGS...]",
+			Action:    runRun,
+		},
+		{
+			Name:  "status",
+			Usage: "Summarize the config, sources, validation problems, cache state and temporary variables",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "clear-temporary",
+					Usage: "remove the temporary variables of this directory",
+				},
 			},
-			&cli.BoolFlag{
-				Name:    "isolate",
-				Aliases: []string{"i"},
-				Usage:   "ignore system environment variables (load only from .env files)",
+			Action: runStatus,
+		},
+		{
+			Name:      "ssh",
+			Usage:     "Run a command on a remote host with the loaded variables injected",
+			ArgsUsage: "<DESTINATION> [SSH OPTIONS] -- <COMMAND> [ARGS...]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "via-file",
+					Usage: "transfer variables through a temporary remote file instead of an env(1) prefix",
+				},
 			},
+			Action: runSSH,
 		},
-		Before: func(c *cli.Context) error {
-			if c.App.Metadata == nil {
-				c.App.Metadata = make(map[string]any)
-			}
-			c.App.Metadata["files"] = &files
-			return nil
+		{
+			Name:      "get",
+			Usage:     "Get the value of a specific environment variable",
+			ArgsUsage: "<KEY>",
+			Action:    runGet,
+		},
+		{
+			Name:  "keys",
+			Usage: "List all available environment variable keys",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "output format (text, json)",
+					Value:   "text",
+				},
+				&cli.BoolFlag{
+					Name:    "null",
+					Aliases: []string{"z"},
+					Usage:   "end each key with NUL instead of a newline",
+				},
+			},
+			Action: runKeys,
 		},
-		Commands: []*cli.Command{
-			{
-				Name:            "exec",
-				Usage:           "Execute a command with the loaded environment variables",
-				SkipFlagParsing: true,
-				Action:          runExec,
+		{
+			Name:  "list",
+			Usage: "List all environment variables in KEY=VALUE format",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "output format (text, json, csv, ndjson, cmd for batch files, ps1)",
+					Value:   "text",
+				},
+				&cli.StringFlag{
+					Name:  "group-by",
+					Usage: "group variables under a header per `source`",
+				},
+				&cli.BoolFlag{
+					Name:  "with-meta",
+					Usage: "include the source and description of each key in json output",
+				},
+				&cli.BoolFlag{
+					Name:    "null",
+					Aliases: []string{"z"},
+					Usage:   "end each KEY=VALUE with NUL instead of a newline, so values may contain newlines",
+				},
+				&cli.BoolFlag{
+					Name:  "copy",
+					Usage: "put the output on the system clipboard instead of printing it",
+				},
 			},
-			{
-				Name:      "get",
-				Usage:     "Get the value of a specific environment variable",
-				ArgsUsage: "<KEY>",
-				Action:    runGet,
+			Action: runList,
+		},
+		{
+			Name:      "set",
+			Usage:     "Set a variable in the last -f file (default .env); reads the value from stdin when omitted",
+			ArgsUsage: "<KEY> [VALUE]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "type",
+					Usage: "check the value against `TYPE` (string, integer, number, boolean, url, duration, json) and annotate new keys with it",
+				},
 			},
-			{
-				Name:  "keys",
-				Usage: "List all available environment variable keys",
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:    "output",
-						Aliases: []string{"o"},
-						Usage:   "output format (text, json)",
-						Value:   "text",
-					},
+			Action: runSet,
+		},
+		{
+			Name:      "fmt",
+			Usage:     "Normalize the formatting of .env files, preserving multiline values",
+			ArgsUsage: "[FILE...]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "check",
+					Usage: "only report files that are not formatted",
+				},
+			},
+			Action: runFmt,
+		},
+		{
+			Name:  "merge",
+			Usage: "Write the merged sources into a single env file",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "file to write (default: stdout)",
+				},
+				&cli.BoolFlag{
+					Name:  "annotate",
+					Usage: "precede each key with a '# from: file:line' comment",
+				},
+			},
+			Action: runMerge,
+		},
+		{
+			Name:  "convert",
+			Usage: "Write the merged sources as dotenv, docker, yaml or json, encoding values by their denv:type",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "to",
+					Usage: "output format (dotenv, docker, yaml, json)",
+					Value: "dotenv",
+				},
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "file to write (default: stdout)",
+				},
+			},
+			Action: runConvert,
+		},
+		{
+			Name:  "guard",
+			Usage: "Fail if staged git changes contain values of secret keys",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "secret-key",
+					Usage: "treat keys matching the glob `PATTERN` as secrets (repeatable)",
+					Value: cli.NewStringSlice(defaultSecretKeys...),
+				},
+				&cli.BoolFlag{
+					Name:  "install",
+					Usage: "install guard as the git pre-commit hook",
+				},
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "replace an existing pre-commit hook",
+				},
+			},
+			Action: runGuard,
+		},
+		{
+			Name:  "secret",
+			Usage: "Store personal secrets in the OS keychain, referenced from env files as keyring://KEY",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "set",
+					Usage:     "Store a value in the keychain; reads it from stdin when omitted",
+					ArgsUsage: "<KEY> [VALUE]",
+					Action:    runSecretSet,
+				},
+				{
+					Name:      "get",
+					Usage:     "Print a value stored in the keychain",
+					ArgsUsage: "<KEY>",
+					Action:    runSecretGet,
+				},
+				{
+					Name:      "delete",
+					Usage:     "Remove a value from the keychain",
+					ArgsUsage: "<KEY>",
+					Action:    runSecretDelete,
 				},
-				Action: runKeys,
 			},
-			{
-				Name:  "list",
-				Usage: "List all environment variables in KEY=VALUE format",
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:    "output",
-						Aliases: []string{"o"},
-						Usage:   "output format (text, json)",
-						Value:   "text",
+		},
+		{
+			Name:  "snapshot",
+			Usage: "Save the fully resolved environment and replay it later",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "save",
+					Usage:     "Save the resolved environment, secrets included, encrypted at rest",
+					ArgsUsage: "<NAME>",
+					Flags:     snapshotFlags(),
+					Action:    runSnapshotSave,
+				},
+				{
+					Name:      "exec",
+					Usage:     "Run a command with exactly the environment of a snapshot",
+					ArgsUsage: "<NAME> [--] <command> [args...]",
+					Flags:     snapshotFlags(),
+					Action:    runSnapshotExec,
+				},
+				{
+					Name:   "list",
+					Usage:  "List saved snapshots",
+					Flags:  snapshotFlags(),
+					Action: runSnapshotList,
+				},
+			},
+		},
+		{
+			Name:      "grep",
+			Usage:     "Search keys and values across all sources, printing where they are defined",
+			ArgsUsage: "<PATTERN>",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:    "ignore-case",
+					Aliases: []string{"i"},
+					Usage:   "match case-insensitively",
+				},
+				&cli.StringSliceFlag{
+					Name:  "mask",
+					Usage: "mask values of keys matching the glob `PATTERN` (repeatable)",
+					Value: cli.NewStringSlice(defaultSecretKeys...),
+				},
+				&cli.BoolFlag{
+					Name:  "no-mask",
+					Usage: "print secret values in clear text",
+				},
+			},
+			Action: runGrep,
+		},
+		{
+			Name:  "schema",
+			Usage: "Work with the environment contract",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "export",
+					Usage: "Print a JSON Schema inferred from the sources and their denv: annotations",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "output",
+							Aliases: []string{"o"},
+							Usage:   "file to write (default: stdout)",
+						},
 					},
+					Action: runSchemaExport,
+				},
+			},
+		},
+		{
+			Name:  "codegen",
+			Usage: "Generate typed config accessors from the sources and their denv: annotations",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "lang",
+					Value: "go",
+					Usage: "language to generate (go, typescript, python)",
+				},
+				&cli.StringFlag{
+					Name:  "package",
+					Value: "config",
+					Usage: "Go package name of the generated file",
+				},
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "file to write (default: stdout)",
+				},
+			},
+			Action: runCodegen,
+		},
+		{
+			Name:      "wrap",
+			Usage:     "Generate a wrapper script that runs a command through denv with the current flags",
+			ArgsUsage: "<command> [args...]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "out",
+					Usage: "wrapper script to write",
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: "wrapper type (sh, bat; default: bat on Windows, sh elsewhere)",
+				},
+			},
+			Action: runWrap,
+		},
+		{
+			Name:      "rotate",
+			Usage:     "Replace a key with the output of a generator command and run a reload command",
+			ArgsUsage: "<KEY>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "command",
+					Usage: "shell `COMMAND` printing the new value",
+				},
+				&cli.StringFlag{
+					Name:  "vault-secret",
+					Usage: "write the value to this Vault KV v2 secret `PATH` instead of the env file",
+				},
+				&cli.StringFlag{
+					Name:    "reload",
+					Usage:   "shell `COMMAND` run with the updated environment after rotating",
+					EnvVars: []string{"DENV_RELOAD_COMMAND"},
+				},
+			},
+			Action: runRotate,
+		},
+		{
+			Name:   "refresh",
+			Usage:  "Re-fetch expired secret references annotated with '# denv:ttl=DURATION' into the cache",
+			Action: runRefresh,
+		},
+		{
+			Name:  "serve",
+			Usage: "Serve the merged environment over a read-only HTTP API",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "addr",
+					Usage: "listen address",
+					Value: "127.0.0.1:7070",
+				},
+				&cli.StringFlag{
+					Name:    "token",
+					Usage:   "require `TOKEN` as a bearer token on /env endpoints",
+					EnvVars: []string{"DENV_SERVE_TOKEN"},
+				},
+				&cli.StringSliceFlag{
+					Name:  "mask",
+					Usage: "mask values of keys matching the glob `PATTERN` (repeatable)",
+				},
+				&cli.BoolFlag{
+					Name:  "inherit",
+					Usage: "also serve variables inherited from the system environment",
+				},
+				&cli.DurationFlag{
+					Name:  "watch-interval",
+					Usage: "how often /watch re-reads the sources",
+					Value: time.Second,
+				},
+			},
+			Action: runServe,
+		},
+		{
+			Name:  "watch",
+			Usage: "Print an event for every key added, changed or removed in the sources until interrupted",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "output format (text, ndjson)",
+					Value:   "text",
+				},
+				&cli.DurationFlag{
+					Name:  "interval",
+					Usage: "how often the sources are re-read",
+					Value: time.Second,
+				},
+				&cli.BoolFlag{
+					Name:  "initial",
+					Usage: "report every key as added when watching starts",
+				},
+			},
+			Action: runWatch,
+		},
+		{
+			Name:  "version",
+			Usage: "Print the version, commit, build date and Go version of denv",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "output format (text, json)",
+					Value:   "text",
+				},
+			},
+			Action: runVersion,
+		},
+		{
+			Name:  "self-update",
+			Usage: "Replace denv with the latest signed release for this platform",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "version",
+					Usage: "install release `TAG` instead of the latest one",
+				},
+				&cli.BoolFlag{
+					Name:  "check",
+					Usage: "only print the available version; exit with 1 if it differs from the running one",
+				},
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "reinstall even if the release is the running version",
 				},
-				Action: runList,
 			},
+			Action: runSelfUpdate,
+		},
+		{
+			Name:   "lsp",
+			Usage:  "Run a language server for env files on stdin and stdout (diagnostics, hover, go to definition)",
+			Action: runLSP,
+		},
+		{
+			Name:   "doctor",
+			Usage:  "Check env files and the merged environment for common problems",
+			Action: runDoctor,
+		},
+		{
+			Name:  "validate",
+			Usage: "Check the merged environment against its contract and report problems for CI",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "schema",
+					Usage: "JSON Schema `FILE` (as written by schema export) listing the expected and required keys",
+				},
+				&cli.StringFlag{
+					Name:  "template",
+					Usage: "env template `FILE` such as .env.example listing the expected keys",
+				},
+				&cli.BoolFlag{
+					Name:  "strict",
+					Usage: "fail on warnings such as keys missing from the schema or template",
+				},
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "output format (text, json)",
+					Value:   "text",
+				},
+			},
+			Action: runValidate,
+		},
+		{
+			Name:      "annotate",
+			Usage:     "Record the description, owner and sensitivity of a key in the sidecar <file>.meta.json, or print them",
+			ArgsUsage: "KEY",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "description",
+					Usage: "what the key is for",
+				},
+				&cli.StringFlag{
+					Name:  "owner",
+					Usage: "team or person responsible for the key",
+				},
+				&cli.BoolFlag{
+					Name:  "secret",
+					Usage: "mark the key as secret; --secret=false overrides secret detection",
+				},
+				&cli.BoolFlag{
+					Name:  "clear",
+					Usage: "remove all annotations of the key",
+				},
+			},
+			Action: runAnnotate,
+		},
+		{
+			Name:  "prune",
+			Usage: "Report the keys of the env files that no code reads, and remove them with --delete",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "scan",
+					Usage: "code to search for references: a file, a directory or `DIR/...` for a whole tree (repeatable)",
+					Value: cli.NewStringSlice("./..."),
+				},
+				&cli.StringSliceFlag{
+					Name:  "keep",
+					Usage: "never report keys matching the glob `PATTERN`, e.g. variables read by libraries (repeatable)",
+				},
+				&cli.BoolFlag{
+					Name:  "delete",
+					Usage: "remove the unused keys and the comments above them from the files",
+				},
+			},
+			Action: runPrune,
+		},
+		{
+			Name:  "diff",
+			Usage: "Compare the variables of the sources with those of a running deployment",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "k8s",
+					Usage: "Kubernetes workload `[NAMESPACE/]KIND/NAME`, e.g. deployment/api",
+				},
+				&cli.StringFlag{
+					Name:  "container",
+					Usage: "container of the --k8s workload (default: the first)",
+				},
+				&cli.StringFlag{
+					Name:  "heroku",
+					Usage: "Heroku `APP` (uses the heroku CLI)",
+				},
+				&cli.StringFlag{
+					Name:  "flyctl",
+					Usage: "Fly.io `APP` (uses flyctl; secret values cannot be compared)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "ignore",
+					Usage: "skip keys matching the glob `PATTERN`, e.g. platform variables (repeatable)",
+				},
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "output format (text, json)",
+					Value:   "text",
+				},
+			},
+			Action: runDiff,
+		},
+		{
+			Name:  "push",
+			Usage: "Write the variables of the sources to a Heroku, Fly.io or Render app",
+			Flags: append(deployFlags(), &cli.BoolFlag{
+				Name:  "delete",
+				Usage: "also remove variables that are only set on the app",
+			}),
+			Action: runPush,
+		},
+		{
+			Name:  "pull",
+			Usage: "Read the config vars of a Heroku, Fly.io or Render app into .env format",
+			Flags: append(deployFlags(), &cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "merge into this file instead of printing (default: stdout)",
+			}),
+			Action: runPull,
+		},
+		{
+			Name:  "import",
+			Usage: "Capture the environment of a running process or container into .env format",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  "pid",
+					Usage: "process ID to read the environment from (Linux)",
+				},
+				&cli.StringFlag{
+					Name:  "container",
+					Usage: "docker container ID or name to inspect",
+				},
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "file to write (default: stdout)",
+				},
+			},
+			Action: runImport,
 		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		format, _ := app.Metadata["error-format"].(string)
+		writeError(app.ErrWriter, err, format)
+		os.Exit(exitCode(err))
 	}
 }
 
-func loadEnv(c *cli.Context) (map[string]string, error) {
-	envMap := make(map[string]string)
-
-	if !c.Bool("isolate") {
-		for _, e := range os.Environ() {
-			pair := strings.SplitN(e, "=", 2)
-			if len(pair) == 2 {
-				envMap[pair[0]] = pair[1]
+// newApp returns the app with its global flags and the Before hook applying
+// them, along with the sources they select; main adds the commands.
+func newApp() (*cli.App, *[]EnvFile) {
+	var files []EnvFile
+	app := &cli.App{
+		Name:  "denv",
+		Usage: "A simple CLI utility to manage environment variables from .env files",
+		Flags: appFlags(&files),
+		Before: func(c *cli.Context) error {
+			if c.App.Metadata == nil {
+				c.App.Metadata = make(map[string]any)
 			}
+			c.App.Metadata["files"] = &files
+			if err := applyErrorFlags(c); err != nil {
+				return err
+			}
+			applyLocal(c, &files)
+			if err := applyConfig(c, &files); err != nil {
+				return err
+			}
+			return applyTemporary(c, &files)
+		},
+	}
+	return app, &files
+}
+
+func appFlags(files *[]EnvFile) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "project config `FILE` (default: denv.yaml if present)",
+			EnvVars: []string{"DENV_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    "app",
+			Usage:   "use the files, variables and run targets of app `NAME` from the apps section of the project config",
+			EnvVars: []string{"DENV_APP"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-hooks",
+			Usage:   "skip the before_exec and after_exec hooks of the project config",
+			EnvVars: []string{"DENV_NO_HOOKS"},
+		},
+		&cli.GenericFlag{
+			Name:    "file",
+			Aliases: []string{"f"},
+			Usage:   "path to .env file",
+			Value:   &envFileFlag{files: files, optional: false},
+		},
+		&cli.GenericFlag{
+			Name:    "file-optional",
+			Aliases: []string{"fo"},
+			Usage:   "path to .env file (optional, ignore if missing)",
+			Value:   &envFileFlag{files: files, optional: true},
+		},
+		&cli.GenericFlag{
+			Name:  "source-timeout",
+			Usage: "give up reading the remote source given right before after `DURATION` (per attempt)",
+			Value: &policyFlag{files: files, name: "timeout"},
+		},
+		&cli.GenericFlag{
+			Name:  "source-retries",
+			Usage: "retry the remote source given right before up to `N` times",
+			Value: &policyFlag{files: files, name: "retries"},
+		},
+		&cli.GenericFlag{
+			Name:  "source-on-error",
+			Usage: "when the remote source given right before fails: `POLICY` fail (default), warn or skip, loading none of its keys",
+			Value: &policyFlag{files: files, name: "on-error"},
+		},
+		&cli.GenericFlag{
+			Name:  "verify",
+			Usage: "check the s3://, gs:// or git:: source given right before against `CHECK`: sha256:<hex>, minisign:<public key> or cosign:<key>",
+			Value: &verifyFlag{files: files},
+		},
+		&cli.StringSliceFlag{
+			Name:  "layer",
+			Usage: "merge sources in this order instead, later layers taking precedence: `LAYER` system, config, file[:PATH], secrets[:KIND] or overrides (repeatable; unlisted sources are not loaded)",
+		},
+		&cli.StringFlag{
+			Name:    "at",
+			Usage:   "read env files as of git revision `REV` (HEAD~5, a tag or commit) or the last commit before a date such as 2024-01-01",
+			EnvVars: []string{"DENV_AT"},
+		},
+		&cli.BoolFlag{
+			Name:    "check-permissions",
+			Usage:   "refuse to load env files that other users can access or that another user owns",
+			EnvVars: []string{"DENV_CHECK_PERMISSIONS"},
+		},
+		&cli.BoolFlag{
+			Name:    "local",
+			Usage:   "load an optional <file>.local after every --file and --file-optional (e.g. .env.production.local)",
+			EnvVars: []string{"DENV_LOCAL"},
+		},
+		&cli.GenericFlag{
+			Name:    "isolate",
+			Aliases: []string{"i"},
+			Usage:   "ignore system environment variables (load only from .env files); --isolate=`PRESET` (minimal, posix, ci) keeps a baseline such as PATH and HOME",
+			Value:   &isolateFlag{},
+		},
+		&cli.BoolFlag{
+			Name:    "quiet",
+			Aliases: []string{"q"},
+			Usage:   "suppress error messages and warnings (rely on the exit code)",
+		},
+		&cli.BoolFlag{
+			Name:    "porcelain",
+			Usage:   "stable output for scripts: data only on stdout, confirmations and other messages on stderr, no prompts",
+			EnvVars: []string{"DENV_PORCELAIN"},
+		},
+		&cli.StringSliceFlag{
+			Name:  "only",
+			Usage: "load only keys matching the glob `PATTERN` from sources (repeatable)",
+		},
+		&cli.StringFlag{
+			Name:  "on-conflict",
+			Usage: "what to do when sources define a key with different values (error, warn, first-wins, last-wins)",
+			Value: conflictLastWins,
+		},
+		&cli.StringSliceFlag{
+			Name:    "protected-key",
+			Usage:   "glob `PATTERN` of keys sources may not set (repeatable, replaces the defaults)",
+			EnvVars: []string{"DENV_PROTECTED_KEYS"},
+			Value:   cli.NewStringSlice(defaultProtectedKeys...),
+		},
+		&cli.BoolFlag{
+			Name:  "allow-protected",
+			Usage: "allow sources to set protected keys",
+		},
+		&cli.IntFlag{
+			Name:  "parallel",
+			Usage: "read up to `N` sources concurrently",
+			Value: 8,
+		},
+		&cli.StringFlag{
+			Name:  "encoding",
+			Usage: "encoding of env files (auto, utf-8, utf-16le, utf-16be, latin1); auto detects byte order marks",
+			Value: "auto",
+		},
+		&cli.BoolFlag{
+			Name:  "shell-compat",
+			Usage: "accept env files written to be sourced by a shell (set -a blocks, $VAR from the environment, ${VAR:-default})",
+		},
+		&cli.BoolFlag{
+			Name:  "no-transform",
+			Usage: "load values verbatim, without resolving any value prefix or vault: and keyring:// references",
+		},
+		&cli.BoolFlag{
+			Name:  "flatten-json",
+			Usage: "expand json: object and array values into KEY_FIELD variables",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-exec-values",
+			Usage: "execute $(command) substitutions in .env values (runs arbitrary commands from env files!)",
+		},
+		&cli.DurationFlag{
+			Name:  "exec-timeout",
+			Usage: "timeout for each $(command) substitution",
+			Value: 10 * time.Second,
+		},
+		&cli.GenericFlag{
+			Name:  "vault-path",
+			Usage: "Vault KV v2 path to import all keys from (a trailing / imports every secret below it)",
+			Value: &envFileFlag{files: files, optional: false, kind: sourceVault},
+		},
+		&cli.StringFlag{
+			Name:    "vault-addr",
+			Usage:   "Vault server address",
+			EnvVars: []string{"VAULT_ADDR"},
+		},
+		&cli.StringFlag{
+			Name:    "vault-token",
+			Usage:   "Vault token",
+			EnvVars: []string{"VAULT_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "vault-namespace",
+			Usage:   "Vault Enterprise namespace",
+			EnvVars: []string{"VAULT_NAMESPACE"},
+		},
+		&cli.StringFlag{
+			Name:    "vault-role-id",
+			Usage:   "AppRole role ID (used when no token is given)",
+			EnvVars: []string{"VAULT_ROLE_ID"},
+		},
+		&cli.StringFlag{
+			Name:    "vault-secret-id",
+			Usage:   "AppRole secret ID",
+			EnvVars: []string{"VAULT_SECRET_ID"},
+		},
+		&cli.BoolFlag{
+			Name:  "vault-renew",
+			Usage: "renew the Vault token before reading secrets",
+		},
+		&cli.DurationFlag{
+			Name:  "cache-ttl",
+			Usage: "cache values fetched from remote sources for `DURATION` (encrypted on disk, 0 disables)",
+		},
+		&cli.BoolFlag{
+			Name:  "refresh",
+			Usage: "bypass cached remote values and fetch them again",
+		},
+		&cli.StringFlag{
+			Name:    "cache-dir",
+			Usage:   "directory for cached remote values (default: user cache dir)",
+			EnvVars: []string{"DENV_CACHE_DIR"},
+		},
+		&cli.BoolFlag{
+			Name:  "no-parse-cache",
+			Usage: "always re-parse env files instead of using cached results for large files",
+		},
+		&cli.StringSliceFlag{
+			Name:  "env-ttl",
+			Usage: "set a temporary variable for this directory as `KEY=VALUE=DURATION` (e.g. DEBUG=1=2h), injected until it expires",
+		},
+		&cli.BoolFlag{
+			Name:  "show-secrets",
+			Usage: "print likely secret values in list output instead of masking them",
+		},
+		&cli.StringFlag{
+			Name:    "error-format",
+			Usage:   "print errors as text or as json objects with code, message, file, line and key",
+			Value:   "text",
+			EnvVars: []string{"DENV_ERROR_FORMAT"},
+		},
+		&cli.BoolFlag{
+			Name:  "pretty",
+			Usage: "indent JSON output",
+		},
+		&cli.BoolFlag{
+			Name:  "compact",
+			Usage: "print JSON output on a single line",
+		},
+		&cli.GenericFlag{
+			Name:  "k8s-secret",
+			Usage: "Kubernetes Secret to import (namespace/name)",
+			Value: &envFileFlag{files: files, optional: false, kind: sourceK8sSecret},
+		},
+		&cli.GenericFlag{
+			Name:  "k8s-configmap",
+			Usage: "Kubernetes ConfigMap to import (namespace/name)",
+			Value: &envFileFlag{files: files, optional: false, kind: sourceK8sConfigMap},
+		},
+		&cli.StringFlag{
+			Name:  "k8s-context",
+			Usage: "kubeconfig context to use (default: current context)",
+		},
+		&cli.GenericFlag{
+			Name:  "op-vault",
+			Usage: "1Password vault to import the items tagged with --op-tag from",
+			Value: &envFileFlag{files: files, optional: false, kind: sourceOnePassword},
+		},
+		&cli.StringFlag{
+			Name:  "op-tag",
+			Usage: "tag of the 1Password items to import",
+			Value: "denv",
+		},
+		&cli.StringFlag{
+			Name:    "op-connect-host",
+			Usage:   "1Password Connect server URL (default: use the op CLI with OP_SERVICE_ACCOUNT_TOKEN)",
+			EnvVars: []string{"OP_CONNECT_HOST"},
+		},
+		&cli.StringFlag{
+			Name:    "op-connect-token",
+			Usage:   "1Password Connect access token",
+			EnvVars: []string{"OP_CONNECT_TOKEN"},
+		},
+	}
+}
+
+// applyLocal puts an optional <file>.local right after every file given on
+// the command line when --local is set, following the convention of
+// frontend tooling. Files that are local overrides already, or whose
+// override is listed explicitly, are left alone.
+func applyLocal(c *cli.Context, files *[]EnvFile) {
+	if !c.Bool("local") {
+		return
+	}
+	listed := make(map[string]bool)
+	for _, file := range *files {
+		if file.Kind == sourceFile {
+			listed[file.Path] = true
+		}
+	}
+	var expanded []EnvFile
+	for _, file := range *files {
+		expanded = append(expanded, file)
+		local := file.Path + ".local"
+		if file.Kind != sourceFile || strings.HasSuffix(file.Path, ".local") || listed[local] {
+			continue
 		}
+		listed[local] = true
+		expanded = append(expanded, EnvFile{Path: local, Optional: true, Format: file.Format})
 	}
+	*files = expanded
+}
 
-	var files []EnvFile
+// envFiles returns the sources given on the command line, in order.
+func envFiles(c *cli.Context) []EnvFile {
 	if v, ok := c.App.Metadata["files"]; ok {
 		if f, ok := v.(*[]EnvFile); ok {
-			files = *f
+			return *f
 		}
 	}
+	return nil
+}
+
+// sourceReader reads individual sources, sharing backend clients between
+// them. It is safe for concurrent use.
+type sourceReader struct {
+	c *cli.Context
+	// want selects the keys to resolve; nil resolves all of them. Values of
+	// other keys are dropped before transforms and secret lookups run.
+	want func(key string) bool
+
+	// mu guards the lazily created backends below and warning output.
+	mu    sync.Mutex
+	vault *vaultClient
+	// secrets memoizes Vault secrets read for vault: references.
+	secrets map[string]map[string]string
+	cache   *sourceCache
+	// cacheOpened is set once opening the cache was attempted.
+	cacheOpened bool
+	parsed      *parseCache
+	// parsedOpened is set once the parse cache has been opened.
+	parsedOpened bool
+	// keysOnly is set when the caller only needs key names; large files are
+	// then streamed without keeping their values (see streamEnvFile).
+	keysOnly bool
+	// extends is set by mergeWith to the keys whose merged value still
+	// extends the inherited one, with the entries to put around it.
+	extends map[string]pathListParts
+	// system places the system environment at the system layer of
+	// --layer, see layeredSources.
+	system bool
+	// revisions memoizes the commit --at resolves to per directory.
+	revisions map[string]string
+	// modes holds the merge modes of the file sources read, see
+	// mergeModes.
+	modes map[string]map[string]string
+}
+
+func (r *sourceReader) warnf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.c.App.ErrWriter, "Warning: "+format+"\n", args...)
+}
+
+// skipMissing reports whether err only means that the optional file does not
+// exist, which every command loading sources ignores.
+func skipMissing(file EnvFile, err error) bool {
+	return file.Optional && errors.Is(err, os.ErrNotExist)
+}
+
+// readAll reads sources concurrently, at most --parallel at a time, and
+// returns their values and errors in the order of files.
+func (r *sourceReader) readAll(files []EnvFile) ([]map[string]string, []error) {
+	limit := r.c.Int("parallel")
+	if limit < 1 {
+		limit = 1
+	}
+
+	results := make([]map[string]string, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = r.read(file)
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+func (r *sourceReader) read(file EnvFile) (map[string]string, error) {
+	if isRemoteSource(file) {
+		return r.readWithPolicy(file, func(ctx context.Context) (map[string]string, error) {
+			return r.readSource(ctx, file)
+		})
+	}
+	return r.readSource(context.Background(), file)
+}
 
-	for _, file := range files {
-		loaded, err := godotenv.Read(file.Path)
+func (r *sourceReader) readSource(ctx context.Context, file EnvFile) (map[string]string, error) {
+	c := r.c
+	var loaded map[string]string
+	switch file.Kind {
+	case sourceFile:
+		var modes map[string]string
+		var err error
+		if loaded, modes, err = r.readEnvFile(file); err != nil {
+			return nil, err
+		}
+		r.setMergeModes(file, modes)
+	case sourceConfig:
+		loaded = loadedConfig(c).env()
+	case sourceTemporary:
+		loaded = temporaryEnv(c)
+	case sourceSystem:
+		// Inherited values are never transformed.
+		env := make(map[string]string)
+		for _, e := range inheritedEnv(c) {
+			if k, v, ok := strings.Cut(e, "="); ok {
+				env[k] = v
+			}
+		}
+		return env, nil
+	case sourceS3, sourceGCS:
+		var err error
+		if loaded, err = r.readObject(ctx, file); err != nil {
+			return nil, err
+		}
+	case sourceGit:
+		var err error
+		if loaded, err = r.readGit(ctx, file); err != nil {
+			return nil, err
+		}
+	default:
+		return r.readRemote(ctx, file)
+	}
+	// Flattened JSON produces keys that differ from the source key, so it
+	// can only be filtered after transforming.
+	if r.want != nil && !c.Bool("flatten-json") {
+		maps.DeleteFunc(loaded, func(k, _ string) bool { return !r.want(k) })
+	}
+	// Transforms only change values, unless they flatten JSON into new keys.
+	if c.Bool("no-transform") || r.keysOnly && !c.Bool("flatten-json") {
+		return loaded, nil
+	}
+
+	ttls, err := secretTTLs(c, file, loaded)
+	if err != nil {
+		return nil, err
+	}
+	var resolve, keyring secretResolver
+	if !isRemoteSource(file) {
+		resolve = func(ref string) (string, error) {
+			return r.resolveSecret(ref, ttls[ref])
+		}
+		keyring = keyringGet
+	}
+	var files fileResolver
+	if file.Kind == sourceFile {
+		// Relative file: paths are resolved against the env file.
+		dir := filepath.Dir(file.Path)
+		files = func(path string) ([]byte, error) {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			return r.readFile(path)
+		}
+	}
+	return transformValues(loaded, files, c.Bool("flatten-json"), resolve, keyring)
+}
+
+// readEnvFile parses a local env file and returns its values and merge
+// modes, see parseEnvData. Large files go through the parse cache unless
+// command substitution or shell-compat mode is enabled, since their
+// results may depend on the process environment.
+func (r *sourceReader) readEnvFile(file EnvFile) (env, modes map[string]string, err error) {
+	path := file.Path
+	opts := r.parseOptions(path)
+	opts.Format = file.Format
+	if file.Format == formatExports {
+		opts.ShellCompat = true
+	}
+	if r.c.String("at") != "" {
+		return r.readEnvFileAt(file, opts)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.c.Bool("check-permissions") || loadedConfig(r.c).CheckPermissions {
+		if err := checkFilePermissions(path, info); err != nil {
+			return nil, nil, withExitCode(exitValidation, err)
+		}
+	}
+	if info.Size() >= streamMinSize && (r.want != nil || r.keysOnly) && canStream(opts) && !r.c.Bool("flatten-json") {
+		return streamEnvFile(path, opts, r.want, r.keysOnly)
+	}
+	if opts.ExecValues || opts.ShellCompat || opts.Encoding != "auto" || info.Size() < parseCacheMinSize {
+		return readEnvFile(path, opts)
+	}
+
+	r.mu.Lock()
+	if !r.parsedOpened {
+		parsed, err := openParseCache(r.c)
 		if err != nil {
-			if file.Optional && errors.Is(err, os.ErrNotExist) {
-				continue
+			fmt.Fprintf(r.c.App.ErrWriter, "Warning: parse cache disabled: %v\n", err)
+		}
+		r.parsed, r.parsedOpened = parsed, true
+	}
+	parsed := r.parsed
+	r.mu.Unlock()
+
+	if parsed == nil {
+		return readEnvFile(path, opts)
+	}
+	return parsed.read(path, info, opts)
+}
+
+// resolveSecret resolves a vault: reference of the form path#field, reading
+// each secret path at most once per reader. With a ttl the value is kept in
+// the cache for that long.
+func (r *sourceReader) resolveSecret(ref string, ttl time.Duration) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("invalid secret reference %q (expected path#field)", ref)
+	}
+
+	var cache *sourceCache
+	var entry string
+	if ttl > 0 {
+		if cache = r.openCache(); cache != nil {
+			entry = cache.entryPath(EnvFile{Path: ref, Kind: sourceVault}, r.scope(sourceVault))
+			if cached, ok := cache.get(entry); ok {
+				return cached[field], nil
 			}
-			return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
 		}
+	}
+
+	r.mu.Lock()
+	secret, ok := r.secrets[path]
+	r.mu.Unlock()
+	if !ok {
+		vault, err := r.vaultClient()
+		if err != nil {
+			return "", err
+		}
+		if secret, err = vault.readSecret(context.Background(), path); err != nil {
+			return "", err
+		}
+		r.mu.Lock()
+		if r.secrets == nil {
+			r.secrets = make(map[string]map[string]string)
+		}
+		r.secrets[path] = secret
+		r.mu.Unlock()
+	}
 
-		maps.Copy(envMap, loaded)
+	val, ok := secret[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found in secret %s", field, path)
+	}
+	if cache != nil {
+		if err := cache.put(entry, map[string]string{field: val}, ttl); err != nil {
+			r.warnf("failed to cache %s: %v", ref, err)
+		}
+	}
+	return val, nil
+}
+
+// openCache returns the cache of remote values, or nil if it cannot be
+// opened.
+func (r *sourceReader) openCache() *sourceCache {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.cacheOpened {
+		cache, err := openSourceCache(r.c)
+		if err != nil {
+			fmt.Fprintf(r.c.App.ErrWriter, "Warning: cache disabled: %v\n", err)
+		}
+		r.cache, r.cacheOpened = cache, true
 	}
+	return r.cache
+}
 
-	return envMap, nil
+// scope identifies the backend a remote source of kind is read from, so
+// cached values from different servers or clusters don't mix.
+func (r *sourceReader) scope(kind string) string {
+	switch kind {
+	case sourceVault:
+		return r.c.String("vault-addr") + "\x00" + r.c.String("vault-namespace")
+	case sourceK8sSecret, sourceK8sConfigMap:
+		return r.c.String("k8s-context")
+	case sourceOnePassword:
+		return r.c.String("op-connect-host") + "\x00" + r.c.String("op-tag")
+	}
+	return ""
 }
 
-func runExec(c *cli.Context) error {
-	args := c.Args().Slice()
-	if len(args) == 0 {
-		return fmt.Errorf("no command specified")
+// readRemote fetches a remote source, going through the cache when
+// --cache-ttl is set.
+func (r *sourceReader) readRemote(ctx context.Context, file EnvFile) (map[string]string, error) {
+	c := r.c
+	var cache *sourceCache
+	if c.Duration("cache-ttl") > 0 {
+		cache = r.openCache()
 	}
 
-	envMap, err := loadEnv(c)
+	var entry string
+	if cache != nil {
+		entry = cache.entryPath(file, r.scope(file.Kind))
+		if cached, ok := cache.get(entry); ok {
+			return cached, nil
+		}
+	}
+
+	var loaded map[string]string
+	var err error
+	switch file.Kind {
+	case sourceVault:
+		var vault *vaultClient
+		vault, err = r.vaultClient()
+		if err == nil {
+			loaded, err = vault.readPath(ctx, file.Path)
+		}
+	case sourceK8sSecret, sourceK8sConfigMap:
+		loaded, err = readKubernetes(ctx, file.Kind, file.Path, c.String("k8s-context"))
+	case sourceOnePassword:
+		loaded, err = readOnePassword(ctx, c, file.Path)
+	default:
+		return nil, fmt.Errorf("unknown source kind %q", file.Kind)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	envSlice := make([]string, 0, len(envMap))
-	for k, v := range envMap {
-		envSlice = append(envSlice, fmt.Sprintf("%s=%s", k, v))
+	if cache != nil {
+		if err := cache.put(entry, loaded, 0); err != nil {
+			r.warnf("failed to cache %s: %v", file.Path, err)
+		}
+	}
+	return loaded, nil
+}
+
+// vaultClient returns the shared Vault client, logging in on first use.
+func (r *sourceReader) vaultClient() (*vaultClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.vault == nil {
+		vault, err := newVaultClient(r.c)
+		if err != nil {
+			return nil, err
+		}
+		r.vault = vault
+	}
+	return r.vault, nil
+}
+
+func (r *sourceReader) parseOptions(path string) parseOptions {
+	c := r.c
+	return parseOptions{
+		ExecValues:  c.Bool("allow-exec-values"),
+		ExecTimeout: c.Duration("exec-timeout"),
+		ShellCompat: c.Bool("shell-compat"),
+		Encoding:    c.String("encoding"),
+		Dir:         filepath.Dir(path),
+		Warn: func(msg string) {
+			r.warnf("%s: %s", path, msg)
+		},
+	}
+}
+
+// loadEnv returns the system environment (see inheritedEnv) merged with the
+// configured sources. When keys are given only those keys are resolved from
+// the sources, so unrelated secret references are never looked up.
+func loadEnv(c *cli.Context, keys ...string) (map[string]string, error) {
+	envMap, _, err := loadEnvOrigins(c, keys...)
+	return envMap, err
+}
+
+// loadEnvOrigins is loadEnv that also reports where each key was last
+// defined: the source (see EnvFile.String) or "environment".
+func loadEnvOrigins(c *cli.Context, keys ...string) (map[string]string, map[string]string, error) {
+	reader := &sourceReader{c: c, want: keyFilter(c, keys), system: true}
+	envMap, origins, err := mergeWith(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(c.StringSlice("layer")) > 0 {
+		return envMap, origins, nil
+	}
+	// Sources override the system environment, so inherited variables only
+	// fill in keys the sources do not define or extend, like PATH+=.
+	for _, e := range inheritedEnv(c) {
+		if k, v, ok := strings.Cut(e, "="); ok {
+			if _, defined := origins[k]; !defined {
+				envMap[k] = v
+				origins[k] = sourceEnvironment
+			} else if parts, ok := reader.extends[k]; ok {
+				envMap[k] = parts.around(v)
+			}
+		}
+	}
+	return envMap, origins, nil
+}
+
+// loadSources merges the configured sources in order, without the system
+// environment. keys and --only restrict which keys are resolved.
+func loadSources(c *cli.Context, keys ...string) (map[string]string, error) {
+	envMap, _, err := mergeSources(c, keys)
+	return envMap, err
+}
+
+// mergeSources reads and merges the configured sources, returning the
+// merged values and the source each key came from.
+func mergeSources(c *cli.Context, keys []string) (map[string]string, map[string]string, error) {
+	return mergeWith(&sourceReader{c: c, want: keyFilter(c, keys)})
+}
+
+// loadKeys returns the sorted keys of the environment. Unless value
+// conflicts have to be reported, large files are streamed without their
+// values.
+func loadKeys(c *cli.Context) ([]string, error) {
+	policy := c.String("on-conflict")
+	reader := &sourceReader{c: c, want: keyFilter(c, nil), keysOnly: policy == conflictLastWins || policy == conflictFirstWins, system: true}
+	envMap, _, err := mergeWith(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.StringSlice("layer")) > 0 {
+		return sortedKeys(envMap), nil
+	}
+	for _, e := range inheritedEnv(c) {
+		if k, _, ok := strings.Cut(e, "="); ok {
+			envMap[k] = ""
+		}
+	}
+	return sortedKeys(envMap), nil
+}
+
+// mergeWith reads the configured sources with reader and merges them.
+func mergeWith(reader *sourceReader) (map[string]string, map[string]string, error) {
+	c := reader.c
+	policy := c.String("on-conflict")
+	if !slices.Contains(conflictPolicies, policy) {
+		return nil, nil, fmt.Errorf("invalid --on-conflict %q (expected %s)", policy, strings.Join(conflictPolicies, ", "))
 	}
 
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Env = envSlice
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	allowProtected := c.Bool("allow-protected")
+	protected := c.StringSlice("protected-key")
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	files, err := layeredSources(c, reader.system)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, errs := reader.readAll(files)
 
-	go func() {
-		for sig := range sigChan {
-			if cmd.Process != nil {
-				cmd.Process.Signal(sig)
+	size := 0
+	for _, loaded := range results {
+		size += len(loaded)
+	}
+	envMap := make(map[string]string, size)
+	origins := make(map[string]string, size)
+	cfg := loadedConfig(c)
+	reader.extends = make(map[string]pathListParts)
+	for i, file := range files {
+		loaded, err := results[i], errs[i]
+		if err != nil {
+			if skipMissing(file, err) {
+				continue
 			}
+			if file.Kind == sourceFile {
+				return nil, nil, &fs.PathError{Op: "failed to read", Path: file.Path, Err: err}
+			}
+			return nil, nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
 		}
-	}()
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start command: %w", err)
+		// The system layer overrides like any source, but its keys are
+		// neither protected nor conflicts: their place was chosen with
+		// --layer.
+		if file.Kind == sourceSystem {
+			for k, v := range loaded {
+				envMap[k] = v
+				origins[k] = sourceEnvironment
+				delete(reader.extends, k)
+			}
+			continue
+		}
+
+		// Keys are merged in map order; problems are collected and reported
+		// sorted by key so the output stays deterministic.
+		source := file.String()
+		var denied []string
+		var conflicts [][2]string
+		modes := reader.mergeModes(file)
+		for k, v := range loaded {
+			mode := modes[k]
+			if mode == "" {
+				mode = cfg.mergeRule(k)
+			}
+			// Appending cannot shadow the inherited entries of a protected
+			// key such as PATH, so only replacing and prepending are denied.
+			if !allowProtected && mode != mergeAppend && matchesAny(k, protected) {
+				denied = append(denied, k)
+				continue
+			}
+			if mode != "" {
+				prev, defined := envMap[k]
+				if parts, ok := reader.extends[k]; ok || !defined {
+					parts.add(v, mode)
+					reader.extends[k] = parts
+					v = parts.around("")
+				} else {
+					v = joinPathList(prev, v, mode)
+				}
+				envMap[k] = v
+				origins[k] = source
+				continue
+			}
+			delete(reader.extends, k)
+			if prev, ok := origins[k]; ok && envMap[k] != v {
+				if policy == conflictFirstWins {
+					continue
+				}
+				if policy != conflictLastWins {
+					conflicts = append(conflicts, [2]string{k, prev})
+				}
+			}
+			envMap[k] = v
+			origins[k] = source
+		}
+		if len(denied) > 0 {
+			k := slices.Min(denied)
+			return nil, nil, withExitCode(exitValidation, fmt.Errorf("%s from %s is a protected key (use --allow-protected to override it)", k, file))
+		}
+		slices.SortFunc(conflicts, func(a, b [2]string) int { return strings.Compare(a[0], b[0]) })
+		for _, conflict := range conflicts {
+			if policy == conflictError {
+				return nil, nil, withExitCode(exitValidation, fmt.Errorf("%s is defined in both %s and %s", conflict[0], conflict[1], file))
+			}
+			reader.warnf("%s from %s overrides %s", conflict[0], file, conflict[1])
+		}
 	}
 
-	err = cmd.Wait()
+	if reader.want != nil {
+		maps.DeleteFunc(envMap, func(k, _ string) bool { return !reader.want(k) })
+		maps.DeleteFunc(origins, func(k, _ string) bool { return !reader.want(k) })
+	}
+	return envMap, origins, nil
+}
 
-	if exitErr, ok := err.(*exec.ExitError); ok {
-		os.Exit(exitErr.ExitCode())
+// keyFilter combines explicitly requested keys with the --only glob
+// patterns. It returns nil when every key is wanted.
+func keyFilter(c *cli.Context, keys []string) func(string) bool {
+	only := c.StringSlice("only")
+	if len(keys) == 0 && len(only) == 0 {
+		return nil
 	}
+	return func(key string) bool {
+		if len(keys) > 0 && !slices.Contains(keys, key) {
+			return false
+		}
+		return len(only) == 0 || matchesAny(key, only)
+	}
+}
 
-	return err
+// matchesAny reports whether key matches one of the glob patterns.
+func matchesAny(key string, patterns []string) bool {
+	for _, p := range patterns {
+		// Patterns are mostly literal keys or PREFIX_*; rule those out
+		// without the cost of path.Match.
+		literal := p
+		if i := strings.IndexAny(p, `*?[\`); i >= 0 {
+			literal = p[:i]
+		} else if p != key {
+			continue
+		}
+		if !strings.HasPrefix(key, literal) {
+			continue
+		}
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
 }
 
 func runGet(c *cli.Context) error {
@@ -204,51 +1649,70 @@ func runGet(c *cli.Context) error {
 		return fmt.Errorf("key argument is required")
 	}
 
-	envMap, err := loadEnv(c)
+	envMap, err := loadEnv(c, key)
 	if err != nil {
 		return err
 	}
 
 	val, ok := envMap[key]
 	if !ok {
-		return cli.Exit(fmt.Sprintf("key '%s' not found", key), 1)
+		return withExitCode(exitFailure, fmt.Errorf("key '%s' not found", key))
 	}
 
 	fmt.Fprintln(c.App.Writer, val)
 	return nil
 }
 
+// writeJSON writes v as JSON followed by a newline. Map keys are always
+// sorted, so equal environments produce identical bytes; --pretty and
+// --compact override the command's default layout.
+func writeJSON(c *cli.Context, w io.Writer, v any, pretty bool) error {
+	if c.Bool("pretty") && c.Bool("compact") {
+		return fmt.Errorf("--pretty and --compact are mutually exclusive")
+	}
+	enc := json.NewEncoder(w)
+	if c.Bool("pretty") || (pretty && !c.Bool("compact")) {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
 func runKeys(c *cli.Context) error {
-	envMap, err := loadEnv(c)
+	keys, err := loadKeys(c)
 	if err != nil {
 		return err
 	}
 
-	keys := make([]string, 0, len(envMap))
-	for k := range envMap {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
 	output := c.String("output")
 
 	if output == "json" {
-		data, err := json.Marshal(keys)
-		if err != nil {
-			return err
-		}
-		fmt.Fprintln(c.App.Writer, string(data))
-	} else {
-		for _, k := range keys {
-			fmt.Fprintln(c.App.Writer, k)
-		}
+		return writeJSON(c, c.App.Writer, keys, false)
+	}
+	sep, err := recordSeparator(c)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		fmt.Fprint(c.App.Writer, k+sep)
 	}
 
 	return nil
 }
 
 func runList(c *cli.Context) error {
-	envMap, err := loadEnv(c)
+	if !c.Bool("copy") {
+		return writeList(c, c.App.Writer)
+	}
+	var buf bytes.Buffer
+	if err := writeList(c, &buf); err != nil {
+		return err
+	}
+	return copyToClipboard(c, buf.Bytes())
+}
+
+// writeList prints the environment to w in the --output format.
+func writeList(c *cli.Context, w io.Writer) error {
+	envMap, origins, err := loadEnvOrigins(c)
 	if err != nil {
 		return err
 	}
@@ -260,18 +1724,191 @@ func runList(c *cli.Context) error {
 	sort.Strings(keys)
 
 	output := c.String("output")
+	sep, err := recordSeparator(c)
+	if err != nil {
+		return err
+	}
 
-	if output == "json" {
-		data, err := json.Marshal(envMap)
-		if err != nil {
-			return err
+	// Text output is read by people, so likely secrets are masked; the
+	// other formats feed tools or shell sessions and keep the values, with
+	// a warning.
+	secretSet := secretKeys(c, envMap, origins, defaultSecretKeys)
+	if !c.Bool("show-secrets") {
+		var secrets []string
+		for k := range secretSet {
+			secrets = append(secrets, k)
+		}
+		sort.Strings(secrets)
+		switch {
+		case !slices.Contains([]string{"json", "csv", "ndjson", "cmd", "ps1"}, output):
+			for _, k := range secrets {
+				envMap[k] = maskedValue
+			}
+		case len(secrets) > 0:
+			fmt.Fprintf(c.App.ErrWriter, "Warning: output contains likely secret values (%s); pass --show-secrets to confirm\n", strings.Join(secrets, ", "))
+		}
+	}
+
+	if groupBy := c.String("group-by"); groupBy != "" {
+		if groupBy != "source" {
+			return fmt.Errorf("unsupported --group-by %q (expected source)", groupBy)
+		}
+		if output != "text" {
+			return fmt.Errorf("--group-by requires text output")
+		}
+		if c.Bool("porcelain") || c.Bool("null") {
+			return fmt.Errorf("--group-by is for people and cannot be used with --porcelain or -z")
+		}
+		return printGroupedBySource(c, w, envMap, origins)
+	}
+
+	switch output {
+	case "json":
+		if c.Bool("with-meta") {
+			return writeJSON(c, w, keyMeta(c, envMap, origins, secretSet), false)
+		}
+		return writeJSON(c, w, envMap, false)
+	case "csv":
+		w := csv.NewWriter(w)
+		w.Write([]string{"key", "value", "source"})
+		for _, k := range keys {
+			w.Write([]string{k, envMap[k], origins[k]})
+		}
+		w.Flush()
+		return w.Error()
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, k := range keys {
+			record := struct {
+				Key    string `json:"key"`
+				Value  string `json:"value"`
+				Source string `json:"source"`
+			}{k, envMap[k], origins[k]}
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+	case "cmd":
+		for _, k := range keys {
+			line, err := cmdSetLine(k, envMap[k])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s\r\n", line)
 		}
-		fmt.Fprintln(c.App.Writer, string(data))
-	} else {
+	case "ps1":
 		for _, k := range keys {
-			fmt.Fprintf(c.App.Writer, "%s=%s\n", k, envMap[k])
+			fmt.Fprintf(w, "%s\n", ps1SetLine(k, envMap[k]))
+		}
+	default:
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s=%s%s", k, envMap[k], sep)
 		}
 	}
 
 	return nil
 }
+
+// fileEntries parses a file source, as of --at when set, for metadata such
+// as key order and line numbers. Commands are not executed since values
+// are not needed; other sources and unreadable files yield no entries.
+func fileEntries(c *cli.Context, file EnvFile) []envEntry {
+	if file.Kind != sourceFile {
+		return nil
+	}
+	data, err := (&sourceReader{c: c}).readFile(file.Path)
+	if err != nil {
+		return nil
+	}
+	if data, err = decodeEnv(data, c.String("encoding")); err != nil {
+		return nil
+	}
+	entries, _ := parseEnvFormat(data, parseOptions{ShellCompat: c.Bool("shell-compat"), Format: file.Format})
+	return entries
+}
+
+// keyDescriptions returns the descriptions of keys taken from the comments
+// above their assignments in file sources; later files override earlier
+// ones unless their assignment is not commented.
+func keyDescriptions(c *cli.Context) map[string]string {
+	descriptions := make(map[string]string)
+	for _, file := range envFiles(c) {
+		for _, e := range fileEntries(c, file) {
+			if d := e.description(); d != "" {
+				descriptions[e.Key] = d
+			}
+		}
+	}
+	return descriptions
+}
+
+type keyMetadata struct {
+	Value       string `json:"value"`
+	Source      string `json:"source"`
+	Description string `json:"description,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	Secret      bool   `json:"secret,omitempty"`
+}
+
+// keyMeta describes the keys for list --with-meta. Descriptions recorded
+// by annotate take precedence over comments.
+func keyMeta(c *cli.Context, envMap, origins map[string]string, secrets map[string]bool) map[string]keyMetadata {
+	descriptions := keyDescriptions(c)
+	annotations := keyAnnotations(c)
+	meta := make(map[string]keyMetadata, len(envMap))
+	for k, v := range envMap {
+		m := keyMetadata{Value: v, Source: origins[k], Description: descriptions[k], Owner: annotations[k].Owner, Secret: secrets[k]}
+		if d := annotations[k].Description; d != "" {
+			m.Description = d
+		}
+		meta[k] = m
+	}
+	return meta
+}
+
+// printGroupedBySource prints variables under a "# source" header per
+// origin: inherited system variables first, then sources in the order they
+// were given. Keys from files keep their order in the file.
+func printGroupedBySource(c *cli.Context, w io.Writer, envMap, origins map[string]string) error {
+	groups := []string{sourceEnvironment}
+	order := map[string][]string{}
+	for _, file := range envFiles(c) {
+		name := file.String()
+		if !slices.Contains(groups, name) {
+			groups = append(groups, name)
+		}
+		for _, e := range fileEntries(c, file) {
+			order[name] = append(order[name], e.Key)
+		}
+	}
+
+	members := map[string][]string{}
+	for _, k := range sortedKeys(envMap) {
+		members[origins[k]] = append(members[origins[k]], k)
+	}
+
+	first := true
+	for _, group := range groups {
+		keys := members[group]
+		if len(keys) == 0 {
+			continue
+		}
+		position := func(k string) int {
+			if i := slices.Index(order[group], k); i >= 0 {
+				return i
+			}
+			return len(order[group])
+		}
+		slices.SortStableFunc(keys, func(a, b string) int { return position(a) - position(b) })
+
+		if !first {
+			fmt.Fprintln(w)
+		}
+		first = false
+		fmt.Fprintf(w, "# %s\n", group)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s=%s\n", k, envMap[k])
+		}
+	}
+	return nil
+}
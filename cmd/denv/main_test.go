@@ -2,39 +2,41 @@ package main
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
 
-func createTestApp() (*cli.App, *[]EnvFile) {
-	var files []EnvFile
-	app := &cli.App{
-		Flags: []cli.Flag{
-			&cli.GenericFlag{
-				Name:  "file",
-				Value: &envFileFlag{files: &files, optional: false},
-			},
-			&cli.GenericFlag{
-				Name:    "file-optional",
-				Aliases: []string{"fo"},
-				Value:   &envFileFlag{files: &files, optional: true},
-			},
-			&cli.BoolFlag{Name: "isolate"},
-		},
-		Before: func(c *cli.Context) error {
-			if c.App.Metadata == nil {
-				c.App.Metadata = make(map[string]any)
-			}
-			c.App.Metadata["files"] = &files
-			return nil
-		},
+// TestMain lets exec re-execute the test binary to apply resource limits,
+// as it does denv.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == limitedExecArg {
+		runLimitedExec(os.Args[2:])
 	}
-	return app, &files
+	os.Exit(m.Run())
+}
+
+// writeFakeCommand writes an executable shell script into a temp dir and
+// returns its path. Tests use it to stand in for external CLIs.
+func writeFakeCommand(t *testing.T, name, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands require a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
 }
 
 func TestLoadEnv(t *testing.T) {
@@ -49,7 +51,7 @@ func TestLoadEnv(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app, _ := createTestApp()
+	app, _ := newApp()
 	app.Action = func(c *cli.Context) error {
 		envMap, err := loadEnv(c)
 		if err != nil {
@@ -84,7 +86,7 @@ func TestDefaultEnvRemoved(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app, _ := createTestApp()
+	app, _ := newApp()
 	app.Action = func(c *cli.Context) error {
 		envMap, err := loadEnv(c)
 		if err != nil {
@@ -111,7 +113,7 @@ func TestIsolate(t *testing.T) {
 	os.Setenv("SYSTEM_VAR", "system")
 	defer os.Unsetenv("SYSTEM_VAR")
 
-	app, _ := createTestApp()
+	app, _ := newApp()
 	app.Action = func(c *cli.Context) error {
 		envMap, err := loadEnv(c)
 		if err != nil {
@@ -141,7 +143,7 @@ func TestKeysJSON(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app, _ := createTestApp()
+	app, _ := newApp()
 	app.Commands = []*cli.Command{
 		{
 			Name: "keys",
@@ -182,7 +184,7 @@ func TestListJSON(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app, _ := createTestApp()
+	app, _ := newApp()
 	app.Commands = []*cli.Command{
 		{
 			Name: "list",
@@ -219,6 +221,237 @@ func TestListJSON(t *testing.T) {
 	}
 }
 
+func runListOutput(t *testing.T, args ...string) string {
+	t.Helper()
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "list",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Value:   "text",
+				},
+				&cli.StringFlag{Name: "group-by"},
+				&cli.BoolFlag{Name: "with-meta"},
+			},
+			Action: runList,
+		},
+	}
+
+	var buf bytes.Buffer
+	app.Writer = &buf
+	if err := app.Run(append([]string{"denv"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestListCSV(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("FOO=bar\nMSG='a, \"b\"'"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runListOutput(t, "--file", envFile, "--isolate", "list", "-o", "csv")
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV output: %v\nOutput was: %q", err, out)
+	}
+
+	want := [][]string{
+		{"key", "value", "source"},
+		{"FOO", "bar", envFile},
+		{"MSG", `a, "b"`, envFile},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("expected %q, got %q", want, records)
+	}
+}
+
+func TestListNDJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	env1 := filepath.Join(tmpDir, ".env1")
+	env2 := filepath.Join(tmpDir, ".env2")
+	if err := os.WriteFile(env1, []byte("FOO=bar\nCOMMON=1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(env2, []byte("COMMON=2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runListOutput(t, "--file", env1, "--file", env2, "--isolate", "list", "-o", "ndjson")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", out)
+	}
+
+	var record struct {
+		Key, Value, Source string
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Key != "COMMON" || record.Value != "2" || record.Source != env2 {
+		t.Errorf("expected COMMON=2 from %s, got %+v", env2, record)
+	}
+}
+
+func TestListGroupBySource(t *testing.T) {
+	tmpDir := t.TempDir()
+	env1 := filepath.Join(tmpDir, ".env1")
+	env2 := filepath.Join(tmpDir, ".env2")
+	if err := os.WriteFile(env1, []byte("ZED=1\nALPHA=1\nCOMMON=1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(env2, []byte("COMMON=2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runListOutput(t, "--file", env1, "--file", env2, "--isolate", "list", "--group-by", "source")
+	want := "# " + env1 + "\nZED=1\nALPHA=1\n\n# " + env2 + "\nCOMMON=2\n"
+	if out != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+}
+
+func TestListWithMeta(t *testing.T) {
+	tmpDir := t.TempDir()
+	env1 := filepath.Join(tmpDir, ".env1")
+	env2 := filepath.Join(tmpDir, ".env2")
+	content := `# Service settings
+
+# Port the HTTP server listens on.
+# denv:required
+PORT=8080
+# Log verbosity,
+# one of debug or info.
+LOG_LEVEL=info
+`
+	if err := os.WriteFile(env1, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(env2, []byte("PORT=9090\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runListOutput(t, "--file", env1, "--file", env2, "--isolate", "list", "-o", "json", "--with-meta")
+	want := `{"LOG_LEVEL":{"value":"info","source":"` + env1 + `","description":"Log verbosity,\none of debug or info."},` +
+		`"PORT":{"value":"9090","source":"` + env2 + `","description":"Port the HTTP server listens on."}}` + "\n"
+	if out != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+}
+
+func TestListJSONLayout(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("ZED=1\nALPHA=2\nMID=3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	compact := runListOutput(t, "--file", envFile, "--isolate", "list", "-o", "json")
+	if compact != `{"ALPHA":"2","MID":"3","ZED":"1"}`+"\n" {
+		t.Errorf("expected sorted single-line JSON, got %q", compact)
+	}
+	pretty := runListOutput(t, "--file", envFile, "--isolate", "--pretty", "list", "-o", "json")
+	if pretty != "{\n  \"ALPHA\": \"2\",\n  \"MID\": \"3\",\n  \"ZED\": \"1\"\n}\n" {
+		t.Errorf("expected indented JSON, got %q", pretty)
+	}
+	for i := 0; i < 5; i++ {
+		if out := runListOutput(t, "--file", envFile, "--isolate", "list", "-o", "json"); out != compact {
+			t.Fatalf("output changed between runs: %q vs %q", out, compact)
+		}
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	tmpDir := t.TempDir()
+	env1 := filepath.Join(tmpDir, ".env1")
+	env2 := filepath.Join(tmpDir, ".env2")
+	if err := os.WriteFile(env1, []byte("COMMON=1\nSAME=x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(env2, []byte("COMMON=2\nSAME=x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy  string
+		want    string
+		wantErr bool
+		warning bool
+	}{
+		{policy: "last-wins", want: "2"},
+		{policy: "first-wins", want: "1"},
+		{policy: "warn", want: "2", warning: true},
+		{policy: "error", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var got string
+			app, _ := newApp()
+			var stderr bytes.Buffer
+			app.ErrWriter = &stderr
+			app.Action = func(c *cli.Context) error {
+				envMap, err := loadEnv(c)
+				got = envMap["COMMON"]
+				return err
+			}
+
+			err := app.Run([]string{"denv", "--isolate", "--on-conflict", tt.policy, "--file", env1, "--file", env2})
+			if tt.wantErr {
+				if exitCode(err) != exitValidation {
+					t.Fatalf("expected validation error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected COMMON=%s, got %s", tt.want, got)
+			}
+			if warned := strings.Contains(stderr.String(), "COMMON"); warned != tt.warning {
+				t.Errorf("unexpected warning output %q", stderr.String())
+			}
+			if strings.Contains(stderr.String(), "SAME") {
+				t.Errorf("identical values must not conflict, got %q", stderr.String())
+			}
+		})
+	}
+}
+
+func TestProtectedKeys(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PATH=/tmp/evil\nDYLD_INSERT_LIBRARIES=x.dylib\nPORT=1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) (map[string]string, error) {
+		var envMap map[string]string
+		app, _ := newApp()
+		app.Action = func(c *cli.Context) error {
+			var err error
+			envMap, err = loadEnv(c)
+			return err
+		}
+		err := app.Run(append([]string{"denv", "--isolate", "--file", envFile}, args...))
+		return envMap, err
+	}
+
+	if _, err := run(); exitCode(err) != exitValidation || !strings.Contains(err.Error(), "DYLD_INSERT_LIBRARIES") {
+		t.Errorf("expected protected key error, got %v", err)
+	}
+	if envMap, err := run("--allow-protected"); err != nil || envMap["PATH"] != "/tmp/evil" {
+		t.Errorf("expected --allow-protected to permit PATH, got %v (%v)", envMap, err)
+	}
+	if _, err := run("--protected-key", "PORT"); err == nil || !strings.Contains(err.Error(), "PORT") {
+		t.Errorf("expected custom protected key to replace defaults, got %v", err)
+	}
+}
+
 func TestOptionalFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	env1 := filepath.Join(tmpDir, ".env1")
@@ -228,7 +461,7 @@ func TestOptionalFile(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app, _ := createTestApp()
+	app, _ := newApp()
 	app.Action = func(c *cli.Context) error {
 		envMap, err := loadEnv(c)
 		if err != nil {
@@ -249,7 +482,7 @@ func TestOptionalFile(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app2, _ := createTestApp()
+	app2, _ := newApp()
 	app2.Action = func(c *cli.Context) error {
 		envMap, err := loadEnv(c)
 		if err != nil {
@@ -268,6 +501,50 @@ func TestOptionalFile(t *testing.T) {
 	}
 }
 
+func TestLocalFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := filepath.Join(tmpDir, ".env")
+	prod := filepath.Join(tmpDir, ".env.production")
+	for path, content := range map[string]string{
+		env:            "A=env\nB=env\n",
+		env + ".local": "A=env.local\nB=env.local\n",
+		prod:           "B=production\nC=production\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app, files := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		want := map[string]string{"A": "env.local", "B": "env.local", "C": "production"}
+		for k, v := range want {
+			if envMap[k] != v {
+				return fmt.Errorf("expected %s=%s, got %q", k, v, envMap[k])
+			}
+		}
+		return nil
+	}
+	if err := app.Run([]string{"denv", "--isolate", "--local", "-f", env, "-f", prod, "--fo", env + ".local"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// .env.local is listed explicitly, so it keeps its own position.
+	want := []EnvFile{
+		{Path: env},
+		{Path: prod},
+		{Path: prod + ".local", Optional: true},
+		{Path: env + ".local", Optional: true},
+	}
+	if !reflect.DeepEqual(*files, want) {
+		t.Errorf("expected sources %+v, got %+v", want, *files)
+	}
+}
+
 func TestMergeOrder(t *testing.T) {
 	tmpDir := t.TempDir()
 	env1 := filepath.Join(tmpDir, ".env1")
@@ -284,7 +561,7 @@ func TestMergeOrder(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app, _ := createTestApp()
+	app, _ := newApp()
 	app.Action = func(c *cli.Context) error {
 		envMap, err := loadEnv(c)
 		if err != nil {
@@ -301,7 +578,7 @@ func TestMergeOrder(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app2, _ := createTestApp()
+	app2, _ := newApp()
 	app2.Action = func(c *cli.Context) error {
 		envMap, err := loadEnv(c)
 		if err != nil {
@@ -317,3 +594,75 @@ func TestMergeOrder(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLoadEnvParallel(t *testing.T) {
+	kubectl := writeFakeCommand(t, "kubectl", `sleep 0.3; echo '{"data":{"NAME":"'$3'"}}'`)
+	defer func(orig string) { kubectlCommand = orig }(kubectlCommand)
+	kubectlCommand = kubectl
+
+	args := []string{"denv", "--isolate"}
+	for i := range 5 {
+		args = append(args, "--k8s-configmap", fmt.Sprintf("default/cm%d", i))
+	}
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		start := time.Now()
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if envMap["NAME"] != "cm4" {
+			return fmt.Errorf("expected the last source to win, got NAME=%s", envMap["NAME"])
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			return fmt.Errorf("expected sources to load concurrently, took %s", elapsed)
+		}
+		return nil
+	}
+
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeLargeEnvFiles writes n generated variables split over two files
+// that override half of each other's keys.
+func writeLargeEnvFiles(b *testing.B, n int) (string, string) {
+	b.Helper()
+	dir := b.TempDir()
+	var base, override strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&base, "GENERATED_KEY_%05d=value-%d-abcdefghijklmnopqrstuvwxyz\n", i, i)
+		if i%2 == 0 {
+			fmt.Fprintf(&override, "GENERATED_KEY_%05d=\"override ${GENERATED_KEY_%05d}\"\n", i, i)
+		}
+	}
+	basePath := filepath.Join(dir, ".env")
+	overridePath := filepath.Join(dir, ".env.local")
+	if err := os.WriteFile(basePath, []byte(base.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(overridePath, []byte(override.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return basePath, overridePath
+}
+
+func BenchmarkLoadEnv(b *testing.B) {
+	base, override := writeLargeEnvFiles(b, 10000)
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := loadEnv(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := app.Run([]string{"denv", "--no-parse-cache", "-f", base, "-f", override}); err != nil {
+		b.Fatal(err)
+	}
+}
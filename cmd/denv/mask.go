@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+// maskWriter replaces every occurrence of the secrets in the bytes written
+// through it with maskedValue. Output that may be the start of a secret is
+// held back until the next write shows whether it is one; Flush writes it
+// unchanged.
+type maskWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	secrets []string
+	// first marks bytes that start some secret, to skip most positions
+	// without comparing.
+	first   [256]bool
+	pending []byte
+}
+
+// newMaskWriter returns a writer masking secrets in the output written to
+// w. Longer secrets are matched first, so a secret containing another one
+// is masked as a whole.
+func newMaskWriter(w io.Writer, secrets []string) *maskWriter {
+	m := &maskWriter{w: w}
+	for _, s := range secrets {
+		if s != "" && !slices.Contains(m.secrets, s) {
+			m.secrets = append(m.secrets, s)
+			m.first[s[0]] = true
+		}
+	}
+	slices.SortFunc(m.secrets, func(a, b string) int { return len(b) - len(a) })
+	return m
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = append(m.pending, p...)
+	if err := m.scrub(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes output held back as a possible secret prefix.
+func (m *maskWriter) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.scrub(true)
+}
+
+// scrub writes the pending bytes with secrets masked. Unless final, it
+// stops at the first position where the rest could still become a secret.
+func (m *maskWriter) scrub(final bool) error {
+	var out []byte
+	buf := m.pending
+	i := 0
+scan:
+	for i < len(buf) {
+		if !m.first[buf[i]] {
+			out = append(out, buf[i])
+			i++
+			continue
+		}
+		rest := string(buf[i:])
+		if !final {
+			for _, s := range m.secrets {
+				if len(rest) < len(s) && strings.HasPrefix(s, rest) {
+					break scan
+				}
+			}
+		}
+		for _, s := range m.secrets {
+			if strings.HasPrefix(rest, s) {
+				out = append(out, maskedValue...)
+				i += len(s)
+				continue scan
+			}
+		}
+		out = append(out, buf[i])
+		i++
+	}
+	m.pending = append(m.pending[:0], buf[i:]...)
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := m.w.Write(out)
+	return err
+}
+
+// maskedSecrets returns the values of the keys in envMap that are likely
+// secrets (see secretKeys). Short values such as ports or flags would mask
+// unrelated output, so they are left alone.
+func maskedSecrets(c *cli.Context, envMap, origins map[string]string) []string {
+	var values []string
+	for k := range secretKeys(c, envMap, origins, defaultSecretKeys) {
+		if v := envMap[k]; len(v) >= guardMinLength {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMaskWriter(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"single write", []string{"token=s3cr3t-value done"}, "token=*** done"},
+		{"split secret", []string{"token=s3cr", "3t-val", "ue done"}, "token=*** done"},
+		{"prefix only", []string{"s3cr3t", "!"}, "s3cr3t!"},
+		{"prefix at end", []string{"abc s3cr"}, "abc s3cr"},
+		{"longest first", []string{"s3cr3t-value-long"}, "***"},
+		{"adjacent", []string{"s3cr3t-values3cr3t-value"}, "******"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newMaskWriter(&buf, []string{"s3cr3t-value", "s3cr3t-value-long", ""})
+			for _, s := range tc.writes {
+				if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestExecMaskOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	content := "API_TOKEN=tok-123456\nPASSWORD=abc\nHOST=db.internal\nOUT=" + tmpDir + "/out.log\n"
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	captureExit(t)
+	script := `printf 'token %s\n' "$API_TOKEN"; printf 'password %s host %s' "$PASSWORD" "$HOST" >&2`
+	args := []string{"denv", "--isolate", "--file", envFile, "exec", "--mask-output", "--stdout", "$OUT", "--stderr", "$OUT", "sh", "-c", script}
+	if err := createExecApp().Run(args); err != nil {
+		t.Fatal(err)
+	}
+
+	// Values shorter than guardMinLength are not masked.
+	out, _ := os.ReadFile(filepath.Join(tmpDir, "out.log"))
+	if want := "token ***\npassword abc host db.internal"; string(out) != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// runMerge writes the merged sources (without the system environment) as a
+// single env file, optionally annotating every key with where it came from.
+// Keys that extend the inherited value, like PATH+=, keep doing so.
+func runMerge(c *cli.Context) error {
+	reader := &sourceReader{c: c, want: keyFilter(c, nil)}
+	envMap, origins, err := mergeWith(reader)
+	if err != nil {
+		return err
+	}
+
+	// Line of the last definition of each key per source, which is the
+	// one that took effect.
+	lines := make(map[string]map[string]int)
+	if c.Bool("annotate") {
+		for _, file := range envFiles(c) {
+			byKey := make(map[string]int)
+			for _, e := range fileEntries(c, file) {
+				byKey[e.Key] = e.Line
+			}
+			lines[file.String()] = byKey
+		}
+	}
+
+	var sb strings.Builder
+	for _, k := range sortedKeys(envMap) {
+		if c.Bool("annotate") {
+			origin := origins[k]
+			if line, ok := lines[origin][k]; ok {
+				origin = fmt.Sprintf("%s:%d", origin, line)
+			}
+			fmt.Fprintf(&sb, "# from: %s\n", origin)
+		}
+		if parts, ok := reader.extends[k]; ok {
+			sb.WriteString(extendingAssignment(c, k, parts))
+			continue
+		}
+		fmt.Fprintf(&sb, "%s=%s\n", k, formatValue(envMap[k]))
+	}
+
+	output := c.String("output")
+	if output == "" || output == "-" {
+		fmt.Fprint(c.App.Writer, sb.String())
+		return nil
+	}
+	return os.WriteFile(output, []byte(sb.String()), 0600)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestMerge(t *testing.T) {
+	tmpDir := t.TempDir()
+	base := filepath.Join(tmpDir, "base.env")
+	prod := filepath.Join(tmpDir, "prod.env")
+	out := filepath.Join(tmpDir, "out.env")
+
+	if err := os.WriteFile(base, []byte("PORT=8080\nNAME='my app'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(prod, []byte("# production\n\nPORT=80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "merge",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "output", Aliases: []string{"o"}},
+				&cli.BoolFlag{Name: "annotate"},
+			},
+			Action: runMerge,
+		},
+	}
+
+	if err := app.Run([]string{"denv", "-f", base, "-f", prod, "merge", "-o", out, "--annotate"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# from: " + base + ":2\nNAME='my app'\n# from: " + prod + ":3\nPORT=80\n"
+	if string(data) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, data)
+	}
+
+	merged, _, err := readEnvFile(out, parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged["NAME"] != "my app" || merged["PORT"] != "80" || len(merged) != 2 {
+		t.Errorf("expected merged file to read back, got %v", merged)
+	}
+}
+
+func TestMergeKeepsExtendingKeys(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	tmpDir := t.TempDir()
+	a := filepath.Join(tmpDir, "a.env")
+	b := filepath.Join(tmpDir, "b.env")
+	out := filepath.Join(tmpDir, "out.env")
+	if err := os.WriteFile(a, []byte("LIBS+=/a\n# denv:merge=prepend\nINCLUDE=/first\nMIXED+=/after\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("LIBS+=/b\n# denv:merge=prepend\nMIXED=/before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LIBS", "/sys")
+	t.Setenv("INCLUDE", "/usr/include")
+	t.Setenv("MIXED", "/sys")
+
+	run := func(args ...string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		app, _ := newApp()
+		app.Writer = &buf
+		app.Commands = []*cli.Command{
+			{Name: "merge", Flags: []cli.Flag{&cli.StringFlag{Name: "output", Aliases: []string{"o"}}, &cli.BoolFlag{Name: "annotate"}}, Action: runMerge},
+			{Name: "convert", Flags: []cli.Flag{&cli.StringFlag{Name: "to"}, &cli.StringFlag{Name: "output"}}, Action: runConvert},
+			{Name: "get", Action: runGet},
+		}
+		if err := app.Run(append([]string{"denv"}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	run("-f", a, "-f", b, "merge", "-o", out)
+	for _, key := range []string{"LIBS", "INCLUDE", "MIXED"} {
+		if got, want := run("-f", out, "get", key), run("-f", a, "-f", b, "get", key); got != want {
+			t.Errorf("%s: expected %q from the merged file, got %q", key, want, got)
+		}
+	}
+	if got := run("-f", out, "get", "LIBS"); got != "/sys"+sep+"/a"+sep+"/b\n" {
+		t.Errorf("expected LIBS to extend the inherited value, got %q", got)
+	}
+
+	want := "# denv:merge=prepend\nINCLUDE=/first\nLIBS+=/a" + sep + "/b\nMIXED=/before" + sep + "/sys" + sep + "/after\n"
+	if got := run("-f", a, "-f", b, "convert", "--to", "dotenv"); got != want {
+		t.Errorf("expected dotenv\n%s\ngot\n%s", want, got)
+	}
+	want = "INCLUDE=/first" + sep + "/usr/include\nLIBS=/sys" + sep + "/a" + sep + "/b\nMIXED=/before" + sep + "/sys" + sep + "/after\n"
+	if got := run("-f", a, "-f", b, "convert", "--to", "docker"); got != want {
+		t.Errorf("expected docker\n%s\ngot\n%s", want, got)
+	}
+}
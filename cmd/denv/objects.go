@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// Object storage sources, given as -f s3://bucket/key or gs://bucket/key.
+const (
+	sourceS3  = "s3"
+	sourceGCS = "gs"
+)
+
+// Commands used to read object storage, using their ambient credentials.
+var (
+	awsCommand    = "aws"
+	gcloudCommand = "gcloud"
+)
+
+// objectSource splits an s3:// or gs:// URL into its source kind and
+// bucket/key path.
+func objectSource(value string) (kind, path string, ok bool, err error) {
+	for _, kind := range []string{sourceS3, sourceGCS} {
+		path, found := strings.CutPrefix(value, kind+"://")
+		if !found {
+			continue
+		}
+		bucket, key, _ := strings.Cut(path, "/")
+		if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+			return "", "", false, fmt.Errorf("invalid object URL %q (expected %s://bucket/key)", value, kind)
+		}
+		return kind, path, true, nil
+	}
+	return "", "", false, nil
+}
+
+// isObjectSource reports whether file is read from object storage.
+func isObjectSource(file EnvFile) bool {
+	return file.Kind == sourceS3 || file.Kind == sourceGCS
+}
+
+// objectNotFound turns the error of a lookup of a missing object into one
+// matching fs.ErrNotExist, so optional object sources may be absent.
+func objectNotFound(file EnvFile, err error) error {
+	msg := err.Error()
+	for _, marker := range []string{"Not Found", "NoSuchKey", "NotFound", "404", "No URLs matched"} {
+		if strings.Contains(msg, marker) {
+			return &fs.PathError{Op: "read", Path: file.String(), Err: fs.ErrNotExist}
+		}
+	}
+	return err
+}
+
+// objectETag returns the current ETag of an object.
+func objectETag(ctx context.Context, file EnvFile) (string, error) {
+	bucket, key, _ := strings.Cut(file.Path, "/")
+	var meta struct {
+		ETag string `json:"ETag"`
+		Etag string `json:"etag"`
+	}
+	var err error
+	if file.Kind == sourceS3 {
+		err = runCLIJSON(ctx, awsCommand, &meta, "s3api", "head-object", "--bucket", bucket, "--key", key, "--output", "json")
+	} else {
+		err = runCLIJSON(ctx, gcloudCommand, &meta, "storage", "objects", "describe", "gs://"+file.Path, "--format=json")
+	}
+	if err != nil {
+		return "", objectNotFound(file, err)
+	}
+	if meta.ETag == "" {
+		meta.ETag = meta.Etag
+	}
+	return meta.ETag, nil
+}
+
+// fetchObject downloads the content of an object.
+func fetchObject(ctx context.Context, file EnvFile) ([]byte, error) {
+	var data []byte
+	var err error
+	if file.Kind == sourceS3 {
+		data, err = runCLI(ctx, awsCommand, "", "s3", "cp", "--quiet", file.String(), "-")
+	} else {
+		data, err = runCLI(ctx, gcloudCommand, "", "storage", "cat", file.String())
+	}
+	if err != nil {
+		return nil, objectNotFound(file, err)
+	}
+	return data, nil
+}
+
+// readObject reads an env file from object storage. The parsed values are
+// kept in the cache together with the object's ETag, so the object is only
+// downloaded again once it changed. Command substitution is never run for
+// object sources.
+func (r *sourceReader) readObject(ctx context.Context, file EnvFile) (map[string]string, error) {
+	etag, err := objectETag(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	cache := r.openCache()
+	var entryPath string
+	if cache != nil {
+		// Values are verified before they are cached, so a changed
+		// --verify never reuses entries stored without it.
+		entryPath = cache.entryPath(file, file.Verify)
+		if entry, ok := cache.stored(entryPath); ok && !cache.refresh && etag != "" && entry.ETag == etag {
+			return entry.Env, nil
+		}
+	}
+
+	data, err := fetchObject(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	if file.Verify != "" {
+		signature := func(suffix string) ([]byte, error) {
+			return fetchObject(ctx, EnvFile{Kind: file.Kind, Path: file.Path + suffix})
+		}
+		if err := verifySource(r.c, file, data, signature); err != nil {
+			return nil, err
+		}
+	}
+	opts := r.parseOptions(file.String())
+	opts.ExecValues = false
+	opts.Format = file.Format
+	if data, err = decodeEnv(data, opts.Encoding); err != nil {
+		return nil, err
+	}
+	entries, err := parseEnvFormat(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string, len(entries))
+	for _, e := range entries {
+		env[e.Key] = e.Value
+	}
+
+	if cache != nil && etag != "" {
+		if err := writeSealed(cache.aead, entryPath, cacheEntry{Stored: time.Now(), Env: env, ETag: etag}); err != nil {
+			r.warnf("failed to cache %s: %v", file, err)
+		}
+	}
+	return env, nil
+}
+
+// objectCacheStatus describes the cached copy of an object source.
+func objectCacheStatus(r *sourceReader, file EnvFile) string {
+	cache := r.openCache()
+	if cache == nil {
+		return ""
+	}
+	entry, ok := cache.stored(cache.entryPath(file, file.Verify))
+	if !ok {
+		return ", not cached"
+	}
+	return fmt.Sprintf(", cached with ETag %s", entry.ETag)
+}
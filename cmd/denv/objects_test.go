@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestObjectSource(t *testing.T) {
+	for _, tt := range []struct {
+		value, kind, path string
+		ok, fails         bool
+	}{
+		{value: "s3://bucket/prod/app.env", kind: sourceS3, path: "bucket/prod/app.env", ok: true},
+		{value: "gs://bucket/app.env", kind: sourceGCS, path: "bucket/app.env", ok: true},
+		{value: ".env"},
+		{value: "s3://bucket", fails: true},
+		{value: "gs://bucket/dir/", fails: true},
+	} {
+		kind, path, ok, err := objectSource(tt.value)
+		if (err != nil) != tt.fails || kind != tt.kind || path != tt.path || ok != tt.ok {
+			t.Errorf("%s: got %q %q %v %v", tt.value, kind, path, ok, err)
+		}
+	}
+}
+
+func TestReadObjectSources(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"etag":    `"v1"`,
+		"content": "PORT=8080\nREGION=eu\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetches := filepath.Join(dir, "fetches")
+	aws := writeFakeCommand(t, "aws", `
+case "$1 $2" in
+"s3api head-object")
+  [ "$6" = prod.env ] || { echo "An error occurred (404) when calling the HeadObject operation: Not Found" >&2; exit 254; }
+  printf '{"ETag":%s}' "$(cat `+dir+`/etag)" ;;
+"s3 cp") echo "$4" >> `+fetches+`; cat `+dir+`/content ;;
+*) echo "unexpected $*" >&2; exit 1 ;;
+esac
+`)
+	gcloud := writeFakeCommand(t, "gcloud", `
+case "$2" in
+objects) echo '{"etag":"CNv1"}' ;;
+cat) echo "$3" >> `+fetches+`; echo LOG_LEVEL=debug ;;
+esac
+`)
+	defer func(a, g string) { awsCommand, gcloudCommand = a, g }(awsCommand, gcloudCommand)
+	awsCommand, gcloudCommand = aws, gcloud
+
+	list := func(args ...string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		app := createRunApp()
+		app.Writer = &buf
+		if err := app.Run(append([]string{"denv", "--isolate", "--cache-dir", filepath.Join(dir, "cache")}, append(args, "list")...)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	args := []string{"-f", "s3://bucket/prod.env", "-f", "gs://bucket/app.env", "-fo", "s3://bucket/missing.env"}
+	want := "LOG_LEVEL=debug\nPORT=8080\nREGION=eu\n"
+	if out := list(args...); out != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+
+	// Unchanged ETags are served from the cache; a new one is fetched.
+	list(args...)
+	if err := os.WriteFile(filepath.Join(dir, "content"), []byte("PORT=9090\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "etag"), []byte(`"v2"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out := list(args...); !strings.Contains(out, "PORT=9090\n") {
+		t.Errorf("expected the changed object to be fetched, got:\n%s", out)
+	}
+	data, err := os.ReadFile(fetches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sources are read concurrently, so fetches are compared in sorted order.
+	fetched := strings.Fields(string(data))
+	slices.Sort(fetched)
+	if want := []string{"gs://bucket/app.env", "s3://bucket/prod.env", "s3://bucket/prod.env"}; !slices.Equal(fetched, want) {
+		t.Errorf("expected fetches %v, got %v", want, fetched)
+	}
+
+	app := createRunApp()
+	err = app.Run([]string{"denv", "--isolate", "--cache-dir", filepath.Join(dir, "cache"), "-f", "s3://bucket/missing.env", "list"})
+	if err == nil || !strings.Contains(err.Error(), "file does not exist") {
+		t.Errorf("expected a missing object error, got %v", err)
+	}
+}
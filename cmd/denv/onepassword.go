@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// opCommand is the 1Password CLI used with service account tokens. It is a
+// variable so tests can substitute a fake.
+var opCommand = "op"
+
+// opItem is a 1Password item as returned by Connect and by "op item get
+// --format json".
+type opItem struct {
+	ID     string    `json:"id"`
+	Title  string    `json:"title"`
+	Fields []opField `json:"fields"`
+}
+
+type opField struct {
+	Label   string `json:"label"`
+	Value   string `json:"value"`
+	Purpose string `json:"purpose"`
+}
+
+// readOnePassword imports the items of a 1Password vault that carry
+// --op-tag. It talks to a Connect server when --op-connect-host is set and
+// otherwise runs the op CLI, which authenticates with the service account
+// token in OP_SERVICE_ACCOUNT_TOKEN.
+func readOnePassword(ctx context.Context, c *cli.Context, vault string) (map[string]string, error) {
+	var items []opItem
+	var err error
+	if host := c.String("op-connect-host"); host != "" {
+		items, err = opConnectItems(ctx, host, c.String("op-connect-token"), vault, c.String("op-tag"))
+	} else {
+		items, err = opCLIItems(ctx, vault, c.String("op-tag"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return opItemsEnv(items), nil
+}
+
+// opItemsEnv maps item fields to variables. A field labelled like an
+// upper-case variable name (API_TOKEN) is used as is; other labels are
+// prefixed with the item title, so the password field of "Database"
+// becomes DATABASE_PASSWORD. Items are applied in title order, so later
+// titles win on duplicate keys. Notes and empty fields are skipped.
+func opItemsEnv(items []opItem) map[string]string {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Title < items[j].Title })
+	env := make(map[string]string)
+	for _, item := range items {
+		for _, f := range item.Fields {
+			if f.Value == "" || f.Purpose == "NOTES" || f.Label == "" {
+				continue
+			}
+			key := f.Label
+			if key != envKey(key) || validateKey(key) != nil {
+				key = envKey(item.Title, f.Label)
+			}
+			env[key] = f.Value
+		}
+	}
+	return env
+}
+
+type opConnectClient struct {
+	host  string
+	token string
+	http  *http.Client
+}
+
+func (o *opConnectClient) get(ctx context.Context, path string, query url.Values, out any) error {
+	u := o.host + "/v1/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.token)
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		msg := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Message != "" {
+			msg = apiErr.Message
+		}
+		return fmt.Errorf("1password connect GET %s: %s", path, msg)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("1password connect GET %s: invalid response: %w", path, err)
+	}
+	return nil
+}
+
+// opConnectItems reads the tagged items of a vault, given by name or ID,
+// from a 1Password Connect server.
+func opConnectItems(ctx context.Context, host, token, vault, tag string) ([]opItem, error) {
+	if token == "" {
+		return nil, fmt.Errorf("1password connect token is required (--op-connect-token or OP_CONNECT_TOKEN)")
+	}
+	o := &opConnectClient{host: strings.TrimRight(host, "/"), token: token, http: &http.Client{Timeout: 30 * time.Second}}
+
+	var vaults []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := o.get(ctx, "vaults", nil, &vaults); err != nil {
+		return nil, err
+	}
+	vaultID := ""
+	for _, v := range vaults {
+		if v.Name == vault || v.ID == vault {
+			vaultID = v.ID
+			break
+		}
+	}
+	if vaultID == "" {
+		return nil, fmt.Errorf("1password vault %q not found", vault)
+	}
+
+	var summaries []opItem
+	query := url.Values{"filter": {fmt.Sprintf("tag eq %q", tag)}}
+	if err := o.get(ctx, "vaults/"+vaultID+"/items", query, &summaries); err != nil {
+		return nil, err
+	}
+	items := make([]opItem, 0, len(summaries))
+	for _, s := range summaries {
+		var item opItem
+		if err := o.get(ctx, "vaults/"+vaultID+"/items/"+s.ID, nil, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// opCLIItems reads the tagged items of a vault with the op CLI.
+func opCLIItems(ctx context.Context, vault, tag string) ([]opItem, error) {
+	var summaries []opItem
+	if err := runOp(ctx, &summaries, "item", "list", "--vault", vault, "--tags", tag, "--format", "json"); err != nil {
+		return nil, err
+	}
+	items := make([]opItem, 0, len(summaries))
+	for _, s := range summaries {
+		var item opItem
+		if err := runOp(ctx, &item, "item", "get", s.ID, "--vault", vault, "--format", "json"); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func runOp(ctx context.Context, out any, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, opCommand, args...)
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	data, err := cmd.Output()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("op: %s", strings.TrimSpace(stderr.String()))
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid op output: %w", err)
+	}
+	return nil
+}
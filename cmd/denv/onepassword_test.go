@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestOnePasswordConnect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer connect-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"status": 401, "message": "Invalid token signature"})
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/vaults":
+			w.Write([]byte(`[{"id":"v1","name":"Other"},{"id":"v2","name":"Production"}]`))
+		case "/v1/vaults/v2/items":
+			if got := r.URL.Query().Get("filter"); got != `tag eq "denv"` {
+				t.Errorf("unexpected filter %q", got)
+			}
+			w.Write([]byte(`[{"id":"i1","title":"Stripe"},{"id":"i2","title":"Database"}]`))
+		case "/v1/vaults/v2/items/i1":
+			w.Write([]byte(`{"id":"i1","title":"Stripe","fields":[{"label":"STRIPE_KEY","value":"sk_live_123"},{"label":"notesPlain","value":"rotate yearly","purpose":"NOTES"}]}`))
+		case "/v1/vaults/v2/items/i2":
+			w.Write([]byte(`{"id":"i2","title":"Database","fields":[{"label":"username","value":"app","purpose":"USERNAME"},{"label":"password","value":"hunter22","purpose":"PASSWORD"},{"label":"DB_HOST","value":"db.internal"},{"label":"empty","value":""}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	run := func(token string) (map[string]string, error) {
+		var env map[string]string
+		app, _ := newApp()
+		app.Action = func(c *cli.Context) error {
+			var err error
+			env, err = loadEnv(c)
+			return err
+		}
+		err := app.Run([]string{"denv", "--isolate", "--op-connect-host", srv.URL, "--op-connect-token", token, "--op-vault", "Production"})
+		return env, err
+	}
+
+	env, err := run("connect-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"STRIPE_KEY":        "sk_live_123",
+		"DATABASE_USERNAME": "app",
+		"DATABASE_PASSWORD": "hunter22",
+		"DB_HOST":           "db.internal",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("expected %q, got %q", want, env)
+	}
+
+	if _, err := run("wrong"); err == nil || !strings.Contains(err.Error(), "1password connect GET vaults: Invalid token signature") {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+}
+
+func TestOnePasswordCLI(t *testing.T) {
+	op := writeFakeCommand(t, "op", `
+case "$1 $2" in
+"item list") [ "$4 $6" = "Dev team" ] || { echo "unexpected $*" >&2; exit 1; }
+  echo '[{"id":"a","title":"GitHub"}]' ;;
+"item get") echo '{"id":"a","title":"GitHub","fields":[{"label":"GITHUB_TOKEN","value":"ghp_abc"},{"label":"api url","value":"https://api.github.com"}]}' ;;
+*) echo "unexpected $*" >&2; exit 1 ;;
+esac
+`)
+	defer func(orig string) { opCommand = orig }(opCommand)
+	opCommand = op
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		env, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		want := map[string]string{"GITHUB_TOKEN": "ghp_abc", "GITHUB_API_URL": "https://api.github.com"}
+		if !reflect.DeepEqual(env, want) {
+			t.Errorf("expected %q, got %q", want, env)
+		}
+		return nil
+	}
+	if err := app.Run([]string{"denv", "--isolate", "--op-tag", "team", "--op-vault", "Dev"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := opCLIItems(context.Background(), "Missing", "denv"); err == nil || !strings.HasPrefix(err.Error(), "op: unexpected item list --vault Missing") {
+		t.Errorf("expected an op error, got %v", err)
+	}
+}
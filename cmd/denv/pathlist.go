@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Merge modes for list-style variables such as PATH. Instead of replacing
+// the value from earlier sources (or the system environment), an
+// assignment written as KEY+=VALUE, annotated with "# denv:merge=MODE" or
+// matched by a merge rule in the project config joins with it.
+const (
+	mergeAppend  = "append"
+	mergePrepend = "prepend"
+)
+
+// joinPathList extends base with value, separated by the OS path list
+// separator. Empty sides are dropped so no empty entry is added.
+func joinPathList(base, value, mode string) string {
+	switch {
+	case base == "":
+		return value
+	case value == "":
+		return base
+	case mode == mergePrepend:
+		return value + string(os.PathListSeparator) + base
+	}
+	return base + string(os.PathListSeparator) + value
+}
+
+// pathListParts are the entries added before and after a value that is
+// not known yet, such as the inherited PATH.
+type pathListParts struct {
+	Before, After string
+}
+
+func (p *pathListParts) add(value, mode string) {
+	if mode == mergePrepend {
+		p.Before = joinPathList(p.Before, value, mergePrepend)
+	} else {
+		p.After = joinPathList(p.After, value, mergeAppend)
+	}
+}
+
+// around returns base with the parts around it.
+func (p pathListParts) around(base string) string {
+	return joinPathList(joinPathList(p.Before, base, mergeAppend), p.After, mergeAppend)
+}
+
+// extendingAssignment writes key, whose value from the sources extends the
+// inherited one, as a dotenv assignment that extends it again when loaded:
+// appended entries as KEY+=, prepended ones with a denv:merge=prepend
+// annotation. Entries on both sides do not fit one assignment, so they
+// are written around the inherited value instead.
+func extendingAssignment(c *cli.Context, key string, parts pathListParts) string {
+	switch {
+	case parts.Before == "":
+		return key + "+=" + formatValue(parts.After) + "\n"
+	case parts.After == "":
+		return "# denv:merge=prepend\n" + key + "=" + formatValue(parts.Before) + "\n"
+	}
+	return key + "=" + formatValue(parts.around(inheritedValue(c, key))) + "\n"
+}
+
+// inheritedValue returns the value of key in the inherited environment.
+func inheritedValue(c *cli.Context, key string) string {
+	for _, e := range inheritedEnv(c) {
+		if k, v, ok := strings.Cut(e, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// decodeConfigMerge decodes the merge rules of the config: a mapping of
+// key glob patterns to append or prepend.
+func decodeConfigMerge(value any) (map[string]string, error) {
+	m, ok := value.(map[string]any)
+	if !ok && value != nil {
+		return nil, fmt.Errorf("expected a mapping of key patterns to append or prepend")
+	}
+	rules := make(map[string]string, len(m))
+	for pattern, v := range m {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern", pattern)
+		}
+		mode, _ := v.(string)
+		if mode != mergeAppend && mode != mergePrepend {
+			return nil, fmt.Errorf("%s: expected append or prepend", pattern)
+		}
+		rules[pattern] = mode
+	}
+	return rules, nil
+}
+
+// mergeRule returns the mode of the first config merge rule matching key,
+// trying an exact pattern before globs in sorted order.
+func (cfg *config) mergeRule(key string) string {
+	if mode, ok := cfg.Merge[key]; ok {
+		return mode
+	}
+	for _, pattern := range sortedKeys(cfg.Merge) {
+		if matchesAny(key, []string{pattern}) {
+			return cfg.Merge[pattern]
+		}
+	}
+	return ""
+}
+
+// mergeModes returns the keys of a file source whose final value extends
+// the one from earlier sources, with their merge mode, as recorded when
+// the file was read.
+func (r *sourceReader) mergeModes(file EnvFile) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.modes[modesKey(file)]
+}
+
+// setMergeModes records the merge modes of a file source read by r.
+func (r *sourceReader) setMergeModes(file EnvFile, modes map[string]string) {
+	if modes == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.modes == nil {
+		r.modes = make(map[string]map[string]string)
+	}
+	r.modes[modesKey(file)] = modes
+}
+
+func modesKey(file EnvFile) string {
+	return file.Path + "?format=" + file.Format
+}
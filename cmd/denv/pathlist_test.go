@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestParsePathListAssignments(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	src := "PATH+=/opt/a/bin\nPATH+=/opt/b/bin\n" +
+		"LIB=/usr/lib\n# denv:merge=prepend\nLIB=/opt/lib\n" +
+		"# denv:merge=prepend\nPYTHONPATH=src\nPYTHONPATH=/reset\n"
+	entries, err := parseDotenv([]byte(src), parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct{ Key, Value, Merge string }
+	var got []result
+	for _, e := range entries {
+		got = append(got, result{e.Key, e.Value, e.Merge})
+	}
+	want := []result{
+		{"PATH", "/opt/a/bin", mergeAppend},
+		{"PATH", "/opt/a/bin" + sep + "/opt/b/bin", mergeAppend},
+		{"LIB", "/usr/lib", ""},
+		{"LIB", "/opt/lib" + sep + "/usr/lib", ""},
+		{"PYTHONPATH", "src", mergePrepend},
+		{"PYTHONPATH", "/reset", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	_, modes, err := parseEnvData([]byte(src), parseOptions{})
+	if want := map[string]string{"PATH": mergeAppend}; err != nil || !reflect.DeepEqual(modes, want) {
+		t.Errorf("expected merge modes %v, got %v (%v)", want, modes, err)
+	}
+
+	if _, err := parseDotenv([]byte("# denv:merge=sideways\nPATH=/x\n"), parseOptions{}); err == nil || !strings.Contains(err.Error(), "invalid denv:merge=sideways") {
+		t.Errorf("expected an invalid mode error, got %v", err)
+	}
+
+	formatted, err := formatEnvFile([]byte("PATH += /opt/bin \n"))
+	if err != nil || string(formatted) != "PATH+=/opt/bin\n" {
+		t.Errorf("expected fmt to keep +=, got %q (%v)", formatted, err)
+	}
+}
+
+func TestMergePathLists(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("PYTHONPATH", "/site")
+	files := map[string]string{
+		".env":        "PATH+=/opt/tool/bin\nGOFLAGS=-mod=mod\n",
+		".env.dev":    "PATH+=/opt/dev/bin\nGOFLAGS=-race\nPYTHONPATH=src\n",
+		".env.prefix": "# denv:merge=prepend\nPATH=/opt/first\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wide := []byte{0xFF, 0xFE}
+	for _, r := range "PATH+=/opt/wide/bin\n" {
+		wide = binary.LittleEndian.AppendUint16(wide, uint16(r))
+	}
+	if err := os.WriteFile(".env.wide", wide, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(args ...string) (map[string]string, error) {
+		var env map[string]string
+		app, _ := newApp()
+		app.Action = func(c *cli.Context) error {
+			var err error
+			env, err = loadEnv(c)
+			return err
+		}
+		err := app.Run(append([]string{"denv"}, args...))
+		return env, err
+	}
+
+	env, err := load("-f", ".env", "-f", ".env.dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/usr/bin" + sep + "/opt/tool/bin" + sep + "/opt/dev/bin"; env["PATH"] != want {
+		t.Errorf("expected PATH %q, got %q", want, env["PATH"])
+	}
+	if env["GOFLAGS"] != "-race" || env["PYTHONPATH"] != "src" {
+		t.Errorf("expected plain assignments to replace, got %q and %q", env["GOFLAGS"], env["PYTHONPATH"])
+	}
+
+	env, err = load("-f", ".env", "-f", ".env.wide")
+	if want := "/usr/bin" + sep + "/opt/tool/bin" + sep + "/opt/wide/bin"; err != nil || env["PATH"] != want {
+		t.Errorf("expected PATH %q from a UTF-16 file, got %q (%v)", want, env["PATH"], err)
+	}
+
+	env, err = load("--isolate", "-f", ".env")
+	if err != nil || env["PATH"] != "/opt/tool/bin" {
+		t.Errorf("expected PATH without the inherited value, got %q (%v)", env["PATH"], err)
+	}
+
+	if _, err := load("-f", ".env", "-f", ".env.prefix"); err == nil || !strings.Contains(err.Error(), "PATH from .env.prefix is a protected key") {
+		t.Errorf("expected prepending to PATH to be denied, got %v", err)
+	}
+	env, err = load("--allow-protected", "-f", ".env", "-f", ".env.prefix")
+	if want := "/opt/first" + sep + "/usr/bin" + sep + "/opt/tool/bin"; err != nil || env["PATH"] != want {
+		t.Errorf("expected PATH %q, got %q (%v)", want, env["PATH"], err)
+	}
+
+	if err := os.WriteFile(defaultConfigFile, []byte("merge:\n  PYTHON*: prepend\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err = load("-f", ".env.dev")
+	if want := "src" + sep + "/site"; err != nil || env["PYTHONPATH"] != want {
+		t.Errorf("expected PYTHONPATH %q from the config rule, got %q (%v)", want, env["PYTHONPATH"], err)
+	}
+
+	if err := os.WriteFile(defaultConfigFile, []byte("merge:\n  PATH: replace\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := load("-f", ".env"); err == nil || !strings.Contains(err.Error(), "merge: PATH: expected append or prepend") {
+		t.Errorf("expected an invalid rule error, got %v", err)
+	}
+}
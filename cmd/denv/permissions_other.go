@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// checkFilePermissions is a no-op: file modes do not describe access on
+// this platform.
+func checkFilePermissions(path string, info fs.FileInfo) error {
+	return nil
+}
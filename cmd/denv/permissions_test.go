@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not checked on Windows")
+	}
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("TOKEN=secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(envFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(args ...string) error {
+		app, _ := newApp()
+		app.Action = func(c *cli.Context) error {
+			_, err := loadEnv(c)
+			return err
+		}
+		return app.Run(append([]string{"denv", "--isolate", "-f", envFile}, args...))
+	}
+
+	if err := load(); err != nil {
+		t.Fatalf("permissions should only be checked on request: %v", err)
+	}
+	err := load("--check-permissions")
+	if err == nil || !strings.Contains(err.Error(), "is accessible by other users (mode 0644") {
+		t.Fatalf("expected a permission error, got %v", err)
+	}
+	if code := exitCode(err); code != exitValidation {
+		t.Errorf("expected exit code %d, got %d", exitValidation, code)
+	}
+
+	if err := os.WriteFile(defaultConfigFile, []byte("check-permissions: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := load(); err == nil {
+		t.Error("expected check-permissions in denv.yaml to enable the check")
+	}
+
+	if err := os.Chmod(envFile, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := load("--check-permissions"); err != nil {
+		t.Errorf("expected a private file to load, got %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// checkFilePermissions rejects env files that other users can read or
+// write, or that are owned by someone other than the current user or root,
+// in the spirit of ssh's checks on private keys.
+func checkFilePermissions(path string, info fs.FileInfo) error {
+	if perm := info.Mode().Perm(); perm&0o006 != 0 {
+		return fmt.Errorf("%s is accessible by other users (mode %04o, run chmod o-rwx %s)", path, perm, path)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if uid := int(st.Uid); uid != os.Getuid() && uid != 0 {
+			return fmt.Errorf("%s is owned by another user (uid %d)", path, uid)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/urfave/cli/v2"
+)
+
+// humanWriter returns where confirmations and other messages meant for
+// people go: stdout, or stderr with --porcelain, so stdout only carries
+// data.
+func humanWriter(c *cli.Context) io.Writer {
+	if c.Bool("porcelain") {
+		return c.App.ErrWriter
+	}
+	return c.App.Writer
+}
+
+// recordSeparator ends each record of line-oriented output: a newline, or
+// NUL with -z so values may contain newlines.
+func recordSeparator(c *cli.Context) (string, error) {
+	if !c.Bool("null") {
+		return "\n", nil
+	}
+	if c.String("output") != "text" {
+		return "", errors.New("-z requires text output")
+	}
+	return "\x00", nil
+}
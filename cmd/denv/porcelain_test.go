@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestPorcelain(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=80\nMOTD=\"line one\nline two\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) (string, string, error) {
+		var stdout, stderr bytes.Buffer
+		app, _ := newApp()
+		app.Writer, app.ErrWriter = &stdout, &stderr
+		outputFlags := []cli.Flag{
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: "text"},
+			&cli.BoolFlag{Name: "null", Aliases: []string{"z"}},
+		}
+		app.Commands = []*cli.Command{
+			{Name: "keys", Flags: outputFlags, Action: runKeys},
+			{Name: "list", Flags: append(outputFlags, &cli.StringFlag{Name: "group-by"}), Action: runList},
+			{Name: "validate", Flags: outputFlags, Action: runValidate},
+			{Name: "push", Flags: append(deployFlags(), &cli.BoolFlag{Name: "delete"}), Action: runPush},
+			{Name: "pull", Flags: append(deployFlags(), &cli.StringFlag{Name: "output"}), Action: runPull},
+		}
+		err := app.Run(append([]string{"denv", "--isolate", "-f", envFile}, args...))
+		return stdout.String(), stderr.String(), err
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"keys", "-z"}, "MOTD\x00PORT\x00"},
+		{[]string{"list", "-z"}, "MOTD=line one\nline two\x00PORT=80\x00"},
+		{[]string{"list"}, "MOTD=line one\nline two\nPORT=80\n"},
+	} {
+		out, _, err := run(tt.args...)
+		if err != nil || out != tt.want {
+			t.Errorf("%v: expected %q, got %q (%v)", tt.args, tt.want, out, err)
+		}
+	}
+
+	if _, _, err := run("list", "-z", "-o", "json"); err == nil || err.Error() != "-z requires text output" {
+		t.Errorf("expected -z to require text output, got %v", err)
+	}
+	if _, _, err := run("--porcelain", "list", "--group-by", "source"); err == nil {
+		t.Error("expected --group-by to be rejected with --porcelain")
+	}
+
+	out, errOut, err := run("--porcelain", "validate")
+	if err != nil || out != "" || errOut != "No problems found\n" {
+		t.Errorf("expected the message on stderr only, got stdout %q, stderr %q (%v)", out, errOut, err)
+	}
+	if out, _, _ := run("validate"); out != "No problems found\n" {
+		t.Errorf("expected the message on stdout without --porcelain, got %q", out)
+	}
+
+	defer func(h string) { herokuCommand = h }(herokuCommand)
+	herokuCommand = writeFakeCommand(t, "heroku", `printf '%s\n' '{"PORT":"80","MOTD":"line one\nline two"}'`)
+	for _, args := range [][]string{
+		{"--porcelain", "push", "--target", "heroku:api"},
+		{"--porcelain", "pull", "--target", "heroku:api", "--output", envFile},
+	} {
+		out, errOut, err := run(args...)
+		if err != nil || out != "" || !strings.Contains(errOut, "up to date") {
+			t.Errorf("%v: expected the no-op message on stderr only, got stdout %q, stderr %q (%v)", args, out, errOut, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// envReferencePatterns match the ways code reads environment variables;
+// the first group is the name, or a list of names for destructuring.
+var envReferencePatterns = map[string][]*regexp.Regexp{
+	"go": {
+		regexp.MustCompile(`os\.(?:Getenv|LookupEnv)\(\s*["` + "`" + `]([A-Za-z_]\w*)["` + "`" + `]`),
+	},
+	"js": {
+		regexp.MustCompile(`(?:process\.env|import\.meta\.env)\.([A-Za-z_$][\w$]*)`),
+		regexp.MustCompile(`(?:process\.env|import\.meta\.env)\[\s*["'` + "`" + `]([A-Za-z_]\w*)["'` + "`" + `]\s*\]`),
+		regexp.MustCompile(`\{([^{}]*)\}\s*=\s*(?:process\.env|import\.meta\.env)\b`),
+	},
+	"python": {
+		regexp.MustCompile(`os\.(?:getenv|environ\.get|environ\.setdefault)\(\s*["']([A-Za-z_]\w*)["']`),
+		regexp.MustCompile(`os\.environ\[\s*["']([A-Za-z_]\w*)["']\s*\]`),
+	},
+	"ruby": {
+		regexp.MustCompile(`ENV\.fetch\(\s*["']([A-Za-z_]\w*)["']`),
+		regexp.MustCompile(`ENV\[\s*["']([A-Za-z_]\w*)["']\s*\]`),
+	},
+}
+
+// scannedLanguages maps the extensions of scanned files to their patterns.
+var scannedLanguages = map[string]string{
+	".go":  "go",
+	".js":  "js",
+	".jsx": "js",
+	".mjs": "js",
+	".cjs": "js",
+	".ts":  "js",
+	".tsx": "js",
+	".vue": "js",
+	".py":  "python",
+	".rb":  "ruby",
+}
+
+// skippedDirs are never scanned: dependencies and build artifacts reference
+// variables of their own.
+var skippedDirs = []string{"node_modules", "vendor", "__pycache__", "venv"}
+
+// referencedKeys adds the variable names referenced by a source file.
+func referencedKeys(src []byte, lang string, keys map[string]bool) {
+	for _, re := range envReferencePatterns[lang] {
+		for _, m := range re.FindAllSubmatch(src, -1) {
+			// "{ A, B: b, C = 1 } = process.env" reads A, B and C.
+			for _, name := range strings.Split(string(m[1]), ",") {
+				name, _, _ = strings.Cut(name, ":")
+				name, _, _ = strings.Cut(name, "=")
+				if name = strings.TrimSpace(name); isVarName(name) {
+					keys[name] = true
+				}
+			}
+		}
+	}
+}
+
+// scanReferences returns the variables referenced by the code below the
+// scan targets. Like go list, "dir/..." scans dir recursively and a plain
+// directory only its own files.
+func scanReferences(targets []string) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	scan := func(file string) error {
+		lang, ok := scannedLanguages[filepath.Ext(file)]
+		if !ok {
+			return nil
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		referencedKeys(src, lang, keys)
+		return nil
+	}
+
+	for _, target := range targets {
+		root, recursive := strings.CutSuffix(filepath.ToSlash(target), "/...")
+		if root == "..." {
+			root, recursive = ".", true
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := scan(root); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				return scan(p)
+			}
+			if p == root {
+				return nil
+			}
+			if !recursive || strings.HasPrefix(d.Name(), ".") || slices.Contains(skippedDirs, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// expansionRe matches $VAR and ${VAR...} references in env file values.
+var expansionRe = regexp.MustCompile(`\$\{?([A-Za-z_]\w*)`)
+
+// removeEnvEntries deletes the given assignments from src together with
+// the comments directly above them, leaving the rest untouched.
+func removeEnvEntries(src []byte, entries []envEntry) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	removed := make(map[int]bool)
+	for _, e := range entries {
+		for line := e.Line - len(e.Comments); line <= e.EndLine; line++ {
+			removed[line] = true
+		}
+	}
+	var kept []string
+	for i, line := range lines {
+		if !removed[i+1] {
+			kept = append(kept, line)
+		}
+	}
+	return []byte(strings.Join(kept, "\n"))
+}
+
+// runPrune reports the keys of the env files that no scanned code reads,
+// and removes them with --delete. Keys used by other values of the files,
+// or matching --keep, are never reported.
+func runPrune(c *cli.Context) error {
+	used, err := scanReferences(c.StringSlice("scan"))
+	if err != nil {
+		return err
+	}
+	keep := c.StringSlice("keep")
+
+	type prunedFile struct {
+		path    string
+		src     []byte
+		entries []envEntry
+	}
+	var files []prunedFile
+	for _, file := range envFiles(c) {
+		if file.Kind != sourceFile || file.Format != "" && file.Format != formatExports {
+			continue
+		}
+		entries := fileEntries(c, file)
+		for _, e := range entries {
+			for _, m := range expansionRe.FindAllStringSubmatch(e.Raw, -1) {
+				used[m[1]] = true
+			}
+		}
+		files = append(files, prunedFile{path: file.Path, entries: entries})
+	}
+
+	var unused int
+	for i := range files {
+		f := &files[i]
+		var pruned []envEntry
+		for _, e := range f.entries {
+			if used[e.Key] || slices.ContainsFunc(keep, func(pattern string) bool {
+				ok, _ := path.Match(pattern, e.Key)
+				return ok
+			}) {
+				continue
+			}
+			fmt.Fprintf(c.App.Writer, "%s:%d: %s\n", f.path, e.Line, e.Key)
+			pruned = append(pruned, e)
+		}
+		f.entries = pruned
+		unused += len(pruned)
+	}
+	if unused == 0 {
+		return nil
+	}
+	if !c.Bool("delete") {
+		return withExitCode(exitValidation, fmt.Errorf("%d unused keys (remove them with --delete)", unused))
+	}
+
+	for _, f := range files {
+		if len(f.entries) == 0 {
+			continue
+		}
+		src, err := os.ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+		if src, err = decodeEnv(src, c.String("encoding")); err != nil {
+			return &fs.PathError{Op: "failed to decode", Path: f.path, Err: err}
+		}
+		if err := writeFileKeepMode(f.path, removeEnvEntries(src, f.entries)); err != nil {
+			return err
+		}
+		fmt.Fprintf(humanWriter(c), "Removed %d keys from %s\n", len(f.entries), f.path)
+	}
+	return nil
+}
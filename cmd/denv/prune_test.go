@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func runPruneOutput(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "prune",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{Name: "scan", Value: cli.NewStringSlice("./...")},
+				&cli.StringSliceFlag{Name: "keep"},
+				&cli.BoolFlag{Name: "delete"},
+			},
+			Action: runPrune,
+		},
+	}
+
+	var buf bytes.Buffer
+	app.Writer, app.ErrWriter = &buf, &bytes.Buffer{}
+	err := app.Run(append([]string{"denv"}, args...))
+	return buf.String(), err
+}
+
+func TestReferencedKeys(t *testing.T) {
+	tests := []struct {
+		lang string
+		src  string
+		want []string
+	}{
+		{"go", "port := os.Getenv(\"PORT\")\nv, ok := os.LookupEnv(`DEBUG`)", []string{"DEBUG", "PORT"}},
+		{"js", "const url = process.env.API_URL ?? import.meta.env['VITE_KEY']", []string{"API_URL", "VITE_KEY"}},
+		{"js", "const { DB_HOST, DB_PORT: port, DB_NAME = 'app' } = process.env", []string{"DB_HOST", "DB_NAME", "DB_PORT"}},
+		{"python", "os.environ[\"SECRET\"]\nos.getenv('HOST', 'x')\nos.environ.get(\"USER\")", []string{"HOST", "SECRET", "USER"}},
+		{"ruby", "ENV.fetch(\"REDIS_URL\") || ENV['CACHE']", []string{"CACHE", "REDIS_URL"}},
+		{"go", "os.Getenv(name)", nil},
+	}
+	for _, tt := range tests {
+		keys := make(map[string]bool)
+		referencedKeys([]byte(tt.src), tt.lang, keys)
+		var got []string
+		for k := range keys {
+			got = append(got, k)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.src, tt.want, got)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	files := map[string]string{
+		"main.go":                       "package main\n\nvar port = os.Getenv(\"PORT\")\n",
+		"web/app.ts":                    "fetch(process.env.API_URL)\n",
+		"web/node_modules/lib/index.js": "process.env.LEGACY\n",
+		".env": `PORT=8080
+API_HOST=api.example.com
+API_URL=https://${API_HOST}/v1
+
+# Not used anymore.
+# denv:secret
+LEGACY=1
+AWS_REGION=eu-west-1
+`,
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, err := runPruneOutput(t, "-f", ".env", "prune")
+	if exitCode(err) != exitValidation {
+		t.Errorf("expected exit code 4 for unused keys, got %v", err)
+	}
+	if want := ".env:7: LEGACY\n.env:8: AWS_REGION\n"; out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+
+	// Only the top level of the directory is scanned without "/...".
+	out, _ = runPruneOutput(t, "-f", ".env", "prune", "--scan", ".", "--keep", "AWS_*")
+	if want := ".env:3: API_URL\n.env:7: LEGACY\n"; out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+
+	if _, err := runPruneOutput(t, "-f", ".env", "prune", "--keep", "AWS_*", "--delete"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(".env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "PORT=8080\nAPI_HOST=api.example.com\nAPI_URL=https://${API_HOST}/v1\n\nAWS_REGION=eu-west-1\n"; string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+
+	if _, err := runPruneOutput(t, "-f", ".env", "prune", "--keep", "AWS_*"); err != nil {
+		t.Errorf("expected no unused keys, got %v", err)
+	}
+}
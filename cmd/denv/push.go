@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// renderAPI is the base URL of the Render REST API. It is a variable so
+// tests can point it at a fake server.
+var renderAPI = "https://api.render.com/v1"
+
+type renderClient struct {
+	token string
+	http  *http.Client
+}
+
+func newRenderClient(c *cli.Context) (*renderClient, error) {
+	token := c.String("render-api-key")
+	if token == "" {
+		return nil, fmt.Errorf("render API key is required (--render-api-key or RENDER_API_KEY)")
+	}
+	return &renderClient{token: token, http: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (r *renderClient) do(method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, renderAPI+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+r.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		msg := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Message != "" {
+			msg = apiErr.Message
+		}
+		return fmt.Errorf("render %s %s: %s", method, path, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("render %s %s: invalid response: %w", method, path, err)
+	}
+	return nil
+}
+
+// envVars lists the environment variables of a Render service, following
+// the API's cursor pagination.
+func (r *renderClient) envVars(service string) (map[string]string, error) {
+	const limit = 100
+	env := make(map[string]string)
+	cursor := ""
+	for {
+		query := url.Values{"limit": {fmt.Sprint(limit)}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		var page []struct {
+			EnvVar struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			} `json:"envVar"`
+			Cursor string `json:"cursor"`
+		}
+		if err := r.do(http.MethodGet, "/services/"+url.PathEscape(service)+"/env-vars?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page {
+			env[item.EnvVar.Key] = item.EnvVar.Value
+			cursor = item.Cursor
+		}
+		if len(page) < limit {
+			return env, nil
+		}
+	}
+}
+
+func (r *renderClient) setEnvVar(service, key, value string) error {
+	return r.do(http.MethodPut, "/services/"+url.PathEscape(service)+"/env-vars/"+url.PathEscape(key), map[string]string{"value": value}, nil)
+}
+
+func (r *renderClient) deleteEnvVar(service, key string) error {
+	return r.do(http.MethodDelete, "/services/"+url.PathEscape(service)+"/env-vars/"+url.PathEscape(key), nil, nil)
+}
+
+// herokuAPI is the base URL of the Heroku Platform API, a variable for
+// tests like renderAPI.
+var herokuAPI = "https://api.heroku.com"
+
+// setHerokuConfigVars sets and removes config vars of a Heroku app in one
+// Platform API request, which keeps values out of the process list where
+// heroku config:set would put them. Without --heroku-api-key the token of
+// the logged-in heroku CLI is used.
+func setHerokuConfigVars(c *cli.Context, app string, set map[string]string, unset []string) error {
+	if len(set) == 0 && len(unset) == 0 {
+		return nil
+	}
+	token := c.String("heroku-api-key")
+	if token == "" {
+		out, err := runCLI(context.Background(), herokuCommand, "", "auth:token")
+		if err != nil {
+			return fmt.Errorf("heroku API key is required (--heroku-api-key, HEROKU_API_KEY or heroku login): %w", err)
+		}
+		token = strings.TrimSpace(string(out))
+	}
+
+	// A null value removes the config var.
+	vars := make(map[string]*string, len(set)+len(unset))
+	for k, v := range set {
+		vars[k] = &v
+	}
+	for _, k := range unset {
+		vars[k] = nil
+	}
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return err
+	}
+	path := "/apps/" + url.PathEscape(app) + "/config-vars"
+	req, err := http.NewRequest(http.MethodPatch, herokuAPI+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		msg := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Message != "" {
+			msg = apiErr.Message
+		}
+		return fmt.Errorf("heroku PATCH %s: %s", path, msg)
+	}
+	return nil
+}
+
+// deployTarget is a PaaS app addressed as platform:name: heroku:APP,
+// fly:APP or render:SERVICE_ID.
+type deployTarget struct {
+	Platform string
+	Name     string
+}
+
+func parseDeployTarget(s string) (deployTarget, error) {
+	platform, name, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return deployTarget{}, fmt.Errorf("invalid target %q (expected heroku:APP, fly:APP or render:SERVICE_ID)", s)
+	}
+	switch platform {
+	case "heroku", "fly", "render":
+		return deployTarget{Platform: platform, Name: name}, nil
+	}
+	return deployTarget{}, fmt.Errorf("unsupported target platform %q (expected heroku, fly or render)", platform)
+}
+
+func (t deployTarget) String() string {
+	return t.Platform + ":" + t.Name
+}
+
+// read returns the config vars of the target, with the keys whose values
+// cannot be read back.
+func (t deployTarget) read(c *cli.Context) (map[string]string, []string, error) {
+	switch t.Platform {
+	case "heroku":
+		env, err := readHerokuEnv(t.Name)
+		return env, nil, err
+	case "fly":
+		return readFlyEnv(t.Name)
+	}
+	client, err := newRenderClient(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	env, err := client.envVars(t.Name)
+	return env, nil, err
+}
+
+// apply sets and removes config vars on the target. Fly values are written
+// as secrets; the env section of fly.toml only changes with a deploy.
+func (t deployTarget) apply(c *cli.Context, set map[string]string, unset []string) error {
+	keys := sortedKeys(set)
+	switch t.Platform {
+	case "heroku":
+		return setHerokuConfigVars(c, t.Name, set, unset)
+
+	case "fly":
+		// secrets import reads KEY=VALUE lines from stdin, which keeps values
+		// out of the process list; multiline values use triple quotes.
+		if len(keys) > 0 {
+			var sb strings.Builder
+			for _, k := range keys {
+				v := set[k]
+				if strings.Contains(v, "\n") {
+					v = `"""` + v + `"""`
+				}
+				sb.WriteString(k + "=" + v + "\n")
+			}
+			if _, err := runCLI(context.Background(), flyctlCommand, sb.String(), "secrets", "import", "--app", t.Name); err != nil {
+				return err
+			}
+		}
+		if len(unset) > 0 {
+			args := append([]string{"secrets", "unset"}, unset...)
+			if _, err := runCLI(context.Background(), flyctlCommand, "", append(args, "--app", t.Name)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	client, err := newRenderClient(c)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := client.setEnvVar(t.Name, k, set[k]); err != nil {
+			return err
+		}
+	}
+	for _, k := range unset {
+		if err := client.deleteEnvVar(t.Name, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployFlags are the flags shared by push and pull.
+func deployFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "target",
+			Usage:    "app to sync with: heroku:APP, fly:APP or render:SERVICE_ID",
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:  "ignore",
+			Usage: "skip keys matching the glob `PATTERN` (repeatable)",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "print the changes without applying them",
+		},
+		&cli.BoolFlag{
+			Name:  "confirm",
+			Usage: "ask before applying each change",
+		},
+		&cli.StringFlag{
+			Name:    "render-api-key",
+			Usage:   "Render API key for render: targets",
+			EnvVars: []string{"RENDER_API_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "heroku-api-key",
+			Usage:   "Heroku API key for heroku: targets (default: heroku auth:token)",
+			EnvVars: []string{"HEROKU_API_KEY"},
+		},
+	}
+}
+
+// confirmChanges prints each change and, with --confirm, asks whether to
+// apply it, returning the accepted ones. shown holds the changes as
+// printed, with secrets masked.
+func confirmChanges(c *cli.Context, changes, shown []drift, target string) ([]drift, error) {
+	if c.Bool("confirm") && c.Bool("porcelain") {
+		return nil, fmt.Errorf("--confirm asks interactively and cannot be used with --porcelain")
+	}
+	if !c.Bool("confirm") || c.Bool("dry-run") {
+		for _, d := range shown {
+			fmt.Fprintln(c.App.Writer, d.format(target))
+		}
+		return changes, nil
+	}
+
+	var accepted []drift
+	scanner := bufio.NewScanner(c.App.Reader)
+	for i, d := range changes {
+		fmt.Fprintf(c.App.ErrWriter, "%s\nApply? [y/N] ", shown[i].format(target))
+		if !scanner.Scan() {
+			fmt.Fprintln(c.App.ErrWriter)
+			break
+		}
+		if answer := strings.ToLower(strings.TrimSpace(scanner.Text())); answer == "y" || answer == "yes" {
+			accepted = append(accepted, d)
+		}
+	}
+	return accepted, scanner.Err()
+}
+
+// runPush writes the variables of the local sources to a PaaS app. Keys
+// only set on the app are kept unless --delete is given.
+func runPush(c *cli.Context) error {
+	target, err := parseDeployTarget(c.String("target"))
+	if err != nil {
+		return err
+	}
+	envMap, origins, err := mergeSources(c, nil)
+	if err != nil {
+		return err
+	}
+	remote, unknown, err := target.read(c)
+	if err != nil {
+		return err
+	}
+
+	ignore := c.StringSlice("ignore")
+	var changes []drift
+	for _, d := range diffDeployment(envMap, remote, unknown) {
+		if matchesAny(d.Key, ignore) || d.Status == driftRemoteOnly && !c.Bool("delete") {
+			continue
+		}
+		changes = append(changes, d)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(humanWriter(c), "%s is up to date\n", target)
+		return nil
+	}
+
+	shown := append([]drift(nil), changes...)
+	if !c.Bool("show-secrets") {
+		maskDrifts(shown, secretKeys(c, envMap, origins, defaultSecretKeys))
+	}
+	changes, err = confirmChanges(c, changes, shown, target.String())
+	if err != nil {
+		return err
+	}
+	if c.Bool("dry-run") {
+		fmt.Fprintf(humanWriter(c), "Dry run: %d change(s) not pushed\n", len(changes))
+		return nil
+	}
+
+	set := make(map[string]string)
+	var unset []string
+	for _, d := range changes {
+		if d.Status == driftRemoteOnly {
+			unset = append(unset, d.Key)
+		} else {
+			set[d.Key] = d.Local
+		}
+	}
+	if len(changes) > 0 {
+		if err := target.apply(c, set, unset); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(humanWriter(c), "Pushed %d change(s) to %s\n", len(changes), target)
+	return nil
+}
+
+// runPull reads the config vars of a PaaS app and prints them as a .env
+// file or, with --output, merges them into that file: changed and new keys
+// are written in place and keys missing on the app are kept.
+func runPull(c *cli.Context) error {
+	target, err := parseDeployTarget(c.String("target"))
+	if err != nil {
+		return err
+	}
+	remote, unknown, err := target.read(c)
+	if err != nil {
+		return err
+	}
+	ignore := c.StringSlice("ignore")
+	for k := range remote {
+		if matchesAny(k, ignore) {
+			delete(remote, k)
+		}
+	}
+	var unreadable []string
+	for _, k := range unknown {
+		if _, ok := remote[k]; !ok && !matchesAny(k, ignore) {
+			unreadable = append(unreadable, k)
+		}
+	}
+	if len(unreadable) > 0 {
+		fmt.Fprintf(c.App.ErrWriter, "Warning: values on %s cannot be read and were skipped: %s\n", target, strings.Join(unreadable, ", "))
+	}
+
+	path := c.String("output")
+	if path == "" {
+		for _, k := range sortedKeys(remote) {
+			fmt.Fprintf(c.App.Writer, "%s=%s\n", k, formatValue(remote[k]))
+		}
+		return nil
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	entries, err := parseDotenv(src, parseOptions{})
+	if err != nil {
+		return &fs.PathError{Op: "failed to parse", Path: path, Err: err}
+	}
+	local := make(map[string]string)
+	for _, e := range entries {
+		local[e.Key] = e.Value
+	}
+
+	// Compare from the app's side, so + marks keys the file gains.
+	var changes []drift
+	for _, d := range diffDeployment(remote, local, nil) {
+		if d.Status != driftRemoteOnly {
+			changes = append(changes, d)
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(humanWriter(c), "%s is up to date with %s\n", path, target)
+		return nil
+	}
+
+	shown := append([]drift(nil), changes...)
+	if !c.Bool("show-secrets") {
+		maskDrifts(shown, nil)
+	}
+	changes, err = confirmChanges(c, changes, shown, path)
+	if err != nil {
+		return err
+	}
+	if c.Bool("dry-run") {
+		fmt.Fprintf(humanWriter(c), "Dry run: %d change(s) not written to %s\n", len(changes), path)
+		return nil
+	}
+
+	for _, d := range changes {
+		if src, err = setEnvValue(src, d.Key, d.Local); err != nil {
+			return &fs.PathError{Op: "failed to parse", Path: path, Err: err}
+		}
+	}
+	if len(changes) > 0 {
+		if err := writeFileKeepMode(path, src); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(humanWriter(c), "Pulled %d change(s) from %s into %s\n", len(changes), target, path)
+	return nil
+}
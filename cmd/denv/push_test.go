@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func createDeployApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name:   "push",
+			Flags:  append(deployFlags(), &cli.BoolFlag{Name: "delete"}),
+			Action: runPush,
+		},
+		{
+			Name:   "pull",
+			Flags:  append(deployFlags(), &cli.StringFlag{Name: "output"}),
+			Action: runPull,
+		},
+	}
+	return app
+}
+
+func TestParseDeployTarget(t *testing.T) {
+	if target, err := parseDeployTarget("render:srv-1"); err != nil || target != (deployTarget{Platform: "render", Name: "srv-1"}) {
+		t.Errorf("unexpected target %+v (%v)", target, err)
+	}
+	for _, s := range []string{"heroku", "heroku:", "vercel:app"} {
+		if _, err := parseDeployTarget(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestPushCLIPlatforms(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=8080\nLOG_LEVEL=debug\nAPI_TOKEN=\"line1\nline2\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "log")
+	heroku := writeFakeCommand(t, "heroku", `
+case "$1" in
+config) echo '{"PORT":"8080","LOG_LEVEL":"info","OLD":"x"}' ;;
+auth:token) echo token ;;
+*) echo "$@" >> `+log+` ;;
+esac
+`)
+	flyctl := writeFakeCommand(t, "flyctl", `
+case "$1 $2" in
+"config show") echo '{"env":{"PORT":"8080"}}' ;;
+"secrets list") echo '[{"Name":"API_TOKEN"}]' ;;
+"secrets import") echo "$@" >> `+log+`; cat >> `+log+` ;;
+esac
+`)
+	defer func(h, f string) { herokuCommand, flyctlCommand = h, f }(herokuCommand, flyctlCommand)
+	herokuCommand, flyctlCommand = heroku, flyctl
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		f, _ := os.OpenFile(log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		fmt.Fprintf(f, "%s %s %s %s\n", r.Method, r.URL.Path, r.Header.Get("Authorization"), body)
+		f.Close()
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	defer func(u string) { herokuAPI = u }(herokuAPI)
+	herokuAPI = srv.URL
+
+	run := func(stdin string, args ...string) string {
+		t.Helper()
+		os.Remove(log)
+		var out bytes.Buffer
+		app := createDeployApp()
+		app.Writer = &out
+		app.ErrWriter = io.Discard
+		app.Reader = strings.NewReader(stdin)
+		if err := app.Run(append([]string{"denv", "-f", envFile, "push"}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(log)
+		return out.String() + "--\n" + string(data)
+	}
+
+	got := run("", "--target", "heroku:api", "--dry-run", "--delete")
+	want := "+ API_TOKEN=***\n~ LOG_LEVEL: info -> debug\n- OLD=x\nDry run: 3 change(s) not pushed\n--\n"
+	if got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	got = run("n\ny\n", "--target", "heroku:api", "--confirm")
+	want = "Pushed 1 change(s) to heroku:api\n--\nPATCH /apps/api/config-vars Bearer token {\"LOG_LEVEL\":\"debug\"}\n"
+	if got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	got = run("", "--target", "heroku:api", "--delete", "--heroku-api-key", "key")
+	want = "+ API_TOKEN=***\n~ LOG_LEVEL: info -> debug\n- OLD=x\nPushed 3 change(s) to heroku:api\n--\nPATCH /apps/api/config-vars Bearer key " +
+		`{"API_TOKEN":"line1\nline2","LOG_LEVEL":"debug","OLD":null}` + "\n"
+	if got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	got = run("", "--target", "fly:api")
+	want = "? API_TOKEN (value on fly:api cannot be read)\n+ LOG_LEVEL=debug\nPushed 2 change(s) to fly:api\n--\n" +
+		"secrets import --app api\nAPI_TOKEN=\"\"\"line1\nline2\"\"\"\nLOG_LEVEL=debug\n"
+	if got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestPushPullRender(t *testing.T) {
+	var mu sync.Mutex
+	remote := map[string]string{"PORT": "80", "DATABASE_URL": "postgres://db", "NEW": "1"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"unauthorized"}`))
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/services/srv-1/env-vars/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/services/srv-1/env-vars":
+			type envVar struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			}
+			var page []map[string]any
+			for _, k := range sortedKeys(remote) {
+				page = append(page, map[string]any{"envVar": envVar{k, remote[k]}, "cursor": k})
+			}
+			json.NewEncoder(w).Encode(page)
+		case r.Method == http.MethodPut:
+			var body struct{ Value string }
+			json.NewDecoder(r.Body).Decode(&body)
+			remote[key] = body.Value
+			w.Write([]byte(`{}`))
+		case r.Method == http.MethodDelete:
+			delete(remote, key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { renderAPI = u }(renderAPI)
+	renderAPI = srv.URL
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("# local settings\nPORT=8080\nDEBUG=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		app := createDeployApp()
+		app.Writer = &out
+		app.ErrWriter = io.Discard
+		err := app.Run(append([]string{"denv", "-f", envFile}, args...))
+		return out.String(), err
+	}
+
+	if _, err := run("pull", "--target", "render:srv-1"); err == nil || !strings.Contains(err.Error(), "render API key is required") {
+		t.Errorf("expected a missing key error, got %v", err)
+	}
+
+	out, err := run("pull", "--target", "render:srv-1", "--render-api-key", "key", "--ignore", "NEW")
+	if err != nil || out != "DATABASE_URL=postgres://db\nPORT=80\n" {
+		t.Errorf("unexpected pull output %q (%v)", out, err)
+	}
+
+	out, err = run("pull", "--target", "render:srv-1", "--render-api-key", "key", "--output", envFile, "--ignore", "DATABASE_URL")
+	if err != nil || out != "+ NEW=1\n~ PORT: 8080 -> 80\nPulled 2 change(s) from render:srv-1 into "+envFile+"\n" {
+		t.Errorf("unexpected pull output %q (%v)", out, err)
+	}
+	data, _ := os.ReadFile(envFile)
+	if string(data) != "# local settings\nPORT=80\nDEBUG=1\nNEW=1\n" {
+		t.Errorf("unexpected file after pull:\n%s", data)
+	}
+
+	if err := os.WriteFile(envFile, []byte("PORT=8080\nDEBUG=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("push", "--target", "render:srv-1", "--render-api-key", "key", "--delete"); err != nil {
+		t.Fatal(err)
+	}
+	if len(remote) != 2 || remote["PORT"] != "8080" || remote["DEBUG"] != "1" {
+		t.Errorf("unexpected remote after push: %v", remote)
+	}
+	if out, _ := run("push", "--target", "render:srv-1", "--render-api-key", "key"); out != "render:srv-1 is up to date\n" {
+		t.Errorf("expected no changes, got %q", out)
+	}
+}
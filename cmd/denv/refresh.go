@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// secretTTLs returns the lifetime of vault: references in a file, keyed by
+// reference, from "# denv:ttl=DURATION" annotations above their keys.
+func secretTTLs(c *cli.Context, file EnvFile, loaded map[string]string) (map[string]time.Duration, error) {
+	hasRefs := false
+	for _, v := range loaded {
+		if strings.HasPrefix(v, prefixVault) {
+			hasRefs = true
+			break
+		}
+	}
+	if !hasRefs {
+		return nil, nil
+	}
+
+	ttls := make(map[string]time.Duration)
+	for _, e := range fileEntries(c, file) {
+		value, ok := e.annotation("ttl")
+		if !ok {
+			continue
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return nil, &parseError{Line: e.Line, Key: e.Key, Err: fmt.Errorf("invalid ttl %q", value)}
+		}
+		if ref, ok := strings.CutPrefix(loaded[e.Key], prefixVault); ok {
+			ttls[ref] = ttl
+		}
+	}
+	return ttls, nil
+}
+
+// runRefresh re-fetches the annotated secret references whose cached value
+// is missing or expired, leaving fresh ones alone.
+func runRefresh(c *cli.Context) error {
+	reader := &sourceReader{c: c}
+	refreshed := 0
+	for _, file := range envFiles(c) {
+		if file.Kind != sourceFile {
+			continue
+		}
+		loaded, _, err := reader.readEnvFile(file)
+		if err != nil {
+			if skipMissing(file, err) {
+				continue
+			}
+			return &fs.PathError{Op: "failed to read", Path: file.Path, Err: err}
+		}
+		ttls, err := secretTTLs(c, file, loaded)
+		if err != nil {
+			return &fs.PathError{Op: "failed to read", Path: file.Path, Err: err}
+		}
+
+		for _, k := range sortedKeys(loaded) {
+			ref, ok := strings.CutPrefix(loaded[k], prefixVault)
+			if !ok || ttls[ref] == 0 {
+				continue
+			}
+			cache := reader.openCache()
+			if cache == nil {
+				return fmt.Errorf("cache is not available")
+			}
+			if _, fresh := cache.get(cache.entryPath(EnvFile{Path: ref, Kind: sourceVault}, reader.scope(sourceVault))); fresh {
+				continue
+			}
+			if _, err := reader.resolveSecret(ref, ttls[ref]); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			fmt.Fprintf(humanWriter(c), "refreshed %s\n", k)
+			refreshed++
+		}
+	}
+
+	if refreshed == 0 {
+		fmt.Fprintln(humanWriter(c), "All cached secrets are fresh")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestRefreshSecretTTL(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := "# Database host\n# denv:ttl=1h\nDB_HOST=vault:secret/data/myapp#DB_HOST\n"
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	base := []string{"denv", "--isolate", "--cache-dir", t.TempDir(), "--vault-addr", srv.URL,
+		"--vault-token", "root", "--vault-namespace", "team", "--file", envFile}
+
+	refresh := func() string {
+		t.Helper()
+		var buf bytes.Buffer
+		app, _ := newApp()
+		app.Writer = &buf
+		app.Commands = []*cli.Command{{Name: "refresh", Action: runRefresh}}
+		if err := app.Run(append(base, "refresh")); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if out := refresh(); !strings.Contains(out, "refreshed DB_HOST") {
+		t.Errorf("expected DB_HOST to be refreshed, got %q", out)
+	}
+	if out := refresh(); !strings.Contains(out, "All cached secrets are fresh") {
+		t.Errorf("expected no refresh for a fresh value, got %q", out)
+	}
+
+	// Served from the cache without contacting Vault.
+	srv.Close()
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if envMap["DB_HOST"] != "db.internal" {
+			return fmt.Errorf("expected cached DB_HOST=db.internal, got %s", envMap["DB_HOST"])
+		}
+		return nil
+	}
+	if err := app.Run(base); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSecretTTLInvalid(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("# denv:ttl=soon\nKEY=vault:secret/data/app#KEY\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		_, err := loadEnv(c)
+		return err
+	}
+	err := app.Run([]string{"denv", "--isolate", "--file", envFile})
+	if err == nil || !strings.Contains(err.Error(), "line 2: KEY: invalid ttl") {
+		t.Fatalf("expected invalid ttl error, got %v", err)
+	}
+}
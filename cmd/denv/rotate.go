@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// runRotate replaces the value of a key with the output of a generator
+// command, in the target env file or a Vault secret, and then runs the
+// reload command with the updated environment.
+func runRotate(c *cli.Context) error {
+	if c.NArg() != 1 {
+		if c.NArg() > 1 && strings.HasPrefix(c.Args().Get(1), "-") {
+			return fmt.Errorf("flags must come before KEY, e.g. denv rotate --command CMD %s", c.Args().First())
+		}
+		return fmt.Errorf("expected exactly one KEY argument")
+	}
+	key := c.Args().First()
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	generator := c.String("command")
+	if generator == "" {
+		return fmt.Errorf("--command is required")
+	}
+
+	value, err := runValueCommand(generator, nil, parseOptions{ExecTimeout: c.Duration("exec-timeout")})
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return fmt.Errorf("generator %q produced an empty value", generator)
+	}
+
+	var target string
+	if secret := c.String("vault-secret"); secret != "" {
+		vault, err := newVaultClient(c)
+		if err != nil {
+			return err
+		}
+		if err := vault.writeSecretField(secret, key, value); err != nil {
+			return err
+		}
+		target = "vault:" + secret
+	} else {
+		if target, err = targetFile(c); err != nil {
+			return err
+		}
+		src, err := os.ReadFile(target)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if src, err = decodeEnv(src, c.String("encoding")); err != nil {
+			return &fs.PathError{Op: "failed to decode", Path: target, Err: err}
+		}
+		updated, err := setEnvValue(src, key, value)
+		if err != nil {
+			return &fs.PathError{Op: "failed to parse", Path: target, Err: err}
+		}
+		if err := writeFileKeepMode(target, updated); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(humanWriter(c), "Rotated %s in %s\n", key, target)
+
+	reload := c.String("reload")
+	if reload == "" {
+		return nil
+	}
+	envMap, err := loadEnv(c)
+	if err != nil {
+		return err
+	}
+	cmd := shellCommand(context.Background(), reload)
+	cmd.Stdout = c.App.Writer
+	cmd.Stderr = c.App.ErrWriter
+	for k, v := range envMap {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("reload command failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func createRotateApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "rotate",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "command"},
+				&cli.StringFlag{Name: "vault-secret"},
+				&cli.StringFlag{Name: "reload"},
+			},
+			Action: runRotate,
+		},
+	}
+	return app
+}
+
+func TestRotateFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	reloaded := filepath.Join(tmpDir, "reloaded")
+	if err := os.WriteFile(envFile, []byte("# api\nAPI_KEY=old\nPORT=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	app := createRotateApp()
+	app.Writer = &out
+	args := []string{"denv", "--isolate", "-f", envFile, "rotate",
+		"--command", "echo new-secret", "--reload", `echo "$API_KEY" > ` + reloaded, "API_KEY"}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# api\nAPI_KEY=new-secret\nPORT=1\n" {
+		t.Errorf("unexpected file content:\n%s", data)
+	}
+	if data, _ := os.ReadFile(reloaded); string(data) != "new-secret\n" {
+		t.Errorf("expected reload command to see the new value, got %q", data)
+	}
+	if !strings.Contains(out.String(), "Rotated API_KEY in "+envFile) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestRotateVault(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	var got map[string]map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/v1/secret/data/myapp" ||
+			r.Header.Get("Content-Type") != "application/merge-patch+json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// The last source is not an editable .env file, which only matters when
+	// rotating into a file.
+	app := createRotateApp()
+	app.Writer = &bytes.Buffer{}
+	args := []string{"denv", "--vault-addr", srv.URL, "--vault-token", "root", "-f", "app.ini?format=ini",
+		"rotate", "--command", "echo new-secret", "--vault-secret", "secret/data/myapp", "API_KEY"}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+	if got["data"]["API_KEY"] != "new-secret" {
+		t.Errorf("expected patched API_KEY, got %v", got)
+	}
+}
+
+func TestRotateEmptyValue(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	app := createRotateApp()
+	if err := app.Run([]string{"denv", "-f", envFile, "rotate", "--command", "true", "API_KEY"}); err == nil {
+		t.Fatal("expected error for empty generator output")
+	}
+	if _, err := os.Stat(envFile); !os.IsNotExist(err) {
+		t.Error("expected the file to be left untouched")
+	}
+}
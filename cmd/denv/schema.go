@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Value types understood by "denv:type" annotations.
+var keyTypes = []string{"string", "integer", "number", "boolean", "url", "duration", "json"}
+
+// typePatterns are the forms of integer, number and duration values, and
+// boolValues those of booleans (the spellings strconv.ParseBool accepts).
+// validate and the JSON Schema both use them, so a value passes one
+// exactly when it passes the other.
+var (
+	typePatterns = map[string]*regexp.Regexp{
+		"integer":  regexp.MustCompile(`^[-+]?[0-9]+$`),
+		"number":   regexp.MustCompile(`^[-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][-+]?[0-9]+)?$`),
+		"duration": regexp.MustCompile(durationPattern),
+	}
+	boolValues = []string{"true", "false", "1", "0", "t", "f", "T", "F", "TRUE", "FALSE", "True", "False"}
+)
+
+// keySpec is the contract of a key, gathered from "# denv:..." annotations
+// in the comments above its assignments.
+type keySpec struct {
+	Type     string
+	Enum     []string
+	Pattern  string
+	Required bool
+	Secret   bool
+	// Description is taken from the plain comments above the key, or
+	// recorded by annotate like Owner.
+	Description string
+	Owner       string
+}
+
+// apply merges the annotations of e into the spec; later definitions of a
+// key override earlier ones.
+func (s *keySpec) apply(e envEntry) error {
+	if v, ok := e.annotation("type"); ok {
+		if !slices.Contains(keyTypes, v) {
+			return &parseError{Line: e.Line, Key: e.Key, Err: fmt.Errorf("unknown type %q (expected %s)", v, strings.Join(keyTypes, ", "))}
+		}
+		s.Type = v
+	}
+	if v, ok := e.annotation("enum"); ok {
+		s.Enum = strings.Split(v, "|")
+	}
+	if v, ok := e.annotation("pattern"); ok {
+		if _, err := regexp.Compile(v); err != nil {
+			return &parseError{Line: e.Line, Key: e.Key, Err: fmt.Errorf("invalid pattern: %w", err)}
+		}
+		s.Pattern = v
+	}
+	if _, ok := e.annotation("required"); ok {
+		s.Required = true
+	}
+	if secret, ok := secretAnnotation(e); ok {
+		s.Secret = secret
+	}
+	if d := e.description(); d != "" {
+		s.Description = d
+	}
+	return nil
+}
+
+// inferType guesses the type of a value for keys without a type
+// annotation.
+func inferType(v string) string {
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return "integer"
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil && !strings.ContainsAny(v, "xXpPeEiInN") {
+		return "number"
+	}
+	if v == "true" || v == "false" {
+		return "boolean"
+	}
+	if u, err := url.Parse(v); err == nil && u.Scheme != "" && u.Host != "" {
+		return "url"
+	}
+	if isDuration(v) {
+		return "duration"
+	}
+	if strings.HasPrefix(v, "{") || strings.HasPrefix(v, "[") {
+		if json.Valid([]byte(v)) {
+			return "json"
+		}
+	}
+	return "string"
+}
+
+// keySpecs collects the specs of all keys defined by the sources, from the
+// annotations in file sources and the types of the merged values.
+func keySpecs(c *cli.Context) (map[string]*keySpec, error) {
+	envMap, err := loadSources(c)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := annotatedSpecs(c, envMap)
+	if err != nil {
+		return nil, err
+	}
+	for k, spec := range specs {
+		if spec.Type == "" {
+			spec.Type = inferType(envMap[k])
+		}
+	}
+	return specs, nil
+}
+
+// annotatedSpecs collects the specs of the keys in envMap from the
+// annotations in file sources and their sidecars written by annotate; keys
+// without annotations get an empty spec.
+func annotatedSpecs(c *cli.Context, envMap map[string]string) (map[string]*keySpec, error) {
+	specs := make(map[string]*keySpec, len(envMap))
+	for k := range envMap {
+		specs[k] = &keySpec{}
+	}
+	for _, file := range envFiles(c) {
+		for _, e := range fileEntries(c, file) {
+			spec, ok := specs[e.Key]
+			if !ok {
+				continue
+			}
+			if err := spec.apply(e); err != nil {
+				return nil, &fs.PathError{Op: "invalid annotation in", Path: file.Path, Err: err}
+			}
+		}
+	}
+	for k, a := range keyAnnotations(c) {
+		spec, ok := specs[k]
+		if !ok {
+			continue
+		}
+		if a.Description != "" {
+			spec.Description = a.Description
+		}
+		spec.Owner = a.Owner
+		if a.Secret != nil {
+			spec.Secret = *a.Secret
+		}
+	}
+	return specs, nil
+}
+
+// validate checks a value against the spec.
+func (s *keySpec) validate(value string) error {
+	if value == "" {
+		if s.Required {
+			return errors.New("is required but empty")
+		}
+		return nil
+	}
+
+	var err error
+	switch s.Type {
+	case "integer", "number", "duration":
+		if !typePatterns[s.Type].MatchString(value) {
+			err = errors.New("invalid value")
+		}
+	case "boolean":
+		if !slices.Contains(boolValues, value) {
+			err = errors.New("invalid boolean")
+		}
+	case "url":
+		var u *url.URL
+		if u, err = url.Parse(value); err == nil && (u.Scheme == "" || u.Host == "") {
+			err = errors.New("missing scheme or host")
+		}
+	case "json":
+		if !json.Valid([]byte(value)) {
+			err = errors.New("invalid JSON")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("expected %s, got %q", s.Type, value)
+	}
+	if s.Enum != nil && !slices.Contains(s.Enum, value) {
+		return fmt.Errorf("expected one of %s, got %q", strings.Join(s.Enum, ", "), value)
+	}
+	if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(value) {
+		return fmt.Errorf("%q does not match pattern %s", value, s.Pattern)
+	}
+	return nil
+}
+
+// validateEnv checks the values of envMap against the annotations of
+// their keys and describes each violation, sorted by key.
+func validateEnv(c *cli.Context, envMap map[string]string) ([]string, error) {
+	specs, err := annotatedSpecs(c, envMap)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, k := range sortedKeys(envMap) {
+		if err := specs[k].validate(envMap[k]); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", k, err))
+		}
+	}
+	return problems, nil
+}
+
+type jsonSchemaProperty struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	// ContentMediaType marks strings holding JSON documents.
+	ContentMediaType string `json:"contentMediaType,omitempty"`
+	DenvType         string `json:"x-denv-type,omitempty"`
+	DenvOwner        string `json:"x-denv-owner,omitempty"`
+	DenvSecret       bool   `json:"x-denv-secret,omitempty"`
+}
+
+type jsonSchema struct {
+	Schema     string                        `json:"$schema"`
+	Title      string                        `json:"title"`
+	Type       string                        `json:"type"`
+	Properties map[string]jsonSchemaProperty `json:"properties"`
+	Required   []string                      `json:"required,omitempty"`
+}
+
+// jsonSchemaFor converts key specs to a JSON Schema describing the
+// environment as an object of string values.
+func jsonSchemaFor(specs map[string]*keySpec) jsonSchema {
+	schema := jsonSchema{
+		Schema:     "https://json-schema.org/draft/2020-12/schema",
+		Title:      "Environment",
+		Type:       "object",
+		Properties: make(map[string]jsonSchemaProperty, len(specs)),
+	}
+	for k, spec := range specs {
+		prop := jsonSchemaProperty{Type: "string", Description: spec.Description, Enum: spec.Enum, Pattern: spec.Pattern, DenvType: spec.Type, DenvOwner: spec.Owner, DenvSecret: spec.Secret}
+		switch spec.Type {
+		case "integer", "number", "duration":
+			if prop.Pattern == "" {
+				prop.Pattern = typePatterns[spec.Type].String()
+			}
+		case "boolean":
+			if prop.Enum == nil {
+				prop.Enum = boolValues
+			}
+		case "url":
+			prop.Format = "uri"
+		case "json":
+			prop.ContentMediaType = "application/json"
+		}
+		schema.Properties[k] = prop
+		if spec.Required {
+			schema.Required = append(schema.Required, k)
+		}
+	}
+	slices.Sort(schema.Required)
+	return schema
+}
+
+func runSchemaExport(c *cli.Context) error {
+	specs, err := keySpecs(c)
+	if err != nil {
+		return err
+	}
+	schema := jsonSchemaFor(specs)
+
+	output := c.String("output")
+	if output == "" || output == "-" {
+		return writeJSON(c, c.App.Writer, schema, true)
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(c, &buf, schema, true); err != nil {
+		return err
+	}
+	return os.WriteFile(output, buf.Bytes(), 0644)
+}
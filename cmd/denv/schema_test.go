@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestInferType(t *testing.T) {
+	for value, want := range map[string]string{
+		"8080":                "integer",
+		"0.5":                 "number",
+		"true":                "boolean",
+		"https://example.com": "url",
+		"hello":               "string",
+		"NaN":                 "string",
+		"":                    "string",
+	} {
+		if got := inferType(value); got != want {
+			t.Errorf("inferType(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func createSchemaApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "schema",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "export",
+					Flags:  []cli.Flag{&cli.StringFlag{Name: "output", Aliases: []string{"o"}}},
+					Action: runSchemaExport,
+				},
+			},
+		},
+	}
+	return app
+}
+
+func TestSchemaExport(t *testing.T) {
+	tmpDir := t.TempDir()
+	base := filepath.Join(tmpDir, "base.env")
+	local := filepath.Join(tmpDir, "local.env")
+	content := `# Port the HTTP server listens on.
+# denv:required
+PORT=8080
+# denv:enum=debug|info|warn
+LOG_LEVEL=info
+# denv:type=string
+VERSION=2
+API_URL=https://api.example.com
+`
+	if err := os.WriteFile(base, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, []byte("# denv:required\nLOG_LEVEL=debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app := createSchemaApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "-f", base, "-f", local, "schema", "export"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var schema jsonSchema
+	if err := json.Unmarshal(buf.Bytes(), &schema); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"LOG_LEVEL", "PORT"}) {
+		t.Errorf("unexpected required keys %v", schema.Required)
+	}
+	want := map[string]jsonSchemaProperty{
+		"PORT":      {Type: "string", Description: "Port the HTTP server listens on.", Pattern: `^[-+]?[0-9]+$`, DenvType: "integer"},
+		"LOG_LEVEL": {Type: "string", Enum: []string{"debug", "info", "warn"}, DenvType: "string"},
+		"VERSION":   {Type: "string", DenvType: "string"},
+		"API_URL":   {Type: "string", Format: "uri", DenvType: "url"},
+	}
+	if !reflect.DeepEqual(schema.Properties, want) {
+		t.Errorf("expected properties\n%+v\ngot\n%+v", want, schema.Properties)
+	}
+}
+
+func TestSchemaExportCompact(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("DEBUG=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app := createSchemaApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "--compact", "-f", envFile, "schema", "export"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"$schema":"https://json-schema.org/draft/2020-12/schema","title":"Environment","type":"object",` +
+		`"properties":{"DEBUG":{"type":"string","enum":["true","false","1","0","t","f","T","F","TRUE","FALSE","True","False"],"x-denv-type":"boolean"}}}` + "\n"
+	if buf.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func TestSchemaInvalidAnnotation(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("# denv:type=color\nBG=red\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := createSchemaApp()
+	err := app.Run([]string{"denv", "-f", envFile, "schema", "export"})
+	if err == nil || !strings.Contains(err.Error(), `line 2: BG: unknown type "color"`) {
+		t.Fatalf("expected unknown type error, got %v", err)
+	}
+}
+
+func TestSchemaMatchesValidate(t *testing.T) {
+	values := []string{"1", "-2", "+3", "1.5", ".5", "1e5", "2.5E-3", "1e", "0x10", "inf", "NaN", "1_000",
+		"true", "false", "t", "F", "TRUE", "yes", "on", "30s", "1h30m", "-1.5h", "10", "abc"}
+	for _, typ := range []string{"integer", "number", "boolean", "duration"} {
+		spec := &keySpec{Type: typ}
+		prop := jsonSchemaFor(map[string]*keySpec{"K": spec}).Properties["K"]
+		for _, v := range values {
+			inSchema := slices.Contains(prop.Enum, v)
+			if prop.Pattern != "" {
+				inSchema = regexp.MustCompile(prop.Pattern).MatchString(v)
+			}
+			if valid := spec.validate(v) == nil; valid != inSchema {
+				t.Errorf("%s %q: validate accepts it: %v, schema accepts it: %v", typ, v, valid, inSchema)
+			}
+		}
+	}
+}
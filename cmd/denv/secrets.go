@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// defaultSecretKeys are glob patterns of keys whose values are treated as
+// secrets and masked when printed.
+var defaultSecretKeys = []string{"*SECRET*", "*TOKEN*", "*PASSWORD*", "*PASSWD*", "*API_KEY*", "*PRIVATE_KEY*", "*CREDENTIALS*"}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// randomLooking reports whether a value looks like a generated credential:
+// a long hex string, or a long token mixing letters and digits whose
+// characters are close to uniformly distributed. Paths, URLs and text are
+// never considered random.
+func randomLooking(v string) bool {
+	if strings.ContainsAny(v, " \t\r\n:") || strings.HasPrefix(v, "/") {
+		return false
+	}
+	hex := strings.Trim(strings.ToLower(v), "0123456789abcdef") == ""
+	if hex {
+		return len(v) >= 32 && entropy(v) >= 3
+	}
+	return len(v) >= 20 &&
+		strings.ContainsAny(v, "0123456789") &&
+		strings.ContainsAny(strings.ToLower(v), "abcdefghijklmnopqrstuvwxyz") &&
+		entropy(v) >= 4
+}
+
+// looksSecret reports whether a key likely holds a secret, judging by its
+// name and the randomness of its value.
+func looksSecret(key, value string, masks []string) bool {
+	return matchesAny(key, masks) || randomLooking(value)
+}
+
+// secretAnnotation returns the denv:secret annotation of an entry: a bare
+// "denv:secret" marks the key as secret and "denv:secret=false" overrides
+// the heuristics for keys that only look like one.
+func secretAnnotation(e envEntry) (secret, ok bool) {
+	v, ok := e.annotation("secret")
+	if !ok {
+		return false, false
+	}
+	return v != "false", true
+}
+
+// secretKeys returns the merged keys whose values are secrets: keys
+// annotated with denv:secret or marked by annotate, vault: and keyring://
+// references in files, everything read from Vault, Kubernetes Secrets or
+// 1Password and keys that look secret by name or value.
+func secretKeys(c *cli.Context, envMap, origins map[string]string, masks []string) map[string]bool {
+	annotated := make(map[string]bool)
+	refs := make(map[string]bool)
+	kinds := make(map[string]string)
+	for _, file := range envFiles(c) {
+		kinds[file.String()] = file.Kind
+		for _, e := range fileEntries(c, file) {
+			if secret, ok := secretAnnotation(e); ok {
+				annotated[e.Key] = secret
+			}
+			if strings.HasPrefix(e.Value, prefixVault) || strings.HasPrefix(e.Value, prefixKeyring) {
+				refs[e.Key] = true
+			}
+		}
+	}
+	for k, a := range keyAnnotations(c) {
+		if a.Secret != nil {
+			annotated[k] = *a.Secret
+		}
+	}
+
+	secret := make(map[string]bool)
+	for k, v := range envMap {
+		if s, ok := annotated[k]; ok {
+			if s {
+				secret[k] = true
+			}
+			continue
+		}
+		kind := kinds[origins[k]]
+		if refs[k] || kind == sourceVault || kind == sourceK8sSecret || kind == sourceOnePassword || looksSecret(k, v, masks) {
+			secret[k] = true
+		}
+	}
+	return secret
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestRandomLooking(t *testing.T) {
+	for value, want := range map[string]bool{
+		"ghp_R4nd0mT0k3nV4lu3Xq9Lm2Zp7":        true,
+		"9f86d081884c7d659a2feaa0c55ad015":     true,
+		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa":   false,
+		"production":                           false,
+		"postgres://user@localhost/app":        false,
+		"/usr/local/bin/some-long-binary-1":    false,
+		"550e8400-e29b-41d4-a716-446655440000": false,
+		"this is a long sentence with 1 digit": false,
+	} {
+		if got := randomLooking(value); got != want {
+			t.Errorf("randomLooking(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestListMasksSecrets(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := `API_TOKEN=abc
+SESSION=ghp_R4nd0mT0k3nV4lu3Xq9Lm2Zp7
+# denv:secret=false
+BUILD_PASSWORD_HINT=ask-ops
+# denv:secret
+WEBHOOK=https://hooks.example.com/x
+PORT=8080
+`
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) (string, string) {
+		app, _ := newApp()
+		app.Commands = []*cli.Command{
+			{
+				Name:   "list",
+				Flags:  []cli.Flag{&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: "text"}, &cli.StringFlag{Name: "group-by"}},
+				Action: runList,
+			},
+		}
+		var stdout, stderr bytes.Buffer
+		app.Writer = &stdout
+		app.ErrWriter = &stderr
+		if err := app.Run(append([]string{"denv", "--isolate", "-f", envFile}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		return stdout.String(), stderr.String()
+	}
+
+	out, _ := run("list")
+	want := "API_TOKEN=***\nBUILD_PASSWORD_HINT=ask-ops\nPORT=8080\nSESSION=***\nWEBHOOK=***\n"
+	if out != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+
+	out, warning := run("list", "-o", "csv")
+	if !strings.Contains(out, "SESSION,ghp_R4nd0mT0k3nV4lu3Xq9Lm2Zp7,") {
+		t.Errorf("expected csv to keep values, got %q", out)
+	}
+	if !strings.Contains(warning, "(API_TOKEN, SESSION, WEBHOOK)") {
+		t.Errorf("expected a warning naming the secrets, got %q", warning)
+	}
+
+	out, warning = run("--show-secrets", "list")
+	if !strings.Contains(out, "API_TOKEN=abc\n") || warning != "" {
+		t.Errorf("expected clear values without warning, got %q / %q", out, warning)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// releaseAPI is the GitHub API endpoint of the repository releases are
+// published in.
+var releaseAPI = "https://api.github.com/repos/akhmanov/denv-go"
+
+// releasePublicKey is the base64 Ed25519 key checksums.txt of releases is
+// signed with, set by release builds with -X main.releasePublicKey=...
+// Builds without it cannot update themselves.
+var releasePublicKey = ""
+
+// selfExecutable returns the path of the running binary.
+var selfExecutable = os.Executable
+
+// Release assets besides the binaries, which are named
+// denv_<os>_<arch>[.exe].
+const (
+	releaseChecksums = "checksums.txt"
+	releaseSignature = "checksums.txt.sig"
+)
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// releaseAssetName is the binary of the current platform.
+func releaseAssetName() string {
+	name := "denv_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+var releaseClient = &http.Client{Timeout: 5 * time.Minute}
+
+func httpGet(url string, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := releaseClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// fetchRelease returns the latest release, or the one tagged tag.
+func fetchRelease(tag string) (*githubRelease, error) {
+	url := releaseAPI + "/releases/latest"
+	if tag != "" {
+		url = releaseAPI + "/releases/tags/" + tag
+	}
+	data, err := httpGet(url, "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	var release githubRelease
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("invalid release: %w", err)
+	}
+	return &release, nil
+}
+
+func (r *githubRelease) download(name string) ([]byte, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return httpGet(asset.URL, "")
+		}
+	}
+	return nil, fmt.Errorf("release %s has no %s", r.TagName, name)
+}
+
+// verifiedChecksums downloads the checksums of a release and checks their
+// signature, returning the SHA-256 of each asset.
+func (r *githubRelease) verifiedChecksums(publicKey ed25519.PublicKey) (map[string]string, error) {
+	sums, err := r.download(releaseChecksums)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := r.download(releaseSignature)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || !ed25519.Verify(publicKey, sums, sig) {
+		return nil, fmt.Errorf("release %s: invalid signature of %s", r.TagName, releaseChecksums)
+	}
+
+	checksums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		if sum, name, ok := strings.Cut(scanner.Text(), "  "); ok {
+			checksums[strings.TrimPrefix(name, "*")] = strings.ToLower(sum)
+		}
+	}
+	return checksums, nil
+}
+
+// replaceExecutable atomically replaces the binary at path with data,
+// keeping its mode. Windows cannot overwrite a running binary, so the old
+// one is moved aside first.
+func replaceExecutable(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".denv-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runSelfUpdate replaces the running binary with the latest release (or
+// --version) for this platform after checking the signed checksums.
+func runSelfUpdate(c *cli.Context) error {
+	if releasePublicKey == "" {
+		return errors.New("this build has no release signing key and cannot update itself; download a release or use go install")
+	}
+	key, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid release signing key")
+	}
+
+	release, err := fetchRelease(c.String("version"))
+	if err != nil {
+		return err
+	}
+	current := currentBuild().Version
+	if release.TagName == current && !c.Bool("force") {
+		fmt.Fprintf(humanWriter(c), "denv %s is up to date\n", current)
+		return nil
+	}
+	if c.Bool("check") {
+		fmt.Fprintf(c.App.Writer, "%s\n", release.TagName)
+		fmt.Fprintf(humanWriter(c), "denv %s is available (current: %s)\n", release.TagName, current)
+		return cli.Exit("", 1)
+	}
+
+	checksums, err := release.verifiedChecksums(ed25519.PublicKey(key))
+	if err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	name := releaseAssetName()
+	want, ok := checksums[name]
+	if !ok {
+		return fmt.Errorf("release %s has no build for %s/%s", release.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	data, err := release.download(name)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != want {
+		return withExitCode(exitValidation, fmt.Errorf("release %s: checksum mismatch for %s", release.TagName, name))
+	}
+
+	path, err := selfExecutable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if err := replaceExecutable(path, data); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	fmt.Fprintf(humanWriter(c), "Updated denv from %s to %s\n", current, release.TagName)
+	return nil
+}
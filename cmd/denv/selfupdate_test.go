@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestSelfUpdate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("new denv binary")
+	sum := sha256.Sum256(binary)
+	checksums := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), releaseAssetName())
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(checksums)))
+
+	var server *httptest.Server
+	assets := map[string]string{
+		releaseAssetName(): string(binary),
+		releaseChecksums:   checksums,
+		releaseSignature:   signature,
+	}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/releases/latest" {
+			var list []string
+			for name := range assets {
+				list = append(list, fmt.Sprintf(`{"name":%q,"browser_download_url":"%s/assets/%s"}`, name, server.URL, name))
+			}
+			fmt.Fprintf(w, `{"tag_name":"v2.0.0","assets":[%s]}`, strings.Join(list, ","))
+			return
+		}
+		content, ok := assets[strings.TrimPrefix(r.URL.Path, "/assets/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+
+	exe := filepath.Join(t.TempDir(), "denv")
+	if err := os.WriteFile(exe, []byte("old denv binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(api, key, v string, self func() (string, error)) {
+		releaseAPI, releasePublicKey, version, selfExecutable = api, key, v, self
+	}(releaseAPI, releasePublicKey, version, selfExecutable)
+	releaseAPI, version = server.URL, "v1.0.0"
+	releasePublicKey = base64.StdEncoding.EncodeToString(pub)
+	selfExecutable = func() (string, error) { return exe, nil }
+
+	run := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		app, _ := newApp()
+		app.Writer = &buf
+		app.Commands = []*cli.Command{{
+			Name: "self-update",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "version"},
+				&cli.BoolFlag{Name: "check"},
+				&cli.BoolFlag{Name: "force"},
+			},
+			Action: runSelfUpdate,
+		}}
+		err := app.Run(append([]string{"denv", "self-update"}, args...))
+		return buf.String(), err
+	}
+
+	code := captureExit(t)
+	if out, _ := run("--check"); out != "v2.0.0\ndenv v2.0.0 is available (current: v1.0.0)\n" || *code != 1 {
+		t.Errorf("unexpected --check output %q (exit %d)", out, *code)
+	}
+
+	// A tampered binary is rejected.
+	assets[releaseAssetName()] = "evil"
+	if _, err := run(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+	assets[releaseAssetName()] = string(binary)
+
+	// So are checksums signed with another key.
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	releasePublicKey = base64.StdEncoding.EncodeToString(other)
+	if _, err := run(); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("expected an invalid signature, got %v", err)
+	}
+	releasePublicKey = base64.StdEncoding.EncodeToString(pub)
+
+	if out, err := run(); err != nil || out != "Updated denv from v1.0.0 to v2.0.0\n" {
+		t.Fatalf("unexpected output %q (%v)", out, err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil || !bytes.Equal(data, binary) {
+		t.Errorf("expected the binary to be replaced, got %q (%v)", data, err)
+	}
+	if info, err := os.Stat(exe); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode 0755 to be kept, got %v (%v)", info.Mode(), err)
+	}
+
+	version = "v2.0.0"
+	if out, err := run(); err != nil || out != "denv v2.0.0 is up to date\n" {
+		t.Errorf("unexpected output %q (%v)", out, err)
+	}
+
+	releasePublicKey = ""
+	if _, err := run(); err == nil || !strings.Contains(err.Error(), "no release signing key") {
+		t.Errorf("expected updates to be refused without a key, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const maskedValue = "***"
+
+type serveOptions struct {
+	Token string
+	Masks []string
+	// ShowSecrets serves likely secrets (see secretKeys) in clear.
+	ShowSecrets bool
+	// Inherit serves the inherited system environment along with the keys
+	// the sources define.
+	Inherit bool
+	// WatchInterval is how often /watch re-reads the sources.
+	WatchInterval time.Duration
+}
+
+// envChange is a /watch event: keys that were added or modified and keys
+// that disappeared since the previous event.
+type envChange struct {
+	Changed map[string]string `json:"changed,omitempty"`
+	Removed []string          `json:"removed,omitempty"`
+}
+
+// diffEnv returns the change turning prev into next.
+func diffEnv(prev, next map[string]string) envChange {
+	var change envChange
+	for _, k := range sortedKeys(next) {
+		if v, ok := prev[k]; !ok || v != next[k] {
+			if change.Changed == nil {
+				change.Changed = make(map[string]string)
+			}
+			change.Changed[k] = next[k]
+		}
+	}
+	for _, k := range sortedKeys(prev) {
+		if _, ok := next[k]; !ok {
+			change.Removed = append(change.Removed, k)
+		}
+	}
+	return change
+}
+
+// newServeHandler exposes the merged environment read-only. The sources are
+// re-read on every request so clients always see the current files. Only
+// keys the sources define are served, and likely secrets are masked,
+// unless opts say otherwise.
+func newServeHandler(c *cli.Context, opts serveOptions) http.Handler {
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if opts.Token != "" {
+				got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if subtle.ConstantTimeCompare([]byte(got), []byte(opts.Token)) != 1 {
+					if r.URL.Path == grpcWatchPath {
+						grpcError(w, grpcUnauthenticated, "unauthorized")
+					} else {
+						http.Error(w, "unauthorized", http.StatusUnauthorized)
+					}
+					return
+				}
+			}
+			next(w, r)
+		}
+	}
+
+	load := func() (map[string]string, error) {
+		var envMap, origins map[string]string
+		var err error
+		if opts.Inherit {
+			envMap, origins, err = loadEnvOrigins(c)
+		} else {
+			envMap, origins, err = mergeSources(c, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		secrets := make(map[string]bool)
+		if !opts.ShowSecrets {
+			secrets = secretKeys(c, envMap, origins, defaultSecretKeys)
+		}
+		for k := range envMap {
+			if secrets[k] || matchesAny(k, opts.Masks) {
+				envMap[k] = maskedValue
+			}
+		}
+		return envMap, nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /env", authorized(func(w http.ResponseWriter, r *http.Request) {
+		envMap, err := load()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(envMap)
+	}))
+	mux.HandleFunc("GET /env/{key}", authorized(func(w http.ResponseWriter, r *http.Request) {
+		envMap, err := load()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		val, ok := envMap[r.PathValue("key")]
+		if !ok {
+			http.Error(w, fmt.Sprintf("key '%s' not found", r.PathValue("key")), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, val)
+	}))
+	mux.HandleFunc("GET /watch", authorized(func(w http.ResponseWriter, r *http.Request) {
+		serveWatch(w, r, load, opts.WatchInterval)
+	}))
+	mux.HandleFunc("POST "+grpcWatchPath, authorized(func(w http.ResponseWriter, r *http.Request) {
+		serveGRPCWatch(w, r, load, opts.WatchInterval)
+	}))
+	return mux
+}
+
+// serveWatch streams env changes as server-sent events. The first "change"
+// event carries the full environment; later ones only the difference.
+func serveWatch(w http.ResponseWriter, r *http.Request, load func() (map[string]string, error), interval time.Duration) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	pollChanges(r.Context(), load, interval, func(change envChange, err error) {
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		} else {
+			data, _ := json.Marshal(change)
+			fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+	})
+}
+
+// pollChanges calls emit with the full environment and then with every
+// change until ctx is done. Sources are polled so remote backends are
+// covered as well as files. A failed read is reported once until a read
+// succeeds again.
+func pollChanges(ctx context.Context, load func() (map[string]string, error), interval time.Duration, emit func(envChange, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var current map[string]string
+	var lastErr string
+	for {
+		next, err := load()
+		switch {
+		case err != nil:
+			if err.Error() != lastErr {
+				lastErr = err.Error()
+				emit(envChange{}, err)
+			}
+		default:
+			lastErr = ""
+			if change := diffEnv(current, next); current == nil || change.Changed != nil || change.Removed != nil {
+				emit(change, nil)
+			}
+			current = maps.Clone(next)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runServe(c *cli.Context) error {
+	opts := serveOptions{
+		Token:         c.String("token"),
+		Masks:         c.StringSlice("mask"),
+		ShowSecrets:   c.Bool("show-secrets"),
+		Inherit:       c.Bool("inherit"),
+		WatchInterval: c.Duration("watch-interval"),
+	}
+	if opts.WatchInterval <= 0 {
+		return fmt.Errorf("--watch-interval must be positive")
+	}
+
+	addr := c.String("addr")
+	if opts.Token == "" && !strings.HasPrefix(addr, "127.0.0.1:") && !strings.HasPrefix(addr, "localhost:") {
+		fmt.Fprintf(c.App.ErrWriter, "Warning: serving on %s without --token\n", addr)
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newServeHandler(c, opts),
+		ReadHeaderTimeout: 10 * time.Second,
+		// gRPC clients speak HTTP/2 without TLS to the same port.
+		Protocols: new(http.Protocols),
+	}
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	fmt.Fprintf(c.App.ErrWriter, "Serving environment on http://%s\n", addr)
+	return srv.ListenAndServe()
+}
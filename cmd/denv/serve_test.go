@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestServe(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=8080\nDB_PASSWORD=secret\nAPI_TOKEN=abc\nDB_HOST=db\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		srv := httptest.NewServer(newServeHandler(c, serveOptions{Token: "s3cret", Masks: []string{"DB_HOST"}, WatchInterval: time.Second}))
+		defer srv.Close()
+
+		get := func(path, token string) (*http.Response, string) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp, string(body)
+		}
+
+		if resp, _ := get("/healthz", ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("expected /healthz to be public, got %d", resp.StatusCode)
+		}
+		if resp, _ := get("/env", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected 401 for a bad token, got %d", resp.StatusCode)
+		}
+
+		resp, body := get("/env", "s3cret")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var env map[string]string
+		if err := json.Unmarshal([]byte(body), &env); err != nil {
+			t.Fatal(err)
+		}
+		// Likely secrets are masked by default, --mask adds to them, and
+		// the inherited environment is not served.
+		if env["PORT"] != "8080" || env["DB_PASSWORD"] != maskedValue || env["API_TOKEN"] != maskedValue || env["DB_HOST"] != maskedValue {
+			t.Errorf("unexpected /env response: %v", env)
+		}
+		if _, ok := env["SERVE_INHERITED"]; ok {
+			t.Errorf("expected only source keys, got %v", env)
+		}
+
+		if _, body := get("/env/PORT", "s3cret"); body != "8080\n" {
+			t.Errorf("expected PORT value, got %q", body)
+		}
+		if resp, _ := get("/env/MISSING", "s3cret"); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404 for a missing key, got %d", resp.StatusCode)
+		}
+		return nil
+	}
+
+	t.Setenv("SERVE_INHERITED", "1")
+	if err := app.Run([]string{"denv", "--file", envFile}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeShowSecretsAndInherit(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("DB_PASSWORD=secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SERVE_INHERITED", "1")
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		srv := httptest.NewServer(newServeHandler(c, serveOptions{ShowSecrets: true, Inherit: true, WatchInterval: time.Second}))
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + "/env")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var env map[string]string
+		if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+			return err
+		}
+		if env["DB_PASSWORD"] != "secret" || env["SERVE_INHERITED"] != "1" {
+			t.Errorf("expected secrets and inherited keys in clear, got DB_PASSWORD=%q SERVE_INHERITED=%q", env["DB_PASSWORD"], env["SERVE_INHERITED"])
+		}
+		return nil
+	}
+
+	if err := app.Run([]string{"denv", "--file", envFile}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeWatch(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=8080\nDEBUG=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		srv := httptest.NewServer(newServeHandler(c, serveOptions{WatchInterval: 20 * time.Millisecond}))
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + "/watch")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		nextChange := func() envChange {
+			for scanner.Scan() {
+				if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+					var change envChange
+					if err := json.Unmarshal([]byte(data), &change); err != nil {
+						t.Fatal(err)
+					}
+					return change
+				}
+			}
+			t.Fatal("stream ended")
+			return envChange{}
+		}
+
+		if change := nextChange(); change.Changed["PORT"] != "8080" || change.Changed["DEBUG"] != "1" {
+			t.Errorf("expected initial snapshot, got %+v", change)
+		}
+
+		if err := os.WriteFile(envFile, []byte("PORT=9090\n"), 0644); err != nil {
+			return err
+		}
+		change := nextChange()
+		if len(change.Changed) != 1 || change.Changed["PORT"] != "9090" {
+			t.Errorf("expected PORT change, got %+v", change)
+		}
+		if len(change.Removed) != 1 || change.Removed[0] != "DEBUG" {
+			t.Errorf("expected DEBUG removal, got %+v", change)
+		}
+		return nil
+	}
+
+	if err := app.Run([]string{"denv", "--isolate", "--file", envFile}); err != nil {
+		t.Fatal(err)
+	}
+}
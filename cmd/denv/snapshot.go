@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// snapshot is a fully resolved environment saved for later replay.
+type snapshot struct {
+	Created time.Time         `json:"created"`
+	Env     map[string]string `json:"env"`
+}
+
+// snapshotStore keeps snapshots encrypted like cache entries. The key is
+// taken from --snapshot-key when set, so snapshots saved in CI can be
+// opened on another machine, and is generated next to them otherwise.
+type snapshotStore struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// snapshotFlags are the flags shared by the snapshot subcommands.
+func snapshotFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "snapshot-dir",
+			Usage:   "directory holding snapshots (default: snapshots in the cache dir)",
+			EnvVars: []string{"DENV_SNAPSHOT_DIR"},
+		},
+		&cli.StringFlag{
+			Name:    "snapshot-key",
+			Usage:   "hex-encoded 32 byte `KEY` encrypting snapshots (default: a key generated in the snapshot dir)",
+			EnvVars: []string{"DENV_SNAPSHOT_KEY"},
+		},
+	}
+}
+
+func openSnapshotStore(c *cli.Context) (*snapshotStore, error) {
+	dir := c.String("snapshot-dir")
+	if dir == "" {
+		base, err := cacheDir(c)
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(base, "snapshots")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	hexKey := c.String("snapshot-key")
+	if hexKey == "" {
+		aead, err := cacheCipher(dir)
+		if err != nil {
+			return nil, err
+		}
+		return &snapshotStore{dir: dir, aead: aead}, nil
+	}
+	key, err := hex.DecodeString(hexKey)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("--snapshot-key must be 32 bytes encoded as 64 hex characters")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotStore{dir: dir, aead: aead}, nil
+}
+
+func (s *snapshotStore) path(name string) (string, error) {
+	if name == "" || name == "key" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return filepath.Join(s.dir, name+".snap"), nil
+}
+
+func (s *snapshotStore) load(name string) (*snapshot, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("snapshot %s not found: %w", name, err)
+		}
+		return nil, err
+	}
+	var snap snapshot
+	if !readSealed(s.aead, path, &snap) {
+		return nil, fmt.Errorf("cannot decrypt snapshot %s (wrong --snapshot-key?)", name)
+	}
+	return &snap, nil
+}
+
+func runSnapshotSave(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("expected exactly one snapshot name, got %d arguments", c.NArg())
+	}
+	name := c.Args().First()
+
+	store, err := openSnapshotStore(c)
+	if err != nil {
+		return err
+	}
+	path, err := store.path(name)
+	if err != nil {
+		return err
+	}
+	envMap, err := loadEnv(c)
+	if err != nil {
+		return err
+	}
+	if err := writeSealed(store.aead, path, snapshot{Created: time.Now().UTC(), Env: envMap}); err != nil {
+		return err
+	}
+	fmt.Fprintf(humanWriter(c), "Saved snapshot %s (%d variables)\n", name, len(envMap))
+	return nil
+}
+
+func runSnapshotExec(c *cli.Context) error {
+	args := c.Args().Slice()
+	if len(args) < 2 {
+		return fmt.Errorf("expected a snapshot name and a command")
+	}
+
+	store, err := openSnapshotStore(c)
+	if err != nil {
+		return err
+	}
+	snap, err := store.load(args[0])
+	if err != nil {
+		return err
+	}
+	command := args[1:]
+	if command[0] == "--" {
+		command = command[1:]
+	}
+	if len(command) == 0 {
+		return fmt.Errorf("no command specified")
+	}
+	return execWithEnv(c, command, snap.Env, nil, nil)
+}
+
+func runSnapshotList(c *cli.Context) error {
+	store, err := openSnapshotStore(c)
+	if err != nil {
+		return err
+	}
+	matches, err := filepath.Glob(filepath.Join(store.dir, "*.snap"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	for _, path := range matches {
+		name := strings.TrimSuffix(filepath.Base(path), ".snap")
+		var snap snapshot
+		if !readSealed(store.aead, path, &snap) {
+			fmt.Fprintf(c.App.Writer, "%s\t(cannot decrypt)\n", name)
+			continue
+		}
+		fmt.Fprintf(c.App.Writer, "%s\t%s\t%d variables\n", name, snap.Created.Format(time.RFC3339), len(snap.Env))
+	}
+	return nil
+}
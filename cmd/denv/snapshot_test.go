@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func createSnapshotApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "snapshot",
+			Subcommands: []*cli.Command{
+				{Name: "save", Flags: snapshotFlags(), Action: runSnapshotSave},
+				{Name: "exec", Flags: snapshotFlags(), Action: runSnapshotExec},
+				{Name: "list", Flags: snapshotFlags(), Action: runSnapshotList},
+			},
+		},
+	}
+	return app
+}
+
+func TestSnapshot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell commands")
+	}
+
+	tmpDir := t.TempDir()
+	snapDir := filepath.Join(tmpDir, "snapshots")
+	envFile := filepath.Join(tmpDir, ".env")
+	out := filepath.Join(tmpDir, "out")
+	if err := os.WriteFile(envFile, []byte("API_TOKEN=s3cr3t\nMODE=ci\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key := strings.Repeat("ab", 32)
+
+	app := createSnapshotApp()
+	app.Writer = &bytes.Buffer{}
+	if err := app.Run([]string{"denv", "--isolate", "-f", envFile, "snapshot", "save", "--snapshot-dir", snapDir, "--snapshot-key", key, "ci-42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(snapDir, "ci-42.snap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("s3cr3t")) {
+		t.Error("snapshot stores secrets in plain text")
+	}
+
+	// The snapshot is replayed after the file changed.
+	if err := os.WriteFile(envFile, []byte("MODE=local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code := captureExit(t)
+	app = createSnapshotApp()
+	err = app.Run([]string{"denv", "-f", envFile, "snapshot", "exec", "--snapshot-dir", snapDir, "--snapshot-key", key, "ci-42", "--", "sh", "-c", "echo $MODE $API_TOKEN > " + out})
+	if err != nil || *code > 0 {
+		t.Fatalf("exec failed: %v (exit %d)", err, *code)
+	}
+	got, _ := os.ReadFile(out)
+	if string(got) != "ci s3cr3t\n" {
+		t.Errorf("expected the snapshot environment, got %q", got)
+	}
+
+	var buf bytes.Buffer
+	app = createSnapshotApp()
+	app.Writer = &buf
+	if err := app.Run([]string{"denv", "snapshot", "list", "--snapshot-dir", snapDir, "--snapshot-key", key}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "ci-42\t") || !strings.HasSuffix(buf.String(), "\t2 variables\n") {
+		t.Errorf("unexpected list output %q", buf.String())
+	}
+
+	app = createSnapshotApp()
+	err = app.Run([]string{"denv", "snapshot", "exec", "--snapshot-dir", snapDir, "--snapshot-key", strings.Repeat("cd", 32), "ci-42", "true"})
+	if err == nil || !strings.Contains(err.Error(), "cannot decrypt") {
+		t.Errorf("expected a decryption error with the wrong key, got %v", err)
+	}
+
+	app = createSnapshotApp()
+	err = app.Run([]string{"denv", "snapshot", "save", "--snapshot-dir", snapDir, "../escape"})
+	if err == nil || !strings.Contains(err.Error(), "invalid snapshot name") {
+		t.Errorf("expected an invalid name error, got %v", err)
+	}
+}
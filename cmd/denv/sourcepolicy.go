@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Failure policies of a remote source.
+const (
+	onErrorFail = "fail"
+	onErrorWarn = "warn"
+	onErrorSkip = "skip"
+)
+
+// sourcePolicy bounds how long a remote source may take and what a failure
+// means: fail the command (default), or load nothing from the source with
+// or without a warning.
+type sourcePolicy struct {
+	Timeout time.Duration
+	Retries int
+	OnError string
+}
+
+// retryDelay is the pause before the first retry; it doubles with each
+// further attempt.
+var retryDelay = 500 * time.Millisecond
+
+// isRemoteSource reports whether file is fetched from a backend rather
+// than read from disk or the config.
+func isRemoteSource(file EnvFile) bool {
+	switch file.Kind {
+	case sourceFile, sourceConfig, sourceTemporary, sourceSystem:
+		return false
+	}
+	return true
+}
+
+// set applies a timeout, retries or on-error option.
+func (p *sourcePolicy) set(name, value string) error {
+	switch name {
+	case "timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q (expected a positive duration such as 5s)", value)
+		}
+		p.Timeout = d
+	case "retries":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid retries %q (expected a non-negative number)", value)
+		}
+		p.Retries = n
+	case "on-error":
+		if value != onErrorFail && value != onErrorWarn && value != onErrorSkip {
+			return fmt.Errorf("invalid on-error %q (expected fail, warn or skip)", value)
+		}
+		p.OnError = value
+	}
+	return nil
+}
+
+// policyFlag sets an option of the policy of the remote source given
+// right before it.
+type policyFlag struct {
+	files *[]EnvFile
+	name  string
+}
+
+func (f *policyFlag) String() string {
+	return ""
+}
+
+func (f *policyFlag) Set(value string) error {
+	files := *f.files
+	if len(files) == 0 || !isRemoteSource(files[len(files)-1]) {
+		return fmt.Errorf("--source-%s must follow a remote source", f.name)
+	}
+	return files[len(files)-1].Policy.set(f.name, value)
+}
+
+// errSourceTimeout is returned for attempts exceeding the source timeout.
+var errSourceTimeout = errors.New("timed out")
+
+// readWithPolicy reads a remote source with fetch, applying its timeout
+// and retries. A source whose attempts all failed yields no values when its
+// policy is warn or skip. Each attempt gets a context that is cancelled
+// when it times out, which kills the commands and requests of the backend;
+// fetch has returned before the next attempt starts.
+func (r *sourceReader) readWithPolicy(file EnvFile, fetch func(ctx context.Context) (map[string]string, error)) (map[string]string, error) {
+	policy := file.Policy
+	attempt := func() (map[string]string, error) {
+		if policy.Timeout <= 0 {
+			return fetch(context.Background())
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+		defer cancel()
+		env, err := fetch(ctx)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w after %s", errSourceTimeout, policy.Timeout)
+		}
+		return env, err
+	}
+
+	var env map[string]string
+	var err error
+	delay := retryDelay
+	for i := 0; i <= policy.Retries; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if env, err = attempt(); err == nil {
+			return env, nil
+		}
+	}
+
+	switch policy.OnError {
+	case onErrorWarn:
+		r.warnf("skipping %s: %v", file, err)
+		return map[string]string{}, nil
+	case onErrorSkip:
+		return map[string]string{}, nil
+	}
+	return nil, err
+}
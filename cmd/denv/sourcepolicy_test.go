@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSourcePolicy(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	attempts := filepath.Join(dir, "attempts")
+	// The object store fails the first two requests, and hangs for slow.env.
+	aws := writeFakeCommand(t, "aws", `
+case "$*" in *slow.env*) exec sleep 10 ;; esac
+echo x >> `+attempts+`
+if [ $(wc -l < `+attempts+`) -le 2 ]; then echo "connection reset" >&2; exit 1; fi
+case "$1" in
+s3api) echo '{"ETag":"\"v1\""}' ;;
+s3) echo REGION=eu ;;
+esac
+`)
+	defer func(a string, d time.Duration) { awsCommand, retryDelay = a, d }(awsCommand, retryDelay)
+	awsCommand, retryDelay = aws, time.Millisecond
+
+	list := func(args ...string) (string, string, error) {
+		os.Remove(attempts)
+		var stdout, stderr bytes.Buffer
+		app := createRunApp()
+		app.Writer, app.ErrWriter = &stdout, &stderr
+		err := app.Run(append(append([]string{"denv", "--isolate", "--cache-dir", filepath.Join(dir, "cache"), "--refresh", "-f", envFile}, args...), "list"))
+		return stdout.String(), stderr.String(), err
+	}
+
+	if _, _, err := list("-f", "s3://bucket/app.env"); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("expected the failure without retries, got %v", err)
+	}
+	if out, _, err := list("-f", "s3://bucket/app.env", "--source-retries", "2"); err != nil || out != "PORT=80\nREGION=eu\n" {
+		t.Errorf("expected retries to succeed, got %q (%v)", out, err)
+	}
+
+	// A timed out attempt kills the command and waits for it, so neither
+	// it nor a later test restoring awsCommand races with it.
+	slow := []string{"-f", "s3://bucket/slow.env", "--source-timeout", "50ms"}
+	start := time.Now()
+	if _, _, err := list(slow...); err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be killed, took %s", elapsed)
+	}
+	out, errOut, err := list(append(slow, "--source-on-error", "warn")...)
+	if err != nil || out != "PORT=80\n" || !strings.Contains(errOut, "Warning: skipping s3://bucket/slow.env: timed out after 50ms") {
+		t.Errorf("expected a warning and the other sources, got %q, %q (%v)", out, errOut, err)
+	}
+	out, errOut, err = list(append(slow, "--source-on-error", "skip")...)
+	if err != nil || out != "PORT=80\n" || errOut != "" {
+		t.Errorf("expected the source to be skipped silently, got %q, %q (%v)", out, errOut, err)
+	}
+
+	for _, args := range [][]string{
+		{"--source-timeout", "5s"},
+		{"-f", "s3://bucket/app.env", "--source-on-error", "ignore"},
+		{"-f", "s3://bucket/app.env", "--source-retries", "-1"},
+	} {
+		if _, _, err := list(args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestConfigSourcePolicy(t *testing.T) {
+	doc, err := parseYAML([]byte("files:\n  - path: s3://bucket/app.env\n    timeout: 2s\n    retries: 1\n    on-error: warn\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := decodeConfig(doc, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (sourcePolicy{Timeout: 2 * time.Second, Retries: 1, OnError: onErrorWarn}); cfg.Files[0].Policy != want {
+		t.Errorf("expected %+v, got %+v", want, cfg.Files[0].Policy)
+	}
+
+	doc, err = parseYAML([]byte("files:\n  - path: .env\n    on-error: skip\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeConfig(doc, "."); err == nil || !strings.Contains(err.Error(), "only apply to remote sources") {
+		t.Errorf("expected an error for a local file, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// sshCommand is the ssh client binary. It is a variable so tests can
+// substitute a fake.
+var sshCommand = "ssh"
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runSSH runs a command on a remote host with the loaded sources (but not
+// the local system environment) injected, either as an env(1) prefix or,
+// with --via-file, through a temporary file that is sourced and removed
+// before the command starts so values never appear in the remote process
+// list.
+func runSSH(c *cli.Context) error {
+	args := c.Args().Slice()
+	sshArgs, command := args, []string(nil)
+	for i, arg := range args {
+		if arg == "--" {
+			sshArgs, command = args[:i], args[i+1:]
+			break
+		}
+	}
+	if command == nil && len(args) > 1 {
+		sshArgs, command = args[:1], args[1:]
+	}
+	if len(sshArgs) == 0 || len(command) == 0 {
+		return fmt.Errorf("usage: denv ssh <destination> [ssh options] -- <command>")
+	}
+
+	envMap, err := loadSources(c)
+	if err != nil {
+		return err
+	}
+	keys := sortedKeys(envMap)
+
+	var remote string
+	if c.Bool("via-file") {
+		var script strings.Builder
+		for _, k := range keys {
+			if !isShellName(k) {
+				return fmt.Errorf("%s is not a valid shell variable name and cannot be sourced remotely", k)
+			}
+			fmt.Fprintf(&script, "export %s=%s\n", k, shellQuote(envMap[k]))
+		}
+
+		upload := exec.Command(sshCommand, slices.Concat(sshArgs, []string{`umask 077 && f=$(mktemp) && cat > "$f" && echo "$f"`})...)
+		upload.Stdin = strings.NewReader(script.String())
+		upload.Stderr = c.App.ErrWriter
+		out, err := upload.Output()
+		if err != nil {
+			return fmt.Errorf("failed to upload environment: %w", err)
+		}
+		path := shellQuote(strings.TrimSpace(string(out)))
+		remote = fmt.Sprintf(". %s; rm -f %s; %s", path, path, strings.Join(command, " "))
+	} else {
+		parts := []string{"env"}
+		for _, k := range keys {
+			parts = append(parts, shellQuote(k+"="+envMap[k]))
+		}
+		remote = strings.Join(append(parts, command...), " ")
+	}
+
+	cmd := exec.Command(sshCommand, slices.Concat(sshArgs, []string{remote})...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = c.App.Writer
+	cmd.Stderr = c.App.ErrWriter
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return cli.Exit("", exitErr.ExitCode())
+	}
+	return err
+}
+
+func isShellName(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	return !strings.ContainsFunc(s, func(r rune) bool {
+		return !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func createSSHApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{Name: "ssh", Flags: []cli.Flag{&cli.BoolFlag{Name: "via-file"}}, Action: runSSH},
+	}
+	return app
+}
+
+func TestSSHEnvPrefix(t *testing.T) {
+	// The fake ssh prints each argument on its own line.
+	fake := writeFakeCommand(t, "ssh", `for a in "$@"; do echo "$a"; done`)
+	defer func(orig string) { sshCommand = orig }(sshCommand)
+	sshCommand = fake
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("TOKEN=it's secret\nPORT=80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app := createSSHApp()
+	app.Writer = &buf
+	args := []string{"denv", "--file", envFile, "ssh", "deploy@host", "-p", "2222", "--", "./deploy.sh", "--fast"}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{"deploy@host", "-p", "2222", `env 'PORT=80' 'TOKEN=it'\''s secret' ./deploy.sh --fast`}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected ssh invocation:\n%s", buf.String())
+	}
+}
+
+func TestSSHViaFile(t *testing.T) {
+	// The fake ssh "uploads" by saving stdin and printing a path, then
+	// records the final remote command.
+	dir := t.TempDir()
+	fake := writeFakeCommand(t, "ssh", `
+last=""; for a in "$@"; do last="$a"; done
+case "$last" in
+*mktemp*) cat > "`+dir+`/uploaded"; echo /tmp/denv.remote ;;
+*) echo "$last" > "`+dir+`/command"; echo "ARGS: $*" >&2 ;;
+esac
+`)
+	defer func(orig string) { sshCommand = orig }(sshCommand)
+	sshCommand = fake
+
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("TOKEN=secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"denv", "--file", envFile, "ssh", "--via-file", "host", "./deploy.sh"}
+	if err := createSSHApp().Run(args); err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded, _ := os.ReadFile(filepath.Join(dir, "uploaded"))
+	if string(uploaded) != "export TOKEN='secret'\n" {
+		t.Errorf("unexpected uploaded file %q", uploaded)
+	}
+	command, _ := os.ReadFile(filepath.Join(dir, "command"))
+	if strings.TrimSpace(string(command)) != ". '/tmp/denv.remote'; rm -f '/tmp/denv.remote'; ./deploy.sh" {
+		t.Errorf("unexpected remote command %q", command)
+	}
+	if strings.Contains(string(command), "secret") {
+		t.Error("values must not appear on the remote command line in --via-file mode")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// sourceStatus describes a loaded source: whether a file exists and when
+// it was modified, and the number of keys it defines or why it failed.
+func sourceStatus(file EnvFile, loaded map[string]string, err error) string {
+	if file.Kind == sourceFile {
+		info, statErr := os.Stat(file.Path)
+		switch {
+		case errors.Is(statErr, fs.ErrNotExist) && file.Optional:
+			return "missing (optional)"
+		case statErr != nil:
+			return fmt.Sprintf("error: %v", statErr)
+		case err == nil:
+			return fmt.Sprintf("%d keys, modified %s", len(loaded), info.ModTime().Format(time.DateTime))
+		}
+	}
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return fmt.Sprintf("%d keys", len(loaded))
+}
+
+// cacheStatus describes the cached values of a remote source; it is empty
+// for other sources.
+func cacheStatus(c *cli.Context, r *sourceReader, file EnvFile) string {
+	switch file.Kind {
+	case sourceFile, sourceConfig, sourceTemporary:
+		return ""
+	case sourceS3, sourceGCS:
+		return objectCacheStatus(r, file)
+	case sourceGit:
+		return gitCacheStatus(c, file)
+	}
+	if c.Duration("cache-ttl") <= 0 {
+		return ", not cached"
+	}
+	cache := r.openCache()
+	if cache == nil {
+		return ""
+	}
+	entry, ok := cache.stored(cache.entryPath(file, r.scope(file.Kind)))
+	if !ok {
+		return ", not cached"
+	}
+	ttl := cache.ttl
+	if entry.TTL > 0 {
+		ttl = entry.TTL
+	}
+	age := time.Since(entry.Stored).Truncate(time.Second)
+	freshness := "fresh"
+	if age > ttl {
+		freshness = "expired"
+	}
+	return fmt.Sprintf(", cached %s ago (%s, ttl %s)", age, freshness, ttl)
+}
+
+func runStatus(c *cli.Context) error {
+	if c.Bool("clear-temporary") {
+		if err := clearTemporary(c); err != nil {
+			return err
+		}
+		fmt.Fprintln(humanWriter(c), "Cleared temporary variables")
+		return nil
+	}
+
+	w := c.App.Writer
+	config := "none"
+	if cfg := loadedConfig(c); cfg.Path != "" {
+		config = cfg.Path
+		if cfg.App != "" {
+			config += " (app " + cfg.App + ")"
+		}
+	}
+	fmt.Fprintf(w, "Config: %s\n", config)
+
+	// The cache is inspected before reading, since reading refreshes
+	// expired entries.
+	files := envFiles(c)
+	r := &sourceReader{c: c}
+	caches := make([]string, len(files))
+	for i, file := range files {
+		caches[i] = cacheStatus(c, r, file)
+	}
+	results, errs := r.readAll(files)
+
+	fmt.Fprintln(w, "Sources:")
+	if len(files) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	envMap := make(map[string]string)
+	for i, file := range files {
+		fmt.Fprintf(tw, "  %s\t%s%s\n", file, sourceStatus(file, results[i], errs[i]), caches[i])
+		maps.Copy(envMap, results[i])
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "Validation:")
+	problems, err := validateEnv(c, envMap)
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "  %v\n", err)
+	case len(problems) == 0:
+		fmt.Fprintln(w, "  no problems")
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(w, "  %s\n", problem)
+	}
+
+	fmt.Fprintln(w, "Temporary variables:")
+	vars := activeTemporary(c)
+	if len(vars) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, v := range vars {
+		value := v.Value
+		if looksSecret(v.Key, v.Value, defaultSecretKeys) && !c.Bool("show-secrets") {
+			value = maskedValue
+		}
+		left := time.Until(v.Expires).Truncate(time.Second)
+		fmt.Fprintf(w, "  %s=%s (expires in %s, at %s)\n", v.Key, value, left, v.Expires.Format(time.DateTime))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestStatus(t *testing.T) {
+	kubectl := writeFakeCommand(t, "kubectl", `echo '{"data":{"DB_PASSWORD":"czNjcjN0"}}'`)
+	defer func(orig string) { kubectlCommand = orig }(kubectlCommand)
+	kubectlCommand = kubectl
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile(defaultConfigFile, []byte("env:\n  MODE: dev\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content := "# denv:type=integer\nPORT=abc\n# denv:required\nNAME=\n# denv:enum=a|b\nLEVEL=a\n"
+	if err := os.WriteFile(".env", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status := func() string {
+		t.Helper()
+		app, _ := newApp()
+		app.Commands = []*cli.Command{
+			{Name: "status", Flags: []cli.Flag{&cli.BoolFlag{Name: "clear-temporary"}}, Action: runStatus},
+		}
+		var buf bytes.Buffer
+		app.Writer = &buf
+		args := []string{"denv", "--cache-dir", filepath.Join(dir, "cache"), "--cache-ttl", "1h",
+			"-f", ".env", "--fo", ".env.local", "--k8s-secret", "default/app", "status"}
+		if err := app.Run(args); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	out := status()
+	want := `^Config: denv.yaml
+Sources:
+  config:denv.yaml    1 keys
+  \.env                3 keys, modified \d{4}-\d\d-\d\d \d\d:\d\d:\d\d
+  \.env\.local          missing \(optional\)
+  secret:default/app  1 keys, not cached
+Validation:
+  NAME: is required but empty
+  PORT: expected integer, got "abc"
+Temporary variables:
+  none
+$`
+	if !regexp.MustCompile(want).MatchString(out) {
+		t.Errorf("unexpected status:\n%s", out)
+	}
+
+	if out := status(); !regexp.MustCompile(`secret:default/app  1 keys, cached 0s ago \(fresh, ttl 1h0m0s\)\n`).MatchString(out) {
+		t.Errorf("expected a fresh cache entry:\n%s", out)
+	}
+}
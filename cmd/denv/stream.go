@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+// streamMinSize is the file size from which commands that need only some
+// keys, or only key names, read env files as a stream instead of loading
+// them into memory.
+var streamMinSize int64 = 16 << 20
+
+// canStream reports whether files parsed with opts can be read as a stream:
+// $(command) values may reference any earlier variable, non-UTF-8
+// encodings are decoded as a whole and only the dotenv parser streams.
+func canStream(opts parseOptions) bool {
+	if opts.ExecValues || opts.Format != "" && opts.Format != formatExports {
+		return false
+	}
+	switch strings.ToLower(opts.Encoding) {
+	case "", "auto", "utf-8", "utf8":
+		return true
+	}
+	return false
+}
+
+// streamEnvFile reads the keys accepted by want, or all keys when want is
+// nil, from an env file in two passes over a buffered reader. The first
+// collects the names referenced as $VAR anywhere in the file, so the second
+// only has to keep the values of those and of the wanted keys. With
+// keysOnly, wanted keys map to "" and their values are dropped as well.
+// Merge modes are returned for all keys, like parseEnvData.
+func streamEnvFile(path string, opts parseOptions, want func(string) bool, keysOnly bool) (env, modes map[string]string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 64<<10)
+	head, _ := r.Peek(1024)
+	utf16 := bytes.HasPrefix(head, bomUTF16LE) || bytes.HasPrefix(head, bomUTF16BE)
+	if enc := strings.ToLower(opts.Encoding); !utf16 && (enc == "" || enc == "auto") {
+		_, utf16 = guessUTF16(head)
+	}
+	if utf16 {
+		// UTF-16 needs decoding as a whole.
+		env, modes, err := readEnvFile(path, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k := range env {
+			switch {
+			case want != nil && !want(k):
+				delete(env, k)
+			case keysOnly:
+				env[k] = ""
+			}
+		}
+		return env, modes, nil
+	}
+
+	referenced, err := referencedNames(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	r.Reset(f)
+	if head, _ := r.Peek(len(bomUTF8)); bytes.Equal(head, bomUTF8) {
+		r.Discard(len(bomUTF8))
+	}
+
+	var readErr error
+	next := func() (string, bool) {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			readErr = err
+			return "", false
+		}
+		if err == io.EOF && line == "" {
+			return "", false
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if err == nil {
+			line = strings.TrimSuffix(line, "\r")
+		}
+		return line, true
+	}
+	wanted := func(key string) bool { return want == nil || want(key) }
+	keep := func(key string) bool { return referenced[key] || !keysOnly && wanted(key) }
+
+	env = make(map[string]string)
+	vars := make(map[string]string)
+	err = scanDotenv(next, opts, vars, keep, func(e envEntry) error {
+		merge := e
+		merge.Key = strings.Clone(e.Key)
+		modes = recordMergeMode(modes, merge)
+		// Keys and values are substrings of the line read; copy them so
+		// the lines can be freed.
+		switch {
+		case !wanted(e.Key):
+		case keysOnly:
+			env[strings.Clone(e.Key)] = ""
+		default:
+			env[strings.Clone(e.Key)] = strings.Clone(e.Value)
+		}
+		return nil
+	})
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return env, modes, nil
+}
+
+// referencedNames collects the names of all $VAR and ${VAR} references in
+// the content of r. Quoting and escapes are ignored, so it may report names
+// that are never expanded, but never misses one.
+func referencedNames(r *bufio.Reader) (map[string]bool, error) {
+	names := make(map[string]bool)
+	for {
+		line, err := r.ReadString('\n')
+		for i := strings.IndexByte(line, '$'); i >= 0; i = strings.IndexByte(line, '$') {
+			line = strings.TrimPrefix(line[i+1:], "{")
+			j := 0
+			for j < len(line) && isVarNameChar(line[j]) {
+				j++
+			}
+			if j > 0 {
+				names[line[:j]] = true
+			}
+			line = line[j:]
+		}
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
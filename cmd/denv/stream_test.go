@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+const streamTestContent = "\xEF\xBB\xBF# comment\r\n" +
+	"BASE=/srv\r\n" +
+	"export DATA=${BASE}/data\n" +
+	"UNUSED=big value\n" +
+	"MULTI=\"line one\n" +
+	"line two $BASE\"\n" +
+	"LITERAL='$NOT_EXPANDED'\n" +
+	"BASE=/opt\n" +
+	"LOGS=$BASE/logs # inline comment\n" +
+	"LAST=no newline"
+
+func TestStreamEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte(streamTestContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := parseOptions{Encoding: "auto"}
+	full, _, err := readEnvFile(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key := range full {
+		got, _, err := streamEnvFile(path, opts, func(k string) bool { return k == key }, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]string{key: full[key]}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+
+	got, _, err := streamEnvFile(path, opts, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sortedKeys(got), sortedKeys(full)) {
+		t.Errorf("expected keys %v, got %v", sortedKeys(full), sortedKeys(got))
+	}
+	if got["DATA"] != "" {
+		t.Errorf("expected keys only, got DATA=%q", got["DATA"])
+	}
+}
+
+func TestStreamEnvFileErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("A=1\nB=\"open\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := streamEnvFile(path, parseOptions{}, nil, true)
+	if err == nil || err.Error() != "line 2: B: unterminated quoted value" {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestStreamEnvFileUTF16WithoutBOM(t *testing.T) {
+	var data []byte
+	for _, b := range []byte("A=1\nB=two\n") {
+		data = append(data, b, 0)
+	}
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := streamEnvFile(path, parseOptions{Encoding: "auto"}, func(k string) bool { return k == "B" }, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"B": "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestGetAndKeysStreaming(t *testing.T) {
+	defer func(orig int64) { streamMinSize = orig }(streamMinSize)
+	streamMinSize = 0
+
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte(streamTestContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		app, _ := newApp()
+		app.Writer = &buf
+		app.Commands = []*cli.Command{
+			{Name: "get", Action: runGet},
+			{Name: "keys", Flags: []cli.Flag{&cli.StringFlag{Name: "output", Value: "text"}}, Action: runKeys},
+		}
+		if err := app.Run(append([]string{"denv", "--isolate", "-f", path}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if out := run("get", "LOGS"); out != "/opt/logs\n" {
+		t.Errorf("unexpected get output %q", out)
+	}
+	if out := run("get", "DATA"); out != "/srv/data\n" {
+		t.Errorf("unexpected get output %q", out)
+	}
+	if out := run("keys"); out != "BASE\nDATA\nLAST\nLITERAL\nLOGS\nMULTI\nUNUSED\n" {
+		t.Errorf("unexpected keys output %q", out)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// sourceTemporary holds the variables set with --env-ttl that have not
+// expired yet. It is loaded after all other sources.
+const sourceTemporary = "temporary"
+
+// temporaryVar is a variable set with --env-ttl for the working directory
+// Dir until Expires.
+type temporaryVar struct {
+	Dir     string    `json:"dir"`
+	Key     string    `json:"key"`
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// temporaryStatePath returns the file holding temporary variables,
+// encrypted with the cache key since values may be secrets.
+func temporaryStatePath(c *cli.Context) (string, error) {
+	dir, err := cacheDir(c)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "temporary.bin"), nil
+}
+
+// readTemporary returns all stored temporary variables, including expired
+// ones. A missing state file yields none without creating the cache dir.
+func readTemporary(c *cli.Context) ([]temporaryVar, error) {
+	path, err := temporaryStatePath(c)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	aead, err := cacheCipher(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	var vars []temporaryVar
+	if !readSealed(aead, path, &vars) {
+		return nil, fmt.Errorf("cannot read temporary variables from %s", path)
+	}
+	return vars, nil
+}
+
+func writeTemporary(c *cli.Context, vars []temporaryVar) error {
+	path, err := temporaryStatePath(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	aead, err := cacheCipher(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	return writeSealed(aead, path, vars)
+}
+
+// parseEnvTTL parses KEY=VALUE=DURATION. The duration follows the last
+// "=", so values may contain "=".
+func parseEnvTTL(spec string) (key, value string, ttl time.Duration, err error) {
+	rest, d, ok := cutLast(spec, "=")
+	key, value, ok2 := strings.Cut(rest, "=")
+	if !ok || !ok2 {
+		return "", "", 0, fmt.Errorf("invalid --env-ttl %q (expected KEY=VALUE=DURATION)", spec)
+	}
+	if err := validateKey(key); err != nil {
+		return "", "", 0, fmt.Errorf("invalid --env-ttl %q: %w", spec, err)
+	}
+	ttl, err = time.ParseDuration(d)
+	if err != nil || ttl <= 0 {
+		return "", "", 0, fmt.Errorf("invalid --env-ttl %q: expected a positive duration such as 2h", spec)
+	}
+	return key, value, ttl, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// applyTemporary stores the variables given with --env-ttl and, when
+// temporary variables are active for the working directory, adds them as
+// the last source. Expired variables are dropped whenever the state is
+// written. It runs before every command, so a state that cannot be read
+// or decrypted is ignored with a warning rather than failing the command.
+func applyTemporary(c *cli.Context, files *[]EnvFile) error {
+	vars, err := readTemporary(c)
+	if err != nil {
+		fmt.Fprintf(c.App.ErrWriter, "Warning: ignoring temporary variables: %v\n", err)
+		vars = nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if specs := c.StringSlice("env-ttl"); len(specs) > 0 {
+		vars = slices.DeleteFunc(vars, func(v temporaryVar) bool { return !v.Expires.After(now) })
+		for _, spec := range specs {
+			key, value, ttl, err := parseEnvTTL(spec)
+			if err != nil {
+				return err
+			}
+			vars = slices.DeleteFunc(vars, func(v temporaryVar) bool { return v.Dir == dir && v.Key == key })
+			vars = append(vars, temporaryVar{Dir: dir, Key: key, Value: value, Expires: now.Add(ttl)})
+		}
+		if err := writeTemporary(c, vars); err != nil {
+			return fmt.Errorf("failed to store temporary variables: %w", err)
+		}
+	}
+
+	active := slices.DeleteFunc(vars, func(v temporaryVar) bool { return v.Dir != dir || !v.Expires.After(now) })
+	if len(active) > 0 {
+		c.App.Metadata["temporary"] = active
+		*files = append(*files, EnvFile{Path: dir, Kind: sourceTemporary})
+	}
+	return nil
+}
+
+// activeTemporary returns the temporary variables found by applyTemporary.
+func activeTemporary(c *cli.Context) []temporaryVar {
+	vars, _ := c.App.Metadata["temporary"].([]temporaryVar)
+	return vars
+}
+
+func temporaryEnv(c *cli.Context) map[string]string {
+	env := make(map[string]string)
+	for _, v := range activeTemporary(c) {
+		env[v.Key] = v.Value
+	}
+	return env
+}
+
+// clearTemporary removes the temporary variables of the working directory
+// and drops expired ones.
+func clearTemporary(c *cli.Context) error {
+	vars, err := readTemporary(c)
+	if err != nil || vars == nil {
+		return err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	vars = slices.DeleteFunc(vars, func(v temporaryVar) bool { return v.Dir == dir || !v.Expires.After(now) })
+	return writeTemporary(c, vars)
+}
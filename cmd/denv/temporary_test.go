@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestParseEnvTTL(t *testing.T) {
+	key, value, ttl, err := parseEnvTTL("QUERY=a=b=90m")
+	if err != nil || key != "QUERY" || value != "a=b" || ttl != 90*time.Minute {
+		t.Errorf("unexpected result %q %q %v %v", key, value, ttl, err)
+	}
+	for _, spec := range []string{"DEBUG=1", "DEBUG=1=soon", "DEBUG=1=-1h", "BAD KEY=1=1h", "DEBUG"} {
+		if _, _, _, err := parseEnvTTL(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestTemporaryVariables(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	work := filepath.Join(dir, "work")
+	if err := os.Mkdir(work, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(work)
+	if err := os.WriteFile(".env", []byte("DEBUG=0\nPORT=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) string {
+		t.Helper()
+		app, _ := newApp()
+		app.Commands = []*cli.Command{
+			{
+				Name:   "list",
+				Flags:  []cli.Flag{&cli.StringFlag{Name: "output", Value: "text"}, &cli.StringFlag{Name: "group-by"}},
+				Action: runList,
+			},
+			{
+				Name:   "status",
+				Flags:  []cli.Flag{&cli.BoolFlag{Name: "clear-temporary"}},
+				Action: runStatus,
+			},
+		}
+		var buf bytes.Buffer
+		app.Writer = &buf
+		if err := app.Run(append([]string{"denv", "--isolate", "--cache-dir", cacheDir, "-f", ".env"}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if out := run("--env-ttl", "DEBUG=1=1h", "--env-ttl", "TRACE=on=50ms", "list"); out != "DEBUG=1\nPORT=1\nTRACE=on\n" {
+		t.Errorf("expected temporary variables to override files, got %q", out)
+	}
+	data, err := os.ReadFile(filepath.Join(cacheDir, "temporary.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("DEBUG")) {
+		t.Error("temporary variables are stored in plain text")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if out := run("list"); out != "DEBUG=1\nPORT=1\n" {
+		t.Errorf("expected only the unexpired variable, got %q", out)
+	}
+	if out := run("status"); !strings.Contains(out, "Temporary variables:\n  DEBUG=1 (expires in 59m") {
+		t.Errorf("unexpected status %q", out)
+	}
+
+	// Other directories are not affected.
+	t.Chdir(dir)
+	if err := os.WriteFile(".env", []byte("PORT=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out := run("list"); out != "PORT=2\n" {
+		t.Errorf("expected no temporary variables in another directory, got %q", out)
+	}
+
+	t.Chdir(work)
+	run("status", "--clear-temporary")
+	if out := run("list"); out != "DEBUG=0\nPORT=1\n" {
+		t.Errorf("expected cleared variables, got %q", out)
+	}
+}
+
+func TestTemporaryVariablesUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cacheDir, "temporary.bin"), []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	if err := os.WriteFile(".env", []byte("PORT=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name:   "list",
+			Flags:  []cli.Flag{&cli.StringFlag{Name: "output", Value: "text"}, &cli.StringFlag{Name: "group-by"}},
+			Action: runList,
+		},
+	}
+	var out, errOut bytes.Buffer
+	app.Writer, app.ErrWriter = &out, &errOut
+	if err := app.Run([]string{"denv", "--isolate", "--cache-dir", cacheDir, "-f", ".env", "list"}); err != nil {
+		t.Fatalf("expected a broken state to be ignored, got %v", err)
+	}
+	if out.String() != "PORT=1\n" || !strings.Contains(errOut.String(), "ignoring temporary variables") {
+		t.Errorf("unexpected output %q, stderr %q", out.String(), errOut.String())
+	}
+}
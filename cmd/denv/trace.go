@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// traceFileVar names the file the preloaded tracer appends the names of
+// looked up variables to, one per line.
+const traceFileVar = "DENV_TRACE_FILE"
+
+// traceReport is the result of exec --trace-usage: which of the variables
+// from the sources the command looked up. Inconclusive gives the reason
+// lookups may have gone unseen, so Unread cannot be trusted.
+type traceReport struct {
+	Read         []string `json:"read"`
+	Unread       []string `json:"unread"`
+	Inconclusive string   `json:"inconclusive,omitempty"`
+}
+
+// usageTracer records variable lookups of a command started by exec.
+type usageTracer struct {
+	keys    []string
+	file    string
+	warning string
+}
+
+// startTrace prepares env so the command reports its variable lookups, if
+// --trace-usage is set; keys are the variables to report on. The returned
+// tracer is nil when tracing is off.
+func startTrace(c *cli.Context, command string, env map[string]string, keys []string) (*usageTracer, error) {
+	if !c.Bool("trace-usage") {
+		return nil, nil
+	}
+	lib, err := traceLibrary(c)
+	if err != nil {
+		return nil, err
+	}
+	warning := traceWarning(command)
+	if warning != "" {
+		fmt.Fprintf(c.App.ErrWriter, "Warning: %s\n", warning)
+	}
+	f, err := os.CreateTemp("", "denv-trace-*")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	if preload := env["LD_PRELOAD"]; preload != "" {
+		lib += " " + preload
+	}
+	env["LD_PRELOAD"] = lib
+	env[traceFileVar] = f.Name()
+	return &usageTracer{keys: keys, file: f.Name(), warning: warning}, nil
+}
+
+// finish reads the recorded lookups, removes the trace file and reports the
+// variables that were never read on stderr, or as JSON to --trace-report.
+func (t *usageTracer) finish(c *cli.Context) error {
+	data, err := os.ReadFile(t.file)
+	os.Remove(t.file)
+	if err != nil {
+		return err
+	}
+	looked := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		looked[scanner.Text()] = true
+	}
+
+	report := traceReport{Read: []string{}, Unread: []string{}, Inconclusive: t.warning}
+	for _, k := range slices.Sorted(slices.Values(t.keys)) {
+		if looked[k] {
+			report.Read = append(report.Read, k)
+		} else {
+			report.Unread = append(report.Unread, k)
+		}
+	}
+
+	if path := c.String("trace-report"); path != "" {
+		var buf bytes.Buffer
+		if err := writeJSON(c, &buf, report, true); err != nil {
+			return err
+		}
+		return os.WriteFile(path, buf.Bytes(), 0644)
+	}
+	fmt.Fprintf(c.App.ErrWriter, "denv: the command read %d of %d variables from the sources\n", len(report.Read), len(t.keys))
+	switch {
+	case len(report.Unread) == 0:
+	case report.Inconclusive != "":
+		fmt.Fprintf(c.App.ErrWriter, "denv: not seen (inconclusive, %s): %s\n", report.Inconclusive, strings.Join(report.Unread, ", "))
+	default:
+		fmt.Fprintf(c.App.ErrWriter, "denv: never read: %s\n", strings.Join(report.Unread, ", "))
+	}
+	return nil
+}
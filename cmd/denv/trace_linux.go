@@ -0,0 +1,179 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// traceShimSource is the LD_PRELOAD library behind --trace-usage. It wraps
+// getenv and secure_getenv and appends each looked up name to the file in
+// DENV_TRACE_FILE. Single writes to a file opened with O_APPEND keep lines
+// from concurrent threads and child processes intact.
+const traceShimSource = `#define _GNU_SOURCE
+#include <dlfcn.h>
+#include <fcntl.h>
+#include <string.h>
+#include <unistd.h>
+
+static char *(*real_getenv)(const char *);
+static char *(*real_secure_getenv)(const char *);
+static int trace_fd = -1;
+
+__attribute__((constructor)) static void denv_trace_init(void) {
+	real_getenv = dlsym(RTLD_NEXT, "getenv");
+	real_secure_getenv = dlsym(RTLD_NEXT, "secure_getenv");
+	const char *path = real_getenv ? real_getenv("DENV_TRACE_FILE") : 0;
+	if (path && *path) {
+		trace_fd = open(path, O_WRONLY | O_APPEND | O_CLOEXEC);
+	}
+}
+
+static void denv_trace(const char *name) {
+	char line[256];
+	size_t n;
+	if (trace_fd < 0 || !name) {
+		return;
+	}
+	n = strlen(name);
+	if (n > sizeof(line) - 1) {
+		return;
+	}
+	memcpy(line, name, n);
+	line[n] = '\n';
+	if (write(trace_fd, line, n + 1) < 0) {
+		return;
+	}
+}
+
+char *getenv(const char *name) {
+	denv_trace(name);
+	return real_getenv ? real_getenv(name) : 0;
+}
+
+char *secure_getenv(const char *name) {
+	denv_trace(name);
+	return real_secure_getenv ? real_secure_getenv(name) : 0;
+}
+`
+
+// traceCompiler is the C compiler that builds the tracing library, unless
+// $CC is set.
+var traceCompiler = "cc"
+
+// traceLibrary returns the path of the tracing library, building it into
+// the cache dir on first use.
+func traceLibrary(c *cli.Context) (string, error) {
+	dir, err := cacheDir(c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(traceShimSource))
+	lib := filepath.Join(dir, "trace", "denv-trace-"+hex.EncodeToString(sum[:6])+".so")
+	if _, err := os.Stat(lib); err == nil {
+		return lib, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(lib), 0700); err != nil {
+		return "", err
+	}
+
+	// Build next to the final path under per-process names and rename, so
+	// concurrent runs neither share a source file nor load a partially
+	// written library.
+	tmp := lib + fmt.Sprintf(".%d.tmp", os.Getpid())
+	src := strings.TrimSuffix(lib, ".so") + fmt.Sprintf(".%d.c", os.Getpid())
+	if err := os.WriteFile(src, []byte(traceShimSource), 0600); err != nil {
+		return "", err
+	}
+	defer os.Remove(src)
+	compiler := traceCompiler
+	if cc := os.Getenv("CC"); cc != "" {
+		compiler = cc
+	}
+	out, err := exec.Command(compiler, "-shared", "-fPIC", "-O2", "-o", tmp, src, "-ldl").CombinedOutput()
+	if err != nil {
+		os.Remove(tmp)
+		if len(out) == 0 {
+			return "", fmt.Errorf("--trace-usage needs a C compiler to build its LD_PRELOAD library: %w", err)
+		}
+		return "", fmt.Errorf("failed to build the --trace-usage library with %s: %s", compiler, strings.TrimSpace(string(out)))
+	}
+	if err := os.Rename(tmp, lib); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return lib, nil
+}
+
+// environReaders are programs that copy the environment at startup or
+// read it through environ, so their lookups never reach getenv: shells and
+// the interpreters of scripting languages.
+var environReaders = []string{"sh", "bash", "dash", "zsh", "ksh", "fish", "python*", "node", "nodejs", "bun", "deno", "ruby*", "perl*", "php*", "java"}
+
+// traceWarning explains why lookups of command may go unseen, which makes
+// the trace inconclusive: the tracer only sees calls of libc's getenv, and
+// only in dynamically linked programs.
+func traceWarning(command string) string {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return ""
+	}
+	if interpreter := scriptInterpreter(path); interpreter != "" {
+		return fmt.Sprintf("%s is a script run by %s, which reads variables without calling getenv", command, interpreter)
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil && matchesAny(filepath.Base(resolved), environReaders) {
+		return fmt.Sprintf("%s reads variables from its copy of the environment, not through getenv", command)
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	if f.Section(".go.buildinfo") != nil {
+		return fmt.Sprintf("%s is a Go program, which reads variables without calling getenv", command)
+	}
+	if !slices.ContainsFunc(f.Progs, func(p *elf.Prog) bool { return p.Type == elf.PT_INTERP }) {
+		return fmt.Sprintf("%s is statically linked, so its variable lookups cannot be traced", command)
+	}
+	symbols, _ := f.ImportedSymbols()
+	if !slices.ContainsFunc(symbols, func(s elf.ImportedSymbol) bool { return s.Name == "getenv" || s.Name == "secure_getenv" }) {
+		return fmt.Sprintf("%s does not call getenv, so its variable lookups cannot be traced", command)
+	}
+	return ""
+}
+
+// scriptInterpreter returns the name of the interpreter a #! script at path
+// runs with, or "" for other files.
+func scriptInterpreter(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if !strings.HasPrefix(line, "#!") || len(fields) == 0 {
+		return ""
+	}
+	name := filepath.Base(fields[0])
+	// "#!/usr/bin/env [-S] python3" names the interpreter after the options.
+	if name == "env" {
+		for _, arg := range fields[1:] {
+			if !strings.HasPrefix(arg, "-") {
+				return arg
+			}
+		}
+	}
+	return name
+}
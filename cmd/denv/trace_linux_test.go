@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecTraceUsage(t *testing.T) {
+	if _, err := exec.LookPath(traceCompiler); err != nil {
+		t.Skip("no C compiler")
+	}
+	// printenv and shells scan environ instead of calling getenv, so the
+	// test builds its own reader.
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "reader.c")
+	reader := filepath.Join(tmpDir, "reader")
+	if err := os.WriteFile(src, []byte("#include <stdlib.h>\nint main(void) { return getenv(\"USED\") ? 0 : 1; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(traceCompiler, "-o", reader, src).CombinedOutput(); err != nil {
+		t.Skipf("cannot build the test program: %s", out)
+	}
+
+	envFile := filepath.Join(tmpDir, ".env")
+	report := filepath.Join(tmpDir, "report.json")
+	if err := os.WriteFile(envFile, []byte("USED=1\nSTALE=2\nALSO_STALE=3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code := captureExit(t)
+	app := createExecApp()
+	err := app.Run([]string{"denv", "--cache-dir", filepath.Join(tmpDir, "cache"), "-f", envFile,
+		"exec", "--trace-usage", "--trace-report", report, reader})
+	if err != nil || *code > 0 {
+		t.Fatalf("exec failed: %v (exit %d)", err, *code)
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got traceReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid report %q: %v", data, err)
+	}
+	want := traceReport{Read: []string{"USED"}, Unread: []string{"ALSO_STALE", "STALE"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestTraceWarning(t *testing.T) {
+	tmpDir := t.TempDir()
+	script := filepath.Join(tmpDir, "script")
+	if err := os.WriteFile(script, []byte("#!/usr/bin/env -S python3 -u\nprint(1)\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if w := traceWarning(script); !strings.Contains(w, "run by python3") {
+		t.Errorf("expected a warning for a script, got %q", w)
+	}
+	if sh, err := exec.LookPath("sh"); err == nil {
+		if w := traceWarning(sh); w == "" {
+			t.Error("expected a warning for a shell")
+		}
+	}
+	// The test binary itself is a Go program.
+	if w := traceWarning(os.Args[0]); !strings.Contains(w, "Go program") {
+		t.Errorf("expected a warning for a Go program, got %q", w)
+	}
+
+	if _, err := exec.LookPath(traceCompiler); err != nil {
+		return
+	}
+	src := filepath.Join(tmpDir, "main.c")
+	if err := os.WriteFile(src, []byte("#include <stdlib.h>\nint main(void) { return getenv(\"A\") != 0; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, args := range map[string][]string{"reader": nil, "static": {"-static"}} {
+		bin := filepath.Join(tmpDir, name)
+		if out, err := exec.Command(traceCompiler, append(args, "-o", bin, src)...).CombinedOutput(); err != nil {
+			t.Logf("cannot build %s: %s", name, out)
+			continue
+		}
+		if w := traceWarning(bin); (w == "") != (name == "reader") {
+			t.Errorf("unexpected warning for %s: %q", name, w)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/urfave/cli/v2"
+)
+
+func traceLibrary(c *cli.Context) (string, error) {
+	return "", errors.New("--trace-usage is only supported on Linux")
+}
+
+func traceWarning(command string) string {
+	return ""
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	prefixBase64 = "base64:"
+	prefixFile   = "file:"
+	prefixJSON   = "json:"
+	prefixVault  = "vault:"
+
+	prefixKeyring = "keyring://"
+)
+
+// secretResolver resolves a secret reference such as
+// "secret/data/myapp#DB_PASSWORD" to its value.
+type secretResolver func(ref string) (string, error)
+
+// fileResolver reads the file a file: reference names.
+type fileResolver func(path string) ([]byte, error)
+
+// transformValues resolves base64:, file:, json:, vault: and keyring://
+// value prefixes in loaded values. file: references are read via files,
+// which is nil for sources other than local files. With flattenJSON, JSON
+// objects and arrays are expanded into KEY_FIELD variables instead of being
+// passed through as compact JSON. vault: references are looked up via
+// secrets and keyring:// references via keyring; both are nil for remote
+// sources.
+func transformValues(env map[string]string, files fileResolver, flattenJSON bool, secrets, keyring secretResolver) (map[string]string, error) {
+	// Plain values are copied as they are. Prefixed values are handled in
+	// key order so errors are reported deterministically; flattened JSON may
+	// produce keys that collide with other keys, so then every key is.
+	out := make(map[string]string, len(env))
+	var keys []string
+	for k, v := range env {
+		if flattenJSON || hasValuePrefix(v) {
+			keys = append(keys, k)
+		} else {
+			out[k] = v
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := env[k]
+		switch {
+		case strings.HasPrefix(v, prefixBase64):
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(v, prefixBase64))
+			if err != nil {
+				return nil, fmt.Errorf("key %s: invalid base64 value: %w", k, err)
+			}
+			out[k] = string(decoded)
+		case strings.HasPrefix(v, prefixFile):
+			// A remote source must not read files of the machine loading it.
+			if files == nil {
+				return nil, fmt.Errorf("key %s: file: references are only supported in local env files", k)
+			}
+			data, err := files(strings.TrimPrefix(v, prefixFile))
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", k, err)
+			}
+			out[k] = string(data)
+		case strings.HasPrefix(v, prefixJSON):
+			raw := []byte(strings.TrimPrefix(v, prefixJSON))
+			if !flattenJSON {
+				var buf bytes.Buffer
+				if err := json.Compact(&buf, raw); err != nil {
+					return nil, fmt.Errorf("key %s: invalid JSON value: %w", k, err)
+				}
+				out[k] = buf.String()
+				continue
+			}
+			var parsed any
+			if err := json.Unmarshal(raw, &parsed); err != nil {
+				return nil, fmt.Errorf("key %s: invalid JSON value: %w", k, err)
+			}
+			flattenJSONValue(out, k, parsed)
+		case strings.HasPrefix(v, prefixVault):
+			// A remote source must not read secrets of the machine loading it.
+			if secrets == nil {
+				return nil, fmt.Errorf("key %s: vault: references are not supported in remote sources", k)
+			}
+			val, err := secrets(strings.TrimPrefix(v, prefixVault))
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", k, err)
+			}
+			out[k] = val
+		case strings.HasPrefix(v, prefixKeyring):
+			if keyring == nil {
+				return nil, fmt.Errorf("key %s: keyring:// references are not supported in remote sources", k)
+			}
+			name := strings.TrimPrefix(v, prefixKeyring)
+			val, err := keyring(name)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: keyring %s: %w", k, name, err)
+			}
+			out[k] = val
+		default:
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+// hasValuePrefix reports whether v has one of the prefixes resolved by
+// transformValues.
+func hasValuePrefix(v string) bool {
+	return strings.HasPrefix(v, prefixBase64) || strings.HasPrefix(v, prefixFile) ||
+		strings.HasPrefix(v, prefixJSON) || strings.HasPrefix(v, prefixVault) ||
+		strings.HasPrefix(v, prefixKeyring)
+}
+
+func flattenJSONValue(out map[string]string, key string, v any) {
+	switch val := v.(type) {
+	case map[string]any:
+		for field, child := range val {
+			flattenJSONValue(out, key+"_"+strings.ToUpper(field), child)
+		}
+	case []any:
+		for i, child := range val {
+			flattenJSONValue(out, fmt.Sprintf("%s_%d", key, i), child)
+		}
+	case string:
+		out[key] = val
+	case nil:
+		out[key] = ""
+	default:
+		data, _ := json.Marshal(val)
+		out[key] = string(data)
+	}
+}
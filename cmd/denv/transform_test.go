@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestValueTransforms(t *testing.T) {
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	if err := os.WriteFile(filepath.Join(tmpDir, "cert.pem"), []byte("-----BEGIN CERT-----\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content := "TLS_CERT=file:./cert.pem\nTOKEN=base64:aGVsbG8=\nFEATURES='json:{\"a\": 1}'\nPLAIN=value"
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if envMap["TLS_CERT"] != "-----BEGIN CERT-----\n" {
+			return fmt.Errorf("expected TLS_CERT from file, got %q", envMap["TLS_CERT"])
+		}
+		if envMap["TOKEN"] != "hello" {
+			return fmt.Errorf("expected TOKEN=hello, got %q", envMap["TOKEN"])
+		}
+		if envMap["FEATURES"] != `{"a":1}` {
+			return fmt.Errorf(`expected FEATURES={"a":1}, got %q`, envMap["FEATURES"])
+		}
+		if envMap["PLAIN"] != "value" {
+			return fmt.Errorf("expected PLAIN=value, got %q", envMap["PLAIN"])
+		}
+		return nil
+	}
+
+	if err := app.Run([]string{"denv", "--isolate", "--file", envFile}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValueTransformsFlattenAndOptOut(t *testing.T) {
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	content := "FEATURES='json:{\"a\": 1, \"nested\": {\"b\": \"x\"}}'\nTOKEN=base64:aGVsbG8="
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if envMap["FEATURES_A"] != "1" || envMap["FEATURES_NESTED_B"] != "x" {
+			return fmt.Errorf("expected flattened FEATURES_* keys, got %v", envMap)
+		}
+		if _, ok := envMap["FEATURES"]; ok {
+			return fmt.Errorf("expected FEATURES to be replaced by flattened keys")
+		}
+		return nil
+	}
+	if err := app.Run([]string{"denv", "--isolate", "--flatten-json", "--file", envFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	app2, _ := newApp()
+	app2.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if envMap["TOKEN"] != "base64:aGVsbG8=" {
+			return fmt.Errorf("expected raw TOKEN with --no-transform, got %q", envMap["TOKEN"])
+		}
+		return nil
+	}
+	if err := app2.Run([]string{"denv", "--isolate", "--no-transform", "--file", envFile}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValueTransformsInvalid(t *testing.T) {
+	if _, err := transformValues(map[string]string{"BAD": "base64:!!"}, nil, false, nil, nil); err == nil {
+		t.Error("expected error for invalid base64")
+	}
+	if _, err := transformValues(map[string]string{"BAD": "json:{"}, nil, false, nil, nil); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+	// Without a file resolver, as for remote sources, file: is refused.
+	if _, err := transformValues(map[string]string{"CERT": "file:/etc/passwd"}, nil, false, nil, nil); err == nil {
+		t.Error("expected error for file: outside a local env file")
+	}
+	// Nor are secrets of the local machine resolved for remote sources.
+	for _, v := range []string{"keyring://db-password", "vault:secret/data/app#DB_PASSWORD"} {
+		if _, err := transformValues(map[string]string{"SECRET": v}, nil, false, nil, nil); err == nil {
+			t.Errorf("expected error for %s in a remote source", v)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Output formats of convert.
+var convertFormats = []string{"dotenv", "docker", "yaml", "json"}
+
+// encodeValue writes v, declared as typ by a denv:type annotation (or ""
+// when untyped), as a value in format. Typed values are checked first, so
+// a file written from them reads back with the same meaning:
+//
+//   - dotenv quotes values as needed and writes booleans as true or false;
+//   - docker env files cannot quote, so JSON is compacted onto one line and
+//     other multiline values are rejected;
+//   - yaml writes integers, numbers and booleans bare and quotes strings
+//     that YAML would read as another type, such as yes, 0123 or ~;
+//   - json writes integers, numbers and booleans as JSON values and embeds
+//     JSON values as they are.
+func encodeValue(v, typ, format string) (string, error) {
+	v, err := normalizeValue(v, typ)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case "dotenv":
+		return formatValue(v), nil
+	case "docker":
+		if typ == "json" && v != "" {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, []byte(v)); err != nil {
+				return "", err
+			}
+			v = buf.String()
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return "", fmt.Errorf("multiline values are not supported by the docker env file format")
+		}
+		return v, nil
+	case "yaml":
+		switch {
+		case v == "":
+		case typ == "integer":
+			// Integers beyond 64 bits are written as they are.
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return strconv.FormatInt(n, 10), nil
+			}
+			return strings.TrimPrefix(v, "+"), nil
+		case typ == "number" && !strings.ContainsAny(v, "xXpPiInN_"):
+			return v, nil
+		case typ == "boolean":
+			return v, nil
+		}
+		return yamlString(v), nil
+	case "json":
+		switch {
+		case v == "":
+		case typ == "integer":
+			// Integers beyond 64 bits are written as they are.
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return strconv.FormatInt(n, 10), nil
+			}
+			return strings.TrimPrefix(v, "+"), nil
+		case typ == "number" && json.Valid([]byte(v)), typ == "boolean":
+			return v, nil
+		case typ == "json":
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, []byte(v)); err != nil {
+				return "", err
+			}
+			return buf.String(), nil
+		}
+		return jsonString(v), nil
+	}
+	return "", fmt.Errorf("unsupported format %q (expected %s)", format, strings.Join(convertFormats, ", "))
+}
+
+// normalizeValue checks v against typ and returns it in canonical form,
+// which only changes booleans: 1, T or TRUE become true.
+func normalizeValue(v, typ string) (string, error) {
+	if typ == "" {
+		return v, nil
+	}
+	if err := (&keySpec{Type: typ}).validate(v); err != nil {
+		return "", err
+	}
+	if typ == "boolean" && v != "" {
+		b, _ := strconv.ParseBool(v)
+		v = strconv.FormatBool(b)
+	}
+	return v, nil
+}
+
+// yamlPlainAmbiguous matches plain scalars that YAML 1.1 or 1.2 resolve to
+// something other than a string: booleans, nulls, numbers and timestamps.
+var yamlPlainAmbiguous = regexp.MustCompile(`^(?i:y|n|yes|no|on|off|true|false|null|~|[-+]?(\.inf|\.nan)|[-+]?[0-9][0-9_]*(\.[0-9_]*)?(e[-+]?[0-9]+)?|[-+]?\.[0-9]+(e[-+]?[0-9]+)?|0x[0-9a-f_]+|0o[0-7_]+|0b[01_]+|[0-9]+(:[0-5]?[0-9])+(\.[0-9_]*)?|[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}([tT ].*)?)$`)
+
+// yamlString writes s as a YAML string, plain when that reads back as the
+// same string and double quoted otherwise.
+func yamlString(s string) string {
+	if s == "" || yamlPlainAmbiguous.MatchString(s) ||
+		strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@` \t") ||
+		strings.ContainsAny(s, "\r\n\t\\") || strings.Contains(s, ": ") || strings.Contains(s, " #") ||
+		strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") {
+		return jsonString(s)
+	}
+	return s
+}
+
+// runConvert writes the merged sources (without the system environment) in
+// another format, encoding each value according to its denv:type.
+func runConvert(c *cli.Context) error {
+	format := c.String("to")
+	if !slices.Contains(convertFormats, format) {
+		return fmt.Errorf("unsupported format %q (expected %s)", format, strings.Join(convertFormats, ", "))
+	}
+	reader := &sourceReader{c: c, want: keyFilter(c, nil)}
+	envMap, _, err := mergeWith(reader)
+	if err != nil {
+		return err
+	}
+	// Other formats cannot extend the inherited value of keys like PATH+=,
+	// so they get the value it resolves to.
+	if format != "dotenv" {
+		for k, parts := range reader.extends {
+			if _, ok := envMap[k]; ok {
+				envMap[k] = parts.around(inheritedValue(c, k))
+			}
+		}
+	}
+	specs, err := annotatedSpecs(c, envMap)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	values := make(map[string]json.RawMessage, len(envMap))
+	for _, k := range sortedKeys(envMap) {
+		v, err := encodeValue(envMap[k], specs[k].Type, format)
+		if err != nil {
+			return withExitCode(exitValidation, fmt.Errorf("%s: %w", k, err))
+		}
+		switch format {
+		case "json":
+			values[k] = json.RawMessage(v)
+		case "yaml":
+			fmt.Fprintf(&sb, "%s: %s\n", k, v)
+		default:
+			if parts, ok := reader.extends[k]; ok && format == "dotenv" {
+				sb.WriteString(extendingAssignment(c, k, parts))
+				continue
+			}
+			fmt.Fprintf(&sb, "%s=%s\n", k, v)
+		}
+	}
+	if format == "json" {
+		if err := writeJSON(c, &sb, values, true); err != nil {
+			return err
+		}
+	}
+
+	output := c.String("output")
+	if output == "" || output == "-" {
+		fmt.Fprint(c.App.Writer, sb.String())
+		return nil
+	}
+	return os.WriteFile(output, []byte(sb.String()), 0600)
+}
+
+// durationPattern is the JSON Schema pattern of values accepted by
+// time.ParseDuration.
+const durationPattern = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+)$`
+
+// isDuration reports whether v is a duration with a unit, such as 1h30m.
+func isDuration(v string) bool {
+	_, err := time.ParseDuration(v)
+	return err == nil && strings.ContainsAny(v, "hmsuµn")
+}
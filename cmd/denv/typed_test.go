@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestEncodeValue(t *testing.T) {
+	tests := []struct {
+		value, typ, format, want string
+	}{
+		{"TRUE", "boolean", "dotenv", "true"},
+		{`{"a": "b c"}`, "json", "dotenv", `'{"a": "b c"}'`},
+		{"{\n  \"a\": 1\n}", "json", "docker", `{"a":1}`},
+		{"080", "integer", "yaml", "80"},
+		{"1.5", "number", "yaml", "1.5"},
+		{"yes", "", "yaml", `"yes"`},
+		{"0123", "", "yaml", `"0123"`},
+		{"2024-01-02", "", "yaml", `"2024-01-02"`},
+		{"- item", "", "yaml", `"- item"`},
+		{"a: b", "", "yaml", `"a: b"`},
+		{"postgres://db:5432/app", "url", "yaml", "postgres://db:5432/app"},
+		{"30s", "duration", "yaml", "30s"},
+		{"8080", "", "json", `"8080"`},
+		{"8080", "integer", "json", "8080"},
+		{"t", "boolean", "json", "true"},
+		{"{\n  \"a\": [1, 2]\n}", "json", "json", `{"a":[1,2]}`},
+		{"", "integer", "json", `""`},
+	}
+	for _, tt := range tests {
+		got, err := encodeValue(tt.value, tt.typ, tt.format)
+		if err != nil || got != tt.want {
+			t.Errorf("encodeValue(%q, %q, %q) = %q, %v; want %q", tt.value, tt.typ, tt.format, got, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ value, typ, format, want string }{
+		{"abc", "integer", "yaml", `expected integer, got "abc"`},
+		{"5 minutes", "duration", "dotenv", `expected duration, got "5 minutes"`},
+		{"{a:1}", "json", "json", `expected json, got "{a:1}"`},
+		{"line1\nline2", "", "docker", "multiline values are not supported"},
+	} {
+		if _, err := encodeValue(tt.value, tt.typ, tt.format); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("encodeValue(%q, %q, %q): expected error %q, got %v", tt.value, tt.typ, tt.format, tt.want, err)
+		}
+	}
+}
+
+func TestSetAndFmtTypes(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("# denv:type=integer\nPORT=80\n# denv:type=boolean\nDEBUG=1\n# denv:type=json\nFLAGS={\"beta\": true}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) error {
+		return createEditApp().Run(append([]string{"denv", "-f", envFile}, args...))
+	}
+
+	if err := run("set", "PORT", "http"); exitCode(err) != exitValidation || !strings.Contains(err.Error(), `PORT: expected integer, got "http"`) {
+		t.Errorf("expected a type error, got %v", err)
+	}
+	if err := run("set", "--type", "url", "PORT", "http://x"); err == nil || !strings.Contains(err.Error(), "PORT is annotated as integer, not url") {
+		t.Errorf("expected a conflicting type error, got %v", err)
+	}
+	if err := run("set", "--type", "time", "WHEN", "now"); err == nil || !strings.Contains(err.Error(), `unknown type "time"`) {
+		t.Errorf("expected an unknown type error, got %v", err)
+	}
+	if err := run("set", "--type", "boolean", "VERBOSE", "YES"); exitCode(err) != exitValidation {
+		t.Errorf("expected YES to be rejected as a boolean, got %v", err)
+	}
+	if err := run("set", "PORT", "8080"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("set", "--type", "duration", "TIMEOUT", "1m30s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("fmt"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(envFile)
+	want := "# denv:type=integer\nPORT=8080\n# denv:type=boolean\nDEBUG=true\n# denv:type=json\nFLAGS='{\"beta\": true}'\n# denv:type=duration\nTIMEOUT=1m30s\n"
+	if string(data) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, data)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	src := "# denv:type=integer\nPORT=8080\n# denv:type=boolean\nDEBUG=1\n# denv:type=json\nFLAGS='{\"beta\": true}'\nNAME=no\nVERSION=1.10\n"
+	if err := os.WriteFile(envFile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(to string) (string, error) {
+		var buf bytes.Buffer
+		app, _ := newApp()
+		app.Writer = &buf
+		app.Commands = []*cli.Command{{
+			Name:   "convert",
+			Flags:  []cli.Flag{&cli.StringFlag{Name: "to"}, &cli.StringFlag{Name: "output"}},
+			Action: runConvert,
+		}}
+		err := app.Run([]string{"denv", "-f", envFile, "convert", "--to", to})
+		return buf.String(), err
+	}
+
+	tests := map[string]string{
+		"yaml":   "DEBUG: true\nFLAGS: \"{\\\"beta\\\": true}\"\nNAME: \"no\"\nPORT: 8080\nVERSION: \"1.10\"\n",
+		"json":   "{\n  \"DEBUG\": true,\n  \"FLAGS\": {\n    \"beta\": true\n  },\n  \"NAME\": \"no\",\n  \"PORT\": 8080,\n  \"VERSION\": \"1.10\"\n}\n",
+		"docker": "DEBUG=true\nFLAGS={\"beta\":true}\nNAME=no\nPORT=8080\nVERSION=1.10\n",
+		"dotenv": "DEBUG=true\nFLAGS='{\"beta\": true}'\nNAME=no\nPORT=8080\nVERSION=1.10\n",
+	}
+	for to, want := range tests {
+		if got, err := run(to); err != nil || got != want {
+			t.Errorf("--to %s: expected\n%s\ngot\n%s (%v)", to, want, got, err)
+		}
+	}
+
+	if _, err := run("toml"); err == nil || !strings.Contains(err.Error(), `unsupported format "toml"`) {
+		t.Errorf("expected an unsupported format error, got %v", err)
+	}
+	if err := os.WriteFile(envFile, []byte("# denv:type=integer\nPORT=http\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("yaml"); exitCode(err) != exitValidation {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// validateProblem is a finding of denv validate. Check names the rule:
+// contract (denv: annotations), unresolved, required, unused or missing.
+type validateProblem struct {
+	Level   string `json:"level"`
+	Check   string `json:"check"`
+	Key     string `json:"key"`
+	Source  string `json:"source,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p validateProblem) location() string {
+	switch {
+	case p.Line > 0:
+		return fmt.Sprintf("%s:%d", p.Source, p.Line)
+	case p.Source != "":
+		return p.Source
+	}
+	return "environment"
+}
+
+type validateReport struct {
+	Valid    bool              `json:"valid"`
+	Problems []validateProblem `json:"problems"`
+}
+
+// placeholderValues are values that stand in for a real one in copied
+// example files.
+var placeholderValues = []string{"changeme", "change-me", "change_me", "todo", "tbd", "fixme", "placeholder", "xxx", "null", "none", "undefined"}
+
+// obviouslyEmpty reports whether v is blank or a placeholder such as
+// "changeme", "<your-token>" or a pair of quotes.
+func obviouslyEmpty(v string) bool {
+	v = strings.TrimSpace(v)
+	switch {
+	case v == "", v == `""`, v == "''":
+		return true
+	case strings.HasPrefix(v, "<") && strings.HasSuffix(v, ">"):
+		return true
+	}
+	return slices.Contains(placeholderValues, strings.ToLower(v))
+}
+
+// contractKeys reads the keys expected by a JSON Schema (as written by
+// schema export) or, for any other file, an env template such as
+// .env.example; required lists the keys a schema requires.
+func contractKeys(path string) (keys map[string]bool, required []string, err error) {
+	keys = make(map[string]bool)
+	if strings.HasSuffix(path, ".json") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		var schema jsonSchema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return nil, nil, fmt.Errorf("%s: invalid JSON Schema: %w", path, err)
+		}
+		for k := range schema.Properties {
+			keys[k] = true
+		}
+		return keys, schema.Required, nil
+	}
+
+	path, format, err := splitFormat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	env, _, err := readEnvFile(path, parseOptions{Format: format, Encoding: "auto"})
+	if err != nil {
+		return nil, nil, err
+	}
+	for k := range env {
+		keys[k] = true
+	}
+	return keys, nil, nil
+}
+
+// runValidate checks the merged environment for annotation violations,
+// references to variables defined nowhere, required keys with blank or
+// placeholder values and, given --schema or --template, keys the contract
+// does not list. Warnings fail only with --strict.
+func runValidate(c *cli.Context) error {
+	output := c.String("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unsupported output format: %s", output)
+	}
+	envMap, origins, err := loadEnvOrigins(c)
+	if err != nil {
+		return err
+	}
+
+	// Locate the assignment each key was last defined by.
+	lines := make(map[string]int)
+	var unresolved []validateProblem
+	for _, file := range envFiles(c) {
+		for _, e := range fileEntries(c, file) {
+			if origins[e.Key] == file.String() {
+				lines[e.Key] = e.Line
+			}
+			for _, name := range e.Unresolved {
+				if _, ok := envMap[name]; !ok {
+					unresolved = append(unresolved, validateProblem{
+						Level: "error", Check: "unresolved", Key: e.Key, Source: file.String(), Line: e.Line,
+						Message: fmt.Sprintf("%s references %s, which is not defined anywhere", e.Key, name),
+					})
+				}
+			}
+		}
+	}
+	problem := func(level, check, key, format string, args ...any) validateProblem {
+		p := validateProblem{Level: level, Check: check, Key: key, Message: fmt.Sprintf(format, args...)}
+		if origin := origins[key]; origin != sourceEnvironment {
+			p.Source, p.Line = origin, lines[key]
+		}
+		return p
+	}
+
+	specs, err := annotatedSpecs(c, envMap)
+	if err != nil {
+		return err
+	}
+	required := make(map[string]bool)
+	for k, spec := range specs {
+		if spec.Required {
+			required[k] = true
+		}
+	}
+
+	var expected map[string]bool
+	var contract []string
+	for _, flag := range []string{"schema", "template"} {
+		path := c.String(flag)
+		if path == "" {
+			continue
+		}
+		keys, req, err := contractKeys(path)
+		if err != nil {
+			return err
+		}
+		if expected == nil {
+			expected = make(map[string]bool)
+		}
+		maps.Copy(expected, keys)
+		contract = append(contract, path)
+		for _, k := range req {
+			required[k] = true
+		}
+	}
+
+	var problems []validateProblem
+	for _, k := range sortedKeys(envMap) {
+		v := envMap[k]
+		if err := specs[k].validate(v); err != nil {
+			problems = append(problems, problem("error", "contract", k, "%s: %v", k, err))
+		} else if required[k] && obviouslyEmpty(v) {
+			problems = append(problems, problem("error", "required", k, "%s is required but has the placeholder value %q", k, v))
+		}
+		if expected != nil && !expected[k] && origins[k] != sourceEnvironment {
+			problems = append(problems, problem("warning", "unused", k, "%s is not in %s", k, strings.Join(contract, " or ")))
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(required)) {
+		if _, ok := envMap[k]; !ok {
+			// Only a schema can require keys that are not defined.
+			problems = append(problems, validateProblem{Level: "error", Check: "missing", Key: k, Source: c.String("schema"), Message: fmt.Sprintf("%s is required but not defined", k)})
+		}
+	}
+	problems = append(problems, unresolved...)
+
+	failed := 0
+	for _, p := range problems {
+		if p.Level == "error" || c.Bool("strict") {
+			failed++
+		}
+	}
+	if output == "json" {
+		if problems == nil {
+			problems = []validateProblem{}
+		}
+		if err := writeJSON(c, c.App.Writer, validateReport{Valid: failed == 0, Problems: problems}, true); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Fprintf(c.App.Writer, "%s: %s: %s\n", p.Level, p.location(), p.Message)
+		}
+		if len(problems) == 0 {
+			fmt.Fprintln(humanWriter(c), "No problems found")
+		}
+	}
+	if failed > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("validation found %d problem(s)", failed))
+	}
+	return nil
+}
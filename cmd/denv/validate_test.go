@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func createValidateApp() *cli.App {
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "validate",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "schema"},
+				&cli.StringFlag{Name: "template"},
+				&cli.BoolFlag{Name: "strict"},
+				&cli.StringFlag{Name: "output", Value: "text"},
+			},
+			Action: runValidate,
+		},
+	}
+	return app
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	files := map[string]string{
+		".env": "# denv:type=integer\nPORT=80a\n" +
+			"# denv:required\nAPI_KEY=changeme\n" +
+			"API_URL=${BASE_URL}/v1\n" +
+			"CACHE_URL=${REDIS_URL}\n" +
+			"EXTRA=1\n",
+		".env.local":   "REDIS_URL=redis://localhost\n",
+		".env.example": "PORT=\nAPI_KEY=\nAPI_URL=\nCACHE_URL=\nREDIS_URL=\n",
+		"schema.json":  `{"properties":{"PORT":{"type":"string"},"DB_URL":{"type":"string"}},"required":["DB_URL","PORT"]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		app := createValidateApp()
+		app.Writer = &buf
+		err := app.Run(append([]string{"denv", "--isolate", "-f", ".env", "-f", ".env.local", "validate"}, args...))
+		return buf.String(), err
+	}
+
+	out, err := run("--template", ".env.example")
+	want := "error: .env:4: API_KEY is required but has the placeholder value \"changeme\"\n" +
+		"warning: .env:7: EXTRA is not in .env.example\n" +
+		"error: .env:2: PORT: expected integer, got \"80a\"\n" +
+		"error: .env:5: API_URL references BASE_URL, which is not defined anywhere\n"
+	if out != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out)
+	}
+	if exitCode(err) != exitValidation {
+		t.Errorf("expected exit code %d, got %v", exitValidation, err)
+	}
+
+	out, _ = run("--schema", "schema.json", "--output", "json")
+	var report validateReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	var checks []string
+	for _, p := range report.Problems {
+		checks = append(checks, p.Key+":"+p.Check)
+	}
+	wantChecks := []string{"API_KEY:required", "API_KEY:unused", "API_URL:unused", "CACHE_URL:unused", "EXTRA:unused", "PORT:contract", "REDIS_URL:unused", "DB_URL:missing", "API_URL:unresolved"}
+	if report.Valid || !reflect.DeepEqual(checks, wantChecks) {
+		t.Errorf("expected problems %v, got %v", wantChecks, checks)
+	}
+
+	if err := os.WriteFile(".env", []byte("PORT=80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".env.example", []byte("PORT=\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := run("--template", ".env.example"); err != nil || out != "warning: .env.local:1: REDIS_URL is not in .env.example\n" {
+		t.Errorf("expected warnings to pass, got %q (%v)", out, err)
+	}
+	if _, err := run("--template", ".env.example", "--strict"); exitCode(err) != exitValidation {
+		t.Errorf("expected --strict to fail on warnings, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+type vaultClient struct {
+	addr      string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+// newVaultClient builds a client from the vault-* flags. When no token is
+// given it logs in with AppRole; --vault-renew extends the token's lease.
+func newVaultClient(c *cli.Context) (*vaultClient, error) {
+	addr := strings.TrimRight(c.String("vault-addr"), "/")
+	if addr == "" {
+		return nil, fmt.Errorf("vault address is required (--vault-addr or VAULT_ADDR)")
+	}
+
+	v := &vaultClient{
+		addr:      addr,
+		token:     c.String("vault-token"),
+		namespace: c.String("vault-namespace"),
+		http:      &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if v.token == "" {
+		roleID := c.String("vault-role-id")
+		if roleID == "" {
+			return nil, fmt.Errorf("vault token or AppRole role ID is required")
+		}
+		if err := v.loginAppRole(roleID, c.String("vault-secret-id")); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Bool("vault-renew") {
+		if err := v.renewSelf(); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+type vaultResponse struct {
+	Auth struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Data struct {
+		Data map[string]any `json:"data"`
+		Keys []string       `json:"keys"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func (v *vaultClient) do(ctx context.Context, method, path string, body any) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+"/v1/"+strings.TrimLeft(path, "/"), reader)
+	if err != nil {
+		return nil, err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out vaultResponse
+	if resp.StatusCode == http.StatusNoContent {
+		return &out, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("vault %s %s: invalid response: %w", method, path, err)
+	}
+	if resp.StatusCode >= 300 {
+		msg := resp.Status
+		if len(out.Errors) > 0 {
+			msg = strings.Join(out.Errors, "; ")
+		}
+		return nil, fmt.Errorf("vault %s %s: %s", method, path, msg)
+	}
+
+	return &out, nil
+}
+
+func (v *vaultClient) loginAppRole(roleID, secretID string) error {
+	resp, err := v.do(context.Background(), http.MethodPost, "auth/approle/login", map[string]string{
+		"role_id":   roleID,
+		"secret_id": secretID,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Auth.ClientToken == "" {
+		return fmt.Errorf("vault AppRole login returned no token")
+	}
+	v.token = resp.Auth.ClientToken
+	return nil
+}
+
+func (v *vaultClient) renewSelf() error {
+	_, err := v.do(context.Background(), http.MethodPost, "auth/token/renew-self", map[string]string{})
+	return err
+}
+
+// readPath imports a KV v2 secret. A path ending in "/" is treated as a
+// directory: every secret below it is read and merged in lexical order.
+func (v *vaultClient) readPath(ctx context.Context, path string) (map[string]string, error) {
+	path = strings.Trim(path, " ")
+	if !strings.HasSuffix(path, "/") {
+		return v.readSecret(ctx, path)
+	}
+
+	secrets, err := v.listSecrets(ctx, strings.TrimSuffix(path, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string)
+	for _, secret := range secrets {
+		loaded, err := v.readSecret(ctx, secret)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(env, loaded)
+	}
+	return env, nil
+}
+
+// writeSecretField sets a single field of a KV v2 secret, keeping the other
+// fields.
+func (v *vaultClient) writeSecretField(path, field, value string) error {
+	_, err := v.do(context.Background(), http.MethodPatch, path, map[string]any{"data": map[string]string{field: value}})
+	return err
+}
+
+func (v *vaultClient) readSecret(ctx context.Context, path string) (map[string]string, error) {
+	resp, err := v.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string, len(resp.Data.Data))
+	for k, val := range resp.Data.Data {
+		if s, ok := val.(string); ok {
+			env[k] = s
+			continue
+		}
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		env[k] = string(data)
+	}
+	return env, nil
+}
+
+// listSecrets recursively lists the secrets under a "<mount>/data/<dir>"
+// path using the metadata endpoint and returns their data paths.
+func (v *vaultClient) listSecrets(ctx context.Context, dataPath string) ([]string, error) {
+	mount, dir, ok := strings.Cut(dataPath+"/", "/data/")
+	if !ok {
+		return nil, fmt.Errorf("vault path %q is not a KV v2 data path (expected <mount>/data/...)", dataPath)
+	}
+
+	resp, err := v.do(ctx, "LIST", mount+"/metadata/"+strings.TrimSuffix(dir, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := resp.Data.Keys
+	sort.Strings(keys)
+
+	var secrets []string
+	for _, key := range keys {
+		child := dataPath + "/" + strings.TrimSuffix(key, "/")
+		if strings.HasSuffix(key, "/") {
+			nested, err := v.listSecrets(ctx, child)
+			if err != nil {
+				return nil, err
+			}
+			secrets = append(secrets, nested...)
+			continue
+		}
+		secrets = append(secrets, child)
+	}
+	return secrets, nil
+}
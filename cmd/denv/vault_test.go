@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func newFakeVault(t *testing.T) *httptest.Server {
+	secrets := map[string]map[string]any{
+		"/v1/secret/data/myapp":        {"DB_HOST": "db.internal", "PORT": 5432},
+		"/v1/secret/data/myapp/nested": {"API_KEY": "abc"},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			json.NewEncoder(w).Encode(map[string]any{"auth": map[string]string{"client_token": "approle-token"}})
+			return
+		case r.Header.Get("X-Vault-Token") != "root" && r.Header.Get("X-Vault-Token") != "approle-token":
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []string{"permission denied"}})
+			return
+		case r.Header.Get("X-Vault-Namespace") != "team":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case r.Method == "LIST" && r.URL.Path == "/v1/secret/metadata/myapp":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"keys": []string{"nested"}}})
+			return
+		}
+
+		data, ok := secrets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []string{}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": data}})
+	}))
+}
+
+func TestVaultPath(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if envMap["DB_HOST"] != "db.internal" {
+			return fmt.Errorf("expected DB_HOST=db.internal, got %s", envMap["DB_HOST"])
+		}
+		if envMap["PORT"] != "5432" {
+			return fmt.Errorf("expected PORT=5432, got %s", envMap["PORT"])
+		}
+		if envMap["API_KEY"] != "abc" {
+			return fmt.Errorf("expected API_KEY=abc from directory import, got %s", envMap["API_KEY"])
+		}
+		return nil
+	}
+
+	args := []string{"denv", "--isolate", "--vault-addr", srv.URL, "--vault-token", "root", "--vault-namespace", "team",
+		"--vault-path", "secret/data/myapp", "--vault-path", "secret/data/myapp/"}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVaultAppRole(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if envMap["DB_HOST"] != "db.internal" {
+			return fmt.Errorf("expected DB_HOST=db.internal, got %s", envMap["DB_HOST"])
+		}
+		return nil
+	}
+
+	args := []string{"denv", "--isolate", "--vault-addr", srv.URL, "--vault-token", "", "--vault-namespace", "team",
+		"--vault-role-id", "role", "--vault-secret-id", "secret", "--vault-path", "secret/data/myapp"}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVaultPermissionDenied(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		_, err := loadEnv(c)
+		return err
+	}
+
+	args := []string{"denv", "--vault-addr", srv.URL, "--vault-token", "bad", "--vault-path", "secret/data/myapp"}
+	if err := app.Run(args); err == nil {
+		t.Fatal("expected error for rejected token")
+	}
+}
+
+func TestVaultReferencesResolvedLazily(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := "DB_HOST=vault:secret/data/myapp#DB_HOST\nBROKEN=vault:secret/data/missing#KEY\nPORT=8080\n"
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	base := []string{"denv", "--isolate", "--vault-addr", srv.URL, "--vault-token", "root", "--vault-namespace", "team", "--file", envFile}
+
+	app, _ := newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c, "DB_HOST")
+		if err != nil {
+			return err
+		}
+		if envMap["DB_HOST"] != "db.internal" {
+			return fmt.Errorf("expected DB_HOST=db.internal, got %s", envMap["DB_HOST"])
+		}
+		if _, ok := envMap["PORT"]; ok {
+			return fmt.Errorf("expected only the requested key, got %v", envMap)
+		}
+		return nil
+	}
+	if err := app.Run(base); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ = newApp()
+	app.Action = func(c *cli.Context) error {
+		envMap, err := loadEnv(c)
+		if err != nil {
+			return err
+		}
+		if len(envMap) != 1 || envMap["PORT"] != "8080" {
+			return fmt.Errorf("expected only PORT with --only, got %v", envMap)
+		}
+		return nil
+	}
+	if err := app.Run(append(base, "--only", "P*")); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ = newApp()
+	app.Action = func(c *cli.Context) error {
+		_, err := loadEnv(c)
+		return err
+	}
+	if err := app.Run(base); err == nil {
+		t.Fatal("expected error resolving a missing secret when loading all keys")
+	}
+}
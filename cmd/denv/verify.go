@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Methods of --verify.
+const (
+	verifySHA256   = "sha256"
+	verifyMinisign = "minisign"
+	verifyCosign   = "cosign"
+)
+
+// Commands used to check signatures.
+var (
+	minisignCommand = "minisign"
+	cosignCommand   = "cosign"
+)
+
+// signatureSuffixes are the names of detached signatures, relative to the
+// source they sign.
+var signatureSuffixes = map[string]string{
+	verifyMinisign: ".minisig",
+	verifyCosign:   ".sig",
+}
+
+// parseVerify splits a --verify value into its method and argument: the
+// expected hex digest, or the public key of a signature method.
+func parseVerify(spec string) (method, arg string, err error) {
+	method, arg, _ = strings.Cut(spec, ":")
+	switch method {
+	case verifySHA256:
+		if b, err := hex.DecodeString(arg); err != nil || len(b) != sha256.Size {
+			return "", "", fmt.Errorf("invalid --verify %q: expected sha256:<64 hex digits>", spec)
+		}
+		arg = strings.ToLower(arg)
+	case verifyMinisign, verifyCosign:
+		if arg == "" {
+			return "", "", fmt.Errorf("invalid --verify %q: expected %s:<public key>", spec, method)
+		}
+	default:
+		return "", "", fmt.Errorf("invalid --verify %q (expected sha256:, minisign: or cosign:)", spec)
+	}
+	return method, arg, nil
+}
+
+// verifyFlag attaches --verify to the source given right before it.
+type verifyFlag struct {
+	files *[]EnvFile
+}
+
+func (f *verifyFlag) String() string {
+	return ""
+}
+
+func (f *verifyFlag) Set(value string) error {
+	if _, _, err := parseVerify(value); err != nil {
+		return err
+	}
+	files := *f.files
+	if len(files) == 0 || !isVerifiable(files[len(files)-1]) {
+		return errors.New("--verify must follow an s3://, gs:// or git:: source")
+	}
+	files[len(files)-1].Verify = value
+	return nil
+}
+
+// isVerifiable reports whether --verify applies to file.
+func isVerifiable(file EnvFile) bool {
+	return isObjectSource(file) || file.Kind == sourceGit
+}
+
+// verifySource checks fetched content against file.Verify. Signature
+// methods fetch the detached signature with signature, passing the suffix
+// to append to the source, and check it with the signing tool's CLI.
+func verifySource(c *cli.Context, file EnvFile, data []byte, signature func(suffix string) ([]byte, error)) error {
+	method, arg, err := parseVerify(file.Verify)
+	if err != nil {
+		return err
+	}
+	if method == verifySHA256 {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); got != arg {
+			return withExitCode(exitValidation, fmt.Errorf("%s: checksum mismatch: expected sha256:%s, got sha256:%s", file, arg, got))
+		}
+		return nil
+	}
+
+	suffix := signatureSuffixes[method]
+	sig, err := signature(suffix)
+	if err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("%s: cannot read the signature %s%s: %w", file, file, suffix, err))
+	}
+	dir, err := os.MkdirTemp("", "denv-verify-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	content, sigFile := filepath.Join(dir, "content"), filepath.Join(dir, "content"+suffix)
+	if err := os.WriteFile(content, data, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(sigFile, sig, 0600); err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	if method == verifyMinisign {
+		keyFlag := "-P"
+		if _, err := os.Stat(arg); err == nil {
+			keyFlag = "-p"
+		}
+		cmd = exec.Command(minisignCommand, "-V", "-q", keyFlag, arg, "-m", content, "-x", sigFile)
+	} else {
+		cmd = exec.Command(cosignCommand, "verify-blob", "--key", arg, "--signature", sigFile, content)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		return withExitCode(exitValidation, fmt.Errorf("%s: %s signature verification failed: %s", file, method, strings.TrimSpace(string(out))))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseVerify(t *testing.T) {
+	digest := strings.Repeat("AB", 32)
+	for _, tt := range []struct {
+		spec, method, arg string
+		fails             bool
+	}{
+		{spec: "sha256:" + digest, method: verifySHA256, arg: strings.ToLower(digest)},
+		{spec: "minisign:RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3", method: verifyMinisign, arg: "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"},
+		{spec: "cosign:cosign.pub", method: verifyCosign, arg: "cosign.pub"},
+		{spec: "sha256:abc", fails: true},
+		{spec: "md5:" + digest, fails: true},
+		{spec: "cosign:", fails: true},
+	} {
+		method, arg, err := parseVerify(tt.spec)
+		if (err != nil) != tt.fails || method != tt.method || arg != tt.arg {
+			t.Errorf("%s: got %q %q %v", tt.spec, method, arg, err)
+		}
+	}
+}
+
+func TestVerifyRemoteSources(t *testing.T) {
+	content := "PORT=8080\n"
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+
+	aws := writeFakeCommand(t, "aws", `
+case "$1 $2" in
+"s3api head-object") echo '{"ETag":"\"v1\""}' ;;
+"s3 cp")
+  case "$4" in
+  *.minisig) echo "signature" ;;
+  *) printf 'PORT=8080\n' ;;
+  esac ;;
+esac
+`)
+	minisign := writeFakeCommand(t, "minisign", `
+while [ $# -gt 0 ]; do
+  case "$1" in
+  -P) key="$2"; shift ;;
+  -x) sig="$2"; shift ;;
+  esac
+  shift
+done
+[ "$key" = RWgood ] && grep -q signature "$sig" || { echo "Signature verification failed" >&2; exit 1; }
+`)
+	defer func(a, m string) { awsCommand, minisignCommand = a, m }(awsCommand, minisignCommand)
+	awsCommand, minisignCommand = aws, minisign
+
+	cache := filepath.Join(t.TempDir(), "cache")
+	list := func(verify string) (string, int, error) {
+		code := captureExit(t)
+		*code = 0
+		var buf bytes.Buffer
+		app := createRunApp()
+		app.Writer = &buf
+		err := app.Run([]string{"denv", "--isolate", "--cache-dir", cache, "-f", "s3://bucket/prod.env", "--verify", verify, "list"})
+		return buf.String(), exitCode(err), err
+	}
+
+	for _, verify := range []string{"sha256:" + digest, "minisign:RWgood"} {
+		if out, _, err := list(verify); err != nil || out != content {
+			t.Errorf("%s: expected %q, got %q (%v)", verify, content, out, err)
+		}
+	}
+	for _, tt := range []struct{ verify, want string }{
+		{"sha256:" + strings.Repeat("0", 64), "checksum mismatch"},
+		{"minisign:RWbad", "minisign signature verification failed: Signature verification failed"},
+	} {
+		_, code, err := list(tt.verify)
+		if err == nil || !strings.Contains(err.Error(), tt.want) || code != exitValidation {
+			t.Errorf("%s: expected %q with exit code %d, got %v (%d)", tt.verify, tt.want, exitValidation, err, code)
+		}
+	}
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := createRunApp().Run([]string{"denv", "-f", envFile, "--verify", "sha256:" + digest, "list"})
+	if err == nil || !strings.Contains(err.Error(), "--verify must follow") {
+		t.Errorf("expected --verify to be rejected for a local file, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Build metadata, set by release builds with
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=abc1234 -X main.buildDate=2024-05-01T10:00:00Z"
+//
+// Other builds fall back to what the Go toolchain records.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// currentBuild returns the build metadata, filling in what the linker flags
+// did not set from the module version and VCS stamps of the binary.
+func currentBuild() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+func runVersion(c *cli.Context) error {
+	info := currentBuild()
+	switch output := c.String("output"); output {
+	case "json":
+		return writeJSON(c, c.App.Writer, info, false)
+	case "text":
+		fmt.Fprintf(c.App.Writer, "denv %s\n", info.Version)
+		if info.Commit != "" {
+			fmt.Fprintf(c.App.Writer, "commit: %s\n", info.Commit)
+		}
+		if info.BuildDate != "" {
+			fmt.Fprintf(c.App.Writer, "built: %s\n", info.BuildDate)
+		}
+		fmt.Fprintf(c.App.Writer, "go: %s %s\n", info.GoVersion, info.Platform)
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format: %s", output)
+	}
+}
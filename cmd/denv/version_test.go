@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestVersion(t *testing.T) {
+	defer func(v, c, d string) { version, commit, buildDate = v, c, d }(version, commit, buildDate)
+	version, commit, buildDate = "v1.2.0", "abc1234", "2024-05-01T10:00:00Z"
+
+	run := func(output string) string {
+		var buf bytes.Buffer
+		app, _ := newApp()
+		app.Writer = &buf
+		app.Commands = []*cli.Command{{
+			Name:   "version",
+			Flags:  []cli.Flag{&cli.StringFlag{Name: "output", Value: "text"}},
+			Action: runVersion,
+		}}
+		if err := app.Run([]string{"denv", "version", "--output", output}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	var info buildInfo
+	if err := json.Unmarshal([]byte(run("json")), &info); err != nil {
+		t.Fatal(err)
+	}
+	want := buildInfo{Version: "v1.2.0", Commit: "abc1234", BuildDate: "2024-05-01T10:00:00Z", GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if info != want {
+		t.Errorf("expected %+v, got %+v", want, info)
+	}
+	if out := run("text"); !strings.HasPrefix(out, "denv v1.2.0\ncommit: abc1234\nbuilt: 2024-05-01T10:00:00Z\ngo: ") {
+		t.Errorf("unexpected text output %q", out)
+	}
+
+	version = ""
+	if got := currentBuild().Version; got == "" {
+		t.Error("expected a fallback version")
+	}
+}
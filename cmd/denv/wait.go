@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// waitInterval is the pause between attempts to reach a --wait-for target.
+// It is a variable so tests can shorten it.
+var waitInterval = 500 * time.Millisecond
+
+// waitAttemptTimeout bounds a single connection attempt.
+const waitAttemptTimeout = 2 * time.Second
+
+// parseWaitTarget expands $VARS in a --wait-for target from env and checks
+// that it is a tcp://host:port or http(s):// URL.
+func parseWaitTarget(target string, env map[string]string) (*url.URL, error) {
+	u, err := url.Parse(os.Expand(target, func(k string) string { return env[k] }))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --wait-for %s: %w", target, err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("invalid --wait-for %s: expected tcp://HOST:PORT", target)
+		}
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("invalid --wait-for %s: expected tcp://, http:// or https://", target)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid --wait-for %s: missing host", target)
+	}
+	return u, nil
+}
+
+// probe makes one attempt to reach target: a TCP connection, or an HTTP GET
+// answered with a 2xx or 3xx status.
+func probe(ctx context.Context, target *url.URL) error {
+	ctx, cancel := context.WithTimeout(ctx, waitAttemptTimeout)
+	defer cancel()
+	if target.Scheme == "tcp" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", target.Host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// waitForDependencies blocks until every --wait-for target is reachable,
+// failing once --wait-timeout has passed (0 waits indefinitely).
+func waitForDependencies(c *cli.Context, env map[string]string) error {
+	var targets []*url.URL
+	for _, target := range c.StringSlice("wait-for") {
+		u, err := parseWaitTarget(target, env)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, u)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	if timeout := c.Duration("wait-timeout"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for _, target := range targets {
+		for announced := false; ; announced = true {
+			err := probe(ctx, target)
+			if err == nil {
+				break
+			}
+			if !announced {
+				fmt.Fprintf(c.App.ErrWriter, "denv: waiting for %s\n", target.Redacted())
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("timed out after %s waiting for %s: %v", c.Duration("wait-timeout"), target.Redacted(), err)
+			case <-time.After(waitInterval):
+			}
+		}
+	}
+	return nil
+}
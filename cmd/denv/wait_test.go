@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func runWait(t *testing.T, env map[string]string, args ...string) (string, error) {
+	t.Helper()
+	var stderr bytes.Buffer
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{Name: "wait-for"},
+			&cli.DurationFlag{Name: "wait-timeout", Value: 30 * time.Second},
+		},
+		Action: func(c *cli.Context) error {
+			return waitForDependencies(c, env)
+		},
+		ErrWriter: &stderr,
+	}
+	err := app.Run(append([]string{"denv"}, args...))
+	return stderr.String(), err
+}
+
+func TestParseWaitTarget(t *testing.T) {
+	env := map[string]string{"DB_HOST": "db", "DB_PORT": "5432"}
+	u, err := parseWaitTarget("tcp://${DB_HOST}:$DB_PORT", env)
+	if err != nil || u.Host != "db:5432" {
+		t.Errorf("expected db:5432, got %v (%v)", u, err)
+	}
+	for _, target := range []string{"tcp://db", "db:5432", "ftp://db:21", "http://"} {
+		if _, err := parseWaitTarget(target, env); err == nil {
+			t.Errorf("%s: expected an error", target)
+		}
+	}
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	defer func(d time.Duration) { waitInterval = d }(waitInterval)
+	waitInterval = 10 * time.Millisecond
+
+	// The health check fails twice before the service is up.
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	// The port only accepts connections after a while.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	delayed := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l, _ := net.Listen("tcp", addr)
+		delayed <- l
+	}()
+	defer func() {
+		if l := <-delayed; l != nil {
+			l.Close()
+		}
+	}()
+
+	env := map[string]string{"DB_ADDR": addr, "HEALTH_URL": srv.URL + "/health"}
+	stderr, err := runWait(t, env, "--wait-for", "tcp://$DB_ADDR", "--wait-for", "${HEALTH_URL}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 health checks, got %d", calls.Load())
+	}
+	if !strings.Contains(stderr, "denv: waiting for tcp://"+addr+"\n") {
+		t.Errorf("expected a waiting message, got %q", stderr)
+	}
+
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+	_, err = runWait(t, nil, "--wait-for", "tcp://"+closed, "--wait-timeout", "100ms")
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms waiting for tcp://"+closed) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
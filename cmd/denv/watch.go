@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Types of watch events.
+const (
+	watchAdded   = "added"
+	watchChanged = "changed"
+	watchRemoved = "removed"
+	watchError   = "error"
+)
+
+// watchEvent reports a key that changed between two reads of the sources,
+// or a failed read.
+type watchEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Key      string    `json:"key,omitempty"`
+	Value    string    `json:"value,omitempty"`
+	Previous string    `json:"previous,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
+
+// watchSnapshot is a read of the merged sources. Values of Masked keys
+// are compared as they are but reported as maskedValue.
+type watchSnapshot struct {
+	Env     map[string]string
+	Origins map[string]string
+	Masked  map[string]bool
+}
+
+func (s watchSnapshot) value(k string) string {
+	if s.Masked[k] {
+		return maskedValue
+	}
+	return s.Env[k]
+}
+
+// watchEvents returns the events turning prev into next, in key order.
+func watchEvents(prev, next watchSnapshot, now time.Time) []watchEvent {
+	var events []watchEvent
+	for _, k := range sortedKeys(next.Env) {
+		switch old, ok := prev.Env[k]; {
+		case !ok:
+			events = append(events, watchEvent{Time: now, Type: watchAdded, Key: k, Value: next.value(k), Source: next.Origins[k]})
+		case old != next.Env[k]:
+			events = append(events, watchEvent{Time: now, Type: watchChanged, Key: k, Value: next.value(k), Previous: prev.value(k), Source: next.Origins[k]})
+		}
+	}
+	for _, k := range sortedKeys(prev.Env) {
+		if _, ok := next.Env[k]; !ok {
+			events = append(events, watchEvent{Time: now, Type: watchRemoved, Key: k, Previous: prev.value(k), Source: prev.Origins[k]})
+		}
+	}
+	return events
+}
+
+// watchSources reads the sources every interval until ctx is done and calls
+// emit with the changes. The first read only sets the baseline unless
+// initial is set, in which case every key is reported as added. Errors are
+// reported once until a read succeeds again.
+func watchSources(ctx context.Context, load func() (watchSnapshot, error), interval time.Duration, initial bool, emit func(watchEvent) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var current watchSnapshot
+	loaded := false
+	lastErr := ""
+	for {
+		next, err := load()
+		switch {
+		case err != nil:
+			if err.Error() != lastErr {
+				lastErr = err.Error()
+				if err := emit(watchEvent{Time: time.Now(), Type: watchError, Message: lastErr}); err != nil {
+					return err
+				}
+			}
+		case !loaded && !initial:
+			lastErr = ""
+			current, loaded = next, true
+		default:
+			lastErr = ""
+			for _, e := range watchEvents(current, next, time.Now()) {
+				if err := emit(e); err != nil {
+					return err
+				}
+			}
+			current, loaded = next, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runWatch prints an event for every key added, changed or removed in the
+// merged sources until interrupted. Likely secrets are masked unless
+// --show-secrets is set.
+func runWatch(c *cli.Context) error {
+	output := c.String("output")
+	if output != "text" && output != "ndjson" {
+		return fmt.Errorf("unsupported output format: %s", output)
+	}
+	interval := c.Duration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	load := func() (watchSnapshot, error) {
+		envMap, origins, err := mergeSources(c, nil)
+		if err != nil {
+			return watchSnapshot{}, err
+		}
+		snapshot := watchSnapshot{Env: envMap, Origins: origins}
+		if !c.Bool("show-secrets") {
+			snapshot.Masked = secretKeys(c, envMap, origins, defaultSecretKeys)
+		}
+		return snapshot, nil
+	}
+
+	enc := json.NewEncoder(c.App.Writer)
+	emit := func(e watchEvent) error {
+		if output == "ndjson" {
+			return enc.Encode(e)
+		}
+		var err error
+		switch e.Type {
+		case watchAdded:
+			_, err = fmt.Fprintf(c.App.Writer, "+ %s=%s\n", e.Key, e.Value)
+		case watchChanged:
+			_, err = fmt.Fprintf(c.App.Writer, "~ %s: %s -> %s\n", e.Key, e.Previous, e.Value)
+		case watchRemoved:
+			_, err = fmt.Fprintf(c.App.Writer, "- %s\n", e.Key)
+		default:
+			_, err = fmt.Fprintf(c.App.ErrWriter, "Error: %s\n", e.Message)
+		}
+		return err
+	}
+	return watchSources(c.Context, load, interval, c.Bool("initial"), emit)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestWatchSources(t *testing.T) {
+	snapshot := func(env map[string]string) watchSnapshot {
+		origins := make(map[string]string)
+		for k := range env {
+			origins[k] = ".env"
+		}
+		return watchSnapshot{Env: env, Origins: origins, Masked: map[string]bool{"TOKEN": true}}
+	}
+	reads := []struct {
+		snapshot watchSnapshot
+		err      error
+	}{
+		{snapshot: snapshot(map[string]string{"PORT": "80", "TOKEN": "a", "OLD": "1"})},
+		{err: errors.New("broken")},
+		{err: errors.New("broken")},
+		{snapshot: snapshot(map[string]string{"PORT": "8080", "TOKEN": "b", "NEW": "x"})},
+		{snapshot: snapshot(map[string]string{"PORT": "8080", "TOKEN": "b", "NEW": "x"})},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	load := func() (watchSnapshot, error) {
+		r := reads[n]
+		if n++; n == len(reads) {
+			cancel()
+		}
+		return r.snapshot, r.err
+	}
+	var got []string
+	emit := func(e watchEvent) error {
+		got = append(got, strings.Join([]string{e.Type, e.Key, e.Previous, e.Value, e.Source, e.Message}, "|"))
+		return nil
+	}
+	if err := watchSources(ctx, load, time.Millisecond, false, emit); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"error|||||broken",
+		"added|NEW||x|.env|",
+		"changed|PORT|80|8080|.env|",
+		"changed|TOKEN|***|***|.env|",
+		"removed|OLD|1||.env|",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events\n%v\ngot\n%v", want, got)
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=80\nAPI_TOKEN=secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		app, _ := newApp()
+		app.Writer = &buf
+		app.Commands = []*cli.Command{{
+			Name: "watch",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "output", Value: "text"},
+				&cli.DurationFlag{Name: "interval", Value: time.Second},
+				&cli.BoolFlag{Name: "initial"},
+			},
+			Action: runWatch,
+		}}
+		// A cancelled context stops watching after the first read.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := app.RunContext(ctx, append([]string{"denv", "-f", envFile, "watch"}, args...))
+		return buf.String(), err
+	}
+
+	if out, err := run("--initial"); err != nil || out != "+ API_TOKEN=***\n+ PORT=80\n" {
+		t.Errorf("unexpected output %q (%v)", out, err)
+	}
+	if out, err := run(); err != nil || out != "" {
+		t.Errorf("expected no events without --initial, got %q (%v)", out, err)
+	}
+
+	out, err := run("--initial", "--output", "ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event watchEvent
+	if err := json.Unmarshal([]byte(strings.Split(out, "\n")[1]), &event); err != nil {
+		t.Fatalf("invalid event %q: %v", out, err)
+	}
+	if event.Type != watchAdded || event.Key != "PORT" || event.Value != "80" || event.Source != envFile || event.Time.IsZero() {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	if _, err := run("--interval", "0s"); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
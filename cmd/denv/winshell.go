@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cmdSetLine sets a variable in a cmd.exe batch file. Inside the quotes of
+// set "KEY=value" only % is special and is doubled, which cmd.exe undoes in
+// batch files only. A " would end the quotes early and leave the rest of the
+// line to run as a command, and cmd.exe has no way to escape it there or to
+// write line breaks, so such values are rejected.
+func cmdSetLine(key, value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return "", fmt.Errorf("%s: cmd.exe cannot set values containing line breaks", key)
+	}
+	if strings.Contains(key+value, `"`) {
+		return "", fmt.Errorf("%s: cmd.exe cannot set values containing double quotes", key)
+	}
+	return `set "` + key + "=" + strings.ReplaceAll(value, "%", "%%") + `"`, nil
+}
+
+// ps1SetLine sets a variable in a PowerShell session. Single-quoted strings
+// are literal except for quotes, which are doubled, including the curly
+// quotes PowerShell also accepts. In ${env:KEY} a backtick escapes } and
+// itself.
+func ps1SetLine(key, value string) string {
+	var sb strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			sb.WriteRune(r)
+		}
+		sb.WriteRune(r)
+	}
+	key = strings.NewReplacer("`", "``", "}", "`}").Replace(key)
+	return "${env:" + key + "} = '" + sb.String() + "'"
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestCmdSetLine(t *testing.T) {
+	for value, want := range map[string]string{
+		"8080":        `set "PORT=8080"`,
+		"50%":         `set "PORT=50%%"`,
+		`a & b | c ^`: `set "PORT=a & b | c ^"`,
+		"":            `set "PORT="`,
+	} {
+		if got, err := cmdSetLine("PORT", value); err != nil || got != want {
+			t.Errorf("cmdSetLine(%q) = %q (%v), want %q", value, got, err, want)
+		}
+	}
+	if _, err := cmdSetLine("KEY", "-----BEGIN\nKEY-----"); err == nil {
+		t.Error("expected an error for a multiline value")
+	}
+	if _, err := cmdSetLine("KEY", `a"&calc&"b`); err == nil {
+		t.Error("expected an error for a value with a double quote")
+	}
+}
+
+func TestPS1SetLine(t *testing.T) {
+	for value, want := range map[string]string{
+		"8080":             `${env:PORT} = '8080'`,
+		`it's $HOME`:       `${env:PORT} = 'it''s $HOME'`,
+		"curly ’quote’":    "${env:PORT} = 'curly ’’quote’’'",
+		"line1\nline2`$()": "${env:PORT} = 'line1\nline2`$()'",
+	} {
+		if got := ps1SetLine("PORT", value); got != want {
+			t.Errorf("ps1SetLine(%q) = %q, want %q", value, got, want)
+		}
+	}
+	if got, want := ps1SetLine("A}B`C", "x"), "${env:A`}B``C} = 'x'"; got != want {
+		t.Errorf("ps1SetLine with a brace in the key = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// wrapSkippedFlags are global flags not baked into wrappers: sources are
+// written from envFiles in order, including the ones added by --local,
+// credentials must not end up in a script that may be committed, and
+// temporary variables must expire.
+var wrapSkippedFlags = []string{
+	"config", "env-ttl", "file", "file-optional", "local", "vault-path", "k8s-secret", "k8s-configmap",
+	"op-vault", "vault-token", "vault-secret-id", "op-connect-token",
+	"verify", "source-timeout", "source-retries", "source-on-error",
+}
+
+// wrapArg is a wrapper argument; paths are made relative to the wrapper so
+// it works from any checkout location. The suffix, such as a ?format= of a
+// file source, follows the path unchanged.
+type wrapArg struct {
+	value  string
+	path   bool
+	suffix string
+}
+
+// wrapArgs reconstructs the global flags of the current invocation. Sources
+// from the project config are passed as --config rather than one by one.
+func wrapArgs(c *cli.Context) []wrapArg {
+	var args []wrapArg
+	if cfg := loadedConfig(c); cfg.Path != "" {
+		args = append(args, wrapArg{value: "--config"}, wrapArg{value: cfg.Path, path: true})
+	}
+	for _, file := range envFiles(c) {
+		switch {
+		case file.FromConfig, file.Kind == sourceTemporary:
+			continue
+		case file.Kind == sourceVault:
+			args = append(args, wrapArg{value: "--vault-path"}, wrapArg{value: file.Path})
+		case file.Kind == sourceK8sSecret:
+			args = append(args, wrapArg{value: "--k8s-secret"}, wrapArg{value: file.Path})
+		case file.Kind == sourceK8sConfigMap:
+			args = append(args, wrapArg{value: "--k8s-configmap"}, wrapArg{value: file.Path})
+		case file.Kind == sourceOnePassword:
+			args = append(args, wrapArg{value: "--op-vault"}, wrapArg{value: file.Path})
+		case file.Kind == sourceGit && file.Optional:
+			args = append(args, wrapArg{value: "--file-optional"}, wrapArg{value: file.String() + gitFormatParam(file)})
+		case file.Kind == sourceGit:
+			args = append(args, wrapArg{value: "--file"}, wrapArg{value: file.String() + gitFormatParam(file)})
+		case isObjectSource(file) && file.Optional:
+			args = append(args, wrapArg{value: "--file-optional"}, wrapArg{value: file.String() + formatSuffix(file)})
+		case isObjectSource(file):
+			args = append(args, wrapArg{value: "--file"}, wrapArg{value: file.String() + formatSuffix(file)})
+		case file.Optional:
+			args = append(args, wrapArg{value: "--file-optional"}, wrapArg{value: file.Path, path: true, suffix: formatSuffix(file)})
+		default:
+			args = append(args, wrapArg{value: "--file"}, wrapArg{value: file.Path, path: true, suffix: formatSuffix(file)})
+		}
+		if file.Verify != "" {
+			args = append(args, wrapArg{value: "--verify"}, wrapArg{value: file.Verify})
+		}
+		if p := file.Policy; p.Timeout > 0 {
+			args = append(args, wrapArg{value: "--source-timeout"}, wrapArg{value: p.Timeout.String()})
+		}
+		if p := file.Policy; p.Retries > 0 {
+			args = append(args, wrapArg{value: "--source-retries"}, wrapArg{value: strconv.Itoa(p.Retries)})
+		}
+		if p := file.Policy; p.OnError != "" {
+			args = append(args, wrapArg{value: "--source-on-error"}, wrapArg{value: p.OnError})
+		}
+	}
+
+	for _, flag := range c.App.Flags {
+		name := flag.Names()[0]
+		if slices.Contains(wrapSkippedFlags, name) || !setOnCommandLine(c, flag) {
+			continue
+		}
+		switch flag.(type) {
+		case *cli.BoolFlag:
+			if c.Bool(name) {
+				args = append(args, wrapArg{value: "--" + name})
+			}
+		case *cli.StringSliceFlag:
+			for _, v := range c.StringSlice(name) {
+				args = append(args, wrapArg{value: "--" + name + "=" + v})
+			}
+		case *cli.GenericFlag:
+			if f, ok := c.Generic(name).(*isolateFlag); ok {
+				if f.Setting == "true" {
+					args = append(args, wrapArg{value: "--" + name})
+				} else {
+					args = append(args, wrapArg{value: "--" + name + "=" + f.Setting})
+				}
+				continue
+			}
+			args = append(args, wrapArg{value: fmt.Sprintf("--%s=%v", name, c.Generic(name))})
+		default:
+			args = append(args, wrapArg{value: fmt.Sprintf("--%s=%v", name, c.Value(name))})
+		}
+	}
+	return args
+}
+
+// setOnCommandLine reports whether flag was given on the command line.
+// c.IsSet also holds for flags taken from environment variables, which
+// belong to the user running wrap rather than to the wrapper, so when one
+// of those is set the flag must also appear in the arguments.
+func setOnCommandLine(c *cli.Context, flag cli.Flag) bool {
+	if !c.IsSet(flag.Names()[0]) {
+		return false
+	}
+	fromEnv := false
+	if f, ok := flag.(cli.DocGenerationFlag); ok {
+		for _, name := range f.GetEnvVars() {
+			if _, ok := os.LookupEnv(name); ok {
+				fromEnv = true
+			}
+		}
+	}
+	if !fromEnv {
+		return true
+	}
+	for _, arg := range os.Args[1:] {
+		if arg == "--" {
+			break
+		}
+		arg, _, _ = strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if slices.Contains(flag.Names(), arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func runWrap(c *cli.Context) error {
+	out := c.String("out")
+	if out == "" {
+		return fmt.Errorf("--out is required")
+	}
+	if c.NArg() == 0 {
+		return fmt.Errorf("no command specified")
+	}
+
+	format := c.String("format")
+	if format == "" {
+		format = "sh"
+		if runtime.GOOS == "windows" {
+			format = "bat"
+		}
+	}
+
+	outDir, err := filepath.Abs(filepath.Dir(out))
+	if err != nil {
+		return err
+	}
+	relative := func(path string) (string, error) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Rel(outDir, abs)
+	}
+
+	args := wrapArgs(c)
+	args = append(args, wrapArg{value: "exec"}, wrapArg{value: "--"})
+	target := c.Args().First()
+	args = append(args, wrapArg{value: target, path: strings.ContainsAny(target, `/\`)})
+	for _, arg := range c.Args().Tail() {
+		args = append(args, wrapArg{value: arg})
+	}
+
+	var script string
+	switch format {
+	case "sh":
+		words := []string{"exec", "denv"}
+		for _, arg := range args {
+			if !arg.path {
+				words = append(words, shellQuote(arg.value))
+				continue
+			}
+			rel, err := relative(arg.value)
+			if err != nil {
+				return err
+			}
+			word := `"$dir"/` + shellQuote(filepath.ToSlash(rel))
+			if arg.suffix != "" {
+				word += shellQuote(arg.suffix)
+			}
+			words = append(words, word)
+		}
+		script = "#!/bin/sh\n" +
+			"# Generated by denv wrap; re-run it to update.\n" +
+			"dir=$(cd \"$(dirname \"$0\")\" && pwd)\n" +
+			strings.Join(words, " ") + " \"$@\"\n"
+	case "bat":
+		// Batch files expand %VAR%, so a literal % is doubled as in
+		// cmdSetLine.
+		quote := strings.NewReplacer(`"`, `""`, "%", "%%")
+		words := []string{"denv"}
+		for _, arg := range args {
+			if !arg.path {
+				words = append(words, `"`+quote.Replace(arg.value)+`"`)
+				continue
+			}
+			rel, err := relative(arg.value)
+			if err != nil {
+				return err
+			}
+			words = append(words, `"%~dp0`+quote.Replace(filepath.FromSlash(rel)+arg.suffix)+`"`)
+		}
+		script = "@echo off\r\n" +
+			"rem Generated by denv wrap; re-run it to update.\r\n" +
+			strings.Join(words, " ") + " %*\r\n" +
+			"exit /b %ERRORLEVEL%\r\n"
+	default:
+		return fmt.Errorf("unsupported --format %q (expected sh or bat)", format)
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(out, []byte(script), 0755)
+}
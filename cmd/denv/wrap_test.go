@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestWrap(t *testing.T) {
+	fakeDenv := writeFakeCommand(t, "denv", `for arg in "$@"; do echo "$arg"; done`)
+	t.Setenv("PATH", filepath.Dir(fakeDenv)+string(os.PathListSeparator)+os.Getenv("PATH"))
+	// Flags from the environment of the user running wrap are not baked in.
+	t.Setenv("DENV_ERROR_FORMAT", "json")
+
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, "config", ".env")
+	out := filepath.Join(tmpDir, "bin", "app")
+
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "wrap",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "out"},
+				&cli.StringFlag{Name: "format", Value: "sh"},
+			},
+			Action: runWrap,
+		},
+	}
+	args := []string{"denv", "-f", envFile, "--isolate", "--vault-token", "s3cret", "--only", "APP_*",
+		"wrap", "--out", out, "--", filepath.Join(tmpDir, "server"), "--port", "it's"}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(script), "s3cret") {
+		t.Errorf("wrapper must not contain credentials:\n%s", script)
+	}
+
+	// Run the wrapper from another directory with the fake denv.
+	cmd := exec.Command(out, "extra arg")
+	cmd.Dir = t.TempDir()
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("wrapper failed: %v\n%s", err, script)
+	}
+
+	resolved, err := filepath.EvalSymlinks(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"--file", resolved + "/bin/../config/.env",
+		"--isolate", "--only=APP_*",
+		"exec", "--", resolved + "/bin/../server", "--port", "it's", "extra arg",
+	}
+	got := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected args:\n%q\ngot:\n%q\nscript:\n%s", want, got, script)
+	}
+}
+
+func TestWrapBat(t *testing.T) {
+	tmpDir := t.TempDir()
+	out := filepath.Join(tmpDir, "app.bat")
+
+	app, _ := newApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "wrap",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "out"},
+				&cli.StringFlag{Name: "format"},
+			},
+			Action: runWrap,
+		},
+	}
+	args := []string{"denv", "-f", filepath.Join(tmpDir, "100%.env"),
+		"wrap", "--out", out, "--format", "bat", "--", "server", "--ratio", `50% "half"`}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `denv "--file" "%~dp0100%%.env" "exec" "--" "server" "--ratio" "50%% ""half""" %*` + "\r\n"
+	if !strings.Contains(string(script), want) {
+		t.Errorf("expected %q in script:\n%s", want, script)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a significant line of a YAML document.
+type yamlLine struct {
+	no     int
+	indent int
+	text   string
+}
+
+// parseYAML parses the subset of YAML used by denv.yaml: block mappings,
+// block sequences and single-line scalars (plain, single or double quoted).
+// Scalars are returned as strings, mappings as map[string]any and
+// sequences as []any; empty values are nil.
+func parseYAML(data []byte) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, &parseError{Line: i + 1, Err: fmt.Errorf("tabs are not allowed for indentation")}
+		}
+		lines = append(lines, yamlLine{no: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	p := &yamlParser{lines: lines}
+	v, err := p.node(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(lines) {
+		return nil, &parseError{Line: lines[p.pos].no, Err: fmt.Errorf("unexpected indentation")}
+	}
+	return v, nil
+}
+
+// stripYAMLComment removes a # comment that starts a line or follows
+// whitespace outside of quotes.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch b := s[i]; {
+		case quote == '"' && b == '\\':
+			i++
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case (b == '"' || b == '\'') && (i == 0 || s[i-1] == ' '):
+			quote = b
+		case b == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" lines; ok is false for other text.
+func splitYAMLKey(text string) (key, value string, ok bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		return "", "", false
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(text[:len(text)-1]), "", true
+	}
+	key, value, ok = strings.Cut(text, ": ")
+	return strings.TrimSpace(key), strings.TrimSpace(value), ok
+}
+
+func (p *yamlParser) node(indent int) (any, error) {
+	if isYAMLSeqItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	m := make(map[string]any)
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, &parseError{Line: line.no, Err: fmt.Errorf("unexpected indentation")}
+		}
+		if isYAMLSeqItem(line.text) {
+			return nil, &parseError{Line: line.no, Err: fmt.Errorf("expected a key, got a list item")}
+		}
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok || key == "" {
+			return nil, &parseError{Line: line.no, Err: fmt.Errorf("expected \"key: value\"")}
+		}
+		if _, dup := m[key]; dup {
+			return nil, &parseError{Line: line.no, Err: fmt.Errorf("duplicate key %q", key)}
+		}
+		p.pos++
+
+		if value != "" {
+			v, err := yamlScalar(value, line.no)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		// A nested block is indented further, except that sequences may
+		// start at the indentation of their key.
+		m[key] = nil
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || (next.indent == indent && isYAMLSeqItem(next.text)) {
+				v, err := p.node(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			}
+		}
+	}
+	return m, nil
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	var items []any
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isYAMLSeqItem(line.text) {
+			if line.indent > indent {
+				return nil, &parseError{Line: line.no, Err: fmt.Errorf("unexpected indentation")}
+			}
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		switch {
+		case rest == "":
+			p.pos++
+			var item any
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				v, err := p.node(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				item = v
+			}
+			items = append(items, item)
+		case isYAMLSeqItem(rest):
+			return nil, &parseError{Line: line.no, Err: fmt.Errorf("nested inline lists are not supported")}
+		default:
+			if _, _, ok := splitYAMLKey(rest); ok {
+				// "- key: value" starts a mapping indented at its key.
+				p.lines[p.pos] = yamlLine{no: line.no, indent: indent + len(line.text) - len(rest), text: rest}
+				v, err := p.mapping(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, v)
+				continue
+			}
+			v, err := yamlScalar(rest, line.no)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			p.pos++
+		}
+	}
+	return items, nil
+}
+
+func yamlScalar(s string, lineNo int) (any, error) {
+	switch {
+	case s[0] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, &parseError{Line: lineNo, Err: fmt.Errorf("invalid double-quoted string %s", s)}
+		}
+		return v, nil
+	case s[0] == '\'':
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, &parseError{Line: lineNo, Err: fmt.Errorf("unterminated single-quoted string")}
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s[0] == '|' || s[0] == '>':
+		return nil, &parseError{Line: lineNo, Err: fmt.Errorf("block scalars are not supported; use a quoted string")}
+	case s[0] == '[' || s[0] == '{':
+		return nil, &parseError{Line: lineNo, Err: fmt.Errorf("flow collections are not supported; use block style")}
+	case s == "~" || s == "null":
+		return nil, nil
+	}
+	return s, nil
+}
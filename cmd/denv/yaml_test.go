@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	src := `# project config
+files:
+- .env
+- path: .env.local   # comment
+  optional: true
+run:
+  server: go run ./cmd/api
+  quoted: "echo \"hi\" # not a comment"
+  single: 'it''s'
+  plain: it's # comment
+empty:
+nested:
+  - - x
+`
+	if _, err := parseYAML([]byte(src)); err == nil || !strings.Contains(err.Error(), "line 13") {
+		t.Errorf("expected nested inline list error on line 13, got %v", err)
+	}
+
+	src = strings.TrimSuffix(src, "nested:\n  - - x\n")
+	got, err := parseYAML([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"files": []any{
+			".env",
+			map[string]any{"path": ".env.local", "optional": "true"},
+		},
+		"run": map[string]any{
+			"server": "go run ./cmd/api",
+			"quoted": `echo "hi" # not a comment`,
+			"single": "it's",
+			"plain":  "it's",
+		},
+		"empty": nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected\n%#v\ngot\n%#v", want, got)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	cases := map[string]string{
+		"a: 1\na: 2\n":         `line 2: duplicate key "a"`,
+		"a:\n    b: 1\n  c: 2": "line 3: unexpected indentation",
+		"a: |\n  text\n":       "line 1: block scalars are not supported",
+		"a: [1, 2]\n":          "line 1: flow collections are not supported",
+		"a: 1\n- b\n":          "line 2: expected a key, got a list item",
+		"just text\n":          `line 1: expected "key: value"`,
+	}
+	for src, want := range cases {
+		if _, err := parseYAML([]byte(src)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error %q, got %v", src, want, err)
+		}
+	}
+}
@@ -2,10 +2,7 @@ module github.com/akhmanov/denv-go
 
 go 1.25.6
 
-require (
-	github.com/joho/godotenv v1.5.1
-	github.com/urfave/cli/v2 v2.27.7
-)
+require github.com/urfave/cli/v2 v2.27.7
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.7 // indirect